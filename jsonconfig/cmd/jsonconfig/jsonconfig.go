@@ -0,0 +1,205 @@
+/*
+Copyright 2026 The go4 Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+     http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// The jsonconfig program explains a JSON config file as loaded by
+// go4.org/jsonconfig.
+//
+// It prints the fully evaluated config, annotating each value with the
+// file that defined it and the expression (such as _env or _fileobj),
+// if any, that produced it.
+//
+// With the -doc flag, it reads a documentation file describing the
+// keys a program accepts, prints each key's description next to its
+// value, and flags keys in the config that are not documented. The
+// documentation file is a JSON object mirroring the structure of the
+// config: each key maps either to a string describing it, or to an
+// object documenting the keys of a sub-object, whose own description
+// is its "_doc" key. A sub-object documented by a string alone has its
+// keys left unchecked. For example:
+//
+//	{
+//	  "listen": "address to listen on, such as \":8080\"",
+//	  "storage": {
+//	    "_doc": "where blobs are stored",
+//	    "bucket": "name of the GCS bucket holding blobs"
+//	  },
+//	  "handlers": "handler configurations, keyed by URL prefix"
+//	}
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"log"
+	"os"
+	"sort"
+	"strings"
+	"text/tabwriter"
+
+	"go4.org/jsonconfig"
+)
+
+var (
+	flagDoc     = flag.String("doc", "", "optional JSON file documenting the accepted keys; keys not in it are flagged as unknown")
+	includeDirs stringsFlag
+)
+
+func init() {
+	flag.Var(&includeDirs, "I", "directory to search for included config files; may be repeated")
+}
+
+type stringsFlag []string
+
+func (s *stringsFlag) String() string     { return strings.Join(*s, ",") }
+func (s *stringsFlag) Set(v string) error { *s = append(*s, v); return nil }
+
+func usage() {
+	fmt.Fprintf(os.Stderr, "usage: jsonconfig [-I dir]... [-doc docfile] <config.json>\n")
+	flag.PrintDefaults()
+	os.Exit(2)
+}
+
+func main() {
+	flag.Usage = usage
+	flag.Parse()
+	if flag.NArg() != 1 {
+		usage()
+	}
+	unknown, err := run(os.Stdout, flag.Arg(0), *flagDoc, includeDirs)
+	if err != nil {
+		log.Fatal(err)
+	}
+	if unknown > 0 {
+		fmt.Fprintf(os.Stderr, "%d unknown key(s)\n", unknown)
+		os.Exit(1)
+	}
+}
+
+// run explains configFile to w, using the documentation in docFile if
+// non-empty. It returns the number of keys not in the documentation.
+func run(w io.Writer, configFile, docFile string, includeDirs []string) (unknown int, err error) {
+	c := &jsonconfig.ConfigParser{IncludeDirs: includeDirs}
+	obj, err := c.ReadFile(configFile)
+	if err != nil {
+		return 0, err
+	}
+	var doc map[string]interface{}
+	if docFile != "" {
+		slurp, err := ioutil.ReadFile(docFile)
+		if err != nil {
+			return 0, err
+		}
+		if err := json.Unmarshal(slurp, &doc); err != nil {
+			return 0, fmt.Errorf("parsing doc file %s: %v", docFile, err)
+		}
+	}
+	e := &explainer{
+		c:  c,
+		tw: tabwriter.NewWriter(w, 0, 8, 2, ' ', 0),
+	}
+	e.explain(obj, doc, nil, doc != nil)
+	return e.unknown, e.tw.Flush()
+}
+
+// docKey is the key of a sub-object's own description in a
+// documentation file.
+const docKey = "_doc"
+
+type explainer struct {
+	c       *jsonconfig.ConfigParser
+	tw      *tabwriter.Writer
+	unknown int
+}
+
+// explain prints the keys of obj, which is found at path in the root
+// config, along with the documentation for them in doc. If checkUnknown,
+// keys not present in doc are flagged.
+func (e *explainer) explain(obj jsonconfig.Obj, doc map[string]interface{}, path []string, checkUnknown bool) {
+	indent := strings.Repeat("  ", len(path))
+	var known []string
+	for k := range doc {
+		if k != docKey {
+			known = append(known, k)
+		}
+	}
+	obj.NoteKnownKeys(known...)
+	unknown := make(map[string]bool)
+	if checkUnknown {
+		for _, k := range obj.UnknownKeys() {
+			unknown[k] = true
+		}
+	}
+
+	keys := make([]string, 0, len(obj)+len(doc))
+	for k, v := range obj {
+		if _, internal := v.(map[string]bool); internal && k == "_knownkeys" {
+			continue
+		}
+		if _, internal := v.([]error); internal && k == "_errors" {
+			continue
+		}
+		keys = append(keys, k)
+	}
+	for _, k := range known {
+		if _, ok := obj[k]; !ok {
+			keys = append(keys, k)
+		}
+	}
+	sort.Strings(keys)
+
+	for _, k := range keys {
+		thisPath := append(path[:len(path):len(path)], k)
+		subDoc, hasSubDoc := doc[k].(map[string]interface{})
+		desc, _ := doc[k].(string)
+		if hasSubDoc {
+			desc, _ = subDoc[docKey].(string)
+		}
+		if desc != "" {
+			fmt.Fprintf(e.tw, "%s// %s\t\n", indent, desc)
+		}
+		v, set := obj[k]
+		if !set {
+			fmt.Fprintf(e.tw, "%s%s: (not set)\t\n", indent, k)
+			continue
+		}
+		var note string
+		if o, ok := e.c.Origin(thisPath...); ok {
+			note = "# " + o.File
+			if o.Expr != "" {
+				note += " " + o.Expr
+			}
+		}
+		if unknown[k] {
+			note += "  UNKNOWN KEY"
+			e.unknown++
+		}
+		if sub, ok := v.(map[string]interface{}); ok {
+			fmt.Fprintf(e.tw, "%s%s:\t%s\n", indent, k, note)
+			// Don't flag every key below an unknown one, or below
+			// one documented only by a description.
+			e.explain(sub, subDoc, thisPath, checkUnknown && !unknown[k] && hasSubDoc)
+			continue
+		}
+		js, err := json.Marshal(v)
+		if err != nil {
+			js = []byte(fmt.Sprintf("%v", v))
+		}
+		fmt.Fprintf(e.tw, "%s%s: %s\t%s\n", indent, k, js, note)
+	}
+}
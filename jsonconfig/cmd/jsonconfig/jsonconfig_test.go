@@ -0,0 +1,73 @@
+/*
+Copyright 2026 The go4 Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+     http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package main
+
+import (
+	"bytes"
+	"os"
+	"strings"
+	"testing"
+)
+
+func TestExplain(t *testing.T) {
+	os.Unsetenv("JSONCONFIG_TEST_AUTH")
+	var buf bytes.Buffer
+	unknown, err := run(&buf, "testdata/config.json", "testdata/doc.json", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if unknown != 2 {
+		t.Errorf("unknown = %d; want 2", unknown)
+	}
+	var got []string
+	for _, line := range strings.Split(buf.String(), "\n") {
+		got = append(got, strings.TrimRight(line, " "))
+	}
+	want := []string{
+		`// authentication mode`,
+		`auth: "none"                               # testdata/config.json ["_env","${JSONCONFIG_TEST_AUTH}","none"]`,
+		`// public URL of the server`,
+		`baseURL: (not set)`,
+		`// handler names, keyed by URL prefix`,
+		`handlers:                                  # testdata/config.json`,
+		`  /sync/: "sync"                           # testdata/config.json`,
+		`  /ui/: "ui"                               # testdata/config.json`,
+		`// address to listen on`,
+		`listen: ":3179"                            # testdata/config.json`,
+		`// where blobs are stored`,
+		`storage:                                   # testdata/config.json ["_fileobj","testdata/storage.json"]`,
+		`  // name of the GCS bucket holding blobs`,
+		`  bucket: "blobs"                          # testdata/storage.json`,
+		`  region: "us-east1"                       # testdata/storage.json  UNKNOWN KEY`,
+		`verbose: true                              # testdata/config.json  UNKNOWN KEY`,
+		``,
+	}
+	if g, w := strings.Join(got, "\n"), strings.Join(want, "\n"); g != w {
+		t.Errorf("got:\n%s\nwant:\n%s", g, w)
+	}
+}
+
+func TestExplainNoDoc(t *testing.T) {
+	var buf bytes.Buffer
+	unknown, err := run(&buf, "testdata/storage.json", "", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if unknown != 0 || strings.Contains(buf.String(), "UNKNOWN") {
+		t.Errorf("flagged unknown keys without a doc file:\n%s", buf.String())
+	}
+}
@@ -64,6 +64,13 @@ type ConfigParser struct {
 	touchedFiles map[string]bool
 	includeStack stringVector
 
+	// evalFile and evalPath are the file and key path prefix of the
+	// object currently being evaluated. evalPath is non-empty while
+	// evaluating a file included with _fileobj.
+	evalFile string
+	evalPath []string
+	origins  map[string]Origin
+
 	// Open optionally specifies an opener function.
 	Open func(filename string) (File, error)
 
@@ -80,6 +87,17 @@ func (c *ConfigParser) open(filename string) (File, error) {
 	return c.Open(filename)
 }
 
+// An Origin describes where a config value was defined.
+type Origin struct {
+	// File is the name of the config file containing the value.
+	File string
+
+	// Expr is the JSON encoding of the expression (such as
+	// ["_env", "${HOME}"] or ["_fileobj", "other.json"]) that
+	// produced the value. It is empty for literal values.
+	Expr string
+}
+
 // Validates variable names for config _env expresssions
 var envPattern = regexp.MustCompile(`\$\{[A-Za-z0-9_]+\}`)
 
@@ -90,6 +108,7 @@ func (c *ConfigParser) ReadFile(path string) (Obj, error) {
 		return nil, errors.New("ReadFile of empty string but Open hook not defined")
 	}
 	c.touchedFiles = make(map[string]bool)
+	c.origins = make(map[string]Origin)
 	var err error
 	c.rootJSON, err = c.recursiveReadJSON(path)
 	return c.rootJSON, err
@@ -134,6 +153,8 @@ func (c *ConfigParser) recursiveReadJSON(configPath string) (decodedObject map[s
 			f.Name(), extra, err)
 	}
 
+	defer func(old string) { c.evalFile = old }(c.evalFile)
+	c.evalFile = f.Name()
 	if err = c.evaluateExpressions(decodedObject, nil, false); err != nil {
 		return nil, fmt.Errorf("error expanding JSON config expressions in %s:\n%v",
 			f.Name(), err)
@@ -204,7 +225,10 @@ func (c *ConfigParser) CheckTypes(m map[string]interface{}) error {
 // that are found, unless testOnly is true.
 func (c *ConfigParser) evaluateExpressions(m map[string]interface{}, seenKeys []string, testOnly bool) error {
 	for k, ei := range m {
-		thisPath := append(seenKeys, k)
+		thisPath := append(seenKeys[:len(seenKeys):len(seenKeys)], k)
+		if !testOnly {
+			c.setOrigin(thisPath, Origin{File: c.evalFile})
+		}
 		switch subval := ei.(type) {
 		case string, bool, float64, nil:
 			continue
@@ -212,7 +236,17 @@ func (c *ConfigParser) evaluateExpressions(m map[string]interface{}, seenKeys []
 			if len(subval) == 0 {
 				continue
 			}
+			if !testOnly && isExpr(subval) {
+				expr, err := json.Marshal(subval)
+				if err != nil {
+					return fmt.Errorf("%s: %v", strings.Join(thisPath, "."), err)
+				}
+				c.setOrigin(thisPath, Origin{File: c.evalFile, Expr: string(expr)})
+			}
+			oldPath := c.evalPath
+			c.evalPath = c.fullPath(thisPath)
 			evaled, err := c.evalValue(subval)
+			c.evalPath = oldPath
 			if err != nil {
 				return fmt.Errorf("%s: value error %v", strings.Join(thisPath, "."), err)
 			}
@@ -230,6 +264,55 @@ func (c *ConfigParser) evaluateExpressions(m map[string]interface{}, seenKeys []
 	return nil
 }
 
+// isExpr reports whether v is, or is a list containing, an expression
+// to be expanded by evalValue.
+func isExpr(v interface{}) bool {
+	sl, ok := v.([]interface{})
+	if !ok || len(sl) == 0 {
+		return false
+	}
+	if name, ok := sl[0].(string); ok {
+		if _, ok := namedExpander(name); ok {
+			return true
+		}
+	}
+	for _, v := range sl {
+		if isExpr(v) {
+			return true
+		}
+	}
+	return false
+}
+
+// fullPath returns the path from the root config object of the key
+// at path in the object currently being evaluated.
+func (c *ConfigParser) fullPath(path []string) []string {
+	full := make([]string, 0, len(c.evalPath)+len(path))
+	return append(append(full, c.evalPath...), path...)
+}
+
+func (c *ConfigParser) setOrigin(path []string, o Origin) {
+	if c.origins == nil {
+		c.origins = make(map[string]Origin)
+	}
+	c.origins[originKey(c.fullPath(path))] = o
+}
+
+func originKey(path []string) string {
+	return strings.Join(path, "\x00")
+}
+
+// Origin returns where the value at the given key path of the most
+// recently read config was defined. Each element of path is a key in
+// the object named by the elements before it, starting at the root
+// object returned by ReadFile. Keys within objects included with
+// _fileobj are reported relative to the including object, with File
+// set to the included file.
+func (c *ConfigParser) Origin(path ...string) (o Origin, ok bool) {
+	o, ok = c.origins[originKey(path)]
+	return
+}
+
 // Permit either:
 //    ["_env", "VARIABLE"] (required to be set)
 // or ["_env", "VARIABLE", "default_value"]
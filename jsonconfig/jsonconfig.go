@@ -235,6 +235,15 @@ func (jc Obj) requiredList(key string, required bool) []string {
 	return sl
 }
 
+// NoteKnownKeys marks keys as known, as if they had been looked up by
+// one of the RequiredT or OptionalT calls, so that they are not
+// reported by UnknownKeys or Validate.
+func (jc Obj) NoteKnownKeys(keys ...string) {
+	for _, k := range keys {
+		jc.noteKnownKey(k)
+	}
+}
+
 func (jc Obj) noteKnownKey(key string) {
 	_, ok := jc["_knownkeys"]
 	if !ok {
@@ -112,3 +112,54 @@ func TestListExpansion(t *testing.T) {
 		t.Errorf("str = %q, want %q", s, "bar")
 	}
 }
+
+func TestOrigin(t *testing.T) {
+	os.Setenv("TEST_BAR", "bar")
+	var c ConfigParser
+	c.IncludeDirs = []string{"testdata"}
+	if _, err := c.ReadFile("testdata/include1bis.json"); err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		path []string
+		want Origin
+	}{
+		{[]string{"two"}, Origin{File: "testdata/include1bis.json", Expr: `["_fileobj","include2.json"]`}},
+		{[]string{"two", "key"}, Origin{File: "testdata/include2.json"}},
+	}
+	for _, tt := range tests {
+		got, ok := c.Origin(tt.path...)
+		if !ok || got != tt.want {
+			t.Errorf("Origin(%q) = %+v, %v; want %+v", tt.path, got, ok, tt.want)
+		}
+	}
+	if _, ok := c.Origin("nope"); ok {
+		t.Errorf("Origin of missing key reported as found")
+	}
+
+	if _, err := c.ReadFile("testdata/listexpand.json"); err != nil {
+		t.Fatal(err)
+	}
+	if got, want := mustOrigin(t, &c, "list").Expr, `["foo",["_env","${TEST_BAR}"]]`; got != want {
+		t.Errorf("list Expr = %q; want %q", got, want)
+	}
+	if got, want := mustOrigin(t, &c, "str").Expr, `["_env","${TEST_BAR}"]`; got != want {
+		t.Errorf("str Expr = %q; want %q", got, want)
+	}
+}
+
+func mustOrigin(t *testing.T, c *ConfigParser, path ...string) Origin {
+	o, ok := c.Origin(path...)
+	if !ok {
+		t.Fatalf("no origin for %q", path)
+	}
+	return o
+}
+
+func TestNoteKnownKeys(t *testing.T) {
+	obj := Obj{"a": 1.0, "b": "x", "_comment": "ok"}
+	obj.NoteKnownKeys("a")
+	if got, want := obj.UnknownKeys(), []string{"b"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("UnknownKeys = %q; want %q", got, want)
+	}
+}
@@ -14,15 +14,26 @@ See the License for the specific language governing permissions and
 limitations under the License.
 */
 
-// Package bmff reads ISO BMFF boxes, as used by HEIF, etc.
+// Package bmff reads ISO BMFF boxes, as used by HEIF, MP4 and
+// QuickTime files.
 //
-// This is not so much as a generic BMFF reader as it is a BMFF reader
-// as needed by HEIF, though that may change in time. For now, only
-// boxes necessary for the go4.org/media/heif package have explicit
-// parsers.
+// The Reader reads the boxes of any BMFF file sequentially, including
+// 64-bit box sizes and "uuid" boxes; a Tree indexes them for random
+// access, reading only what's needed. Explicit parsers exist for the
+// boxes needed by the go4.org/media/heif and go4.org/media/mp4
+// packages; parsers for other box types may be added with
+// RegisterParser and RegisterUUIDParser.
+//
+// Input is untrusted: the number of boxes, their nesting, the entries
+// of their tables and the size of boxes read into memory are bounded
+// by Limits, and malformed boxes fail to parse with a *ParseError.
+//
+// Boxes are encoded with their Marshal method, either from the fields
+// of a parsed or constructed box, or as a copy of an unparsed one.
 //
 // This package makes no API compatibility promises; it exists
-// primarily for use by the go4.org/media/heif package.
+// primarily for use by the go4.org/media/heif and go4.org/media/mp4
+// packages.
 package bmff
 
 import (
@@ -34,28 +45,54 @@ import (
 	"io"
 	"io/ioutil"
 	"strings"
+	"sync"
 )
 
+// NewReader returns a Reader reading boxes from r.
+//
+// If r implements io.Seeker, boxes that are not read to completion,
+// such as large "mdat" boxes, are skipped by seeking rather than
+// reading.
 func NewReader(r io.Reader) *Reader {
 	br, ok := r.(*bufio.Reader)
 	if !ok {
 		br = bufio.NewReader(r)
 	}
-	return &Reader{br: bufReader{Reader: br}}
+	rd := &Reader{br: bufReader{Reader: br}, st: newParseState(Limits{})}
+	if rs, ok := r.(io.ReadSeeker); ok && !isBufio(r) {
+		rd.rs = rs
+	}
+	return rd
+}
+
+func isBufio(r io.Reader) bool {
+	_, ok := r.(*bufio.Reader)
+	return ok
 }
 
 type Reader struct {
 	br          bufReader
+	rs          io.ReadSeeker // or nil; the reader under br, if seekable
+	st          *parseState
+	depth       int  // of the boxes read
 	lastBox     Box  // or nil
 	noMoreBoxes bool // a box with size 0 (the final box) was seen
 }
 
+// SetLimits sets the limits enforced when reading boxes from r and
+// parsing them. It must be called before the first ReadBox.
+func (r *Reader) SetLimits(l Limits) {
+	r.st = newParseState(l)
+}
+
 type BoxType [4]byte
 
 // Common box types.
 var (
 	TypeFtyp = BoxType{'f', 't', 'y', 'p'}
 	TypeMeta = BoxType{'m', 'e', 't', 'a'}
+	TypeMoov = BoxType{'m', 'o', 'o', 'v'}
+	TypeUUID = BoxType{'u', 'u', 'i', 'd'}
 )
 
 func (t BoxType) String() string { return string(t[:]) }
@@ -81,12 +118,18 @@ type Box interface {
 	Parse() (Box, error)
 
 	// Body returns the inner bytes of the box, ignoring the header.
+	// For "uuid" boxes, the header includes the 16 byte extended type.
 	// The body may start with the 4 byte header of a "Full Box" if the
 	// box's type derives from a full box. Most users will use Parse
 	// instead.
 	// Body will return a new reader at the beginning of the box if the
 	// outer box has already been parsed.
 	Body() io.Reader
+
+	// Marshal returns the encoding of the box, including its header.
+	// Boxes that have been parsed are encoded from the fields of their
+	// parsed type; others are copied from their body.
+	Marshal() ([]byte, error)
 }
 
 // ErrUnknownBox is returned by Box.Parse for unrecognized box types.
@@ -102,28 +145,88 @@ func boxType(s string) BoxType {
 }
 
 var parsers = map[BoxType]parserFunc{
+	boxType("av1C"): parseAV1ConfigurationBox,
+	boxType("clap"): parseCleanAperture,
+	boxType("colr"): parseColorInformation,
 	boxType("dinf"): parseDataInformationBox,
 	boxType("dref"): parseDataReferenceBox,
 	boxType("ftyp"): parseFileTypeBox,
 	boxType("hdlr"): parseHandlerBox,
+	boxType("hvcC"): parseHEVCConfigurationBox,
 	boxType("iinf"): parseItemInfoBox,
 	boxType("infe"): parseItemInfoEntry,
 	boxType("iloc"): parseItemLocationBox,
+	boxType("imir"): parseImageMirror,
 	boxType("ipco"): parseItemPropertyContainerBox,
 	boxType("ipma"): parseItemPropertyAssociation,
+	boxType("idat"): parseItemDataBox,
 	boxType("iprp"): parseItemPropertiesBox,
+	boxType("iref"): parseItemReferenceBox,
 	boxType("irot"): parseImageRotation,
 	boxType("ispe"): parseImageSpatialExtentsProperty,
 	boxType("meta"): parseMetaBox,
 	boxType("pitm"): parsePrimaryItemBox,
+	boxType("pixi"): parsePixelInformation,
+}
+
+// A ParseFunc parses a box registered with RegisterParser or
+// RegisterUUIDParser. It reads the box's contents from b.Body() and
+// typically returns a value of a type embedding b.
+type ParseFunc func(b Box) (Box, error)
+
+var (
+	registerMu  sync.RWMutex
+	registered  = map[BoxType]ParseFunc{}
+	registeredU = map[[16]byte]ParseFunc{} // by uuid extended type
+)
+
+// RegisterParser registers fn as the parser of boxes of type typ.
+// It panics if typ already has a parser.
+func RegisterParser(typ BoxType, fn ParseFunc) {
+	registerMu.Lock()
+	defer registerMu.Unlock()
+	if _, dup := parsers[typ]; dup || registered[typ] != nil {
+		panic("bmff: RegisterParser called twice for box type " + typ.String())
+	}
+	registered[typ] = fn
+}
+
+// RegisterUUIDParser registers fn as the parser of "uuid" boxes with
+// the extended type userType. It panics if userType already has a
+// parser. "uuid" boxes without a registered parser parse as a
+// *UUIDBox.
+func RegisterUUIDParser(userType [16]byte, fn ParseFunc) {
+	registerMu.Lock()
+	defer registerMu.Unlock()
+	if registeredU[userType] != nil {
+		panic(fmt.Sprintf("bmff: RegisterUUIDParser called twice for uuid %x", userType))
+	}
+	registeredU[userType] = fn
+}
+
+func registeredParser(b *box) ParseFunc {
+	registerMu.RLock()
+	defer registerMu.RUnlock()
+	if b.boxType == TypeUUID {
+		if fn := registeredU[b.userType]; fn != nil {
+			return fn
+		}
+		return parseUUIDBox
+	}
+	return registered[b.boxType]
 }
 
 type box struct {
-	size    int64 // 0 means unknown, will read to end of file (box container)
-	boxType BoxType
-	body    io.Reader
-	parsed  Box    // if non-nil, the Parsed result
-	slurp   []byte // if non-nil, the contents slurped to memory
+	size     int64 // 0 means unknown, will read to end of file (box container)
+	boxType  BoxType
+	userType [16]byte // for "uuid" boxes
+	body     io.Reader
+	parsed   Box    // if non-nil, the Parsed result
+	slurp    []byte // if non-nil, the contents slurped to memory
+
+	st         *parseState // or nil for the defaults
+	depth      int         // nesting depth; 0 for top-level boxes
+	marshaling bool        // in Marshal, delegating to parsed
 }
 
 func (b *box) Size() int64   { return b.size }
@@ -140,12 +243,27 @@ func (b *box) Parse() (Box, error) {
 	if b.parsed != nil {
 		return b.parsed, nil
 	}
-	parser, ok := parsers[b.Type()]
-	if !ok {
+	st := b.state()
+	if err := st.checkSize(b.boxType, b.size); err != nil {
+		return nil, &ParseError{Type: b.boxType, Err: err}
+	}
+	var v Box
+	var err error
+	if parser, ok := parsers[b.Type()]; ok {
+		body := b.Body()
+		if b.size == 0 {
+			body = io.LimitReader(body, st.lim.MaxBoxSize)
+		}
+		v, err = parser(b, &bufReader{Reader: bufio.NewReader(body), st: st, depth: b.depth})
+	} else if fn := registeredParser(b); fn != nil {
+		v, err = fn(b)
+	} else {
 		return nil, ErrUnknownBox
 	}
-	v, err := parser(b, &bufReader{Reader: bufio.NewReader(b.Body())})
 	if err != nil {
+		if _, ok := err.(*ParseError); !ok {
+			err = &ParseError{Type: b.boxType, Err: err}
+		}
 		return nil, err
 	}
 	b.parsed = v
@@ -169,7 +287,7 @@ func (r *Reader) ReadBox() (Box, error) {
 		return nil, io.EOF
 	}
 	if r.lastBox != nil {
-		if _, err := io.Copy(ioutil.Discard, r.lastBox.Body()); err != nil {
+		if err := r.skip(r.lastBox.Body()); err != nil {
 			return nil, err
 		}
 	}
@@ -179,8 +297,13 @@ func (r *Reader) ReadBox() (Box, error) {
 	if err != nil {
 		return nil, err
 	}
+	if err := r.st.addBox(r.depth); err != nil {
+		return nil, err
+	}
 	box := &box{
-		size: int64(binary.BigEndian.Uint32(buf[:4])),
+		size:  int64(binary.BigEndian.Uint32(buf[:4])),
+		st:    r.st,
+		depth: r.depth,
 	}
 
 	_, err = io.ReadFull(r.br, box.boxType[:]) // 4 more bytes
@@ -211,7 +334,14 @@ func (r *Reader) ReadBox() (Box, error) {
 	default:
 		remain = box.size - 2*4
 	}
-	if remain < 0 {
+	if box.boxType == TypeUUID {
+		_, err = io.ReadFull(r.br, box.userType[:])
+		if err != nil {
+			return nil, err
+		}
+		remain -= 16
+	}
+	if remain < 0 && box.size > 0 {
 		return nil, fmt.Errorf("Box header for %q has size %d, suggesting %d (negative) bytes remain", box.boxType, box.size, remain)
 	}
 	if box.size > 0 {
@@ -223,19 +353,36 @@ func (r *Reader) ReadBox() (Box, error) {
 	return box, nil
 }
 
+// skip consumes the rest of body, which must be the body of the most
+// recently read box.
+func (r *Reader) skip(body io.Reader) error {
+	lr, ok := body.(*io.LimitedReader)
+	if !ok || r.rs == nil || lr.N <= int64(r.br.Buffered()) {
+		_, err := io.Copy(ioutil.Discard, body)
+		return err
+	}
+	// The underlying reader is ahead of us by the buffered bytes.
+	if _, err := r.rs.Seek(lr.N-int64(r.br.Buffered()), io.SeekCurrent); err != nil {
+		return err
+	}
+	lr.N = 0
+	r.br.Reset(r.rs)
+	return nil
+}
+
 // ReadAndParseBox wraps the ReadBox method, ensuring that the read box is of type typ
 // and parses successfully. It returns the parsed box.
 func (r *Reader) ReadAndParseBox(typ BoxType) (Box, error) {
 	box, err := r.ReadBox()
 	if err != nil {
-		return nil, fmt.Errorf("error reading %q box: %v", typ, err)
+		return nil, fmt.Errorf("error reading %q box: %w", typ, err)
 	}
 	if box.Type() != typ {
 		return nil, fmt.Errorf("error reading %q box: got box type %q instead", typ, box.Type())
 	}
 	pbox, err := box.Parse()
 	if err != nil {
-		return nil, fmt.Errorf("error parsing read %q box: %v", typ, err)
+		return nil, fmt.Errorf("error parsing read %q box: %w", typ, err)
 	}
 	return pbox, nil
 }
@@ -261,6 +408,20 @@ type FileTypeBox struct {
 	Compatible   []string // all 4 bytes
 }
 
+// HasBrand reports whether brand is the file's major brand or one of
+// its compatible brands.
+func (ft *FileTypeBox) HasBrand(brand string) bool {
+	if ft.MajorBrand == brand {
+		return true
+	}
+	for _, b := range ft.Compatible {
+		if b == brand {
+			return true
+		}
+	}
+	return false
+}
+
 func parseFileTypeBox(outer *box, br *bufReader) (Box, error) {
 	buf, err := br.Peek(8)
 	if err != nil {
@@ -285,12 +446,24 @@ func parseFileTypeBox(outer *box, br *bufReader) (Box, error) {
 	}
 }
 
+// MetaBox is a "meta" box.
+//
+// QuickTime files use a variant of the box without the FullBox
+// header; for those, Version and Flags are zero.
 type MetaBox struct {
 	FullBox
 	Children []Box
+
+	quickTime bool // the box lacks the FullBox header
 }
 
 func parseMetaBox(outer *box, br *bufReader) (Box, error) {
+	// In QuickTime files, the box's first child (its "hdlr") starts
+	// immediately.
+	if buf, err := br.Peek(8); err == nil && string(buf[4:8]) == "hdlr" {
+		mb := &MetaBox{FullBox: FullBox{box: outer}, quickTime: true}
+		return mb, br.parseAppendBoxes(&mb.Children)
+	}
 	fb, err := readFullBox(outer, br)
 	if err != nil {
 		return nil, err
@@ -299,11 +472,26 @@ func parseMetaBox(outer *box, br *bufReader) (Box, error) {
 	return mb, br.parseAppendBoxes(&mb.Children)
 }
 
+// UUIDBox is a "uuid" box with an extended type that has no parser
+// registered with RegisterUUIDParser. Its contents are available from
+// Body.
+type UUIDBox struct {
+	*box
+	UserType [16]byte
+}
+
+func parseUUIDBox(b Box) (Box, error) {
+	gen := b.(*box)
+	return &UUIDBox{box: gen, UserType: gen.userType}, nil
+}
+
 func (br *bufReader) parseAppendBoxes(dst *[]Box) error {
 	if br.err != nil {
 		return br.err
 	}
 	boxr := NewReader(br.Reader)
+	boxr.st = br.state()
+	boxr.depth = br.depth + 1
 	for {
 		inner, err := boxr.ReadBox()
 		if err == io.EOF {
@@ -325,11 +513,12 @@ func (br *bufReader) parseAppendBoxes(dst *[]Box) error {
 
 // ItemInfoEntry represents an "infe" box.
 //
-// TODO: currently only parses Version 2 boxes.
+// Versions 0 and 1 of the box describe items only by their content
+// type; their ItemType is reported as "mime".
 type ItemInfoEntry struct {
 	FullBox
 
-	ItemID          uint16
+	ItemID          uint32 // 16 bits before version 3
 	ProtectionIndex uint16
 	ItemType        string // always 4 bytes
 
@@ -349,20 +538,38 @@ func parseItemInfoEntry(outer *box, br *bufReader) (Box, error) {
 		return nil, err
 	}
 	ie := &ItemInfoEntry{FullBox: fb}
-	if fb.Version != 2 {
-		return nil, fmt.Errorf("TODO: found version %d infe box. Only 2 is supported now.", fb.Version)
+	if fb.Version > 3 {
+		return nil, fmt.Errorf("unsupported infe box version %d", fb.Version)
 	}
 
-	ie.ItemID, _ = br.readUint16()
+	if fb.Version < 3 {
+		ie.ItemID, _ = br.readUint16As32()
+	} else {
+		ie.ItemID, _ = br.readUint32()
+	}
 	ie.ProtectionIndex, _ = br.readUint16()
 	if !br.ok() {
 		return nil, br.err
 	}
+	if fb.Version < 2 {
+		// The version 1 extension, if any, follows; it's ignored.
+		ie.ItemType = "mime"
+		ie.Name, _ = br.readString()
+		ie.ContentType, _ = br.readString()
+		if br.anyRemain() {
+			ie.ContentEncoding, _ = br.readString()
+		}
+		if !br.ok() {
+			return nil, br.err
+		}
+		return ie, nil
+	}
 	buf, err := br.Peek(4)
 	if err != nil {
 		return nil, err
 	}
 	ie.ItemType = string(buf[:4])
+	br.Discard(4)
 	ie.Name, _ = br.readString()
 
 	switch ie.ItemType {
@@ -383,7 +590,7 @@ func parseItemInfoEntry(outer *box, br *bufReader) (Box, error) {
 // ItemInfoBox represents an "iinf" box.
 type ItemInfoBox struct {
 	FullBox
-	Count     uint16
+	Count     uint32 // 16 bits in version 0
 	ItemInfos []*ItemInfoEntry
 }
 
@@ -394,7 +601,11 @@ func parseItemInfoBox(outer *box, br *bufReader) (Box, error) {
 	}
 	ib := &ItemInfoBox{FullBox: fb}
 
-	ib.Count, _ = br.readUint16()
+	if fb.Version == 0 {
+		ib.Count, _ = br.readUint16As32()
+	} else {
+		ib.Count, _ = br.readUint32()
+	}
 
 	var itemInfos []Box
 	br.parseAppendBoxes(&itemInfos)
@@ -402,7 +613,7 @@ func parseItemInfoBox(outer *box, br *bufReader) (Box, error) {
 		for _, box := range itemInfos {
 			pb, err := box.Parse()
 			if err != nil {
-				return nil, fmt.Errorf("error parsing ItemInfoEntry in ItemInfoBox: %v", err)
+				return nil, fmt.Errorf("error parsing ItemInfoEntry in ItemInfoBox: %w", err)
 			}
 			if iie, ok := pb.(*ItemInfoEntry); ok {
 				ib.ItemInfos = append(ib.ItemInfos, iie)
@@ -418,7 +629,9 @@ func parseItemInfoBox(outer *box, br *bufReader) (Box, error) {
 // bufReader adds some HEIF/BMFF-specific methods around a *bufio.Reader.
 type bufReader struct {
 	*bufio.Reader
-	err error // sticky error
+	err   error       // sticky error
+	st    *parseState // or nil for the defaults
+	depth int         // of the box being parsed
 }
 
 // ok reports whether all previous reads have been error-free.
@@ -487,6 +700,13 @@ func (br *bufReader) readUint16() (uint16, error) {
 	return v, nil
 }
 
+// readUint16As32 reads a 16-bit value, for fields that are 32 bits
+// in other versions of their box.
+func (br *bufReader) readUint16As32() (uint32, error) {
+	v, err := br.readUint16()
+	return uint32(v), err
+}
+
 func (br *bufReader) readUint32() (uint32, error) {
 	if br.err != nil {
 		return 0, br.err
@@ -553,7 +773,7 @@ func parseItemPropertiesBox(outer *box, br *bufReader) (Box, error) {
 
 	cb, err := boxes[0].Parse()
 	if err != nil {
-		return nil, fmt.Errorf("failed to parse first box, %q: %v", boxes[0].Type(), err)
+		return nil, fmt.Errorf("failed to parse first box, %q: %w", boxes[0].Type(), err)
 	}
 
 	var ok bool
@@ -567,7 +787,7 @@ func parseItemPropertiesBox(outer *box, br *bufReader) (Box, error) {
 	for _, box := range boxes[1:] {
 		boxp, err := box.Parse()
 		if err != nil {
-			return nil, fmt.Errorf("failed to parse association box: %v", err)
+			return nil, fmt.Errorf("failed to parse association box: %w", err)
 		}
 		ipa, ok := boxp.(*ItemPropertyAssociation)
 		if !ok {
@@ -606,7 +826,8 @@ func parseItemPropertyAssociation(outer *box, br *bufReader) (Box, error) {
 	count, _ := br.readUint32()
 	ipa.EntryCount = count
 
-	for i := uint64(0); i < uint64(count) && br.ok(); i++ {
+	var total uint64 // associations
+	for i := uint64(0); i < uint64(count) && br.entries(i+total); i++ {
 		var itemID uint32
 		if fb.Version < 1 {
 			itemID16, _ := br.readUint16()
@@ -615,6 +836,7 @@ func parseItemPropertyAssociation(outer *box, br *bufReader) (Box, error) {
 			itemID, _ = br.readUint32()
 		}
 		assocCount, _ := br.readUint8()
+		total += uint64(assocCount)
 		ipai := ItemPropertyAssociationItem{
 			ItemID:            itemID,
 			AssociationsCount: int(assocCount),
@@ -672,12 +894,13 @@ func parseImageSpatialExtentsProperty(outer *box, br *bufReader) (Box, error) {
 
 type OffsetLength struct {
 	Offset, Length uint64
+	Index          uint64 // extent_index, if the box has an index size
 }
 
 // not a box
 type ItemLocationBoxEntry struct {
-	ItemID             uint16
-	ConstructionMethod uint8 // actually uint4
+	ItemID             uint32 // 16 bits before version 2
+	ConstructionMethod uint8  // actually uint4
 	DataReferenceIndex uint16
 	BaseOffset         uint64 // uint32 or uint64, depending on encoding
 	ExtentCount        uint16
@@ -690,7 +913,7 @@ type ItemLocationBox struct {
 
 	offsetSize, lengthSize, baseOffsetSize, indexSize uint8 // actually uint4
 
-	ItemCount uint16
+	ItemCount uint32 // 16 bits before version 2
 	Items     []ItemLocationBoxEntry
 }
 
@@ -702,34 +925,49 @@ func parseItemLocationBox(outer *box, br *bufReader) (Box, error) {
 	ilb := &ItemLocationBox{
 		FullBox: fb,
 	}
-	buf, err := br.Peek(4)
+	if fb.Version > 2 {
+		return nil, fmt.Errorf("unsupported iloc box version %d", fb.Version)
+	}
+	buf, err := br.Peek(2)
 	if err != nil {
 		return nil, err
 	}
 	ilb.offsetSize = buf[0] >> 4
 	ilb.lengthSize = buf[0] & 15
 	ilb.baseOffsetSize = buf[1] >> 4
-	if fb.Version > 0 { // version 1
+	if fb.Version > 0 { // version 1 or 2
 		ilb.indexSize = buf[1] & 15
 	}
+	br.Discard(2)
 
-	ilb.ItemCount = binary.BigEndian.Uint16(buf[2:4])
-	br.Discard(4)
+	readID := br.readUint16As32
+	if fb.Version < 2 {
+		ilb.ItemCount, _ = br.readUint16As32()
+	} else {
+		ilb.ItemCount, _ = br.readUint32()
+		readID = br.readUint32
+	}
 
-	for i := 0; br.ok() && i < int(ilb.ItemCount); i++ {
+	// Extents may be zero bytes long, so their number is only bounded
+	// by the limits.
+	var extents uint64
+	for i := uint64(0); br.entries(i+extents) && i < uint64(ilb.ItemCount); i++ {
 		var ent ItemLocationBoxEntry
-		ent.ItemID, _ = br.readUint16()
-		if fb.Version > 0 { // version 1
+		ent.ItemID, _ = readID()
+		if fb.Version > 0 { // version 1 or 2
 			cmeth, _ := br.readUint16()
 			ent.ConstructionMethod = byte(cmeth & 15)
 		}
 		ent.DataReferenceIndex, _ = br.readUint16()
-		if br.ok() && ilb.baseOffsetSize > 0 {
-			br.Discard(int(ilb.baseOffsetSize) / 8)
-		}
+		ent.BaseOffset, _ = br.readUintN(ilb.baseOffsetSize * 8)
 		ent.ExtentCount, _ = br.readUint16()
+		extents += uint64(ent.ExtentCount)
+		if !br.entries(i + extents) {
+			break
+		}
 		for j := 0; br.ok() && j < int(ent.ExtentCount); j++ {
 			var ol OffsetLength
+			ol.Index, _ = br.readUintN(ilb.indexSize * 8)
 			ol.Offset, _ = br.readUintN(ilb.offsetSize * 8)
 			ol.Length, _ = br.readUintN(ilb.lengthSize * 8)
 			if br.err != nil {
@@ -750,6 +988,12 @@ type HandlerBox struct {
 	FullBox
 	HandlerType string // always 4 bytes; usually "pict" for iOS Camera images
 	Name        string
+
+	// Preserved for Marshal:
+	preDefined uint32   // QuickTime's component type, such as "mhlr"
+	reserved   [12]byte // QuickTime's component manufacturer and flags
+	pascal     bool     // Name is a Pascal string, as in QuickTime
+	extra      []byte   // after the name
 }
 
 func parseHandlerBox(gen *box, br *bufReader) (Box, error) {
@@ -764,11 +1008,27 @@ func parseHandlerBox(gen *box, br *bufReader) (Box, error) {
 	if err != nil {
 		return nil, err
 	}
+	hb.preDefined = binary.BigEndian.Uint32(buf[:4])
 	hb.HandlerType = string(buf[4:8])
+	copy(hb.reserved[:], buf[8:20])
 	br.Discard(20)
 
-	hb.Name, _ = br.readString()
-	return hb, br.err
+	// The name is NUL-terminated in ISO files, but QuickTime files
+	// use a Pascal string, which may be empty.
+	name, err := ioutil.ReadAll(br)
+	if err != nil {
+		return nil, err
+	}
+	if len(name) > 0 && name[0] < ' ' && int(name[0]) < len(name) {
+		hb.pascal = true
+		hb.extra = name[1+int(name[0]):]
+		name = name[1 : 1+int(name[0])]
+	} else if i := bytes.IndexByte(name, 0); i >= 0 {
+		hb.extra = name[i+1:]
+		name = name[:i]
+	}
+	hb.Name = string(name)
+	return hb, nil
 }
 
 // a "dinf" box
@@ -802,7 +1062,7 @@ func parseDataReferenceBox(gen *box, br *bufReader) (Box, error) {
 // "pitm" box
 type PrimaryItemBox struct {
 	FullBox
-	ItemID uint16
+	ItemID uint32 // 16 bits in version 0
 }
 
 func parsePrimaryItemBox(gen *box, br *bufReader) (Box, error) {
@@ -811,7 +1071,11 @@ func parsePrimaryItemBox(gen *box, br *bufReader) (Box, error) {
 		return nil, err
 	}
 	pib := &PrimaryItemBox{FullBox: fb}
-	pib.ItemID, _ = br.readUint16()
+	if fb.Version == 0 {
+		pib.ItemID, _ = br.readUint16As32()
+	} else {
+		pib.ItemID, _ = br.readUint32()
+	}
 	if !br.ok() {
 		return nil, br.err
 	}
@@ -831,3 +1095,344 @@ func parseImageRotation(gen *box, br *bufReader) (Box, error) {
 	}
 	return &ImageRotation{box: gen, Angle: v & 3}, nil
 }
+
+// ImageMirror is a HEIF "imir" mirroring property.
+type ImageMirror struct {
+	*box
+	Axis uint8 // 0 means a vertical axis (left and right swap), 1 a horizontal one (top and bottom swap)
+}
+
+func parseImageMirror(gen *box, br *bufReader) (Box, error) {
+	v, err := br.readUint8()
+	if err != nil {
+		return nil, err
+	}
+	return &ImageMirror{box: gen, Axis: v & 1}, nil
+}
+
+// CleanAperture is a "clap" property, cropping an image to the given
+// width and height, centered at the given offsets from the image's
+// center. All values are fractions, as numerator and denominator.
+type CleanAperture struct {
+	*box
+	WidthN, WidthD             uint32
+	HeightN, HeightD           uint32
+	HorizOffsetN, HorizOffsetD int32 // denominator is unsigned in the file
+	VertOffsetN, VertOffsetD   int32 // denominator is unsigned in the file
+}
+
+func parseCleanAperture(gen *box, br *bufReader) (Box, error) {
+	var v [8]uint32
+	for i := range v {
+		v[i], _ = br.readUint32()
+	}
+	if !br.ok() {
+		return nil, br.err
+	}
+	if v[5] > 1<<31-1 || v[7] > 1<<31-1 {
+		return nil, errors.New("clean aperture offset denominator out of range")
+	}
+	return &CleanAperture{
+		box:          gen,
+		WidthN:       v[0],
+		WidthD:       v[1],
+		HeightN:      v[2],
+		HeightD:      v[3],
+		HorizOffsetN: int32(v[4]),
+		HorizOffsetD: int32(v[5]),
+		VertOffsetN:  int32(v[6]),
+		VertOffsetD:  int32(v[7]),
+	}, nil
+}
+
+// PixelInformation is a "pixi" property, listing the number of bits
+// per channel of an image.
+type PixelInformation struct {
+	FullBox
+	BitsPerChannel []uint8
+}
+
+func parsePixelInformation(gen *box, br *bufReader) (Box, error) {
+	fb, err := readFullBox(gen, br)
+	if err != nil {
+		return nil, err
+	}
+	pi := &PixelInformation{FullBox: fb}
+	n, _ := br.readUint8()
+	for i := 0; br.ok() && i < int(n); i++ {
+		if v, err := br.readUint8(); err == nil {
+			pi.BitsPerChannel = append(pi.BitsPerChannel, v)
+		}
+	}
+	if !br.ok() {
+		return nil, br.err
+	}
+	return pi, nil
+}
+
+// ColorInformation is a "colr" property. Depending on ColorType, it
+// holds either color parameters ("nclx", or QuickTime's "nclc") or an
+// ICC profile ("prof" or "rICC").
+type ColorInformation struct {
+	*box
+	ColorType string // always 4 bytes
+
+	// If ColorType is "nclx" or "nclc", the code points of ISO/IEC 23091-2:
+	ColorPrimaries          uint16
+	TransferCharacteristics uint16
+	MatrixCoefficients      uint16
+	FullRange               bool // only in "nclx"
+
+	// If ColorType is "prof" or "rICC":
+	ICCProfile []byte
+}
+
+func parseColorInformation(gen *box, br *bufReader) (Box, error) {
+	buf, err := br.Peek(4)
+	if err != nil {
+		return nil, err
+	}
+	ci := &ColorInformation{box: gen, ColorType: string(buf[:4])}
+	br.Discard(4)
+	switch ci.ColorType {
+	case "nclx", "nclc":
+		ci.ColorPrimaries, _ = br.readUint16()
+		ci.TransferCharacteristics, _ = br.readUint16()
+		ci.MatrixCoefficients, _ = br.readUint16()
+		if ci.ColorType == "nclx" {
+			v, _ := br.readUint8()
+			ci.FullRange = v&0x80 != 0
+		}
+	case "prof", "rICC":
+		ci.ICCProfile, err = ioutil.ReadAll(br)
+		if err != nil {
+			return nil, err
+		}
+	}
+	if !br.ok() {
+		return nil, br.err
+	}
+	return ci, nil
+}
+
+// HEVCConfigurationBox is an "hvcC" property: the
+// HEVCDecoderConfigurationRecord of an HEVC-coded image item, as
+// defined by ISO/IEC 14496-15.
+type HEVCConfigurationBox struct {
+	*box
+	ConfigurationVersion      uint8
+	ProfileSpace              uint8 // 2 bits
+	TierFlag                  bool
+	ProfileIDC                uint8 // 5 bits
+	ProfileCompatibilityFlags uint32
+	ConstraintIndicatorFlags  uint64 // 48 bits
+	LevelIDC                  uint8
+	MinSpatialSegmentation    uint16 // 12 bits
+	ParallelismType           uint8  // 2 bits
+	ChromaFormat              uint8  // 0 for monochrome, 1 for 4:2:0, etc
+	BitDepthLuma              uint8
+	BitDepthChroma            uint8
+	AvgFrameRate              uint16 // in frames per 256 seconds; 0 if unspecified
+	ConstantFrameRate         uint8  // 2 bits
+	NumTemporalLayers         uint8  // 3 bits
+	TemporalIDNested          bool
+	LengthSizeMinusOne        uint8 // size of the NAL unit length prefixes, minus one
+	NALArrays                 []HEVCNALArray
+}
+
+// HEVCNALArray is an array of NAL units, usually parameter sets, in
+// an HEVCConfigurationBox.
+type HEVCNALArray struct {
+	ArrayCompleteness bool
+	NALUnitType       uint8
+	NALUnits          [][]byte
+}
+
+func parseHEVCConfigurationBox(gen *box, br *bufReader) (Box, error) {
+	buf, err := br.Peek(23)
+	if err != nil {
+		return nil, err
+	}
+	hb := &HEVCConfigurationBox{
+		box:                       gen,
+		ConfigurationVersion:      buf[0],
+		ProfileSpace:              buf[1] >> 6,
+		TierFlag:                  buf[1]&0x20 != 0,
+		ProfileIDC:                buf[1] & 0x1f,
+		ProfileCompatibilityFlags: binary.BigEndian.Uint32(buf[2:6]),
+		ConstraintIndicatorFlags:  binary.BigEndian.Uint64(buf[4:12]) & (1<<48 - 1),
+		LevelIDC:                  buf[12],
+		MinSpatialSegmentation:    binary.BigEndian.Uint16(buf[13:15]) & 0xfff,
+		ParallelismType:           buf[15] & 3,
+		ChromaFormat:              buf[16] & 3,
+		BitDepthLuma:              buf[17]&7 + 8,
+		BitDepthChroma:            buf[18]&7 + 8,
+		AvgFrameRate:              binary.BigEndian.Uint16(buf[19:21]),
+		ConstantFrameRate:         buf[21] >> 6,
+		NumTemporalLayers:         buf[21] >> 3 & 7,
+		TemporalIDNested:          buf[21]&4 != 0,
+		LengthSizeMinusOne:        buf[21] & 3,
+	}
+	numArrays := int(buf[22])
+	br.Discard(23)
+	for i := 0; br.ok() && i < numArrays; i++ {
+		var arr HEVCNALArray
+		v, _ := br.readUint8()
+		arr.ArrayCompleteness = v&0x80 != 0
+		arr.NALUnitType = v & 0x3f
+		n, _ := br.readUint16()
+		for j := 0; br.ok() && j < int(n); j++ {
+			size, _ := br.readUint16()
+			if !br.ok() {
+				break
+			}
+			// Don't trust size before reading the data.
+			nal, err := ioutil.ReadAll(io.LimitReader(br, int64(size)))
+			if err == nil && len(nal) < int(size) {
+				err = io.ErrUnexpectedEOF
+			}
+			if err != nil {
+				br.err = err
+				break
+			}
+			arr.NALUnits = append(arr.NALUnits, nal)
+		}
+		hb.NALArrays = append(hb.NALArrays, arr)
+	}
+	if !br.ok() {
+		return nil, br.err
+	}
+	return hb, nil
+}
+
+// ItemReferenceBox is an "iref" box, listing typed references between
+// items, such as the "dimg" references from a derived image item to
+// its inputs, or the "thmb" references from thumbnails to the items
+// they depict.
+type ItemReferenceBox struct {
+	FullBox
+	References []ItemReference
+}
+
+// ItemReference is one SingleItemTypeReferenceBox of an "iref" box:
+// references of type Type from item FromItemID to the items ToItemIDs,
+// in order.
+// not a box
+type ItemReference struct {
+	Type       BoxType
+	FromItemID uint32
+	ToItemIDs  []uint32
+}
+
+func parseItemReferenceBox(outer *box, br *bufReader) (Box, error) {
+	fb, err := readFullBox(outer, br)
+	if err != nil {
+		return nil, err
+	}
+	irb := &ItemReferenceBox{FullBox: fb}
+
+	var children []Box
+	if err := br.parseAppendBoxes(&children); err != nil {
+		return nil, err
+	}
+	for _, child := range children {
+		cbr := &bufReader{Reader: bufio.NewReader(child.Body())}
+		readID := cbr.readUint16As32
+		if fb.Version > 0 {
+			readID = cbr.readUint32
+		}
+		ref := ItemReference{Type: child.Type()}
+		ref.FromItemID, _ = readID()
+		count, _ := cbr.readUint16()
+		for i := 0; cbr.ok() && i < int(count); i++ {
+			if id, err := readID(); err == nil {
+				ref.ToItemIDs = append(ref.ToItemIDs, id)
+			}
+		}
+		if !cbr.ok() {
+			return nil, fmt.Errorf("error parsing %q item reference: %w", child.Type(), cbr.err)
+		}
+		irb.References = append(irb.References, ref)
+	}
+	return irb, nil
+}
+
+// ItemDataBox is an "idat" box, holding the data of items stored in
+// the meta box itself (construction method 1).
+type ItemDataBox struct {
+	*box
+	Data []byte
+}
+
+func parseItemDataBox(gen *box, br *bufReader) (Box, error) {
+	data, err := ioutil.ReadAll(br)
+	if err != nil {
+		return nil, err
+	}
+	return &ItemDataBox{box: gen, Data: data}, nil
+}
+
+// AV1ConfigurationBox is an "av1C" property: the
+// AV1CodecConfigurationRecord of an AV1-coded image item, as defined
+// by the AV1 Codec ISO Media File Format Binding.
+type AV1ConfigurationBox struct {
+	*box
+	Version              uint8 // 7 bits
+	SeqProfile           uint8 // 3 bits
+	SeqLevelIdx0         uint8 // 5 bits
+	SeqTier0             uint8 // 1 bit
+	HighBitDepth         bool
+	TwelveBit            bool
+	Monochrome           bool
+	ChromaSubsamplingX   bool
+	ChromaSubsamplingY   bool
+	ChromaSamplePosition uint8 // 2 bits
+
+	// InitialPresentationDelayMinusOne is only meaningful if
+	// InitialPresentationDelayPresent.
+	InitialPresentationDelayPresent  bool
+	InitialPresentationDelayMinusOne uint8 // 4 bits
+
+	ConfigOBUs []byte // usually a sequence header OBU
+}
+
+// BitDepth returns the number of bits per sample: 8, 10 or 12.
+func (c *AV1ConfigurationBox) BitDepth() int {
+	switch {
+	case c.TwelveBit:
+		return 12
+	case c.HighBitDepth:
+		return 10
+	}
+	return 8
+}
+
+func parseAV1ConfigurationBox(gen *box, br *bufReader) (Box, error) {
+	buf, err := br.Peek(4)
+	if err != nil {
+		return nil, err
+	}
+	if buf[0]&0x80 == 0 {
+		return nil, errors.New("av1C box lacks marker bit")
+	}
+	ab := &AV1ConfigurationBox{
+		box:                              gen,
+		Version:                          buf[0] & 0x7f,
+		SeqProfile:                       buf[1] >> 5,
+		SeqLevelIdx0:                     buf[1] & 0x1f,
+		SeqTier0:                         buf[2] >> 7,
+		HighBitDepth:                     buf[2]&0x40 != 0,
+		TwelveBit:                        buf[2]&0x20 != 0,
+		Monochrome:                       buf[2]&0x10 != 0,
+		ChromaSubsamplingX:               buf[2]&0x08 != 0,
+		ChromaSubsamplingY:               buf[2]&0x04 != 0,
+		ChromaSamplePosition:             buf[2] & 3,
+		InitialPresentationDelayPresent:  buf[3]&0x10 != 0,
+		InitialPresentationDelayMinusOne: buf[3] & 0x0f,
+	}
+	br.Discard(4)
+	if ab.ConfigOBUs, err = ioutil.ReadAll(br); err != nil {
+		return nil, err
+	}
+	return ab, nil
+}
@@ -0,0 +1,196 @@
+/*
+Copyright 2026 The go4 Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+     http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package bmff
+
+import (
+	"bytes"
+	"encoding/binary"
+	"io"
+	"io/ioutil"
+	"testing"
+)
+
+// testBox returns a box of type typ with the given body.
+func testBox(typ string, body ...[]byte) []byte {
+	b := bytes.Join(body, nil)
+	hdr := make([]byte, 8)
+	binary.BigEndian.PutUint32(hdr, uint32(8+len(b)))
+	copy(hdr[4:], typ)
+	return append(hdr, b...)
+}
+
+// readBoxes reads all the boxes of r, returning their types and
+// bodies.
+func readBoxes(t *testing.T, r io.Reader) (types []string, bodies [][]byte) {
+	t.Helper()
+	br := NewReader(r)
+	for {
+		b, err := br.ReadBox()
+		if err == io.EOF {
+			return
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+		body, err := ioutil.ReadAll(b.Body())
+		if err != nil {
+			t.Fatal(err)
+		}
+		types = append(types, b.Type().String())
+		bodies = append(bodies, body)
+	}
+}
+
+func TestLargeSizeAndUUID(t *testing.T) {
+	var userType [16]byte
+	copy(userType[:], "0123456789abcdef")
+	large := []byte{0, 0, 0, 1, 'm', 'd', 'a', 't', 0, 0, 0, 0, 0, 0, 0, 19, 'd', 'a', 't'}
+	data := bytes.Join([][]byte{
+		testBox("free", []byte("x")),
+		large,
+		testBox("uuid", userType[:], []byte("body")),
+	}, nil)
+	types, bodies := readBoxes(t, bytes.NewReader(data))
+	if len(types) != 3 || types[1] != "mdat" || string(bodies[1]) != "dat" || types[2] != "uuid" || string(bodies[2]) != "body" {
+		t.Fatalf("got boxes %q with bodies %q", types, bodies)
+	}
+
+	br := NewReader(bytes.NewReader(data))
+	for i := 0; i < 3; i++ {
+		b, err := br.ReadBox()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if i < 2 {
+			continue
+		}
+		pb, err := b.Parse()
+		if err != nil {
+			t.Fatal(err)
+		}
+		ub, ok := pb.(*UUIDBox)
+		if !ok || ub.UserType != userType {
+			t.Fatalf("parsed uuid box = %#v", pb)
+		}
+	}
+}
+
+type testRegisteredBox struct {
+	Box
+	Data string
+}
+
+func TestRegisterParser(t *testing.T) {
+	typ := BoxType{'t', 'e', 's', 't'}
+	var userType [16]byte
+	copy(userType[:], "registered uuid!")
+	parse := func(b Box) (Box, error) {
+		body, err := ioutil.ReadAll(b.Body())
+		if err != nil {
+			return nil, err
+		}
+		return &testRegisteredBox{Box: b, Data: string(body)}, nil
+	}
+	RegisterParser(typ, parse)
+	RegisterUUIDParser(userType, parse)
+
+	data := append(testBox("test", []byte("one")), testBox("uuid", userType[:], []byte("two"))...)
+	br := NewReader(bytes.NewReader(data))
+	for _, want := range []string{"one", "two"} {
+		b, err := br.ReadBox()
+		if err != nil {
+			t.Fatal(err)
+		}
+		pb, err := b.Parse()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if rb, ok := pb.(*testRegisteredBox); !ok || rb.Data != want {
+			t.Errorf("parsed box = %#v; want Data %q", pb, want)
+		}
+	}
+
+	defer func() {
+		if recover() == nil {
+			t.Error("RegisterParser of a built-in box type didn't panic")
+		}
+	}()
+	RegisterParser(TypeMeta, parse)
+}
+
+func TestQuickTimeMeta(t *testing.T) {
+	hdlr := testBox("hdlr", make([]byte, 4), []byte("mhlrmdta"), make([]byte, 12), []byte("\x05Apple"))
+	for _, meta := range [][]byte{
+		testBox("meta", hdlr),                  // QuickTime
+		testBox("meta", make([]byte, 4), hdlr), // ISO
+	} {
+		b, err := NewReader(bytes.NewReader(meta)).ReadAndParseBox(TypeMeta)
+		if err != nil {
+			t.Fatal(err)
+		}
+		mb := b.(*MetaBox)
+		if len(mb.Children) != 1 {
+			t.Fatalf("meta box has %d children; want 1", len(mb.Children))
+		}
+		pb, err := mb.Children[0].Parse()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if hb := pb.(*HandlerBox); hb.HandlerType != "mdta" || hb.Name != "Apple" {
+			t.Errorf("handler = %q, %q; want mdta, Apple", hb.HandlerType, hb.Name)
+		}
+	}
+}
+
+// countingReader is an io.ReadSeeker counting the bytes read.
+type countingReader struct {
+	*bytes.Reader
+	n int
+}
+
+func (r *countingReader) Read(p []byte) (int, error) {
+	n, err := r.Reader.Read(p)
+	r.n += n
+	return n, err
+}
+
+func TestSkipBySeeking(t *testing.T) {
+	data := bytes.Join([][]byte{
+		testBox("ftyp", []byte("isom")),
+		testBox("mdat", make([]byte, 1<<20)),
+		testBox("moov", []byte("last")),
+	}, nil)
+	r := &countingReader{Reader: bytes.NewReader(data)}
+	br := NewReader(r)
+	var last Box
+	for {
+		b, err := br.ReadBox()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+		last = b
+	}
+	if last == nil || last.Type() != TypeMoov {
+		t.Fatalf("last box = %v; want moov", last)
+	}
+	if r.n > 64<<10 {
+		t.Errorf("read %d bytes; want the mdat box skipped", r.n)
+	}
+}
@@ -0,0 +1,97 @@
+//go:build go1.18
+// +build go1.18
+
+/*
+Copyright 2026 The go4 Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+     http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package bmff
+
+import (
+	"bytes"
+	"io"
+	"io/ioutil"
+	"path/filepath"
+	"testing"
+)
+
+// fuzzLimits are tighter than DefaultLimits so that inputs within
+// the limits are still quick to parse.
+var fuzzLimits = Limits{MaxBoxes: 1 << 12, MaxEntries: 1 << 12, MaxBoxSize: 1 << 20}
+
+// addSeeds adds the test files of the heif and mp4 packages to the
+// seed corpus of f.
+func addSeeds(f *testing.F) {
+	for _, pattern := range []string{"../testdata/*", "../../mp4/testdata/*"} {
+		files, _ := filepath.Glob(pattern)
+		for _, name := range files {
+			data, err := ioutil.ReadFile(name)
+			if err == nil {
+				f.Add(data)
+			}
+		}
+	}
+}
+
+func FuzzReader(f *testing.F) {
+	addSeeds(f)
+	f.Fuzz(func(t *testing.T, data []byte) {
+		br := NewReader(bytes.NewReader(data))
+		br.SetLimits(fuzzLimits)
+		for {
+			b, err := br.ReadBox()
+			if err != nil {
+				return
+			}
+			fuzzParse(b)
+		}
+	})
+}
+
+// fuzzParse parses and marshals b and its descendants.
+func fuzzParse(b Box) {
+	pb, err := b.Parse()
+	if err != nil {
+		return
+	}
+	pb.Marshal()
+	for _, c := range children(pb) {
+		fuzzParse(c)
+	}
+	if ip, ok := pb.(*ItemPropertiesBox); ok {
+		fuzzParse(ip.PropertyContainer)
+	}
+}
+
+func FuzzTree(f *testing.F) {
+	addSeeds(f)
+	f.Fuzz(func(t *testing.T, data []byte) {
+		tree := NewTree(bytes.NewReader(data), int64(len(data)))
+		tree.SetLimits(fuzzLimits)
+		nodes, _ := tree.Boxes()
+		var walk func(ns []*Node)
+		walk = func(ns []*Node) {
+			for _, n := range ns {
+				if !n.Type.EqualString("mdat") {
+					n.Parse()
+				}
+				io.Copy(ioutil.Discard, n.Body())
+				cs, _ := n.Children()
+				walk(cs)
+			}
+		}
+		walk(nodes)
+	})
+}
@@ -0,0 +1,139 @@
+/*
+Copyright 2026 The go4 Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+     http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package bmff
+
+import (
+	"errors"
+	"fmt"
+)
+
+// Limits bounds the resources used to read and parse boxes, so
+// crafted files can't cause huge allocations or deep recursion. Zero
+// fields mean the corresponding field of DefaultLimits.
+type Limits struct {
+	// MaxBoxes is the maximum number of boxes read, including the
+	// children of parsed boxes.
+	MaxBoxes int
+
+	// MaxEntries is the maximum number of entries in one box's
+	// table, such as the extents of an "iloc" box or the sample
+	// sizes of an "stsz" box.
+	MaxEntries int
+
+	// MaxDepth is the maximum nesting depth of boxes. Top-level
+	// boxes have depth 0.
+	MaxDepth int
+
+	// MaxBoxSize is the maximum size of a box read into memory to be
+	// parsed.
+	MaxBoxSize int64
+}
+
+// DefaultLimits are the limits used unless others are set with
+// Reader.SetLimits or Tree.SetLimits.
+var DefaultLimits = Limits{
+	MaxBoxes:   1 << 20,
+	MaxEntries: 1 << 20,
+	MaxDepth:   32,
+	MaxBoxSize: 256 << 20,
+}
+
+// ErrLimit is wrapped by the errors returned for input exceeding the
+// Limits in effect.
+var ErrLimit = errors.New("bmff: resource limit exceeded")
+
+// A ParseError is returned by Box.Parse for boxes that are malformed
+// or exceed the Limits in effect.
+type ParseError struct {
+	Type BoxType // of the box being parsed
+	Err  error
+}
+
+func (e *ParseError) Error() string {
+	return fmt.Sprintf("bmff: parsing %q box: %v", e.Type, e.Err)
+}
+
+func (e *ParseError) Unwrap() error { return e.Err }
+
+// parseState is the state shared by the boxes read from a Reader or
+// Tree, and their descendants.
+type parseState struct {
+	lim   Limits
+	boxes int // number read so far
+}
+
+func newParseState(l Limits) *parseState {
+	d := DefaultLimits
+	if l.MaxBoxes <= 0 {
+		l.MaxBoxes = d.MaxBoxes
+	}
+	if l.MaxEntries <= 0 {
+		l.MaxEntries = d.MaxEntries
+	}
+	if l.MaxDepth <= 0 {
+		l.MaxDepth = d.MaxDepth
+	}
+	if l.MaxBoxSize <= 0 {
+		l.MaxBoxSize = d.MaxBoxSize
+	}
+	return &parseState{lim: l}
+}
+
+// addBox records that another box, at the given depth, was read.
+func (st *parseState) addBox(depth int) error {
+	if depth > st.lim.MaxDepth {
+		return fmt.Errorf("boxes nested more than %d deep: %w", st.lim.MaxDepth, ErrLimit)
+	}
+	st.boxes++
+	if st.boxes > st.lim.MaxBoxes {
+		return fmt.Errorf("more than %d boxes: %w", st.lim.MaxBoxes, ErrLimit)
+	}
+	return nil
+}
+
+// checkSize returns an error if a box of the given size may not be
+// read into memory.
+func (st *parseState) checkSize(typ BoxType, size int64) error {
+	if size > st.lim.MaxBoxSize {
+		return fmt.Errorf("%q box of %d bytes exceeds the %d byte limit: %w", typ, size, st.lim.MaxBoxSize, ErrLimit)
+	}
+	return nil
+}
+
+// entries records that the table being parsed has n entries, failing
+// if that's too many. It reports whether all reads so far have been
+// error-free.
+func (br *bufReader) entries(n uint64) bool {
+	if br.err == nil && n > uint64(br.state().lim.MaxEntries) {
+		br.err = fmt.Errorf("more than %d entries: %w", br.state().lim.MaxEntries, ErrLimit)
+	}
+	return br.err == nil
+}
+
+func (br *bufReader) state() *parseState {
+	if br.st == nil {
+		br.st = newParseState(Limits{})
+	}
+	return br.st
+}
+
+func (b *box) state() *parseState {
+	if b.st == nil {
+		b.st = newParseState(Limits{})
+	}
+	return b.st
+}
@@ -0,0 +1,129 @@
+/*
+Copyright 2026 The go4 Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+     http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package bmff
+
+import (
+	"bytes"
+	"errors"
+	"testing"
+)
+
+// zeroExtentsIloc returns an "iloc" box with one item of n zero-byte
+// extents.
+func zeroExtentsIloc(n uint16) []byte {
+	return testBox("iloc",
+		[]byte{0, 0, 0, 0}, // version and flags
+		[]byte{0, 0},       // no offsets or lengths
+		[]byte{0, 1},       // item count
+		[]byte{0, 1, 0, 0}, // item ID and data reference index
+		[]byte{byte(n >> 8), byte(n)},
+	)
+}
+
+func TestLimitEntries(t *testing.T) {
+	data := zeroExtentsIloc(1000)
+
+	br := NewReader(bytes.NewReader(data))
+	b, err := br.ReadBox()
+	if err != nil {
+		t.Fatal(err)
+	}
+	pb, err := b.Parse()
+	if err != nil {
+		t.Fatalf("with default limits: %v", err)
+	}
+	if got := len(pb.(*ItemLocationBox).Items[0].Extents); got != 1000 {
+		t.Errorf("got %d extents; want 1000", got)
+	}
+
+	br = NewReader(bytes.NewReader(data))
+	br.SetLimits(Limits{MaxEntries: 100})
+	if b, err = br.ReadBox(); err != nil {
+		t.Fatal(err)
+	}
+	_, err = b.Parse()
+	if !errors.Is(err, ErrLimit) {
+		t.Fatalf("Parse error = %v; want ErrLimit", err)
+	}
+	var pe *ParseError
+	if !errors.As(err, &pe) || pe.Type != (BoxType{'i', 'l', 'o', 'c'}) {
+		t.Errorf("Parse error = %#v; want a ParseError for iloc", err)
+	}
+}
+
+func TestLimitDepth(t *testing.T) {
+	data := testBox("free")
+	for i := 0; i < 5; i++ {
+		data = testBox("moov", data)
+	}
+	parseDeep := func(l Limits) error {
+		br := NewReader(bytes.NewReader(data))
+		br.SetLimits(l)
+		b, err := br.ReadBox()
+		if err != nil {
+			return err
+		}
+		for {
+			pb, err := b.Parse()
+			if err == ErrUnknownBox {
+				return nil // the innermost "free" box
+			}
+			if err != nil {
+				return err
+			}
+			c, ok := pb.(*ContainerBox)
+			if !ok {
+				return nil
+			}
+			b = c.Children[0]
+		}
+	}
+	if err := parseDeep(Limits{}); err != nil {
+		t.Fatalf("with default limits: %v", err)
+	}
+	if err := parseDeep(Limits{MaxDepth: 3}); !errors.Is(err, ErrLimit) {
+		t.Fatalf("with MaxDepth 3, error = %v; want ErrLimit", err)
+	}
+}
+
+func TestLimitBoxes(t *testing.T) {
+	data := bytes.Repeat(testBox("free"), 20)
+	tree := NewTree(bytes.NewReader(data), int64(len(data)))
+	tree.SetLimits(Limits{MaxBoxes: 10})
+	nodes, err := tree.Boxes()
+	if !errors.Is(err, ErrLimit) {
+		t.Fatalf("Boxes error = %v; want ErrLimit", err)
+	}
+	if len(nodes) != 10 {
+		t.Errorf("got %d boxes; want 10", len(nodes))
+	}
+}
+
+func TestLimitBoxSize(t *testing.T) {
+	data := testBox("ftyp", []byte("heic"), make([]byte, 100))
+	tree := NewTree(bytes.NewReader(data), int64(len(data)))
+	tree.SetLimits(Limits{MaxBoxSize: 64})
+	nodes, err := tree.Boxes()
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = nodes[0].Parse()
+	var pe *ParseError
+	if !errors.As(err, &pe) || !errors.Is(err, ErrLimit) {
+		t.Fatalf("Parse error = %v; want a ParseError wrapping ErrLimit", err)
+	}
+}
@@ -0,0 +1,841 @@
+/*
+Copyright 2026 The go4 Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+     http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package bmff
+
+// This file has the Marshal methods of the box types, encoding them
+// back to their binary form.
+//
+// Count fields, such as ItemInfoBox.Count, are ignored when
+// marshaling; the counts are those of the slices they describe.
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"math"
+)
+
+// NewBox returns a box of type typ with the given body, which must
+// not include the box header. It's useful for marshaling boxes that
+// have no parsed type.
+func NewBox(typ BoxType, body []byte) Box {
+	if body == nil {
+		body = []byte{}
+	}
+	return &box{size: int64(headerSize(typ, len(body)) + len(body)), boxType: typ, slurp: body}
+}
+
+// NewUUIDBox returns a "uuid" box with the extended type userType and
+// the given body.
+func NewUUIDBox(userType [16]byte, body []byte) *UUIDBox {
+	b := NewBox(TypeUUID, body).(*box)
+	b.userType = userType
+	return &UUIDBox{box: b, UserType: userType}
+}
+
+// NewContainerBox returns a ContainerBox of type typ, such as "moov".
+func NewContainerBox(typ BoxType, children ...Box) *ContainerBox {
+	return &ContainerBox{box: &box{boxType: typ}, Children: children}
+}
+
+// NewVisualSampleEntry returns a VisualSampleEntry of type typ, such
+// as "hvc1".
+func NewVisualSampleEntry(typ BoxType) *VisualSampleEntry {
+	return &VisualSampleEntry{box: &box{boxType: typ}, DataReferenceIndex: 1, Depth: 0x18}
+}
+
+// headerSize returns the size of the header of a box of type typ
+// with a body of n bytes.
+func headerSize(typ BoxType, n int) int {
+	size := 8
+	if typ == TypeUUID {
+		size += 16
+	}
+	if uint64(size)+uint64(n) > math.MaxUint32 {
+		size += 8 // largesize
+	}
+	return size
+}
+
+// encoder accumulates the body of a box being marshaled.
+type encoder struct {
+	buf []byte
+	err error // sticky error
+}
+
+func (e *encoder) fail(format string, args ...interface{}) {
+	if e.err == nil {
+		e.err = fmt.Errorf(format, args...)
+	}
+}
+
+func (e *encoder) u8(v uint8) { e.buf = append(e.buf, v) }
+
+func (e *encoder) u16(v uint16) { e.buf = append(e.buf, byte(v>>8), byte(v)) }
+
+func (e *encoder) u32(v uint32) {
+	e.buf = append(e.buf, byte(v>>24), byte(v>>16), byte(v>>8), byte(v))
+}
+
+func (e *encoder) u64(v uint64) {
+	e.u32(uint32(v >> 32))
+	e.u32(uint32(v))
+}
+
+// uintN writes v in bits bits, which must be 0, 8, 16, 32 or 64.
+func (e *encoder) uintN(v uint64, bits uint8) {
+	if bits < 64 && v>>bits != 0 {
+		e.fail("value %d doesn't fit in %d bits", v, bits)
+		return
+	}
+	switch bits {
+	case 0:
+	case 8:
+		e.u8(uint8(v))
+	case 16:
+		e.u16(uint16(v))
+	case 32:
+		e.u32(uint32(v))
+	case 64:
+		e.u64(v)
+	default:
+		e.fail("invalid uintn write size %d", bits)
+	}
+}
+
+// versioned writes v in 64 bits in version 1 boxes and 32 bits in
+// version 0 boxes, the opposite of bufReader.readVersioned.
+func (e *encoder) versioned(v uint64, version uint8) {
+	if version == 1 {
+		e.u64(v)
+	} else {
+		e.uintN(v, 32)
+	}
+}
+
+// id writes an item ID in 16 bits, or 32 bits if wide.
+func (e *encoder) id(v uint32, wide bool) {
+	if !wide && v > math.MaxUint16 {
+		e.fail("item ID %d doesn't fit in 16 bits; use a newer box version", v)
+	}
+	if wide {
+		e.u32(v)
+	} else {
+		e.u16(uint16(v))
+	}
+}
+
+// fourCC writes the 4 byte string s.
+func (e *encoder) fourCC(s string) {
+	if len(s) != 4 {
+		e.fail("%q is not 4 bytes long", s)
+		return
+	}
+	e.buf = append(e.buf, s...)
+}
+
+// str writes s as a NUL-terminated string.
+func (e *encoder) str(s string) {
+	if bytes.IndexByte([]byte(s), 0) >= 0 {
+		e.fail("string %q contains a NUL byte", s)
+	}
+	e.buf = append(append(e.buf, s...), 0)
+}
+
+func (e *encoder) fullBox(fb FullBox) {
+	if fb.Flags > 0xffffff {
+		e.fail("flags %#x don't fit in 24 bits", fb.Flags)
+	}
+	e.u32(uint32(fb.Version)<<24 | fb.Flags&0xffffff)
+}
+
+// boxes writes the encoding of each of boxes.
+func (e *encoder) boxes(boxes []Box) {
+	for _, b := range boxes {
+		if e.err != nil {
+			return
+		}
+		enc, err := b.Marshal()
+		if err != nil {
+			e.err = err
+			return
+		}
+		e.buf = append(e.buf, enc...)
+	}
+}
+
+// finish returns the encoding of a box of type typ whose body is the
+// encoder's contents.
+func (e *encoder) finish(typ BoxType) ([]byte, error) {
+	return e.finishUUID(typ, nil)
+}
+
+func (e *encoder) finishUUID(typ BoxType, userType []byte) ([]byte, error) {
+	if e.err != nil {
+		return nil, fmt.Errorf("marshaling %q box: %v", typ, e.err)
+	}
+	hlen := headerSize(typ, len(e.buf))
+	size := uint64(hlen + len(e.buf))
+	out := make([]byte, 0, size)
+	if hlen == 8 || hlen == 8+16 {
+		out = append(out, byte(size>>24), byte(size>>16), byte(size>>8), byte(size))
+		out = append(out, typ[:]...)
+	} else {
+		out = append(out, 0, 0, 0, 1)
+		out = append(out, typ[:]...)
+		for i := 56; i >= 0; i -= 8 {
+			out = append(out, byte(size>>uint(i)))
+		}
+	}
+	out = append(out, userType...)
+	return append(out, e.buf...), nil
+}
+
+// typeOf returns the type of b, or def if b is nil, as it is for boxes
+// constructed outside of this package.
+func typeOf(b *box, def BoxType) BoxType {
+	if b == nil {
+		return def
+	}
+	return b.boxType
+}
+
+// errNoType is returned when marshaling boxes whose type must be
+// given by a constructor, such as NewContainerBox.
+var errNoType = errors.New("bmff: can't marshal box without a type; use its constructor")
+
+func (b *box) Marshal() ([]byte, error) {
+	// Parsed types embedding a Box without their own Marshal method,
+	// such as those of RegisterParser, land back here; copy those.
+	if b.parsed != nil && !b.marshaling {
+		b.marshaling = true
+		defer func() { b.marshaling = false }()
+		return b.parsed.Marshal()
+	}
+	if b.slurp == nil {
+		slurp, err := ioutil.ReadAll(b.Body())
+		if err != nil {
+			return nil, err
+		}
+		b.slurp = slurp
+	}
+	e := &encoder{buf: b.slurp}
+	if b.boxType == TypeUUID {
+		return e.finishUUID(b.boxType, b.userType[:])
+	}
+	return e.finish(b.boxType)
+}
+
+func (ft *FileTypeBox) Marshal() ([]byte, error) {
+	e := new(encoder)
+	e.fourCC(ft.MajorBrand)
+	e.fourCC(ft.MinorVersion)
+	for _, c := range ft.Compatible {
+		e.fourCC(c)
+	}
+	return e.finish(TypeFtyp)
+}
+
+func (mb *MetaBox) Marshal() ([]byte, error) {
+	e := new(encoder)
+	if !mb.quickTime {
+		e.fullBox(mb.FullBox)
+	}
+	e.boxes(mb.Children)
+	return e.finish(TypeMeta)
+}
+
+func (ub *UUIDBox) Marshal() ([]byte, error) {
+	if ub.box == nil {
+		return nil, errNoType
+	}
+	body, err := ioutil.ReadAll(ub.Body())
+	if err != nil {
+		return nil, err
+	}
+	ub.box.slurp = body
+	e := &encoder{buf: body}
+	return e.finishUUID(TypeUUID, ub.UserType[:])
+}
+
+func (ie *ItemInfoEntry) Marshal() ([]byte, error) {
+	e := new(encoder)
+	e.fullBox(ie.FullBox)
+	switch v := ie.Version; {
+	case v > 3:
+		e.fail("unsupported infe box version %d", v)
+	case v < 2:
+		e.id(ie.ItemID, false)
+		e.u16(ie.ProtectionIndex)
+		e.str(ie.Name)
+		e.str(ie.ContentType)
+		if ie.ContentEncoding != "" {
+			e.str(ie.ContentEncoding)
+		}
+	default:
+		e.id(ie.ItemID, v == 3)
+		e.u16(ie.ProtectionIndex)
+		e.fourCC(ie.ItemType)
+		e.str(ie.Name)
+		switch ie.ItemType {
+		case "mime":
+			e.str(ie.ContentType)
+			if ie.ContentEncoding != "" {
+				e.str(ie.ContentEncoding)
+			}
+		case "uri ":
+			e.str(ie.ItemURIType)
+		}
+	}
+	return e.finish(boxType("infe"))
+}
+
+func (ib *ItemInfoBox) Marshal() ([]byte, error) {
+	e := new(encoder)
+	e.fullBox(ib.FullBox)
+	if ib.Version == 0 {
+		if len(ib.ItemInfos) > math.MaxUint16 {
+			e.fail("too many items for a version 0 box")
+		}
+		e.u16(uint16(len(ib.ItemInfos)))
+	} else {
+		e.u32(uint32(len(ib.ItemInfos)))
+	}
+	for _, iie := range ib.ItemInfos {
+		e.boxes([]Box{iie})
+	}
+	return e.finish(boxType("iinf"))
+}
+
+func (ipc *ItemPropertyContainerBox) Marshal() ([]byte, error) {
+	e := new(encoder)
+	e.boxes(ipc.Properties)
+	return e.finish(boxType("ipco"))
+}
+
+func (ip *ItemPropertiesBox) Marshal() ([]byte, error) {
+	e := new(encoder)
+	if ip.PropertyContainer == nil {
+		e.fail("no property container")
+	} else {
+		e.boxes([]Box{ip.PropertyContainer})
+	}
+	for _, ipa := range ip.Associations {
+		e.boxes([]Box{ipa})
+	}
+	return e.finish(boxType("iprp"))
+}
+
+func (ipa *ItemPropertyAssociation) Marshal() ([]byte, error) {
+	e := new(encoder)
+	e.fullBox(ipa.FullBox)
+	e.u32(uint32(len(ipa.Entries)))
+	for _, ent := range ipa.Entries {
+		e.id(ent.ItemID, ipa.Version >= 1)
+		if len(ent.Associations) > math.MaxUint8 {
+			e.fail("too many associations for item %d", ent.ItemID)
+		}
+		e.u8(uint8(len(ent.Associations)))
+		for _, a := range ent.Associations {
+			var essential uint16
+			if a.Essential {
+				essential = 1
+			}
+			if ipa.Flags&1 != 0 {
+				if a.Index >= 1<<15 {
+					e.fail("property index %d too large", a.Index)
+				}
+				e.u16(essential<<15 | a.Index)
+			} else {
+				if a.Index >= 1<<7 {
+					e.fail("property index %d too large; set flag 1 for 15-bit indexes", a.Index)
+				}
+				e.u8(uint8(essential<<7 | a.Index))
+			}
+		}
+	}
+	return e.finish(boxType("ipma"))
+}
+
+func (p *ImageSpatialExtentsProperty) Marshal() ([]byte, error) {
+	e := new(encoder)
+	e.fullBox(p.FullBox)
+	e.u32(p.ImageWidth)
+	e.u32(p.ImageHeight)
+	return e.finish(boxType("ispe"))
+}
+
+// fieldSize returns the smallest of 0, 4 and 8 bytes that holds all
+// of vals, but at least min.
+func fieldSize(min uint8, vals ...uint64) uint8 {
+	size := min
+	for _, v := range vals {
+		switch {
+		case v > math.MaxUint32:
+			return 8
+		case v > 0 && size < 4:
+			size = 4
+		}
+	}
+	return size
+}
+
+func (ilb *ItemLocationBox) Marshal() ([]byte, error) {
+	e := new(encoder)
+	e.fullBox(ilb.FullBox)
+	if ilb.Version > 2 {
+		e.fail("unsupported iloc box version %d", ilb.Version)
+	}
+	var offsets, lengths, bases, indexes []uint64
+	for _, ent := range ilb.Items {
+		bases = append(bases, ent.BaseOffset)
+		for _, ol := range ent.Extents {
+			offsets = append(offsets, ol.Offset)
+			lengths = append(lengths, ol.Length)
+			indexes = append(indexes, ol.Index)
+		}
+	}
+	offsetSize := fieldSize(ilb.offsetSize, offsets...)
+	lengthSize := fieldSize(ilb.lengthSize, lengths...)
+	baseOffsetSize := fieldSize(ilb.baseOffsetSize, bases...)
+	var indexSize uint8
+	if ilb.Version > 0 {
+		indexSize = fieldSize(ilb.indexSize, indexes...)
+	}
+	e.u8(offsetSize<<4 | lengthSize)
+	e.u8(baseOffsetSize<<4 | indexSize)
+	if ilb.Version < 2 {
+		if len(ilb.Items) > math.MaxUint16 {
+			e.fail("too many items for a version %d box", ilb.Version)
+		}
+		e.u16(uint16(len(ilb.Items)))
+	} else {
+		e.u32(uint32(len(ilb.Items)))
+	}
+	for _, ent := range ilb.Items {
+		e.id(ent.ItemID, ilb.Version == 2)
+		if ilb.Version > 0 {
+			if ent.ConstructionMethod > 15 {
+				e.fail("invalid construction method %d", ent.ConstructionMethod)
+			}
+			e.u16(uint16(ent.ConstructionMethod))
+		} else if ent.ConstructionMethod != 0 {
+			e.fail("construction method %d requires a version 1 or 2 box", ent.ConstructionMethod)
+		}
+		e.u16(ent.DataReferenceIndex)
+		e.uintN(ent.BaseOffset, baseOffsetSize*8)
+		if len(ent.Extents) > math.MaxUint16 {
+			e.fail("too many extents for item %d", ent.ItemID)
+		}
+		e.u16(uint16(len(ent.Extents)))
+		for _, ol := range ent.Extents {
+			if indexSize == 0 && ol.Index != 0 {
+				e.fail("extent index requires a version 1 or 2 box")
+			}
+			e.uintN(ol.Index, indexSize*8)
+			e.uintN(ol.Offset, offsetSize*8)
+			e.uintN(ol.Length, lengthSize*8)
+		}
+	}
+	return e.finish(boxType("iloc"))
+}
+
+func (hb *HandlerBox) Marshal() ([]byte, error) {
+	e := new(encoder)
+	e.fullBox(hb.FullBox)
+	e.u32(hb.preDefined)
+	e.fourCC(hb.HandlerType)
+	e.buf = append(e.buf, hb.reserved[:]...)
+	if hb.pascal && len(hb.Name) < ' ' {
+		e.u8(uint8(len(hb.Name)))
+		e.buf = append(e.buf, hb.Name...)
+	} else {
+		e.str(hb.Name)
+	}
+	e.buf = append(e.buf, hb.extra...)
+	return e.finish(boxType("hdlr"))
+}
+
+func (dib *DataInformationBox) Marshal() ([]byte, error) {
+	e := new(encoder)
+	e.boxes(dib.Children)
+	return e.finish(boxType("dinf"))
+}
+
+func (drb *DataReferenceBox) Marshal() ([]byte, error) {
+	e := new(encoder)
+	e.fullBox(drb.FullBox)
+	e.u32(uint32(len(drb.Children)))
+	e.boxes(drb.Children)
+	return e.finish(boxType("dref"))
+}
+
+func (pib *PrimaryItemBox) Marshal() ([]byte, error) {
+	e := new(encoder)
+	e.fullBox(pib.FullBox)
+	e.id(pib.ItemID, pib.Version != 0)
+	return e.finish(boxType("pitm"))
+}
+
+func (ir *ImageRotation) Marshal() ([]byte, error) {
+	e := new(encoder)
+	e.u8(ir.Angle & 3)
+	return e.finish(boxType("irot"))
+}
+
+func (im *ImageMirror) Marshal() ([]byte, error) {
+	e := new(encoder)
+	e.u8(im.Axis & 1)
+	return e.finish(boxType("imir"))
+}
+
+func (ca *CleanAperture) Marshal() ([]byte, error) {
+	e := new(encoder)
+	if ca.HorizOffsetD < 0 || ca.VertOffsetD < 0 {
+		e.fail("negative clean aperture offset denominator")
+	}
+	for _, v := range []uint32{
+		ca.WidthN, ca.WidthD,
+		ca.HeightN, ca.HeightD,
+		uint32(ca.HorizOffsetN), uint32(ca.HorizOffsetD),
+		uint32(ca.VertOffsetN), uint32(ca.VertOffsetD),
+	} {
+		e.u32(v)
+	}
+	return e.finish(boxType("clap"))
+}
+
+func (pi *PixelInformation) Marshal() ([]byte, error) {
+	e := new(encoder)
+	e.fullBox(pi.FullBox)
+	if len(pi.BitsPerChannel) > math.MaxUint8 {
+		e.fail("too many channels")
+	}
+	e.u8(uint8(len(pi.BitsPerChannel)))
+	e.buf = append(e.buf, pi.BitsPerChannel...)
+	return e.finish(boxType("pixi"))
+}
+
+func (ci *ColorInformation) Marshal() ([]byte, error) {
+	e := new(encoder)
+	e.fourCC(ci.ColorType)
+	switch ci.ColorType {
+	case "nclx", "nclc":
+		e.u16(ci.ColorPrimaries)
+		e.u16(ci.TransferCharacteristics)
+		e.u16(ci.MatrixCoefficients)
+		if ci.ColorType == "nclx" {
+			var v uint8
+			if ci.FullRange {
+				v = 0x80
+			}
+			e.u8(v)
+		}
+	case "prof", "rICC":
+		e.buf = append(e.buf, ci.ICCProfile...)
+	}
+	return e.finish(boxType("colr"))
+}
+
+func (hb *HEVCConfigurationBox) Marshal() ([]byte, error) {
+	e := new(encoder)
+	if hb.ProfileSpace > 3 || hb.ProfileIDC > 31 || hb.MinSpatialSegmentation > 0xfff ||
+		hb.ParallelismType > 3 || hb.ChromaFormat > 3 || hb.ConstantFrameRate > 3 ||
+		hb.NumTemporalLayers > 7 || hb.LengthSizeMinusOne > 3 || hb.ConstraintIndicatorFlags>>48 != 0 {
+		e.fail("field out of range")
+	}
+	if hb.BitDepthLuma < 8 || hb.BitDepthLuma > 15 || hb.BitDepthChroma < 8 || hb.BitDepthChroma > 15 {
+		e.fail("invalid bit depth %d/%d", hb.BitDepthLuma, hb.BitDepthChroma)
+	}
+	e.u8(hb.ConfigurationVersion)
+	b := hb.ProfileSpace<<6 | hb.ProfileIDC&0x1f
+	if hb.TierFlag {
+		b |= 0x20
+	}
+	e.u8(b)
+	e.u32(hb.ProfileCompatibilityFlags)
+	e.u16(uint16(hb.ConstraintIndicatorFlags >> 32))
+	e.u32(uint32(hb.ConstraintIndicatorFlags))
+	e.u8(hb.LevelIDC)
+	e.u16(0xf000 | hb.MinSpatialSegmentation&0xfff)
+	e.u8(0xfc | hb.ParallelismType&3)
+	e.u8(0xfc | hb.ChromaFormat&3)
+	e.u8(0xf8 | (hb.BitDepthLuma-8)&7)
+	e.u8(0xf8 | (hb.BitDepthChroma-8)&7)
+	e.u16(hb.AvgFrameRate)
+	b = hb.ConstantFrameRate<<6 | hb.NumTemporalLayers&7<<3 | hb.LengthSizeMinusOne&3
+	if hb.TemporalIDNested {
+		b |= 4
+	}
+	e.u8(b)
+	if len(hb.NALArrays) > math.MaxUint8 {
+		e.fail("too many NAL unit arrays")
+	}
+	e.u8(uint8(len(hb.NALArrays)))
+	for _, arr := range hb.NALArrays {
+		b := arr.NALUnitType & 0x3f
+		if arr.ArrayCompleteness {
+			b |= 0x80
+		}
+		e.u8(b)
+		if len(arr.NALUnits) > math.MaxUint16 {
+			e.fail("too many NAL units")
+		}
+		e.u16(uint16(len(arr.NALUnits)))
+		for _, nal := range arr.NALUnits {
+			if len(nal) > math.MaxUint16 {
+				e.fail("NAL unit too large")
+			}
+			e.u16(uint16(len(nal)))
+			e.buf = append(e.buf, nal...)
+		}
+	}
+	return e.finish(boxType("hvcC"))
+}
+
+func (irb *ItemReferenceBox) Marshal() ([]byte, error) {
+	e := new(encoder)
+	e.fullBox(irb.FullBox)
+	wide := irb.Version > 0
+	for _, ref := range irb.References {
+		ce := new(encoder)
+		ce.id(ref.FromItemID, wide)
+		if len(ref.ToItemIDs) > math.MaxUint16 {
+			ce.fail("too many references from item %d", ref.FromItemID)
+		}
+		ce.u16(uint16(len(ref.ToItemIDs)))
+		for _, id := range ref.ToItemIDs {
+			ce.id(id, wide)
+		}
+		enc, err := ce.finish(ref.Type)
+		if err != nil {
+			e.fail("%v", err)
+		}
+		e.buf = append(e.buf, enc...)
+	}
+	return e.finish(boxType("iref"))
+}
+
+func (idb *ItemDataBox) Marshal() ([]byte, error) {
+	e := &encoder{buf: idb.Data}
+	return e.finish(boxType("idat"))
+}
+
+func (ab *AV1ConfigurationBox) Marshal() ([]byte, error) {
+	e := new(encoder)
+	if ab.Version > 0x7f || ab.SeqProfile > 7 || ab.SeqLevelIdx0 > 31 || ab.SeqTier0 > 1 ||
+		ab.ChromaSamplePosition > 3 || ab.InitialPresentationDelayMinusOne > 15 {
+		e.fail("field out of range")
+	}
+	bit := func(v bool, b uint8) uint8 {
+		if v {
+			return b
+		}
+		return 0
+	}
+	e.u8(0x80 | ab.Version)
+	e.u8(ab.SeqProfile<<5 | ab.SeqLevelIdx0&0x1f)
+	e.u8(ab.SeqTier0<<7 | bit(ab.HighBitDepth, 0x40) | bit(ab.TwelveBit, 0x20) |
+		bit(ab.Monochrome, 0x10) | bit(ab.ChromaSubsamplingX, 0x08) |
+		bit(ab.ChromaSubsamplingY, 0x04) | ab.ChromaSamplePosition&3)
+	e.u8(bit(ab.InitialPresentationDelayPresent, 0x10) | ab.InitialPresentationDelayMinusOne&0xf)
+	e.buf = append(e.buf, ab.ConfigOBUs...)
+	return e.finish(boxType("av1C"))
+}
+
+// Track boxes.
+
+func (cb *ContainerBox) Marshal() ([]byte, error) {
+	if cb.box == nil {
+		return nil, errNoType
+	}
+	e := new(encoder)
+	e.boxes(cb.Children)
+	return e.finish(cb.boxType)
+}
+
+func (mh *MovieHeaderBox) Marshal() ([]byte, error) {
+	e := new(encoder)
+	e.fullBox(mh.FullBox)
+	e.versioned(mh.CreationTime, mh.Version)
+	e.versioned(mh.ModificationTime, mh.Version)
+	e.u32(mh.Timescale)
+	e.versioned(mh.Duration, mh.Version)
+	e.u32(uint32(mh.Rate))
+	e.u16(uint16(mh.Volume))
+	e.buf = append(e.buf, make([]byte, 2+8)...) // reserved
+	for _, v := range mh.Matrix {
+		e.u32(uint32(v))
+	}
+	e.buf = append(e.buf, make([]byte, 6*4)...) // pre_defined
+	e.u32(mh.NextTrackID)
+	return e.finish(boxType("mvhd"))
+}
+
+func (th *TrackHeaderBox) Marshal() ([]byte, error) {
+	e := new(encoder)
+	e.fullBox(th.FullBox)
+	e.versioned(th.CreationTime, th.Version)
+	e.versioned(th.ModificationTime, th.Version)
+	e.u32(th.TrackID)
+	e.u32(0) // reserved
+	e.versioned(th.Duration, th.Version)
+	e.u64(0) // reserved
+	e.u16(uint16(th.Layer))
+	e.u16(uint16(th.AlternateGroup))
+	e.u16(uint16(th.Volume))
+	e.u16(0) // reserved
+	for _, v := range th.Matrix {
+		e.u32(uint32(v))
+	}
+	e.u32(th.Width)
+	e.u32(th.Height)
+	return e.finish(boxType("tkhd"))
+}
+
+func (mh *MediaHeaderBox) Marshal() ([]byte, error) {
+	e := new(encoder)
+	e.fullBox(mh.FullBox)
+	e.versioned(mh.CreationTime, mh.Version)
+	e.versioned(mh.ModificationTime, mh.Version)
+	e.u32(mh.Timescale)
+	e.versioned(mh.Duration, mh.Version)
+	lang := mh.Language
+	if lang == "" {
+		lang = "und"
+	}
+	var packed uint16
+	if len(lang) != 3 {
+		e.fail("invalid language %q", lang)
+	}
+	for i := 0; i < len(lang) && i < 3; i++ {
+		c := lang[i] - 0x60
+		if lang[i] < 0x60 || c > 31 {
+			e.fail("invalid language %q", lang)
+		}
+		packed = packed<<5 | uint16(c&31)
+	}
+	e.u16(packed)
+	e.u16(0) // pre_defined
+	return e.finish(boxType("mdhd"))
+}
+
+func (sd *SampleDescriptionBox) Marshal() ([]byte, error) {
+	e := new(encoder)
+	e.fullBox(sd.FullBox)
+	e.u32(uint32(len(sd.Children)))
+	e.boxes(sd.Children)
+	return e.finish(boxType("stsd"))
+}
+
+func (ve *VisualSampleEntry) Marshal() ([]byte, error) {
+	if ve.box == nil {
+		return nil, errNoType
+	}
+	e := new(encoder)
+	e.buf = append(e.buf, make([]byte, 6)...) // reserved
+	e.u16(ve.DataReferenceIndex)
+	e.buf = append(e.buf, make([]byte, 2+2+12)...) // pre_defined and reserved
+	e.u16(ve.Width)
+	e.u16(ve.Height)
+	e.u32(0x00480000) // horizresolution: 72 dpi
+	e.u32(0x00480000) // vertresolution: 72 dpi
+	e.u32(0)          // reserved
+	e.u16(1)          // frame_count
+	if len(ve.CompressorName) > 31 {
+		e.fail("compressor name %q too long", ve.CompressorName)
+	}
+	var name [32]byte
+	name[0] = byte(copy(name[1:], ve.CompressorName))
+	e.buf = append(e.buf, name[:]...)
+	e.u16(ve.Depth)
+	e.u16(0xffff) // pre_defined
+	e.boxes(ve.Children)
+	return e.finish(ve.boxType)
+}
+
+func (ts *TimeToSampleBox) Marshal() ([]byte, error) {
+	e := new(encoder)
+	e.fullBox(ts.FullBox)
+	e.u32(uint32(len(ts.Entries)))
+	for _, ent := range ts.Entries {
+		e.u32(ent.SampleCount)
+		e.u32(ent.SampleDelta)
+	}
+	return e.finish(boxType("stts"))
+}
+
+func (ss *SampleSizeBox) Marshal() ([]byte, error) {
+	e := new(encoder)
+	e.fullBox(ss.FullBox)
+	e.u32(ss.SampleSize)
+	if ss.SampleSize != 0 {
+		e.u32(ss.SampleCount)
+	} else {
+		e.u32(uint32(len(ss.Sizes)))
+		for _, v := range ss.Sizes {
+			e.u32(v)
+		}
+	}
+	return e.finish(boxType("stsz"))
+}
+
+// Marshal encodes the box as a "co64" box if it was parsed from one or
+// if its offsets require it, and as an "stco" box otherwise.
+func (co *ChunkOffsetBox) Marshal() ([]byte, error) {
+	typ := typeOf(co.box, boxType("stco"))
+	for _, off := range co.Offsets {
+		if off > math.MaxUint32 {
+			typ = boxType("co64")
+		}
+	}
+	bits := uint8(32)
+	if typ.EqualString("co64") {
+		bits = 64
+	}
+	e := new(encoder)
+	e.fullBox(co.FullBox)
+	e.u32(uint32(len(co.Offsets)))
+	for _, off := range co.Offsets {
+		e.uintN(off, bits)
+	}
+	return e.finish(typ)
+}
+
+func (sc *SampleToChunkBox) Marshal() ([]byte, error) {
+	e := new(encoder)
+	e.fullBox(sc.FullBox)
+	e.u32(uint32(len(sc.Entries)))
+	for _, ent := range sc.Entries {
+		e.u32(ent.FirstChunk)
+		e.u32(ent.SamplesPerChunk)
+		e.u32(ent.SampleDescriptionIndex)
+	}
+	return e.finish(boxType("stsc"))
+}
+
+func (ut *UserDataText) Marshal() ([]byte, error) {
+	e := new(encoder)
+	if len(ut.Text) > math.MaxUint16 {
+		e.fail("text too long")
+	}
+	e.u16(uint16(len(ut.Text)))
+	e.u16(ut.Language)
+	e.buf = append(e.buf, ut.Text...)
+	return e.finish(typeOf(ut.box, boxType("\xa9xyz")))
+}
@@ -0,0 +1,443 @@
+/*
+Copyright 2026 The go4 Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+     http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package bmff
+
+import (
+	"bytes"
+	"io"
+	"io/ioutil"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+// exportedEqual reports whether a and b are equal, considering only
+// their exported fields and, for unparsed boxes, their types and
+// bodies.
+func exportedEqual(a, b reflect.Value) bool {
+	if a.Kind() != b.Kind() {
+		return false
+	}
+	switch a.Kind() {
+	case reflect.Interface:
+		if a.IsNil() || b.IsNil() {
+			return a.IsNil() == b.IsNil()
+		}
+		return exportedEqual(a.Elem(), b.Elem())
+	case reflect.Ptr:
+		if a.IsNil() || b.IsNil() {
+			return a.IsNil() == b.IsNil()
+		}
+		if a.Type() != b.Type() {
+			return false
+		}
+		if ab, ok := a.Interface().(*box); ok {
+			bb := b.Interface().(*box)
+			abody, _ := ioutil.ReadAll(ab.Body())
+			bbody, _ := ioutil.ReadAll(bb.Body())
+			return ab.boxType == bb.boxType && bytes.Equal(abody, bbody)
+		}
+		return exportedEqual(a.Elem(), b.Elem())
+	case reflect.Struct:
+		if a.Type() != b.Type() {
+			return false
+		}
+		for i := 0; i < a.NumField(); i++ {
+			if a.Type().Field(i).PkgPath != "" {
+				continue // unexported
+			}
+			if !exportedEqual(a.Field(i), b.Field(i)) {
+				return false
+			}
+		}
+		return true
+	case reflect.Slice:
+		if a.Len() != b.Len() {
+			return false
+		}
+		for i := 0; i < a.Len(); i++ {
+			if !exportedEqual(a.Index(i), b.Index(i)) {
+				return false
+			}
+		}
+		return true
+	}
+	return reflect.DeepEqual(a.Interface(), b.Interface())
+}
+
+// parseOne reads and parses the single box in enc.
+func parseOne(t *testing.T, enc []byte) Box {
+	t.Helper()
+	b, err := NewReader(bytes.NewReader(enc)).ReadBox()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if b.Size() != int64(len(enc)) {
+		t.Fatalf("box %q has size %d; encoding is %d bytes", b.Type(), b.Size(), len(enc))
+	}
+	pb, err := b.Parse()
+	if err != nil {
+		t.Fatalf("parsing %q box: %v", b.Type(), err)
+	}
+	return pb
+}
+
+func TestMarshalRoundTrip(t *testing.T) {
+	infe := func(version uint8, id uint32, typ, name string) *ItemInfoEntry {
+		return &ItemInfoEntry{FullBox: FullBox{Version: version}, ItemID: id, ItemType: typ, Name: name}
+	}
+	boxes := []Box{
+		&FileTypeBox{MajorBrand: "heic", MinorVersion: "\x00\x00\x00\x00", Compatible: []string{"mif1", "heic"}},
+		&MetaBox{Children: []Box{
+			&HandlerBox{HandlerType: "pict"},
+			&PrimaryItemBox{ItemID: 1},
+			NewBox(BoxType{'f', 'r', 'e', 'e'}, []byte("x")),
+		}},
+		&PrimaryItemBox{FullBox: FullBox{Version: 1}, ItemID: 1 << 20},
+		&ItemInfoBox{Count: 4, ItemInfos: []*ItemInfoEntry{
+			infe(2, 1, "hvc1", ""),
+			infe(2, 2, "Exif", "exif"),
+			{FullBox: FullBox{Version: 2}, ItemID: 3, ItemType: "mime", ContentType: "application/rdf+xml", ContentEncoding: "gzip"},
+			{FullBox: FullBox{Version: 2}, ItemID: 4, ItemType: "uri ", ItemURIType: "urn:example"},
+		}},
+		&ItemInfoBox{FullBox: FullBox{Version: 1}, Count: 2, ItemInfos: []*ItemInfoEntry{
+			infe(3, 1<<17, "hvc1", "big"),
+			{FullBox: FullBox{Version: 0}, ItemID: 5, ItemType: "mime", Name: "note", ContentType: "text/plain"},
+		}},
+		&ItemLocationBox{ItemCount: 2, Items: []ItemLocationBoxEntry{
+			{ItemID: 1, ExtentCount: 1, Extents: []OffsetLength{{Offset: 100, Length: 20}}},
+			{ItemID: 2, BaseOffset: 1 << 33, ExtentCount: 2, Extents: []OffsetLength{{Offset: 0, Length: 5}, {Offset: 10, Length: 5}}},
+		}},
+		&ItemLocationBox{FullBox: FullBox{Version: 1}, ItemCount: 2, Items: []ItemLocationBoxEntry{
+			{ItemID: 1, ConstructionMethod: 1, ExtentCount: 1, Extents: []OffsetLength{{Offset: 0, Length: 20}}},
+			{ItemID: 2, ExtentCount: 1, Extents: []OffsetLength{{Offset: 1000, Length: 5}}},
+		}},
+		&ItemLocationBox{FullBox: FullBox{Version: 2}, ItemCount: 1, Items: []ItemLocationBoxEntry{
+			{ItemID: 1 << 20, ConstructionMethod: 1, ExtentCount: 1, Extents: []OffsetLength{{Index: 1, Offset: 4, Length: 8}}},
+		}},
+		&ItemPropertiesBox{
+			PropertyContainer: &ItemPropertyContainerBox{Properties: []Box{
+				&ImageSpatialExtentsProperty{ImageWidth: 640, ImageHeight: 480},
+				&ImageRotation{Angle: 3},
+				&ImageMirror{Axis: 1},
+				&CleanAperture{WidthN: 600, WidthD: 1, HeightN: 450, HeightD: 1, HorizOffsetN: -3, HorizOffsetD: 2, VertOffsetN: 0, VertOffsetD: 1},
+				&PixelInformation{BitsPerChannel: []uint8{10, 10, 10}},
+				&ColorInformation{ColorType: "nclx", ColorPrimaries: 1, TransferCharacteristics: 13, MatrixCoefficients: 6, FullRange: true},
+				&ColorInformation{ColorType: "prof", ICCProfile: []byte("icc")},
+				&HEVCConfigurationBox{
+					ConfigurationVersion: 1, ProfileIDC: 1, ProfileCompatibilityFlags: 0x60000000,
+					ConstraintIndicatorFlags: 0x900000000000, LevelIDC: 90, ChromaFormat: 1,
+					BitDepthLuma: 8, BitDepthChroma: 8, NumTemporalLayers: 1, TemporalIDNested: true,
+					LengthSizeMinusOne: 3,
+					NALArrays:          []HEVCNALArray{{ArrayCompleteness: true, NALUnitType: 32, NALUnits: [][]byte{{1, 2, 3}}}},
+				},
+				&AV1ConfigurationBox{Version: 1, SeqLevelIdx0: 8, HighBitDepth: true, ChromaSubsamplingX: true, ChromaSubsamplingY: true, ConfigOBUs: []byte{0x0a, 0x0b}},
+			}},
+			Associations: []*ItemPropertyAssociation{
+				{EntryCount: 1, Entries: []ItemPropertyAssociationItem{
+					{ItemID: 1, AssociationsCount: 2, Associations: []ItemProperty{{Essential: true, Index: 1}, {Index: 2}}},
+				}},
+				{FullBox: FullBox{Version: 1, Flags: 1}, EntryCount: 1, Entries: []ItemPropertyAssociationItem{
+					{ItemID: 1 << 20, AssociationsCount: 1, Associations: []ItemProperty{{Essential: true, Index: 300}}},
+				}},
+			},
+		},
+		&ItemReferenceBox{References: []ItemReference{
+			{Type: BoxType{'d', 'i', 'm', 'g'}, FromItemID: 3, ToItemIDs: []uint32{1, 2, 2, 1}},
+			{Type: BoxType{'t', 'h', 'm', 'b'}, FromItemID: 4, ToItemIDs: []uint32{3}},
+		}},
+		&ItemDataBox{Data: []byte("idat data")},
+		&DataInformationBox{Children: []Box{
+			&DataReferenceBox{EntryCount: 1, Children: []Box{NewBox(BoxType{'u', 'r', 'l', ' '}, []byte{0, 0, 0, 1})}},
+		}},
+		NewUUIDBox([16]byte{1, 2, 3}, []byte("uuid body")),
+		NewContainerBox(TypeMoov,
+			&MovieHeaderBox{Timescale: 600, Duration: 1200, Rate: 1 << 16, Volume: 1 << 8, NextTrackID: 2},
+			NewContainerBox(boxType("trak"),
+				&TrackHeaderBox{FullBox: FullBox{Version: 1, Flags: 3}, TrackID: 1, Duration: 1 << 40, Width: 64 << 16, Height: 48 << 16},
+				NewContainerBox(boxType("mdia"),
+					&MediaHeaderBox{Timescale: 600, Duration: 1200, Language: "eng"},
+					NewContainerBox(boxType("stbl"),
+						&SampleDescriptionBox{EntryCount: 1, Children: []Box{
+							func() Box {
+								ve := NewVisualSampleEntry(boxType("avc1"))
+								ve.Width, ve.Height, ve.CompressorName = 64, 48, "test"
+								return ve
+							}(),
+						}},
+						&TimeToSampleBox{Entries: []TimeToSampleEntry{{SampleCount: 2, SampleDelta: 600}}},
+						&SampleSizeBox{SampleSize: 5, SampleCount: 2},
+						&SampleSizeBox{SampleCount: 3, Sizes: []uint32{1, 2, 3}},
+						&SampleToChunkBox{Entries: []SampleToChunkEntry{{1, 2, 1}, {2, 1, 1}}},
+						&ChunkOffsetBox{Offsets: []uint64{100, 200}},
+						&ChunkOffsetBox{Offsets: []uint64{1 << 40}},
+					),
+				),
+			),
+			NewContainerBox(boxType("udta"), &UserDataText{Language: 0x15c7, Text: "+37.7749-122.4194/"}),
+		),
+	}
+	for _, b := range boxes {
+		enc, err := b.Marshal()
+		if err != nil {
+			t.Errorf("Marshal(%T): %v", b, err)
+			continue
+		}
+		pb := parseOne(t, enc)
+		if !exportedEqual(reflect.ValueOf(b), reflect.ValueOf(pb)) && !childrenEqual(t, b, pb) {
+			t.Errorf("parse(marshal(%T)) = %+v; want %+v", b, pb, b)
+		}
+		enc2, err := pb.Marshal()
+		if err != nil {
+			t.Errorf("Marshal(parsed %T): %v", pb, err)
+			continue
+		}
+		if !bytes.Equal(enc, enc2) {
+			t.Errorf("%T: marshaling the parsed box gave different bytes:\n% x\nwant:\n% x", b, enc2, enc)
+		}
+	}
+}
+
+// childrenEqual reports whether a and b, boxes with child boxes, have
+// equal children once b's children are parsed. It reports an error for
+// any differing child.
+func childrenEqual(t *testing.T, a, b Box) bool {
+	if ap, ok := a.(*ItemPropertiesBox); ok {
+		bp := b.(*ItemPropertiesBox)
+		return childrenEqual(t, ap.PropertyContainer, bp.PropertyContainer) &&
+			exportedEqual(reflect.ValueOf(ap.Associations), reflect.ValueOf(bp.Associations))
+	}
+	ac, bc := children(a), children(b)
+	if ac == nil || len(ac) != len(bc) {
+		return false
+	}
+	for i := range ac {
+		bi := bc[i]
+		if _, ok := ac[i].(*box); !ok {
+			pb, err := bi.Parse()
+			if err != nil {
+				t.Errorf("parsing child %q: %v", bi.Type(), err)
+				return false
+			}
+			bi = pb
+		}
+		if !exportedEqual(reflect.ValueOf(ac[i]), reflect.ValueOf(bi)) && !childrenEqual(t, ac[i], bi) {
+			t.Errorf("child %d: got %+v; want %+v", i, bi, ac[i])
+			return false
+		}
+	}
+	// The boxes' other fields must be equal too.
+	return exportedEqual(reflect.ValueOf(withoutChildren(a)), reflect.ValueOf(withoutChildren(b)))
+}
+
+func children(b Box) []Box {
+	switch b := b.(type) {
+	case *MetaBox:
+		return b.Children
+	case *ContainerBox:
+		return b.Children
+	case *SampleDescriptionBox:
+		return b.Children
+	case *VisualSampleEntry:
+		return b.Children
+	case *DataInformationBox:
+		return b.Children
+	case *DataReferenceBox:
+		return b.Children
+	case *ItemPropertyContainerBox:
+		return b.Properties
+	}
+	return nil
+}
+
+// withoutChildren returns a copy of b without its children.
+func withoutChildren(b Box) interface{} {
+	v := reflect.New(reflect.TypeOf(b).Elem())
+	v.Elem().Set(reflect.ValueOf(b).Elem())
+	for _, name := range []string{"Children", "Properties"} {
+		if f := v.Elem().FieldByName(name); f.IsValid() {
+			f.Set(reflect.Zero(f.Type()))
+		}
+	}
+	return v.Interface()
+}
+
+// parseAll parses b and all its descendants.
+func parseAll(t *testing.T, b Box) {
+	pb, err := b.Parse()
+	if err == ErrUnknownBox {
+		return
+	}
+	if err != nil {
+		t.Fatalf("parsing %q: %v", b.Type(), err)
+	}
+	for _, c := range children(pb) {
+		parseAll(t, c)
+	}
+	if ip, ok := pb.(*ItemPropertiesBox); ok {
+		parseAll(t, ip.PropertyContainer)
+	}
+}
+
+// TestMarshalFiles checks that the boxes of real files are marshaled
+// to their original bytes.
+func TestMarshalFiles(t *testing.T) {
+	files, err := filepath.Glob("../testdata/*.[ha][ev][ii][cf]")
+	if err != nil {
+		t.Fatal(err)
+	}
+	files = append(files, "../../mp4/testdata/sample.mp4")
+	if len(files) < 2 {
+		t.Fatalf("found only %d test files", len(files))
+	}
+	for _, name := range files {
+		data, err := ioutil.ReadFile(name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		br := NewReader(bytes.NewReader(data))
+		var start, size int
+		for {
+			b, err := br.ReadBox()
+			if err == io.EOF {
+				break
+			}
+			if err != nil {
+				t.Fatalf("%s: %v", name, err)
+			}
+			start, size = start+size, int(b.Size())
+			if b.Type() != TypeFtyp && b.Type() != TypeMeta && b.Type() != TypeMoov {
+				continue
+			}
+			orig := data[start : start+size]
+			parseAll(t, b)
+			enc, err := b.Marshal()
+			if err != nil {
+				t.Errorf("%s: marshaling %q: %v", name, b.Type(), err)
+				continue
+			}
+			if !bytes.Equal(enc, orig) {
+				t.Errorf("%s: %q box marshaled to %d bytes differing from the original %d", name, b.Type(), len(enc), len(orig))
+			}
+		}
+	}
+}
+
+func TestMarshalErrors(t *testing.T) {
+	for _, b := range []Box{
+		&PrimaryItemBox{ItemID: 1 << 16},
+		&ItemPropertyAssociation{Entries: []ItemPropertyAssociationItem{
+			{ItemID: 1, AssociationsCount: 1, Associations: []ItemProperty{{Index: 200}}},
+		}},
+		&FileTypeBox{MajorBrand: "toolong"},
+		&ItemInfoEntry{FullBox: FullBox{Version: 2}, ItemType: "mime", Name: "a\x00b"},
+		&ContainerBox{},
+		&HEVCConfigurationBox{},
+		&MediaHeaderBox{Language: "English"},
+		&ItemLocationBox{FullBox: FullBox{Flags: 1 << 24}},
+		&ItemLocationBox{Items: []ItemLocationBoxEntry{{ItemID: 1, ConstructionMethod: 1}}},
+	} {
+		if _, err := b.Marshal(); err == nil {
+			t.Errorf("Marshal(%+v) succeeded; want error", b)
+		}
+	}
+}
+
+func TestHeaderSize(t *testing.T) {
+	free := BoxType{'f', 'r', 'e', 'e'}
+	for _, tt := range []struct {
+		typ  BoxType
+		n    int
+		want int
+	}{
+		{free, 0, 8},
+		{TypeUUID, 0, 24},
+		{free, 1<<32 - 9, 8},
+		{free, 1<<32 - 8, 16},
+		{TypeUUID, 1<<32 - 24, 32},
+	} {
+		if got := headerSize(tt.typ, tt.n); got != tt.want {
+			t.Errorf("headerSize(%q, %d) = %d; want %d", tt.typ, tt.n, got, tt.want)
+		}
+	}
+}
+
+func TestMarshalLargeSize(t *testing.T) {
+	e := &encoder{buf: []byte("data")}
+	enc, err := e.finish(BoxType{'m', 'd', 'a', 't'})
+	if err != nil {
+		t.Fatal(err)
+	}
+	// Check the reader handles a largesize header as produced for
+	// big boxes, using a small one.
+	large := append([]byte{0, 0, 0, 1, 'm', 'd', 'a', 't', 0, 0, 0, 0, 0, 0, 0, 20}, "data"...)
+	b, err := NewReader(bytes.NewReader(large)).ReadBox()
+	if err != nil {
+		t.Fatal(err)
+	}
+	got, err := b.Marshal()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(got, enc) {
+		t.Errorf("largesize box marshaled to % x; want % x", got, enc)
+	}
+}
+
+// Marshaling a box encodes the current fields of its parsed
+// descendants.
+func TestMarshalModified(t *testing.T) {
+	data, err := ioutil.ReadFile("../testdata/rotate.heic")
+	if err != nil {
+		t.Fatal(err)
+	}
+	br := NewReader(bytes.NewReader(data))
+	if _, err := br.ReadAndParseBox(TypeFtyp); err != nil {
+		t.Fatal(err)
+	}
+	b, err := br.ReadAndParseBox(TypeMeta)
+	if err != nil {
+		t.Fatal(err)
+	}
+	parseAll(t, b)
+	var rotations []*ImageRotation
+	for _, c := range b.(*MetaBox).Children {
+		pb, _ := c.Parse()
+		if ip, ok := pb.(*ItemPropertiesBox); ok {
+			for _, p := range ip.PropertyContainer.Properties {
+				if pp, _ := p.Parse(); pp != nil {
+					if ir, ok := pp.(*ImageRotation); ok {
+						rotations = append(rotations, ir)
+					}
+				}
+			}
+		}
+	}
+	if len(rotations) == 0 {
+		t.Fatal("no irot properties found")
+	}
+	for _, ir := range rotations {
+		ir.Angle = 2
+	}
+	enc, err := b.Marshal()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, want := bytes.Count(enc, []byte("irot\x02")), len(rotations); got != want {
+		t.Errorf("found %d irot boxes with angle 2; want %d", got, want)
+	}
+}
@@ -0,0 +1,448 @@
+/*
+Copyright 2026 The go4 Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+     http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package bmff
+
+// This file has the parsers for the track structure of image
+// sequences and movies: the "moov" box and its descendants,
+// including QuickTime user data.
+
+import (
+	"errors"
+	"io"
+	"time"
+)
+
+func init() {
+	for typ, fn := range map[string]parserFunc{
+		"co64": parseChunkOffsetBox,
+		"mdhd": parseMediaHeaderBox,
+		"mdia": parseContainerBox,
+		"minf": parseContainerBox,
+		"moov": parseContainerBox,
+		"mvhd": parseMovieHeaderBox,
+		"stbl": parseContainerBox,
+		"stco": parseChunkOffsetBox,
+		"stsc": parseSampleToChunkBox,
+		"stsd": parseSampleDescriptionBox,
+		"stsz": parseSampleSizeBox,
+		"stts": parseTimeToSampleBox,
+		"tkhd": parseTrackHeaderBox,
+		"trak": parseContainerBox,
+		"udta": parseContainerBox,
+
+		"\xa9xyz": parseUserDataText,
+	} {
+		parsers[boxType(typ)] = fn
+	}
+	for typ := range visualSampleEntryTypes {
+		parsers[typ] = parseVisualSampleEntry
+	}
+}
+
+// visualSampleEntryTypes are the sample entry types parsed as a
+// VisualSampleEntry.
+var visualSampleEntryTypes = map[BoxType]bool{
+	boxType("av01"): true,
+	boxType("avc1"): true,
+	boxType("avc3"): true,
+	boxType("hev1"): true,
+	boxType("hvc1"): true,
+	boxType("jpeg"): true,
+	boxType("mp4v"): true,
+}
+
+// ContainerBox is a box whose contents are only other boxes, such as
+// "moov", "trak", "mdia", "minf", "stbl" and "udta".
+type ContainerBox struct {
+	*box
+	Children []Box
+}
+
+func parseContainerBox(gen *box, br *bufReader) (Box, error) {
+	cb := &ContainerBox{box: gen}
+	return cb, br.parseAppendBoxes(&cb.Children)
+}
+
+// Child returns the parsed first child of type typ of parent, a
+// ContainerBox or SampleDescriptionBox, or nil if parent has no such
+// child or is of another type.
+func Child(parent Box, typ string) (Box, error) {
+	var children []Box
+	switch p := parent.(type) {
+	case *ContainerBox:
+		children = p.Children
+	case *SampleDescriptionBox:
+		children = p.Children
+	default:
+		return nil, nil
+	}
+	for _, c := range children {
+		if c.Type().EqualString(typ) {
+			return c.Parse()
+		}
+	}
+	return nil, nil
+}
+
+// Duration returns d units of timescale, as found in movie, track and
+// media headers, as a time.Duration. It returns 0 if timescale is 0.
+func Duration(d uint64, timescale uint32) time.Duration {
+	if timescale == 0 {
+		return 0
+	}
+	sec := d / uint64(timescale)
+	rem := d % uint64(timescale)
+	return time.Duration(sec)*time.Second + time.Duration(rem)*time.Second/time.Duration(timescale)
+}
+
+// readVersioned reads a field that is 64 bits in version 1 boxes
+// and 32 bits in version 0 boxes.
+func (br *bufReader) readVersioned(version uint8) uint64 {
+	if version == 1 {
+		v, _ := br.readUintN(64)
+		return v
+	}
+	v, _ := br.readUint32()
+	return uint64(v)
+}
+
+// MovieHeaderBox is an "mvhd" box.
+type MovieHeaderBox struct {
+	FullBox
+	CreationTime     uint64 // seconds since 1904-01-01 UTC
+	ModificationTime uint64 // seconds since 1904-01-01 UTC
+	Timescale        uint32 // units per second
+	Duration         uint64 // in Timescale units
+	Rate             int32  // 16.16 fixed point; 1.0 is normal playback
+	Volume           int16  // 8.8 fixed point; 1.0 is full volume
+	Matrix           [9]int32
+	NextTrackID      uint32
+}
+
+func parseMovieHeaderBox(gen *box, br *bufReader) (Box, error) {
+	fb, err := readFullBox(gen, br)
+	if err != nil {
+		return nil, err
+	}
+	mh := &MovieHeaderBox{FullBox: fb}
+	mh.CreationTime = br.readVersioned(fb.Version)
+	mh.ModificationTime = br.readVersioned(fb.Version)
+	mh.Timescale, _ = br.readUint32()
+	mh.Duration = br.readVersioned(fb.Version)
+	rate, _ := br.readUint32()
+	mh.Rate = int32(rate)
+	vol, _ := br.readUint16()
+	mh.Volume = int16(vol)
+	br.readUintN(16) // reserved
+	br.readUintN(64) // reserved
+	for i := range mh.Matrix {
+		v, _ := br.readUint32()
+		mh.Matrix[i] = int32(v)
+	}
+	for i := 0; i < 6; i++ {
+		br.readUint32() // pre_defined
+	}
+	mh.NextTrackID, _ = br.readUint32()
+	if !br.ok() {
+		return nil, br.err
+	}
+	return mh, nil
+}
+
+// TrackHeaderBox is a "tkhd" box. Its flags include 1 if the track is
+// enabled, 2 if it's used in the presentation, and 4 if it's used in
+// previews.
+type TrackHeaderBox struct {
+	FullBox
+	CreationTime     uint64 // seconds since 1904-01-01 UTC
+	ModificationTime uint64 // seconds since 1904-01-01 UTC
+	TrackID          uint32
+	Duration         uint64 // in the timescale of the MovieHeaderBox
+	Layer            int16
+	AlternateGroup   int16
+	Volume           int16 // 8.8 fixed point
+	Matrix           [9]int32
+	Width, Height    uint32 // 16.16 fixed point
+}
+
+func parseTrackHeaderBox(gen *box, br *bufReader) (Box, error) {
+	fb, err := readFullBox(gen, br)
+	if err != nil {
+		return nil, err
+	}
+	th := &TrackHeaderBox{FullBox: fb}
+	th.CreationTime = br.readVersioned(fb.Version)
+	th.ModificationTime = br.readVersioned(fb.Version)
+	th.TrackID, _ = br.readUint32()
+	br.readUint32() // reserved
+	th.Duration = br.readVersioned(fb.Version)
+	br.readUintN(64) // reserved
+	for _, dst := range []*int16{&th.Layer, &th.AlternateGroup, &th.Volume} {
+		v, _ := br.readUint16()
+		*dst = int16(v)
+	}
+	br.readUint16() // reserved
+	for i := range th.Matrix {
+		v, _ := br.readUint32()
+		th.Matrix[i] = int32(v)
+	}
+	th.Width, _ = br.readUint32()
+	th.Height, _ = br.readUint32()
+	if !br.ok() {
+		return nil, br.err
+	}
+	return th, nil
+}
+
+// MediaHeaderBox is an "mdhd" box.
+type MediaHeaderBox struct {
+	FullBox
+	CreationTime     uint64 // seconds since 1904-01-01 UTC
+	ModificationTime uint64 // seconds since 1904-01-01 UTC
+	Timescale        uint32 // units per second of the track's sample times
+	Duration         uint64 // in Timescale units
+	Language         string // ISO 639-2/T code, such as "und"
+}
+
+func parseMediaHeaderBox(gen *box, br *bufReader) (Box, error) {
+	fb, err := readFullBox(gen, br)
+	if err != nil {
+		return nil, err
+	}
+	mh := &MediaHeaderBox{FullBox: fb}
+	mh.CreationTime = br.readVersioned(fb.Version)
+	mh.ModificationTime = br.readVersioned(fb.Version)
+	mh.Timescale, _ = br.readUint32()
+	mh.Duration = br.readVersioned(fb.Version)
+	lang, _ := br.readUint16()
+	if !br.ok() {
+		return nil, br.err
+	}
+	// Three 5-bit letters, each offset from 0x60.
+	mh.Language = string([]byte{
+		byte(lang>>10&31) + 0x60,
+		byte(lang>>5&31) + 0x60,
+		byte(lang&31) + 0x60,
+	})
+	return mh, nil
+}
+
+// SampleDescriptionBox is an "stsd" box. Its children are sample
+// entries, such as a VisualSampleEntry, describing the coding of the
+// track's samples.
+type SampleDescriptionBox struct {
+	FullBox
+	EntryCount uint32
+	Children   []Box
+}
+
+func parseSampleDescriptionBox(gen *box, br *bufReader) (Box, error) {
+	fb, err := readFullBox(gen, br)
+	if err != nil {
+		return nil, err
+	}
+	sd := &SampleDescriptionBox{FullBox: fb}
+	sd.EntryCount, _ = br.readUint32()
+	return sd, br.parseAppendBoxes(&sd.Children)
+}
+
+// VisualSampleEntry is the sample entry of a visual track, such as an
+// "hvc1" (HEVC) or "av01" (AV1) box in an "stsd" box. Its children
+// include the codec configuration, such as an HEVCConfigurationBox.
+type VisualSampleEntry struct {
+	*box
+	DataReferenceIndex uint16
+	Width, Height      uint16
+	CompressorName     string
+	Depth              uint16
+	Children           []Box
+}
+
+func parseVisualSampleEntry(gen *box, br *bufReader) (Box, error) {
+	buf, err := br.Peek(78)
+	if err != nil {
+		return nil, err
+	}
+	ve := &VisualSampleEntry{
+		box:                gen,
+		DataReferenceIndex: uint16(buf[6])<<8 | uint16(buf[7]),
+		Width:              uint16(buf[24])<<8 | uint16(buf[25]),
+		Height:             uint16(buf[26])<<8 | uint16(buf[27]),
+		Depth:              uint16(buf[74])<<8 | uint16(buf[75]),
+	}
+	// compressorname is a Pascal string in 32 bytes.
+	if n := int(buf[42]); n < 32 {
+		ve.CompressorName = string(buf[43 : 43+n])
+	}
+	br.Discard(78)
+	return ve, br.parseAppendBoxes(&ve.Children)
+}
+
+// TimeToSampleBox is an "stts" box, giving the decoding time deltas
+// of a track's samples as a run-length encoded table.
+type TimeToSampleBox struct {
+	FullBox
+	Entries []TimeToSampleEntry
+}
+
+// not a box
+type TimeToSampleEntry struct {
+	SampleCount uint32
+	SampleDelta uint32 // in the media's timescale
+}
+
+func parseTimeToSampleBox(gen *box, br *bufReader) (Box, error) {
+	fb, err := readFullBox(gen, br)
+	if err != nil {
+		return nil, err
+	}
+	ts := &TimeToSampleBox{FullBox: fb}
+	n, _ := br.readUint32()
+	for i := uint64(0); i < uint64(n) && br.entries(i); i++ {
+		var e TimeToSampleEntry
+		e.SampleCount, _ = br.readUint32()
+		e.SampleDelta, _ = br.readUint32()
+		if br.ok() {
+			ts.Entries = append(ts.Entries, e)
+		}
+	}
+	if !br.ok() {
+		return nil, br.err
+	}
+	return ts, nil
+}
+
+// SampleSizeBox is an "stsz" box, giving the size of each sample of a
+// track.
+type SampleSizeBox struct {
+	FullBox
+	SampleSize  uint32   // if non-zero, the size of all samples
+	SampleCount uint32   // as declared
+	Sizes       []uint32 // if SampleSize is zero
+}
+
+func parseSampleSizeBox(gen *box, br *bufReader) (Box, error) {
+	fb, err := readFullBox(gen, br)
+	if err != nil {
+		return nil, err
+	}
+	ss := &SampleSizeBox{FullBox: fb}
+	ss.SampleSize, _ = br.readUint32()
+	ss.SampleCount, _ = br.readUint32()
+	if ss.SampleSize == 0 {
+		for i := uint64(0); i < uint64(ss.SampleCount) && br.entries(i); i++ {
+			if v, err := br.readUint32(); err == nil {
+				ss.Sizes = append(ss.Sizes, v)
+			}
+		}
+	}
+	if !br.ok() {
+		return nil, br.err
+	}
+	return ss, nil
+}
+
+// ChunkOffsetBox is an "stco" or "co64" box, giving the file offsets
+// of a track's chunks.
+type ChunkOffsetBox struct {
+	FullBox
+	Offsets []uint64
+}
+
+func parseChunkOffsetBox(gen *box, br *bufReader) (Box, error) {
+	fb, err := readFullBox(gen, br)
+	if err != nil {
+		return nil, err
+	}
+	co := &ChunkOffsetBox{FullBox: fb}
+	bits := uint8(32)
+	if gen.Type().EqualString("co64") {
+		bits = 64
+	}
+	n, _ := br.readUint32()
+	for i := uint64(0); i < uint64(n) && br.entries(i); i++ {
+		if v, err := br.readUintN(bits); err == nil {
+			co.Offsets = append(co.Offsets, v)
+		}
+	}
+	if !br.ok() {
+		return nil, br.err
+	}
+	return co, nil
+}
+
+// SampleToChunkBox is an "stsc" box, giving the number of samples in
+// each chunk of a track as a run-length encoded table.
+type SampleToChunkBox struct {
+	FullBox
+	Entries []SampleToChunkEntry
+}
+
+// not a box
+type SampleToChunkEntry struct {
+	FirstChunk             uint32 // 1-based
+	SamplesPerChunk        uint32
+	SampleDescriptionIndex uint32 // 1-based
+}
+
+func parseSampleToChunkBox(gen *box, br *bufReader) (Box, error) {
+	fb, err := readFullBox(gen, br)
+	if err != nil {
+		return nil, err
+	}
+	sc := &SampleToChunkBox{FullBox: fb}
+	n, _ := br.readUint32()
+	for i := uint64(0); i < uint64(n) && br.entries(i); i++ {
+		var e SampleToChunkEntry
+		e.FirstChunk, _ = br.readUint32()
+		e.SamplesPerChunk, _ = br.readUint32()
+		e.SampleDescriptionIndex, _ = br.readUint32()
+		if br.ok() {
+			if e.FirstChunk == 0 || (len(sc.Entries) > 0 && e.FirstChunk <= sc.Entries[len(sc.Entries)-1].FirstChunk) {
+				return nil, errors.New("stsc box has unordered chunks")
+			}
+			sc.Entries = append(sc.Entries, e)
+		}
+	}
+	if !br.ok() {
+		return nil, br.err
+	}
+	return sc, nil
+}
+
+// UserDataText is a QuickTime user data text box in a "udta" box,
+// such as "\xa9xyz", which holds an ISO 6709 location string.
+type UserDataText struct {
+	*box
+	Language uint16 // packed ISO 639-2/T code, or a Macintosh language code
+	Text     string
+}
+
+func parseUserDataText(gen *box, br *bufReader) (Box, error) {
+	ut := &UserDataText{box: gen}
+	n, _ := br.readUint16()
+	ut.Language, _ = br.readUint16()
+	if !br.ok() {
+		return nil, br.err
+	}
+	buf := make([]byte, n)
+	if _, err := io.ReadFull(br, buf); err != nil {
+		return nil, err
+	}
+	ut.Text = string(buf)
+	return ut, nil
+}
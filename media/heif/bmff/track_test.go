@@ -0,0 +1,68 @@
+/*
+Copyright 2026 The go4 Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+     http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package bmff
+
+import (
+	"testing"
+	"time"
+)
+
+func TestChild(t *testing.T) {
+	traks, err := openTree(t, "../testdata/sequence.heic").FindAll("moov/trak")
+	if err != nil || len(traks) == 0 {
+		t.Fatalf("FindAll = %v, %v", traks, err)
+	}
+	trak, err := traks[0].Parse()
+	if err != nil {
+		t.Fatal(err)
+	}
+	mdia, err := Child(trak, "mdia")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := mdia.(*ContainerBox); !ok {
+		t.Errorf("Child(trak, mdia) = %T; want *ContainerBox", mdia)
+	}
+	for _, parent := range []Box{trak, mdia, nil} {
+		if b, err := Child(parent, "none"); b != nil || err != nil {
+			t.Errorf("Child(%v, none) = %v, %v; want nil, nil", parent, b, err)
+		}
+	}
+	if b, err := Child(mdia, "tkhd"); b != nil || err != nil {
+		t.Errorf("Child(mdia, tkhd) = %v, %v; want nil, nil", b, err)
+	}
+}
+
+func TestDuration(t *testing.T) {
+	tests := []struct {
+		d         uint64
+		timescale uint32
+		want      time.Duration
+	}{
+		{0, 30, 0},
+		{1200, 600, 2 * time.Second},
+		{1, 30, 33333333},
+		{45, 30, 1500 * time.Millisecond},
+		{1 << 40, 90000, 12216795864177777},
+		{100, 0, 0},
+	}
+	for _, tt := range tests {
+		if got := Duration(tt.d, tt.timescale); got != tt.want {
+			t.Errorf("Duration(%d, %d) = %v; want %v", tt.d, tt.timescale, got, tt.want)
+		}
+	}
+}
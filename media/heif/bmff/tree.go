@@ -0,0 +1,365 @@
+/*
+Copyright 2026 The go4 Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+     http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package bmff
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"strings"
+)
+
+// Tree is an index of the boxes of a file, read with random access.
+//
+// Unlike a Reader, a Tree reads only the headers of the boxes it
+// passes over, so boxes after a large "mdat" box are found without
+// reading the media data. Children are indexed when first requested.
+//
+// A Tree is not safe for concurrent use.
+type Tree struct {
+	ra   io.ReaderAt
+	size int64 // or -1 if unknown
+	st   *parseState
+
+	top     []*Node
+	topErr  error
+	topDone bool
+}
+
+// NewTree returns a Tree of the boxes in ra, which holds size bytes.
+// If size is negative, the size of ra is unknown and its top-level
+// boxes are read until the end of ra.
+func NewTree(ra io.ReaderAt, size int64) *Tree {
+	if size < 0 {
+		size = -1
+	}
+	return &Tree{ra: ra, size: size, st: newParseState(Limits{})}
+}
+
+// SetLimits sets the limits on the boxes indexed and parsed by t. It
+// should be called before t is first used.
+func (t *Tree) SetLimits(l Limits) {
+	t.st = newParseState(l)
+}
+
+// Node is a box in a Tree.
+type Node struct {
+	Type     BoxType
+	UserType [16]byte // for "uuid" boxes
+
+	// Offset is the position of the box's header in the file.
+	Offset int64
+
+	// Size is the size of the box, including its header. It's -1
+	// for a final box extending to the end of a file of unknown size.
+	Size int64
+
+	t        *Tree
+	parent   *Node // or nil for top-level boxes
+	depth    int   // 0 for top-level boxes
+	bodyOff  int64 // offset of the body in the file
+	children []*Node
+	indexed  bool  // children is populated
+	childErr error // from indexing children
+	parsed   Box   // if non-nil, the result of Parse
+}
+
+// Boxes returns the top-level boxes of the file.
+func (t *Tree) Boxes() ([]*Node, error) {
+	if !t.topDone {
+		t.top, t.topErr = t.index(nil, 0, t.size)
+		t.topDone = true
+	}
+	return t.top, t.topErr
+}
+
+// index returns the boxes from off to end, the children of parent,
+// or the top-level boxes if parent is nil. If end is -1, the boxes
+// extend to the end of the file.
+func (t *Tree) index(parent *Node, off, end int64) ([]*Node, error) {
+	var nodes []*Node
+	for end == -1 || off < end {
+		n, err := t.readHeader(off, end, parent == nil)
+		if err == io.EOF && end == -1 {
+			return nodes, nil
+		}
+		if err != nil {
+			return nodes, err
+		}
+		n.parent = parent
+		if parent != nil {
+			n.depth = parent.depth + 1
+		}
+		if err := t.st.addBox(n.depth); err != nil {
+			return nodes, fmt.Errorf("bmff: %q box at offset %d: %w", n.Type, n.Offset, err)
+		}
+		nodes = append(nodes, n)
+		if n.Size == -1 {
+			break
+		}
+		off += n.Size
+	}
+	return nodes, nil
+}
+
+// readHeader reads the header of the box at off, which must end by
+// end, unless end is -1 or the box is a top-level one.
+func (t *Tree) readHeader(off, end int64, top bool) (*Node, error) {
+	var hdr [32]byte
+	nr, err := t.ra.ReadAt(hdr[:8], off)
+	if nr == 0 && err == io.EOF {
+		return nil, io.EOF
+	}
+	if nr < 8 {
+		return nil, fmt.Errorf("bmff: short box header at offset %d", off)
+	}
+	n := &Node{t: t, Offset: off}
+	copy(n.Type[:], hdr[4:8])
+	hlen := int64(8)
+	size := int64(binary.BigEndian.Uint32(hdr[:4]))
+	if size == 1 {
+		if _, err := t.ra.ReadAt(hdr[8:16], off+8); err != nil {
+			return nil, fmt.Errorf("bmff: short box header at offset %d", off)
+		}
+		hlen += 8
+		size = int64(binary.BigEndian.Uint64(hdr[8:16]))
+	}
+	if n.Type == TypeUUID {
+		if _, err := t.ra.ReadAt(n.UserType[:], off+hlen); err != nil {
+			return nil, fmt.Errorf("bmff: short uuid box header at offset %d", off)
+		}
+		hlen += 16
+	}
+	n.bodyOff = off + hlen
+	switch {
+	case size == 0 && end == -1:
+		// A final box extending to the end of a file of
+		// unknown size.
+		n.Size = -1
+		return n, nil
+	case size == 0:
+		size = end - off
+	}
+	if size < hlen || off+size < off {
+		return nil, fmt.Errorf("bmff: invalid size of %q box at offset %d", n.Type, off)
+	}
+	// Top-level boxes may extend past the end of truncated files,
+	// but children must fit in their parent.
+	if !top && end != -1 && off+size > end {
+		return nil, fmt.Errorf("bmff: %q box at offset %d extends past its parent", n.Type, off)
+	}
+	n.Size = size
+	return n, nil
+}
+
+// Find returns the first box at path, a slash-separated list of box
+// types such as "meta/iprp/ipco", or nil if there is none.
+func (t *Tree) Find(path string) (*Node, error) {
+	nodes, err := t.findAll(nil, path, true)
+	if err != nil || len(nodes) == 0 {
+		return nil, err
+	}
+	return nodes[0], nil
+}
+
+// FindAll returns all the boxes at path, a slash-separated list of
+// box types such as "moov/trak", in file order.
+func (t *Tree) FindAll(path string) ([]*Node, error) {
+	return t.findAll(nil, path, false)
+}
+
+// Find returns the first descendant of n at path, relative to n, or
+// nil if there is none.
+func (n *Node) Find(path string) (*Node, error) {
+	nodes, err := n.t.findAll(n, path, true)
+	if err != nil || len(nodes) == 0 {
+		return nil, err
+	}
+	return nodes[0], nil
+}
+
+// findAll returns the boxes at path relative to from, or relative to
+// the top level if from is nil. If first, it stops at the first match.
+func (t *Tree) findAll(from *Node, path string, first bool) ([]*Node, error) {
+	if path == "" {
+		return nil, errors.New("bmff: empty box path")
+	}
+	var cur []*Node
+	var err error
+	if from == nil {
+		cur, err = t.Boxes()
+	} else {
+		cur, err = from.Children()
+	}
+	if err != nil {
+		return nil, err
+	}
+	elems := strings.Split(path, "/")
+	for i, elem := range elems {
+		var matches []*Node
+		for _, n := range cur {
+			if !n.Type.EqualString(elem) {
+				continue
+			}
+			if i == len(elems)-1 {
+				matches = append(matches, n)
+				if first {
+					return matches, nil
+				}
+				continue
+			}
+			children, err := n.Children()
+			if err != nil {
+				return nil, err
+			}
+			matches = append(matches, children...)
+		}
+		cur = matches
+	}
+	return cur, nil
+}
+
+// Parent returns the box containing n, or nil if n is a top-level box.
+func (n *Node) Parent() *Node { return n.parent }
+
+// Path returns the slash-separated types of n and its ancestors, such
+// as "meta/iprp/ipco".
+func (n *Node) Path() string {
+	if n.parent == nil {
+		return n.Type.String()
+	}
+	return n.parent.Path() + "/" + n.Type.String()
+}
+
+// bodySize returns the size of n's body, or -1 if it's unknown.
+func (n *Node) bodySize() int64 {
+	if n.Size == -1 {
+		return -1
+	}
+	return n.Offset + n.Size - n.bodyOff
+}
+
+// Body returns a reader of the box's body, which excludes its header.
+func (n *Node) Body() *io.SectionReader {
+	size := n.bodySize()
+	if size == -1 {
+		size = 1<<63 - 1 - n.bodyOff
+	}
+	return io.NewSectionReader(n.t.ra, n.bodyOff, size)
+}
+
+// Box reads the box's body into memory and returns it as an unparsed
+// Box. Use Body to read large boxes, such as "mdat", incrementally.
+func (n *Node) Box() (Box, error) {
+	if err := n.t.st.checkSize(n.Type, n.Size); err != nil {
+		return nil, &ParseError{Type: n.Type, Err: err}
+	}
+	body, err := ioutil.ReadAll(io.LimitReader(n.Body(), n.t.st.lim.MaxBoxSize+1))
+	if err == nil && int64(len(body)) > n.t.st.lim.MaxBoxSize {
+		err = &ParseError{Type: n.Type, Err: n.t.st.checkSize(n.Type, int64(len(body)))}
+	}
+	if err != nil {
+		return nil, err
+	}
+	size := n.Size
+	if size == -1 {
+		size = 0
+	}
+	return &box{size: size, boxType: n.Type, userType: n.UserType, slurp: body, st: n.t.st, depth: n.depth}, nil
+}
+
+// Parse reads and parses the box. The result is cached.
+func (n *Node) Parse() (Box, error) {
+	if n.parsed != nil {
+		return n.parsed, nil
+	}
+	b, err := n.Box()
+	if err != nil {
+		return nil, err
+	}
+	pb, err := b.Parse()
+	if err != nil {
+		return nil, err
+	}
+	n.parsed = pb
+	return pb, nil
+}
+
+// Children returns the boxes contained in n, reading their headers
+// on the first call. Boxes with no known children, such as "mdat"
+// boxes, have none. If a child's header is malformed, Children returns
+// the children before it along with the error.
+func (n *Node) Children() ([]*Node, error) {
+	if n.indexed {
+		return n.children, n.childErr
+	}
+	skip, ok, err := n.childOffset()
+	if err != nil {
+		return nil, err
+	}
+	if ok {
+		end := int64(-1)
+		if n.Size != -1 {
+			end = n.Offset + n.Size
+		}
+		n.children, n.childErr = n.t.index(n, n.bodyOff+skip, end)
+	}
+	n.indexed = true
+	return n.children, n.childErr
+}
+
+// childOffset returns the offset of n's first child from the start of
+// its body, and whether n is a box type with children at all.
+func (n *Node) childOffset() (skip int64, ok bool, err error) {
+	switch n.Type.String() {
+	case "moov", "trak", "mdia", "minf", "stbl", "udta", "edts",
+		"dinf", "iprp", "ipco", "mvex", "moof", "traf":
+		return 0, true, nil
+	case "iref":
+		return 4, true, nil
+	case "dref", "stsd":
+		return 8, true, nil
+	case "meta":
+		// QuickTime "meta" boxes lack the FullBox header, so
+		// their first child's "hdlr" type is at offset 4.
+		var buf [8]byte
+		if _, err := n.t.ra.ReadAt(buf[:], n.bodyOff); err != nil {
+			return 0, false, fmt.Errorf("bmff: reading meta box at offset %d: %v", n.Offset, err)
+		}
+		if string(buf[4:8]) == "hdlr" {
+			return 0, true, nil
+		}
+		return 4, true, nil
+	case "iinf":
+		// The FullBox header is followed by a 16-bit entry count in
+		// version 0 and a 32-bit one otherwise.
+		var version [1]byte
+		if _, err := n.t.ra.ReadAt(version[:], n.bodyOff); err != nil {
+			return 0, false, fmt.Errorf("bmff: reading iinf box at offset %d: %v", n.Offset, err)
+		}
+		if version[0] == 0 {
+			return 6, true, nil
+		}
+		return 8, true, nil
+	}
+	if visualSampleEntryTypes[n.Type] {
+		return 78, true, nil
+	}
+	return 0, false, nil
+}
@@ -0,0 +1,229 @@
+/*
+Copyright 2026 The go4 Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+     http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package bmff
+
+import (
+	"bytes"
+	"io/ioutil"
+	"os"
+	"testing"
+)
+
+func openTree(t *testing.T, name string) *Tree {
+	t.Helper()
+	data, err := ioutil.ReadFile(name)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return NewTree(bytes.NewReader(data), int64(len(data)))
+}
+
+func TestTreeFind(t *testing.T) {
+	tree := openTree(t, "../testdata/park.heic")
+	top, err := tree.Boxes()
+	if err != nil {
+		t.Fatal(err)
+	}
+	var types []string
+	for _, n := range top {
+		types = append(types, n.Type.String())
+	}
+	if got, want := types, []string{"ftyp", "meta", "mdat"}; !equalStrings(got, want) {
+		t.Errorf("top-level boxes = %q; want %q", got, want)
+	}
+
+	ipco, err := tree.Find("meta/iprp/ipco")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if ipco == nil {
+		t.Fatal("meta/iprp/ipco not found")
+	}
+	if got := ipco.Path(); got != "meta/iprp/ipco" {
+		t.Errorf("Path = %q", got)
+	}
+	if ipco.Parent() == nil || ipco.Parent().Type.String() != "iprp" {
+		t.Errorf("Parent = %v; want the iprp box", ipco.Parent())
+	}
+	pb, err := ipco.Parse()
+	if err != nil {
+		t.Fatal(err)
+	}
+	props := pb.(*ItemPropertyContainerBox).Properties
+	children, err := ipco.Children()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(children) != len(props) {
+		t.Fatalf("ipco has %d children; parsed %d properties", len(children), len(props))
+	}
+	for i, c := range children {
+		if c.Type != props[i].Type() || c.Size != props[i].Size() {
+			t.Errorf("child %d = %q of size %d; want %q of size %d", i, c.Type, c.Size, props[i].Type(), props[i].Size())
+		}
+	}
+
+	infes, err := tree.FindAll("meta/iinf/infe")
+	if err != nil {
+		t.Fatal(err)
+	}
+	iinf, err := tree.Find("meta/iinf")
+	if err != nil {
+		t.Fatal(err)
+	}
+	pb, err = iinf.Parse()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := len(pb.(*ItemInfoBox).ItemInfos); len(infes) != want {
+		t.Errorf("found %d infe boxes; want %d", len(infes), want)
+	}
+	pb, err = infes[len(infes)-1].Parse()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if ie := pb.(*ItemInfoEntry); ie.ItemType != "mime" {
+		t.Errorf("last item type = %q; want mime", ie.ItemType)
+	}
+
+	if n, err := tree.Find("meta/nope"); n != nil || err != nil {
+		t.Errorf("Find of missing box = %v, %v; want nil, nil", n, err)
+	}
+	mdat, err := tree.Find("mdat")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if children, err := mdat.Children(); len(children) != 0 || err != nil {
+		t.Errorf("mdat children = %v, %v; want none", children, err)
+	}
+}
+
+func TestTreeTracks(t *testing.T) {
+	tree := openTree(t, "../testdata/sequence.heic")
+	traks, err := tree.FindAll("moov/trak")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(traks) != 2 {
+		t.Fatalf("found %d tracks; want 2", len(traks))
+	}
+	hvcC, err := traks[0].Find("mdia/minf/stbl/stsd/hvc1/hvcC")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if hvcC == nil {
+		t.Fatal("hvcC not found in first track")
+	}
+	if _, err := hvcC.Parse(); err != nil {
+		t.Errorf("parsing hvcC: %v", err)
+	}
+	all, err := tree.FindAll("moov/trak/mdia/minf/stbl/stsd")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(all) != 2 {
+		t.Errorf("found %d stsd boxes; want 2", len(all))
+	}
+}
+
+// countingReaderAt is an io.ReaderAt counting the bytes read.
+type countingReaderAt struct {
+	*bytes.Reader
+	n int
+}
+
+func (r *countingReaderAt) ReadAt(p []byte, off int64) (int, error) {
+	n, err := r.Reader.ReadAt(p, off)
+	r.n += n
+	return n, err
+}
+
+func TestTreeSkipsMdat(t *testing.T) {
+	pitm, err := (&PrimaryItemBox{ItemID: 7}).Marshal()
+	if err != nil {
+		t.Fatal(err)
+	}
+	data := bytes.Join([][]byte{
+		testBox("ftyp", []byte("heic\x00\x00\x00\x00")),
+		testBox("mdat", make([]byte, 8<<20)),
+		testBox("meta", make([]byte, 4), pitm),
+	}, nil)
+	for _, size := range []int64{int64(len(data)), -1} {
+		r := &countingReaderAt{Reader: bytes.NewReader(data)}
+		n, err := NewTree(r, size).Find("meta/pitm")
+		if err != nil {
+			t.Fatal(err)
+		}
+		pb, err := n.Parse()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if id := pb.(*PrimaryItemBox).ItemID; id != 7 {
+			t.Errorf("primary item = %d; want 7", id)
+		}
+		if r.n > 1<<10 {
+			t.Errorf("with size %d, read %d bytes; want the mdat box skipped", size, r.n)
+		}
+	}
+}
+
+func TestTreeErrors(t *testing.T) {
+	data := testBox("moov", testBox("trak", make([]byte, 4)))
+	data[8+3] = 100 // trak's size exceeds moov's
+	tree := NewTree(bytes.NewReader(data), int64(len(data)))
+	if _, err := tree.Find("moov/trak"); err == nil {
+		t.Error("Find succeeded with a child larger than its parent")
+	}
+
+	// The children before a malformed one are still returned.
+	data = testBox("moov", testBox("mvhd"), testBox("trak", make([]byte, 4)))
+	data[16+3] = 100
+	tree = NewTree(bytes.NewReader(data), int64(len(data)))
+	moov, err := tree.Find("moov")
+	if err != nil {
+		t.Fatal(err)
+	}
+	children, err := moov.Children()
+	if err == nil || len(children) != 1 || !children[0].Type.EqualString("mvhd") {
+		t.Errorf("Children = %v, %v; want mvhd and an error", children, err)
+	}
+	if again, err2 := moov.Children(); len(again) != 1 || err2 == nil {
+		t.Errorf("second Children call = %v, %v", again, err2)
+	}
+
+	// Top-level boxes of truncated files are fine.
+	f, err := os.Open("../testdata/park.heic")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	if n, err := NewTree(f, -1).Find("mdat"); n == nil || err != nil {
+		t.Errorf("Find(mdat) in truncated file = %v, %v", n, err)
+	}
+}
+
+func equalStrings(a, b []string) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
@@ -16,6 +16,11 @@ limitations under the License.
 
 // The dumpheif program dumps the structure and metadata of a HEIF file.
 //
+// With -tree, it prints the hierarchy of boxes with their offsets and
+// sizes, continuing past malformed boxes. With -json, it writes the box
+// tree with the parsed fields of each box, the primary item and its
+// properties, and the decoded EXIF data as a JSON object.
+//
 // It exists purely for debugging the go4.org/media/heif and
 // go4.org/media/heif/bmff packages; it makes no backwards
 // compatibility promises.
@@ -39,14 +44,19 @@ import (
 )
 
 var (
-	exifItemID uint16
+	flagJSON = flag.Bool("json", false, "write the box tree, primary item and EXIF data as JSON")
+	flagTree = flag.Bool("tree", false, "print the box hierarchy with offsets and sizes")
+)
+
+var (
+	exifItemID uint32
 	exifLoc    bmff.ItemLocationBoxEntry
 )
 
 func main() {
 	flag.Parse()
-	if flag.NArg() != 1 {
-		fmt.Fprintf(os.Stderr, "usage: dumpheif <file>\n")
+	if flag.NArg() != 1 || *flagJSON && *flagTree {
+		fmt.Fprintf(os.Stderr, "usage: dumpheif [-json | -tree] <file>\n")
 		os.Exit(1)
 	}
 	f, err := os.Open(flag.Arg(0))
@@ -55,12 +65,48 @@ func main() {
 	}
 	defer f.Close()
 
+	switch {
+	case *flagTree:
+		fi, err := f.Stat()
+		if err != nil {
+			log.Fatal(err)
+		}
+		t := bmff.NewTree(f, fi.Size())
+		nodes, err := t.Boxes()
+		printTree(nodes, err, 0)
+		return
+	case *flagJSON:
+		if err := dumpJSON(os.Stdout, f); err != nil {
+			log.Fatal(err)
+		}
+		return
+	}
+
 	hf := heif.Open(f)
 
-	it, err := hf.PrimaryItem()
-	if err != nil {
-		log.Fatalf("PrimaryItem: %v", err)
+	if it, err := hf.PrimaryItem(); err != nil {
+		// Image sequences need not have a primary item.
+		fmt.Printf("no primary item: %v\n", err)
+	} else {
+		dumpPrimary(hf, it)
 	}
+
+	fmt.Printf("BMFF boxes:\n")
+	r := bmff.NewReader(f)
+	for {
+		box, err := r.ReadBox()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			log.Fatalf("ReadBox: %v", err)
+		}
+		dumpBox(box, 0)
+	}
+
+}
+
+func dumpPrimary(hf *heif.File, it *heif.Item) {
 	fmt.Printf("primary item: %v\n", it.ID)
 
 	width, height, ok := it.SpatialExtents()
@@ -87,20 +133,38 @@ func main() {
 		}))
 		fmt.Printf("\n")
 	}
+}
 
-	fmt.Printf("BMFF boxes:\n")
-	r := bmff.NewReader(f)
-	for {
-		box, err := r.ReadBox()
-		if err == io.EOF {
-			break
+// printTree prints nodes and their descendants, indented by depth.
+// Errors reading the boxes are printed where they occur.
+func printTree(nodes []*bmff.Node, err error, depth int) {
+	indent := strings.Repeat("    ", depth)
+	for _, n := range nodes {
+		size := fmt.Sprint(n.Size)
+		if n.Size == -1 {
+			size = "to EOF"
 		}
-		if err != nil {
-			log.Fatalf("ReadBox: %v", err)
+		if n.Type.EqualString("uuid") {
+			fmt.Printf("%s%s %x @%d, size %s\n", indent, typeString(n.Type), n.UserType, n.Offset, size)
+		} else {
+			fmt.Printf("%s%s @%d, size %s\n", indent, typeString(n.Type), n.Offset, size)
 		}
-		dumpBox(box, 0)
+		children, err := n.Children()
+		printTree(children, err, depth+1)
 	}
+	if err != nil {
+		fmt.Printf("%serror: %v\n", indent, err)
+	}
+}
 
+// typeString returns t as a string, reading its bytes as Latin-1 so
+// that QuickTime types such as "\xa9xyz" print as "©xyz".
+func typeString(t bmff.BoxType) string {
+	r := make([]rune, len(t))
+	for i, b := range t {
+		r[i] = rune(b)
+	}
+	return string(r)
 }
 
 type exifWalkFunc func(exif.FieldName, *tiff.Tag) error
@@ -167,6 +231,21 @@ func dumpBox(box bmff.Box, depth int) {
 				fmt.Printf("%s    index: %d, essential: %v\n", indent, ass.Index, ass.Essential)
 			}
 		}
+	case *bmff.ContainerBox:
+		fmt.Printf("%s- %T\n", indent, v)
+		for _, child := range v.Children {
+			dumpBox(child, depth+1)
+		}
+	case *bmff.SampleDescriptionBox:
+		fmt.Printf("%s- %T, %d entries\n", indent, v, v.EntryCount)
+		for _, child := range v.Children {
+			dumpBox(child, depth+1)
+		}
+	case *bmff.VisualSampleEntry:
+		fmt.Printf("%s- %T: %d x %d\n", indent, v, v.Width, v.Height)
+		for _, child := range v.Children {
+			dumpBox(child, depth+1)
+		}
 	case *bmff.DataInformationBox:
 		fmt.Printf("%s- %T\n", indent, v)
 		for _, child := range v.Children {
@@ -190,6 +269,20 @@ func dumpBox(box bmff.Box, depth int) {
 				exifLoc = lbe
 			}
 		}
+	case *bmff.ItemReferenceBox:
+		fmt.Printf("%s- %T: %d references:\n", indent, v, len(v.References))
+		for _, ref := range v.References {
+			fmt.Printf("%s  %q from item %d to items %v\n", indent, ref.Type, ref.FromItemID, ref.ToItemIDs)
+		}
+	case *bmff.ColorInformation:
+		if v.ICCProfile != nil {
+			fmt.Printf("%s- %T: %q, %d byte ICC profile\n", indent, v, v.ColorType, len(v.ICCProfile))
+		} else {
+			fmt.Printf("%s- %T: %q, primaries %d, transfer %d, matrix %d, full range %v\n", indent, v, v.ColorType,
+				v.ColorPrimaries, v.TransferCharacteristics, v.MatrixCoefficients, v.FullRange)
+		}
+	case *bmff.ItemDataBox:
+		fmt.Printf("%s- %T: %d bytes\n", indent, v, len(v.Data))
 
 	case *bmff.ImageSpatialExtentsProperty:
 		fmt.Printf("%s- %T  dimensions: %d x %d\n", indent, v, v.ImageWidth, v.ImageHeight)
@@ -0,0 +1,231 @@
+/*
+Copyright 2026 The go4 Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+     http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package main
+
+import (
+	"bytes"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"reflect"
+
+	"github.com/rwcarlsen/goexif/exif"
+	"github.com/rwcarlsen/goexif/tiff"
+
+	"go4.org/media/heif"
+	"go4.org/media/heif/bmff"
+)
+
+// jsonDump is the output of the -json mode.
+type jsonDump struct {
+	Boxes       []*jsonBox        `json:"boxes"`
+	BoxesError  string            `json:"boxesError,omitempty"`
+	PrimaryItem *jsonItem         `json:"primaryItem,omitempty"`
+	EXIF        map[string]string `json:"exif,omitempty"`
+	EXIFError   string            `json:"exifError,omitempty"`
+}
+
+type jsonBox struct {
+	Type     string      `json:"type"`
+	UserType string      `json:"userType,omitempty"`
+	Offset   int64       `json:"offset"`
+	Size     int64       `json:"size"` // -1 if to the end of the file
+	Fields   interface{} `json:"fields,omitempty"`
+	Error    string      `json:"error,omitempty"`
+	Children []*jsonBox  `json:"children,omitempty"`
+
+	// ChildrenError is the error reading the children, if any.
+	ChildrenError string `json:"childrenError,omitempty"`
+}
+
+type jsonItem struct {
+	ID         uint32          `json:"id"`
+	Type       string          `json:"type,omitempty"`
+	Width      int             `json:"width,omitempty"`
+	Height     int             `json:"height,omitempty"`
+	Properties []*jsonProperty `json:"properties"`
+	Error      string          `json:"error,omitempty"`
+}
+
+type jsonProperty struct {
+	Type   string      `json:"type"`
+	Fields interface{} `json:"fields,omitempty"`
+}
+
+// dumpJSON writes the JSON dump of the file f to w.
+func dumpJSON(w io.Writer, f *os.File) error {
+	fi, err := f.Stat()
+	if err != nil {
+		return err
+	}
+	var d jsonDump
+	nodes, err := bmff.NewTree(f, fi.Size()).Boxes()
+	d.Boxes = jsonBoxes(nodes)
+	if err != nil {
+		d.BoxesError = err.Error()
+	}
+
+	hf := heif.Open(f)
+	if it, err := hf.PrimaryItem(); err == nil {
+		d.PrimaryItem = newJSONItem(it)
+	}
+	if ex, err := hf.EXIF(); err == nil {
+		d.EXIF, err = exifFields(ex)
+		if err != nil {
+			d.EXIFError = err.Error()
+		}
+	}
+
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	return enc.Encode(d)
+}
+
+func jsonBoxes(nodes []*bmff.Node) []*jsonBox {
+	var boxes []*jsonBox
+	for _, n := range nodes {
+		jb := &jsonBox{
+			Type:   typeString(n.Type),
+			Offset: n.Offset,
+			Size:   n.Size,
+		}
+		if n.Type.EqualString("uuid") {
+			jb.UserType = hex.EncodeToString(n.UserType[:])
+		}
+		// Media data is neither parsed nor read into memory.
+		if !n.Type.EqualString("mdat") {
+			pb, err := n.Parse()
+			switch {
+			case err == bmff.ErrUnknownBox:
+			case err != nil:
+				jb.Error = err.Error()
+			default:
+				jb.Fields = jsonValue(reflect.ValueOf(pb))
+			}
+		}
+		children, err := n.Children()
+		jb.Children = jsonBoxes(children)
+		if err != nil {
+			jb.ChildrenError = err.Error()
+		}
+		boxes = append(boxes, jb)
+	}
+	return boxes
+}
+
+func newJSONItem(it *heif.Item) *jsonItem {
+	ji := &jsonItem{ID: it.ID, Properties: []*jsonProperty{}}
+	if it.Info != nil {
+		ji.Type = it.Info.ItemType
+	}
+	ji.Width, ji.Height, _ = it.SpatialExtents()
+	for _, prop := range it.Properties {
+		ji.Properties = append(ji.Properties, &jsonProperty{
+			Type:   typeString(prop.Type()),
+			Fields: jsonValue(reflect.ValueOf(prop)),
+		})
+	}
+	return ji
+}
+
+// exifFields decodes the raw EXIF data ex, returning the string
+// values of its fields by name.
+func exifFields(ex []byte) (map[string]string, error) {
+	x, err := exif.Decode(bytes.NewReader(ex))
+	if err != nil {
+		return nil, fmt.Errorf("EXIF decode: %v", err)
+	}
+	fields := map[string]string{}
+	err = x.Walk(exifWalkFunc(func(name exif.FieldName, tag *tiff.Tag) error {
+		fields[string(name)] = tag.String()
+		return nil
+	}))
+	return fields, err
+}
+
+var (
+	boxType      = reflect.TypeOf((*bmff.Box)(nil)).Elem()
+	boxTypeType  = reflect.TypeOf(bmff.BoxType{})
+	maxDumpBytes = 64
+)
+
+// jsonValue returns the exported fields of v, recursively, in a form
+// suitable for encoding/json. Boxes within v are omitted, as they're
+// in the dump's tree already. Box types are strings, and byte slices
+// are hex strings, truncated after maxDumpBytes bytes.
+func jsonValue(v reflect.Value) interface{} {
+	switch v.Kind() {
+	case reflect.Interface, reflect.Ptr:
+		if v.IsNil() {
+			return nil
+		}
+		return jsonValue(v.Elem())
+	case reflect.Struct:
+		m := map[string]interface{}{}
+		addFields(m, v)
+		return m
+	case reflect.Array, reflect.Slice:
+		if v.Type() == boxTypeType {
+			return typeString(v.Interface().(bmff.BoxType))
+		}
+		if v.Type().Elem().Kind() == reflect.Uint8 {
+			b := make([]byte, v.Len())
+			reflect.Copy(reflect.ValueOf(b), v)
+			if len(b) > maxDumpBytes {
+				return fmt.Sprintf("%x... (%d bytes)", b[:maxDumpBytes], len(b))
+			}
+			return hex.EncodeToString(b)
+		}
+		l := make([]interface{}, 0, v.Len())
+		for i := 0; i < v.Len(); i++ {
+			l = append(l, jsonValue(v.Index(i)))
+		}
+		return l
+	case reflect.Func, reflect.Chan:
+		return nil
+	}
+	return v.Interface()
+}
+
+// addFields adds the exported fields of the struct v to m, including
+// those of embedded structs, skipping boxes.
+func addFields(m map[string]interface{}, v reflect.Value) {
+	t := v.Type()
+	for i := 0; i < t.NumField(); i++ {
+		sf := t.Field(i)
+		fv := v.Field(i)
+		if sf.Anonymous && sf.Type.Kind() == reflect.Struct {
+			addFields(m, fv)
+			continue
+		}
+		if sf.PkgPath != "" || isBoxes(sf.Type) {
+			continue
+		}
+		m[sf.Name] = jsonValue(fv)
+	}
+}
+
+// isBoxes reports whether values of type t are boxes or slices of
+// boxes.
+func isBoxes(t reflect.Type) bool {
+	if t.Kind() == reflect.Slice {
+		t = t.Elem()
+	}
+	return t.Implements(boxType) || t.Kind() == reflect.Interface && t == boxType
+}
@@ -0,0 +1,689 @@
+/*
+Copyright 2026 The go4 Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+     http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package heif
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"sort"
+
+	"go4.org/media/heif/bmff"
+)
+
+// An Editor makes metadata-only changes to a HEIF file, such as
+// replacing its EXIF data or changing the rotation of an image, and
+// writes the edited file. The coded images are copied unchanged: only
+// the meta box is re-serialized, with item locations updated to match.
+//
+// Files containing tracks (image sequences) can't be edited.
+type Editor struct {
+	f      *File
+	exif   []byte // if non-nil, the replacement EXIF data
+	rot    map[uint32]int
+	mirror map[uint32]int // item ID to axis, or -1 for no mirroring
+}
+
+// NewEditor returns an Editor for f. Until WriteTo is called, f's
+// underlying io.ReaderAt must remain valid.
+func NewEditor(f *File) *Editor {
+	return &Editor{
+		f:      f,
+		rot:    make(map[uint32]int),
+		mirror: make(map[uint32]int),
+	}
+}
+
+// SetEXIF replaces the file's EXIF data with exif, which has the form
+// returned by File.EXIF: a TIFF header, optionally preceded by the
+// "Exif\x00\x00" prefix. If the file has no EXIF item, one is added,
+// describing the primary item. The old EXIF bytes are overwritten with
+// zeros in the output.
+func (e *Editor) SetEXIF(exif []byte) {
+	e.exif = append([]byte(nil), exif...)
+}
+
+// SetRotation sets the number of 90 degree counter-clockwise rotations
+// of the given item (see Item.Rotations). Zero removes any rotation.
+func (e *Editor) SetRotation(itemID uint32, rotations int) {
+	e.rot[itemID] = rotations & 3
+}
+
+// SetMirror sets whether the given item is mirrored, and about which
+// axis (see Item.Mirror).
+func (e *Editor) SetMirror(itemID uint32, mirror bool, axis int) {
+	if !mirror {
+		e.mirror[itemID] = -1
+		return
+	}
+	e.mirror[itemID] = axis & 1
+}
+
+// topBox is a top-level box of a file.
+type topBox struct {
+	typ        bmff.BoxType
+	start, end int64 // end is -1 for a final box extending to the end of the file
+}
+
+// topLevelBoxes returns the top-level boxes of the file.
+func (f *File) topLevelBoxes() ([]topBox, error) {
+	nodes, err := f.tree.Boxes()
+	if err != nil {
+		return nil, err
+	}
+	boxes := make([]topBox, len(nodes))
+	for i, n := range nodes {
+		boxes[i] = topBox{typ: n.Type, start: n.Offset, end: -1}
+		if n.Size != -1 {
+			boxes[i].end = n.Offset + n.Size
+		}
+	}
+	return boxes, nil
+}
+
+// span is a byte range of a file, [start, end).
+type span struct{ start, end int64 }
+
+// editState is the state of one Editor.WriteTo call.
+type editState struct {
+	*Editor
+	meta     *bmff.MetaBox
+	metaBox  topBox
+	ilocBox  *bmff.ItemLocationBox
+	iinfBox  *bmff.ItemInfoBox
+	irefBox  *bmff.ItemReferenceBox
+	iprpBox  *bmff.ItemPropertiesBox
+	exifID   uint32 // existing or new EXIF item ID, if e.exif != nil
+	newExif  bool   // exifID is a new item
+	oldExif  []span // file ranges to zero
+	idatZero []span // idat ranges to zero
+}
+
+// WriteTo writes the edited file to w.
+func (e *Editor) WriteTo(w io.Writer) (n int64, err error) {
+	if len(e.exif) > maxItemSize {
+		return 0, errors.New("heif: EXIF data too large")
+	}
+	st := &editState{Editor: e}
+	boxes, err := e.f.topLevelBoxes()
+	if err != nil {
+		return 0, err
+	}
+	metaIdx := -1
+	for i, b := range boxes {
+		switch b.typ {
+		case bmff.TypeMeta:
+			if metaIdx != -1 {
+				return 0, errors.New("heif: file has more than one meta box")
+			}
+			metaIdx = i
+		case bmff.BoxType{'m', 'o', 'o', 'v'}:
+			return 0, errors.New("heif: can't edit files containing tracks")
+		}
+	}
+	if metaIdx == -1 || boxes[metaIdx].end == -1 {
+		return 0, errors.New("heif: file lacks a meta box")
+	}
+	st.metaBox = boxes[metaIdx]
+	if err := st.readMeta(); err != nil {
+		return 0, err
+	}
+
+	// The new meta box's size determines the item offsets it
+	// contains, which can determine its size. Iterate until stable.
+	oldLen := st.metaBox.end - st.metaBox.start
+	var exifMdat []byte
+	if e.exif != nil {
+		if exifMdat, err = st.exifMdat(); err != nil {
+			return 0, err
+		}
+	}
+	var metaBytes []byte
+	metaLen := oldLen
+	for i := 0; ; i++ {
+		if i == 3 {
+			return 0, errors.New("heif: internal error: meta box size didn't converge")
+		}
+		delta := metaLen + int64(len(exifMdat)) - oldLen
+		exifOff := st.metaBox.start + metaLen + 8
+		metaBytes, err = st.buildMeta(delta, exifOff, int64(len(exifMdat))-8)
+		if err != nil {
+			return 0, err
+		}
+		if int64(len(metaBytes)) == metaLen {
+			break
+		}
+		metaLen = int64(len(metaBytes))
+	}
+
+	cw := &countWriter{w: w}
+	for i, b := range boxes {
+		if i == metaIdx {
+			if _, err := cw.Write(metaBytes); err != nil {
+				return cw.n, err
+			}
+			if _, err := cw.Write(exifMdat); err != nil {
+				return cw.n, err
+			}
+			continue
+		}
+		// A truncated final box is copied as is.
+		truncOK := i == len(boxes)-1
+		if err := copyZeroing(cw, e.f.ra, span{b.start, b.end}, st.oldExif, truncOK); err != nil {
+			return cw.n, err
+		}
+	}
+	return cw.n, nil
+}
+
+// readMeta reads and parses the meta box.
+func (st *editState) readMeta() error {
+	mb := st.metaBox
+	br := bmff.NewReader(io.NewSectionReader(st.f.ra, mb.start, mb.end-mb.start))
+	pbox, err := br.ReadAndParseBox(bmff.TypeMeta)
+	if err != nil {
+		return err
+	}
+	st.meta = pbox.(*bmff.MetaBox)
+	var primaryID uint32
+	havePrimary := false
+	for _, child := range st.meta.Children {
+		boxp, err := child.Parse()
+		if err == bmff.ErrUnknownBox {
+			continue
+		}
+		if err != nil {
+			return err
+		}
+		switch v := boxp.(type) {
+		case *bmff.ItemLocationBox:
+			st.ilocBox = v
+		case *bmff.ItemInfoBox:
+			st.iinfBox = v
+		case *bmff.ItemReferenceBox:
+			st.irefBox = v
+		case *bmff.ItemPropertiesBox:
+			st.iprpBox = v
+		case *bmff.PrimaryItemBox:
+			primaryID, havePrimary = v.ItemID, true
+		}
+	}
+	if st.ilocBox == nil || st.iinfBox == nil {
+		return errors.New("heif: meta box lacks item information or locations")
+	}
+	for _, it := range st.ilocBox.Items {
+		if it.ConstructionMethod > 1 {
+			return fmt.Errorf("heif: item %d uses unsupported construction method %d", it.ItemID, it.ConstructionMethod)
+		}
+	}
+	if len(st.rot) > 0 || len(st.mirror) > 0 {
+		if st.iprpBox == nil {
+			return errors.New("heif: meta box lacks item properties")
+		}
+		for id := range st.rot {
+			if !st.hasItem(id) {
+				return fmt.Errorf("heif: can't rotate unknown item %d", id)
+			}
+		}
+		for id := range st.mirror {
+			if !st.hasItem(id) {
+				return fmt.Errorf("heif: can't mirror unknown item %d", id)
+			}
+		}
+	}
+	if st.exif == nil {
+		return nil
+	}
+	var maxID uint32
+	for _, iie := range st.iinfBox.ItemInfos {
+		if iie.ItemType == "Exif" && st.exifID == 0 {
+			st.exifID = iie.ItemID
+		}
+		if iie.ItemID > maxID {
+			maxID = iie.ItemID
+		}
+	}
+	if st.exifID == 0 {
+		if !havePrimary {
+			return errors.New("heif: can't add EXIF to a file without a primary item")
+		}
+		if maxID == 1<<32-1 {
+			return errors.New("heif: no item ID available for EXIF")
+		}
+		st.exifID = maxID + 1
+		st.newExif = true
+		ref := bmff.ItemReference{
+			Type:       bmff.BoxType{'c', 'd', 's', 'c'},
+			FromItemID: st.exifID,
+			ToItemIDs:  []uint32{primaryID},
+		}
+		irb := &bmff.ItemReferenceBox{}
+		if st.irefBox != nil {
+			*irb = *st.irefBox
+		}
+		irb.References = append(irb.References[:len(irb.References):len(irb.References)], ref)
+		st.irefBox = irb
+		return nil
+	}
+	for _, it := range st.ilocBox.Items {
+		if it.ItemID != st.exifID {
+			continue
+		}
+		for _, ext := range it.Extents {
+			s := span{int64(it.BaseOffset + ext.Offset), int64(it.BaseOffset + ext.Offset + ext.Length)}
+			if s.start < 0 || s.end < s.start {
+				return fmt.Errorf("heif: EXIF item has invalid location")
+			}
+			switch {
+			case it.ConstructionMethod == 1:
+				st.idatZero = append(st.idatZero, s)
+			case it.DataReferenceIndex == 0:
+				st.oldExif = append(st.oldExif, s)
+			}
+		}
+	}
+	return nil
+}
+
+func (st *editState) hasItem(id uint32) bool {
+	for _, iie := range st.iinfBox.ItemInfos {
+		if iie.ItemID == id {
+			return true
+		}
+	}
+	return false
+}
+
+// exifMdat returns the mdat box holding the new EXIF item.
+func (st *editState) exifMdat() ([]byte, error) {
+	var tiffOff byte
+	if bytes.HasPrefix(st.exif, []byte("Exif\x00\x00")) {
+		tiffOff = 6
+	}
+	body := append([]byte{0, 0, 0, tiffOff}, st.exif...)
+	return bmff.NewBox(bmff.BoxType{'m', 'd', 'a', 't'}, body).Marshal()
+}
+
+// buildMeta returns the new meta box. Item data after the old meta
+// box moves by delta bytes. If there is new EXIF data, it is at
+// exifOff, exifLen bytes long.
+func (st *editState) buildMeta(delta, exifOff, exifLen int64) ([]byte, error) {
+	children := make([]bmff.Box, 0, len(st.meta.Children)+1)
+	irefWritten := false
+	for _, child := range st.meta.Children {
+		var b bmff.Box
+		var err error
+		switch child.Type().String() {
+		case "iloc":
+			b, err = st.buildIloc(delta, exifOff, exifLen)
+		case "iinf":
+			if st.newExif {
+				b = st.buildIinf()
+				if !irefWritten {
+					// Add the new iref box after iinf.
+					children = append(children, b)
+					b = st.buildIref()
+					irefWritten = true
+				}
+			} else {
+				b, err = rawBox(child)
+			}
+		case "iref":
+			if st.newExif {
+				if irefWritten {
+					continue
+				}
+				b = st.buildIref()
+				irefWritten = true
+			} else {
+				b, err = rawBox(child)
+			}
+		case "iprp":
+			if len(st.rot) > 0 || len(st.mirror) > 0 {
+				b, err = st.buildIprp()
+			} else {
+				b, err = rawBox(child)
+			}
+		case "idat":
+			var body []byte
+			body, err = ioutil.ReadAll(child.Body())
+			for _, s := range st.idatZero {
+				if s.end <= int64(len(body)) {
+					for i := s.start; i < s.end; i++ {
+						body[i] = 0
+					}
+				}
+			}
+			b = bmff.NewBox(child.Type(), body)
+		default:
+			b, err = rawBox(child)
+		}
+		if err != nil {
+			return nil, err
+		}
+		children = append(children, b)
+	}
+	mb := *st.meta
+	mb.Children = children
+	return mb.Marshal()
+}
+
+// movedOffset returns the new absolute file offset of data at off.
+func (st *editState) movedOffset(off uint64, delta int64) (uint64, error) {
+	switch {
+	case off < uint64(st.metaBox.start):
+		return off, nil
+	case off >= uint64(st.metaBox.end):
+		return uint64(int64(off) + delta), nil
+	}
+	return 0, fmt.Errorf("heif: item data at offset %d is inside the meta box", off)
+}
+
+func (st *editState) buildIloc(delta, exifOff, exifLen int64) (bmff.Box, error) {
+	items := make([]bmff.ItemLocationBoxEntry, 0, len(st.ilocBox.Items)+1)
+	haveExif := false
+	for _, it := range st.ilocBox.Items {
+		if st.exif != nil && it.ItemID == st.exifID {
+			if haveExif {
+				continue
+			}
+			haveExif = true
+			items = append(items, bmff.ItemLocationBoxEntry{
+				ItemID:  it.ItemID,
+				Extents: []bmff.OffsetLength{{Offset: uint64(exifOff), Length: uint64(exifLen)}},
+			})
+			continue
+		}
+		// Fold the base offset into the extents.
+		ent := it
+		ent.BaseOffset = 0
+		ent.Extents = make([]bmff.OffsetLength, len(it.Extents))
+		for i, ext := range it.Extents {
+			off := it.BaseOffset + ext.Offset
+			if it.ConstructionMethod == 0 && it.DataReferenceIndex == 0 {
+				var err error
+				if off, err = st.movedOffset(off, delta); err != nil {
+					return nil, err
+				}
+			}
+			ent.Extents[i] = bmff.OffsetLength{Offset: off, Length: ext.Length}
+		}
+		items = append(items, ent)
+	}
+	if st.exif != nil && !haveExif {
+		items = append(items, bmff.ItemLocationBoxEntry{
+			ItemID:  st.exifID,
+			Extents: []bmff.OffsetLength{{Offset: uint64(exifOff), Length: uint64(exifLen)}},
+		})
+	}
+
+	ilb := *st.ilocBox
+	ilb.Items = items
+	if len(items) > 0xffff {
+		ilb.Version = 2
+	}
+	for _, it := range items {
+		if it.ItemID > 0xffff {
+			ilb.Version = 2
+		}
+	}
+	return &ilb, nil
+}
+
+// buildIinf returns the iinf box with an infe for the new EXIF item.
+func (st *editState) buildIinf() bmff.Box {
+	iib := *st.iinfBox
+	infos := iib.ItemInfos
+	if len(infos)+1 > 0xffff && iib.Version == 0 {
+		iib.Version = 1
+	}
+	infe := &bmff.ItemInfoEntry{
+		FullBox:  bmff.FullBox{Version: 2},
+		ItemID:   st.exifID,
+		ItemType: "Exif",
+	}
+	if st.exifID > 0xffff {
+		infe.Version = 3
+	}
+	iib.ItemInfos = append(infos[:len(infos):len(infos)], infe)
+	return &iib
+}
+
+func (st *editState) buildIref() bmff.Box {
+	irb := *st.irefBox
+	for _, ref := range irb.References {
+		if ref.FromItemID > 0xffff {
+			irb.Version = 1
+		}
+		for _, id := range ref.ToItemIDs {
+			if id > 0xffff {
+				irb.Version = 1
+			}
+		}
+	}
+	return &irb
+}
+
+// buildIprp returns the iprp box with the rotation and mirroring
+// changes applied.
+func (st *editState) buildIprp() (bmff.Box, error) {
+	props := st.iprpBox.PropertyContainer.Properties
+	ipco := make([]bmff.Box, 0, len(props)+2)
+	for _, p := range props {
+		b, err := rawBox(p)
+		if err != nil {
+			return nil, err
+		}
+		ipco = append(ipco, b)
+	}
+	// New properties, by type and value, to their 1-based index.
+	newProps := make(map[string]uint16)
+	addProp := func(key string, p bmff.Box) (uint16, error) {
+		if idx, ok := newProps[key]; ok {
+			return idx, nil
+		}
+		idx := len(ipco) + 1
+		if idx > 0x7fff {
+			return 0, errors.New("heif: too many item properties")
+		}
+		newProps[key] = uint16(idx)
+		ipco = append(ipco, p)
+		return uint16(idx), nil
+	}
+	isType := func(idx uint16, typ string) bool {
+		return idx != 0 && int(idx) <= len(props) && props[idx-1].Type().EqualString(typ)
+	}
+
+	// Items to edit, in a deterministic order.
+	var ids []uint32
+	for id := range st.rot {
+		ids = append(ids, id)
+	}
+	for id := range st.mirror {
+		if _, ok := st.rot[id]; !ok {
+			ids = append(ids, id)
+		}
+	}
+	sort.Slice(ids, func(i, j int) bool { return ids[i] < ids[j] })
+
+	assocs := make([]*bmff.ItemPropertyAssociation, len(st.iprpBox.Associations))
+	for i, ipa := range st.iprpBox.Associations {
+		cp := *ipa
+		cp.Entries = append([]bmff.ItemPropertyAssociationItem(nil), ipa.Entries...)
+		assocs[i] = &cp
+	}
+	if len(assocs) == 0 {
+		return nil, errors.New("heif: meta box lacks item property associations")
+	}
+	for _, id := range ids {
+		ent, ipa := -1, assocs[0]
+		for _, a := range assocs {
+			for i := range a.Entries {
+				if a.Entries[i].ItemID == id {
+					ent, ipa = i, a
+					break
+				}
+			}
+			if ent != -1 {
+				break
+			}
+		}
+		if ent == -1 {
+			ipa.Entries = append(ipa.Entries, bmff.ItemPropertyAssociationItem{ItemID: id})
+			ent = len(ipa.Entries) - 1
+		}
+		e := &ipa.Entries[ent]
+		var keep, rot, mir []bmff.ItemProperty
+		for _, a := range e.Associations {
+			switch {
+			case isType(a.Index, "irot"):
+				rot = append(rot, a)
+			case isType(a.Index, "imir"):
+				mir = append(mir, a)
+			default:
+				keep = append(keep, a)
+			}
+		}
+		if r, ok := st.rot[id]; ok {
+			rot = nil
+			if r != 0 {
+				idx, err := addProp(fmt.Sprintf("irot%d", r), &bmff.ImageRotation{Angle: uint8(r)})
+				if err != nil {
+					return nil, err
+				}
+				rot = []bmff.ItemProperty{{Essential: true, Index: idx}}
+			}
+		}
+		if axis, ok := st.mirror[id]; ok {
+			mir = nil
+			if axis >= 0 {
+				idx, err := addProp(fmt.Sprintf("imir%d", axis), &bmff.ImageMirror{Axis: uint8(axis)})
+				if err != nil {
+					return nil, err
+				}
+				mir = []bmff.ItemProperty{{Essential: true, Index: idx}}
+			}
+		}
+		// Transformative properties come last, rotation before
+		// mirroring.
+		e.Associations = append(append(keep, rot...), mir...)
+		if len(e.Associations) > 0xff {
+			return nil, fmt.Errorf("heif: item %d has too many properties", id)
+		}
+	}
+
+	for _, ipa := range assocs {
+		for _, e := range ipa.Entries {
+			if e.ItemID > 0xffff {
+				ipa.Version = 1
+			}
+			for _, a := range e.Associations {
+				if a.Index > 0x7f {
+					ipa.Flags |= 1
+				}
+			}
+		}
+	}
+	return &bmff.ItemPropertiesBox{
+		PropertyContainer: &bmff.ItemPropertyContainerBox{Properties: ipco},
+		Associations:      assocs,
+	}, nil
+}
+
+// copyZeroing copies the bytes of s (to the end of ra if s.end is -1)
+// to w, writing zeros for any bytes within the zero spans. If truncOK,
+// ra may end before s does.
+func copyZeroing(w io.Writer, ra io.ReaderAt, s span, zero []span, truncOK bool) error {
+	const maxInt64 = 1<<63 - 1
+	end := s.end
+	if end == -1 {
+		end = maxInt64
+	}
+	zero = append([]span(nil), zero...)
+	sort.Slice(zero, func(i, j int) bool { return zero[i].start < zero[j].start })
+	pos := s.start
+	for _, z := range zero {
+		if z.end <= pos || z.start >= end {
+			continue
+		}
+		if z.start > pos {
+			if err := copyRange(w, ra, pos, z.start, truncOK); err != nil {
+				return err
+			}
+			pos = z.start
+		}
+		zend := z.end
+		if zend > end {
+			zend = end
+		}
+		if _, err := io.CopyN(w, zeroReader{}, zend-pos); err != nil {
+			return err
+		}
+		pos = zend
+	}
+	return copyRange(w, ra, pos, end, truncOK || s.end == -1)
+}
+
+// copyRange copies [start, end) of ra to w. If toEOF, reaching the end
+// of ra before end isn't an error.
+func copyRange(w io.Writer, ra io.ReaderAt, start, end int64, toEOF bool) error {
+	n, err := io.Copy(w, io.NewSectionReader(ra, start, end-start))
+	if err != nil {
+		return err
+	}
+	if n != end-start && !toEOF {
+		return io.ErrUnexpectedEOF
+	}
+	return nil
+}
+
+type zeroReader struct{}
+
+func (zeroReader) Read(p []byte) (int, error) {
+	for i := range p {
+		p[i] = 0
+	}
+	return len(p), nil
+}
+
+type countWriter struct {
+	w io.Writer
+	n int64
+}
+
+func (cw *countWriter) Write(p []byte) (int, error) {
+	n, err := cw.w.Write(p)
+	cw.n += int64(n)
+	return n, err
+}
+
+// rawBox returns a copy of the unmodified box b that marshals to its
+// original bytes, rather than to a re-encoding of its parsed form.
+func rawBox(b bmff.Box) (bmff.Box, error) {
+	if b.Type() == bmff.TypeUUID {
+		// Whatever parser is registered for it, the box knows its
+		// extended type.
+		return b, nil
+	}
+	body, err := ioutil.ReadAll(b.Body())
+	if err != nil {
+		return nil, err
+	}
+	return bmff.NewBox(b.Type(), body), nil
+}
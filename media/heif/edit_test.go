@@ -0,0 +1,291 @@
+/*
+Copyright 2026 The go4 Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+     http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package heif
+
+import (
+	"bytes"
+	"io"
+	"io/ioutil"
+	"testing"
+
+	"go4.org/media/heif/bmff"
+)
+
+// allItemData returns the data of all of f's items whose data can be
+// read, by item ID.
+func allItemData(t *testing.T, f *File) map[uint32][]byte {
+	meta, err := f.getMeta()
+	if err != nil {
+		t.Fatal(err)
+	}
+	m := make(map[uint32][]byte)
+	for _, iie := range meta.ItemInfo.ItemInfos {
+		it, err := f.ItemByID(iie.ItemID)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if data, err := it.Data(); err == nil {
+			m[iie.ItemID] = data
+		}
+	}
+	return m
+}
+
+func editFile(t *testing.T, name string, edit func(*Editor)) (orig, edited *File, out []byte) {
+	buf, err := ioutil.ReadFile(name)
+	if err != nil {
+		t.Fatal(err)
+	}
+	orig = Open(bytes.NewReader(buf))
+	e := NewEditor(orig)
+	edit(e)
+	var w bytes.Buffer
+	n, err := e.WriteTo(&w)
+	if err != nil {
+		t.Fatalf("%s: WriteTo: %v", name, err)
+	}
+	if n != int64(w.Len()) {
+		t.Errorf("%s: WriteTo = %d; wrote %d bytes", name, n, w.Len())
+	}
+	return orig, Open(bytes.NewReader(w.Bytes())), w.Bytes()
+}
+
+func TestEditEXIF(t *testing.T) {
+	newExif := []byte("Exif\x00\x00II*\x00\x08\x00\x00\x00\x00\x00\x00\x00\x00\x00")
+	for _, name := range []string{"testdata/park.heic", "testdata/meta32.heic", "testdata/thumbnail.heic"} {
+		orig, edited, out := editFile(t, name, func(e *Editor) { e.SetEXIF(newExif) })
+		oldExif, oldErr := orig.EXIF()
+		got, err := edited.EXIF()
+		if err != nil {
+			t.Errorf("%s: EXIF of edited file: %v", name, err)
+		} else if !bytes.Equal(got, newExif) {
+			t.Errorf("%s: EXIF of edited file = %q; want %q", name, got, newExif)
+		}
+		if oldErr == nil && bytes.Contains(out, oldExif) {
+			t.Errorf("%s: old EXIF still present in edited file", name)
+		}
+
+		// All other items are unchanged.
+		exifID := edited.meta.EXIFItemID()
+		want := allItemData(t, orig)
+		gotData := allItemData(t, edited)
+		for id, data := range want {
+			if id == exifID {
+				continue
+			}
+			if !bytes.Equal(gotData[id], data) {
+				t.Errorf("%s: data of item %d changed", name, id)
+			}
+		}
+		if oldErr == ErrNoEXIF {
+			// A new item was added, describing the primary item.
+			if len(gotData) != len(want)+1 {
+				t.Errorf("%s: edited file has %d items with data; want %d", name, len(gotData), len(want)+1)
+			}
+			primary, err := edited.PrimaryItem()
+			if err != nil {
+				t.Fatal(err)
+			}
+			if ids, _ := edited.referencing(primary.ID, "cdsc"); len(ids) != 1 || ids[0] != exifID {
+				t.Errorf("%s: primary item described by %v; want [%d]", name, ids, exifID)
+			}
+		}
+	}
+}
+
+func TestEditRotation(t *testing.T) {
+	_, edited, _ := editFile(t, "testdata/rotate.heic", func(e *Editor) {
+		e.SetRotation(49, 1)
+		e.SetMirror(49, true, 1)
+		e.SetMirror(50, true, 0)
+	})
+	it, err := edited.PrimaryItem()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if r := it.Rotations(); r != 1 {
+		t.Errorf("Rotations = %d; want 1", r)
+	}
+	if axis, ok := it.Mirror(); !ok || axis != 1 {
+		t.Errorf("Mirror = %d, %v; want 1, true", axis, ok)
+	}
+	if w, h, ok := it.SpatialExtents(); !ok || w != 4032 || h != 3024 {
+		t.Errorf("SpatialExtents = %d, %d, %v; want 4032, 3024, true", w, h, ok)
+	}
+	thumb, err := edited.ItemByID(50)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if axis, ok := thumb.Mirror(); !ok || axis != 0 {
+		t.Errorf("thumbnail Mirror = %d, %v; want 0, true", axis, ok)
+	}
+	if r := thumb.Rotations(); r != 3 {
+		t.Errorf("thumbnail Rotations = %d; want unchanged 3", r)
+	}
+
+	// And back again.
+	var buf bytes.Buffer
+	e := NewEditor(edited)
+	e.SetRotation(49, 0)
+	e.SetMirror(49, false, 0)
+	if _, err := e.WriteTo(&buf); err != nil {
+		t.Fatal(err)
+	}
+	it, err = Open(bytes.NewReader(buf.Bytes())).PrimaryItem()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := it.Mirror(); ok || it.Rotations() != 0 {
+		t.Errorf("after reset, Mirror ok = %v, Rotations = %d; want false, 0", ok, it.Rotations())
+	}
+}
+
+func TestEditUnchanged(t *testing.T) {
+	// With no edits, the coded images are still decodable.
+	_, edited, _ := editFile(t, "testdata/grid.heic", func(*Editor) {})
+	if _, err := edited.Image(); err != nil {
+		t.Errorf("Image of rewritten file: %v", err)
+	}
+	if _, err := NewEditor(edited).WriteTo(ioutil.Discard); err != nil {
+		t.Errorf("WriteTo of rewritten file: %v", err)
+	}
+
+	e := NewEditor(Open(bytes.NewReader(nil)))
+	if _, err := e.WriteTo(ioutil.Discard); err == nil {
+		t.Errorf("WriteTo of empty file succeeded")
+	}
+	e = NewEditor(edited)
+	e.SetRotation(99, 1)
+	if _, err := e.WriteTo(ioutil.Discard); err == nil {
+		t.Errorf("rotating an unknown item succeeded")
+	}
+}
+
+// testUUIDProperty is a "uuid" item property with a registered parser.
+type testUUIDProperty struct {
+	bmff.Box
+	Data []byte
+}
+
+var testUUID = [16]byte{'g', 'o', '4', ' ', 'e', 'd', 'i', 't', ' ', 't', 'e', 's', 't', 0, 0, 1}
+
+func init() {
+	bmff.RegisterUUIDParser(testUUID, func(b bmff.Box) (bmff.Box, error) {
+		body, err := ioutil.ReadAll(b.Body())
+		return &testUUIDProperty{Box: b, Data: body}, err
+	})
+}
+
+// withUUIDProperty returns the file name with a "uuid" property of
+// type testUUID appended to its ipco box, and the encoding of that box.
+func withUUIDProperty(t *testing.T, name string) (file, prop []byte) {
+	buf, err := ioutil.ReadFile(name)
+	if err != nil {
+		t.Fatal(err)
+	}
+	uuid := bmff.NewUUIDBox(testUUID, []byte("body"))
+	prop, err = uuid.Marshal()
+	if err != nil {
+		t.Fatal(err)
+	}
+	delta := uint64(len(prop))
+	r := bmff.NewReader(bytes.NewReader(buf))
+	for {
+		b, err := r.ReadBox()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+		if b.Type().String() == "meta" {
+			pb, err := b.Parse()
+			if err != nil {
+				t.Fatal(err)
+			}
+			meta := pb.(*bmff.MetaBox)
+			for i, c := range meta.Children {
+				if c, err = c.Parse(); err != nil {
+					t.Fatal(err)
+				}
+				meta.Children[i] = c
+				switch c := c.(type) {
+				case *bmff.ItemPropertiesBox:
+					c.PropertyContainer.Properties = append(c.PropertyContainer.Properties, uuid)
+				case *bmff.ItemLocationBox:
+					// All data follows the meta box.
+					for i := range c.Items {
+						if c.Items[i].BaseOffset != 0 {
+							c.Items[i].BaseOffset += delta
+							continue
+						}
+						for j := range c.Items[i].Extents {
+							c.Items[i].Extents[j].Offset += delta
+						}
+					}
+				}
+			}
+			b = pb
+		}
+		enc, err := b.Marshal()
+		if err != nil {
+			t.Fatal(err)
+		}
+		file = append(file, enc...)
+	}
+	return file, prop
+}
+
+func TestEditRegisteredUUIDProperty(t *testing.T) {
+	buf, prop := withUUIDProperty(t, "testdata/meta32.heic")
+	f := Open(bytes.NewReader(buf))
+	it, err := f.PrimaryItem()
+	if err != nil {
+		t.Fatal(err)
+	}
+	e := NewEditor(f)
+	e.SetRotation(it.ID, 1) // rewrites the ipco box
+	var w bytes.Buffer
+	if _, err := e.WriteTo(&w); err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Contains(w.Bytes(), prop) {
+		t.Errorf("edited file lacks the uuid property %q", prop)
+	}
+	edited := Open(bytes.NewReader(w.Bytes()))
+	if it, err := edited.PrimaryItem(); err != nil || it.Rotations() != 1 {
+		t.Fatalf("edited file: PrimaryItem = %v, %v", it, err)
+	}
+	meta, err := edited.getMeta()
+	if err != nil {
+		t.Fatal(err)
+	}
+	props := meta.Properties.PropertyContainer.Properties
+	found := false
+	for _, p := range props {
+		p, err := p.Parse()
+		if err != nil {
+			continue
+		}
+		if p, ok := p.(*testUUIDProperty); ok && string(p.Data) == "body" {
+			found = true
+		}
+	}
+	if !found {
+		t.Errorf("edited file's properties lack the parsed uuid property")
+	}
+}
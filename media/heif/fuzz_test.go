@@ -0,0 +1,71 @@
+//go:build go1.18
+// +build go1.18
+
+/*
+Copyright 2026 The go4 Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+     http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package heif
+
+import (
+	"bytes"
+	"io/ioutil"
+	"path/filepath"
+	"testing"
+
+	"go4.org/media/heif/bmff"
+)
+
+func FuzzFile(f *testing.F) {
+	files, _ := filepath.Glob("testdata/*")
+	for _, name := range files {
+		data, err := ioutil.ReadFile(name)
+		if err == nil {
+			f.Add(data)
+		}
+	}
+	f.Fuzz(func(t *testing.T, data []byte) {
+		DecodeConfig(bytes.NewReader(data))
+
+		hf := Open(bytes.NewReader(data))
+		hf.SetLimits(bmff.Limits{MaxBoxes: 1 << 12, MaxEntries: 1 << 12, MaxBoxSize: 1 << 20})
+		hf.Format()
+		hf.EXIF()
+		hf.XMP()
+		hf.ICCProfile()
+		if items, err := hf.MetadataItems(); err == nil {
+			for _, it := range items {
+				it.Data()
+			}
+		}
+		if it, err := hf.PrimaryItem(); err == nil {
+			it.SpatialExtents()
+			it.VisualDimensions()
+			it.CleanAperture()
+			it.DisplayTransform()
+			it.BitsPerChannel()
+			it.Grid()
+			it.Tiles()
+			hf.Thumbnails(it)
+		}
+		if seqs, err := hf.Sequences(); err == nil {
+			for _, s := range seqs {
+				for i := range s.Frames {
+					s.FrameTime(i)
+				}
+			}
+		}
+	})
+}
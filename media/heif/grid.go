@@ -0,0 +1,197 @@
+/*
+Copyright 2026 The go4 Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+     http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package heif
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"image"
+)
+
+// maxImagePixels is the largest derived image, in pixels, this package
+// will assemble.
+const maxImagePixels = 1 << 28
+
+// Grid is the layout of a "grid" derived image item: Rows by Columns
+// tiles of equal size, placed in row-major order and cropped to Width
+// by Height.
+type Grid struct {
+	Rows, Columns int
+	Width, Height int // of the output image
+}
+
+// Grid returns the layout of a "grid" item.
+func (it *Item) Grid() (*Grid, error) {
+	if it.Info == nil || it.Info.ItemType != "grid" {
+		return nil, fmt.Errorf("heif: item %d is not a grid", it.ID)
+	}
+	data, err := it.Data()
+	if err != nil {
+		return nil, err
+	}
+	if len(data) < 8 {
+		return nil, fmt.Errorf("heif: grid item %d is too short", it.ID)
+	}
+	if data[0] != 0 {
+		return nil, fmt.Errorf("heif: grid item %d has unsupported version %d", it.ID, data[0])
+	}
+	g := &Grid{
+		Rows:    int(data[2]) + 1,
+		Columns: int(data[3]) + 1,
+	}
+	if data[1]&1 == 0 {
+		g.Width = int(binary.BigEndian.Uint16(data[4:]))
+		g.Height = int(binary.BigEndian.Uint16(data[6:]))
+	} else {
+		if len(data) < 12 {
+			return nil, fmt.Errorf("heif: grid item %d is too short", it.ID)
+		}
+		g.Width = int(binary.BigEndian.Uint32(data[4:]))
+		g.Height = int(binary.BigEndian.Uint32(data[8:]))
+	}
+	if g.Width == 0 || g.Height == 0 {
+		return nil, fmt.Errorf("heif: grid item %d has empty output size", it.ID)
+	}
+	return g, nil
+}
+
+// Tiles returns the input images of a derived image item, as listed by
+// its "dimg" item references. For a grid, these are its tiles in
+// row-major order. The same item may appear more than once.
+func (it *Item) Tiles() ([]*Item, error) {
+	ids, err := it.f.references(it.ID, "dimg")
+	if err != nil {
+		return nil, err
+	}
+	tiles := make([]*Item, len(ids))
+	for i, id := range ids {
+		tile, err := it.f.ItemByID(id)
+		if err != nil {
+			return nil, fmt.Errorf("heif: tile %d of item %d: %v", id, it.ID, err)
+		}
+		tiles[i] = tile
+	}
+	return tiles, nil
+}
+
+// gridImage decodes a "grid" item's tiles and assembles them.
+func (it *Item) gridImage() (image.Image, error) {
+	g, err := it.Grid()
+	if err != nil {
+		return nil, err
+	}
+	tiles, err := it.Tiles()
+	if err != nil {
+		return nil, err
+	}
+	if len(tiles) != g.Rows*g.Columns {
+		return nil, fmt.Errorf("heif: grid item %d has %d tiles; want %d", it.ID, len(tiles), g.Rows*g.Columns)
+	}
+	if uint64(g.Width)*uint64(g.Height) > maxImagePixels {
+		return nil, fmt.Errorf("heif: grid item %d is too large", it.ID)
+	}
+	var (
+		dst    image.Image
+		tw, th int // tile size
+	)
+	for i, tile := range tiles {
+		x0, y0 := i%g.Columns*tw, i/g.Columns*th
+		if dst != nil && (x0 >= g.Width || y0 >= g.Height) {
+			continue // cropped away entirely
+		}
+		if tile.Info != nil && tile.Info.ItemType == "grid" {
+			return nil, fmt.Errorf("heif: grid item %d has a grid as a tile", it.ID)
+		}
+		m, err := tile.Image()
+		if err != nil {
+			return nil, fmt.Errorf("heif: tile %d of grid item %d: %w", i, it.ID, err)
+		}
+		b := m.Bounds()
+		if dst == nil {
+			tw, th = b.Dx(), b.Dy()
+			if g.Width > g.Columns*tw || g.Height > g.Rows*th {
+				return nil, fmt.Errorf("heif: grid item %d is larger than its tiles", it.ID)
+			}
+			r := image.Rect(0, 0, g.Width, g.Height)
+			switch m := m.(type) {
+			case *image.YCbCr:
+				if m.SubsampleRatio != image.YCbCrSubsampleRatio420 {
+					return nil, fmt.Errorf("heif: grid item %d has unsupported tile subsampling", it.ID)
+				}
+				if (g.Columns > 1 && tw%2 != 0) || (g.Rows > 1 && th%2 != 0) {
+					return nil, fmt.Errorf("heif: grid item %d has odd-sized tiles", it.ID)
+				}
+				dst = image.NewYCbCr(r, image.YCbCrSubsampleRatio420)
+			case *image.Gray:
+				dst = image.NewGray(r)
+			default:
+				return nil, fmt.Errorf("heif: grid item %d has unsupported tile image type %T", it.ID, m)
+			}
+		}
+		if b.Dx() != tw || b.Dy() != th {
+			return nil, fmt.Errorf("heif: grid item %d has tiles of different sizes", it.ID)
+		}
+		if err := pasteTile(dst, m, x0, y0); err != nil {
+			return nil, fmt.Errorf("heif: grid item %d: %v", it.ID, err)
+		}
+	}
+	return dst, nil
+}
+
+var errMixedTiles = errors.New("tiles have different image types")
+
+// pasteTile copies src to dst with its top-left corner at (x0, y0),
+// clipped to dst's bounds, which start at (0, 0). For YCbCr images, x0
+// and y0 are even.
+func pasteTile(dst, src image.Image, x0, y0 int) error {
+	w := dst.Bounds().Dx() - x0
+	if sw := src.Bounds().Dx(); sw < w {
+		w = sw
+	}
+	h := dst.Bounds().Dy() - y0
+	if sh := src.Bounds().Dy(); sh < h {
+		h = sh
+	}
+	sb := src.Bounds()
+	switch dst := dst.(type) {
+	case *image.YCbCr:
+		src, ok := src.(*image.YCbCr)
+		if !ok || src.SubsampleRatio != dst.SubsampleRatio {
+			return errMixedTiles
+		}
+		for y := 0; y < h; y++ {
+			copy(dst.Y[(y0+y)*dst.YStride+x0:][:w], src.Y[src.YOffset(sb.Min.X, sb.Min.Y+y):])
+		}
+		cw := (w + 1) / 2
+		for y := 0; y < (h+1)/2; y++ {
+			di := (y0/2+y)*dst.CStride + x0/2
+			si := src.COffset(sb.Min.X, sb.Min.Y+2*y)
+			copy(dst.Cb[di:][:cw], src.Cb[si:])
+			copy(dst.Cr[di:][:cw], src.Cr[si:])
+		}
+	case *image.Gray:
+		src, ok := src.(*image.Gray)
+		if !ok {
+			return errMixedTiles
+		}
+		for y := 0; y < h; y++ {
+			copy(dst.Pix[(y0+y)*dst.Stride+x0:][:w], src.Pix[src.PixOffset(sb.Min.X, sb.Min.Y+y):])
+		}
+	}
+	return nil
+}
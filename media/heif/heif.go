@@ -14,18 +14,28 @@ See the License for the specific language governing permissions and
 limitations under the License.
 */
 
-// Package heif reads HEIF containers, as found in Apple HEIC/HEVC images.
-// This package does not decode images; it only reads the metadata.
+// Package heif reads HEIF containers, as found in Apple HEIC/HEVC images
+// and in AVIF images.
+// It reads their metadata and, for HEVC-coded images, decodes the
+// pixels using the go4.org/media/heif/hevc package. Importing this
+// package registers the "heic" and "heif" formats with the image
+// package. An Editor makes metadata-only changes, such as replacing
+// the EXIF data, without re-encoding the images.
 //
 // This package is a work in progress and makes no API compatibility
 // promises.
 package heif
 
 import (
+	"bytes"
+	"compress/gzip"
+	"compress/zlib"
 	"errors"
 	"fmt"
+	"image"
 	"io"
-	"log"
+	"io/ioutil"
+	"math"
 
 	"go4.org/media/heif/bmff"
 )
@@ -35,6 +45,7 @@ import (
 // Methods on File should not be called concurrently.
 type File struct {
 	ra      io.ReaderAt
+	tree    *bmff.Tree
 	primary *Item
 
 	// Populated lazily, by getMeta:
@@ -50,6 +61,8 @@ type BoxMeta struct {
 	ItemInfo     *bmff.ItemInfoBox
 	Properties   *bmff.ItemPropertiesBox
 	ItemLocation *bmff.ItemLocationBox
+	ItemData     *bmff.ItemDataBox      // or nil
+	ItemRefs     *bmff.ItemReferenceBox // or nil
 }
 
 // EXIFItemID returns the item ID of the EXIF part, or 0 if not found.
@@ -59,7 +72,7 @@ func (m *BoxMeta) EXIFItemID() uint32 {
 	}
 	for _, ife := range m.ItemInfo.ItemInfos {
 		if ife.ItemType == "Exif" {
-			return uint32(ife.ItemID)
+			return ife.ItemID
 		}
 	}
 	return 0
@@ -97,21 +110,217 @@ func (it *Item) Rotations() int {
 	return 0
 }
 
-// VisualDimensions returns the item's width and height after correcting
-// for any rotations.
+// Mirror reports whether this image should be mirrored when rendered,
+// after any rotation, and about which axis: 0 for a vertical axis
+// (swapping left and right), or 1 for a horizontal axis (swapping top
+// and bottom).
+func (it *Item) Mirror() (axis int, ok bool) {
+	for _, p := range it.Properties {
+		if p, ok := p.(*bmff.ImageMirror); ok {
+			return int(p.Axis), true
+		}
+	}
+	return 0, false
+}
+
+// CleanAperture returns the part of the item's image that should be
+// displayed, in the coordinates of the image as coded, according to
+// its clean aperture ("clap") property. ok is false if the item has
+// no valid clean aperture or no spatial extents.
+func (it *Item) CleanAperture() (r image.Rectangle, ok bool) {
+	width, height, ok := it.SpatialExtents()
+	if !ok {
+		return image.Rectangle{}, false
+	}
+	for _, p := range it.Properties {
+		p, ok := p.(*bmff.CleanAperture)
+		if !ok {
+			continue
+		}
+		if p.WidthD == 0 || p.HeightD == 0 || p.HorizOffsetD == 0 || p.VertOffsetD == 0 {
+			return image.Rectangle{}, false
+		}
+		cw := float64(p.WidthN) / float64(p.WidthD)
+		ch := float64(p.HeightN) / float64(p.HeightD)
+		// The offsets are of the aperture's center from the image's.
+		cx := float64(p.HorizOffsetN)/float64(p.HorizOffsetD) + float64(width-1)/2
+		cy := float64(p.VertOffsetN)/float64(p.VertOffsetD) + float64(height-1)/2
+		x0 := int(math.Floor(cx - (cw-1)/2 + 0.5))
+		y0 := int(math.Floor(cy - (ch-1)/2 + 0.5))
+		r = image.Rect(x0, y0, x0+int(math.Floor(cw+0.5)), y0+int(math.Floor(ch+0.5)))
+		r = r.Intersect(image.Rect(0, 0, width, height))
+		return r, !r.Empty()
+	}
+	return image.Rectangle{}, false
+}
+
+// Transform describes how to display an image item. HEIF applies an
+// item's transformative properties in a fixed order: first the crop,
+// then the rotations, then the mirroring.
+type Transform struct {
+	Crop       image.Rectangle // in coded image coordinates
+	Rotations  int             // 90 degree counter-clockwise rotations, in [0,3]
+	Mirror     bool
+	MirrorAxis int // if Mirror; as returned by Item.Mirror
+}
+
+// DisplayTransform returns the transform from the item's image as
+// coded to the image as it should be displayed. Crop is the clean
+// aperture, or the whole image if the item has none. ok is false if
+// the item lacks spatial extents.
+func (it *Item) DisplayTransform() (t Transform, ok bool) {
+	width, height, ok := it.SpatialExtents()
+	if !ok {
+		return Transform{}, false
+	}
+	t.Crop = image.Rect(0, 0, width, height)
+	if r, ok := it.CleanAperture(); ok {
+		t.Crop = r
+	}
+	t.Rotations = it.Rotations()
+	t.MirrorAxis, t.Mirror = it.Mirror()
+	return t, true
+}
+
+// ICCProfile returns the item's ICC color profile, from its "colr"
+// property, or nil if it has none. Grid items without one use their
+// first tile's.
+func (it *Item) ICCProfile() []byte {
+	if ci := it.colorInfo(func(ci *bmff.ColorInformation) bool { return ci.ICCProfile != nil }); ci != nil {
+		return ci.ICCProfile
+	}
+	return nil
+}
+
+// ColorParameters returns the item's "nclx" (or "nclc") color
+// information property, giving its color primaries, transfer
+// characteristics and matrix coefficients, or nil if it has none.
+// Grid items without one use their first tile's.
+func (it *Item) ColorParameters() *bmff.ColorInformation {
+	return it.colorInfo(func(ci *bmff.ColorInformation) bool {
+		return ci.ColorType == "nclx" || ci.ColorType == "nclc"
+	})
+}
+
+// colorInfo returns the item's first "colr" property matching fn, or
+// that of its first tile if it's a grid.
+func (it *Item) colorInfo(fn func(*bmff.ColorInformation) bool) *bmff.ColorInformation {
+	props := it.Properties
+	if it.Info != nil && it.Info.ItemType == "grid" {
+		if tiles, err := it.Tiles(); err == nil && len(tiles) > 0 {
+			props = append(props[:len(props):len(props)], tiles[0].Properties...)
+		}
+	}
+	for _, p := range props {
+		if p, ok := p.(*bmff.ColorInformation); ok && fn(p) {
+			return p
+		}
+	}
+	return nil
+}
+
+// BitsPerChannel returns the number of bits of each channel of the
+// item's image, from its "pixi" property, or nil if it has none.
+func (it *Item) BitsPerChannel() []int {
+	for _, p := range it.Properties {
+		if p, ok := p.(*bmff.PixelInformation); ok {
+			bits := make([]int, len(p.BitsPerChannel))
+			for i, b := range p.BitsPerChannel {
+				bits[i] = int(b)
+			}
+			return bits
+		}
+	}
+	return nil
+}
+
+// VisualDimensions returns the item's width and height after cropping
+// to any clean aperture and correcting for any rotations.
 func (it *Item) VisualDimensions() (width, height int, ok bool) {
 	width, height, ok = it.SpatialExtents()
+	if r, ok := it.CleanAperture(); ok {
+		width, height = r.Dx(), r.Dy()
+	}
 	for i := 0; i < it.Rotations(); i++ {
 		width, height = height, width
 	}
 	return
 }
 
-// TODO: add HEIF imir (mirroring) accessor, like Image.SpatialExtents.
+// maxItemSize is the largest item Data will read into memory.
+const maxItemSize = 256 << 20
+
+// Data returns the item's raw data, such as the coded image of an
+// "hvc1" item, as located by the file's ItemLocationBox. The data may
+// be stored in the file or in the meta box's ItemDataBox, and is the
+// concatenation of all the item's extents.
+func (it *Item) Data() ([]byte, error) {
+	f := it.f
+	loc := it.Location
+	if loc == nil {
+		return nil, fmt.Errorf("heif: item %d has no location", it.ID)
+	}
+	if loc.ConstructionMethod > 1 {
+		return nil, fmt.Errorf("heif: item %d uses unsupported construction method %d", it.ID, loc.ConstructionMethod)
+	}
+	if loc.ConstructionMethod == 0 && loc.DataReferenceIndex != 0 {
+		return nil, fmt.Errorf("heif: item %d refers to data outside the file", it.ID)
+	}
+	var size uint64
+	for _, e := range loc.Extents {
+		size += e.Length
+		if e.Length == 0 || size > maxItemSize {
+			return nil, fmt.Errorf("heif: item %d has unsupported size", it.ID)
+		}
+	}
+	var idat []byte
+	if loc.ConstructionMethod == 1 {
+		meta, err := f.getMeta()
+		if err != nil {
+			return nil, err
+		}
+		if meta.ItemData == nil {
+			return nil, fmt.Errorf("heif: item %d is stored in a missing idat box", it.ID)
+		}
+		idat = meta.ItemData.Data
+	}
+	buf := make([]byte, 0, size)
+	for _, e := range loc.Extents {
+		off := loc.BaseOffset + e.Offset
+		if off < loc.BaseOffset || off > 1<<62 {
+			return nil, fmt.Errorf("heif: item %d has invalid offset", it.ID)
+		}
+		n := len(buf)
+		buf = buf[:n+int(e.Length)]
+		if loc.ConstructionMethod == 1 {
+			// Offsets are relative to the start of the idat data.
+			if off > uint64(len(idat)) || e.Length > uint64(len(idat))-off {
+				return nil, fmt.Errorf("heif: item %d extends past its idat box", it.ID)
+			}
+			copy(buf[n:], idat[off:])
+			continue
+		}
+		if _, err := f.ra.ReadAt(buf[n:], int64(off)); err != nil {
+			return nil, fmt.Errorf("heif: reading item %d: %v", it.ID, err)
+		}
+	}
+	return buf, nil
+}
 
 // Open returns a handle to access a HEIF file.
 func Open(f io.ReaderAt) *File {
-	return &File{ra: f}
+	size := int64(-1)
+	if s, ok := f.(interface{ Size() int64 }); ok {
+		size = s.Size()
+	}
+	return &File{ra: f, tree: bmff.NewTree(f, size)}
+}
+
+// SetLimits sets the limits on the boxes read from the file, which
+// default to bmff.DefaultLimits. It should be called before any other
+// method of f.
+func (f *File) SetLimits(l bmff.Limits) {
+	f.tree.SetLimits(l)
 }
 
 // ErrNoEXIF is returned by File.EXIF when a file does not contain an EXIF item.
@@ -141,21 +350,120 @@ func (f *File) EXIF() ([]byte, error) {
 	if it.Location == nil {
 		return nil, errors.New("heif: file said it contained EXIF, but didn't say where")
 	}
-	if n := len(it.Location.Extents); n != 1 {
-		return nil, fmt.Errorf("heif: expected 1 EXIF section, saw %d", n)
+	var size uint64
+	for _, e := range it.Location.Extents {
+		size += e.Length
 	}
-	offLen := it.Location.Extents[0]
 	const maxSize = 20 << 10 // 20MB of EXIF seems excessive; cap it for sanity
-	if offLen.Length > maxSize {
-		return nil, fmt.Errorf("heif: declared EXIF size %d exceeds threshold of %d bytes", offLen.Length, maxSize)
+	if size > maxSize {
+		return nil, fmt.Errorf("heif: declared EXIF size %d exceeds threshold of %d bytes", size, maxSize)
 	}
-	buf := make([]byte, offLen.Length-4)
-	n, err := f.ra.ReadAt(buf, int64(offLen.Offset)+4) // TODO: why 4? did I miss something?
+	buf, err := it.Data()
 	if err != nil {
-		log.Printf("Read %d bytes + %v: %q", n, err, buf)
 		return nil, err
 	}
-	return buf, nil
+	// The item starts with a 4 byte exif_tiff_header_offset, the
+	// size of what precedes the TIFF header: usually the "Exif\x00\x00"
+	// prefix of a JPEG APP1 segment, which we keep.
+	if len(buf) < 4 {
+		return nil, errors.New("heif: EXIF item too short")
+	}
+	return buf[4:], nil
+}
+
+// ErrNoXMP is returned by File.XMP when a file does not contain XMP.
+var ErrNoXMP = errors.New("heif: no XMP found")
+
+// XMP returns the raw XMP packet from the file: the contents of its
+// "mime" item of type "application/rdf+xml", decompressed if needed.
+// The error is ErrNoXMP if the file did not contain XMP.
+func (f *File) XMP() ([]byte, error) {
+	items, err := f.MetadataItems()
+	if err != nil {
+		return nil, err
+	}
+	for _, it := range items {
+		if it.Info.ItemType != "mime" || it.Info.ContentType != "application/rdf+xml" {
+			continue
+		}
+		buf, err := it.Data()
+		if err != nil {
+			return nil, err
+		}
+		return decodeContent(buf, it.Info.ContentEncoding)
+	}
+	return nil, ErrNoXMP
+}
+
+// decodeContent undoes the HTTP content encoding of a "mime" item.
+func decodeContent(buf []byte, encoding string) ([]byte, error) {
+	var r io.Reader
+	var err error
+	switch encoding {
+	case "", "identity":
+		return buf, nil
+	case "gzip":
+		r, err = gzip.NewReader(bytes.NewReader(buf))
+	case "deflate":
+		r, err = zlib.NewReader(bytes.NewReader(buf))
+	default:
+		return nil, fmt.Errorf("heif: unsupported content encoding %q", encoding)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("heif: decoding %s content: %v", encoding, err)
+	}
+	out, err := ioutil.ReadAll(io.LimitReader(r, maxItemSize+1))
+	if err != nil {
+		return nil, fmt.Errorf("heif: decoding %s content: %v", encoding, err)
+	}
+	if len(out) > maxItemSize {
+		return nil, fmt.Errorf("heif: decoded %s content too large", encoding)
+	}
+	return out, nil
+}
+
+// ErrNoICCProfile is returned by File.ICCProfile when the primary
+// image has no ICC profile.
+var ErrNoICCProfile = errors.New("heif: no ICC profile found")
+
+// ICCProfile returns the ICC color profile of the file's primary
+// image. See Item.ICCProfile.
+// The error is ErrNoICCProfile if it has none.
+func (f *File) ICCProfile() ([]byte, error) {
+	it, err := f.PrimaryItem()
+	if err != nil {
+		return nil, err
+	}
+	if p := it.ICCProfile(); p != nil {
+		return p, nil
+	}
+	return nil, ErrNoICCProfile
+}
+
+// MetadataItems returns the file's "mime" and "uri " items, such as
+// XMP, in file order. Their Info field has their content type (for
+// "mime" items) or URI type (for "uri " items); their Data method
+// returns their contents.
+func (f *File) MetadataItems() ([]*Item, error) {
+	meta, err := f.getMeta()
+	if err != nil {
+		return nil, err
+	}
+	if meta.ItemInfo == nil {
+		return nil, nil
+	}
+	var items []*Item
+	for _, iie := range meta.ItemInfo.ItemInfos {
+		if iie.ItemType != "mime" && iie.ItemType != "uri " {
+			continue
+		}
+		it, err := f.ItemByID(iie.ItemID)
+		if err != nil {
+			return nil, err
+		}
+		items = append(items, it)
+	}
+	return items, nil
 }
 
 func (f *File) setMetaErr(err error) error {
@@ -172,22 +480,37 @@ func (f *File) getMeta() (*BoxMeta, error) {
 	if f.meta != nil {
 		return f.meta, nil
 	}
-	const assumedMaxSize = 5 << 40 // arbitrary
-	sr := io.NewSectionReader(f.ra, 0, assumedMaxSize)
-	bmr := bmff.NewReader(sr)
-
 	meta := &BoxMeta{}
 
-	pbox, err := bmr.ReadAndParseBox(bmff.TypeFtyp)
-	if err != nil {
+	boxes, err := f.tree.Boxes()
+	if len(boxes) == 0 || boxes[0].Type != bmff.TypeFtyp {
+		if err == nil {
+			err = errors.New("heif: file doesn't start with an ftyp box")
+		}
 		return nil, f.setMetaErr(err)
 	}
+	pbox, err := boxes[0].Parse()
+	if err != nil {
+		return nil, f.setMetaErr(fmt.Errorf("error parsing ftyp box: %v", err))
+	}
 	meta.FileType = pbox.(*bmff.FileTypeBox)
 
-	pbox, err = bmr.ReadAndParseBox(bmff.TypeMeta)
+	// The meta box usually follows the ftyp box, but in image
+	// sequences it may come after the moov box.
+	node, err := f.topLevelBox(bmff.TypeMeta)
 	if err != nil {
 		return nil, f.setMetaErr(err)
 	}
+	if node == nil {
+		return nil, f.setMetaErr(errors.New("heif: file lacks a meta box"))
+	}
+	if node.Size == -1 || node.Size > maxItemSize {
+		return nil, f.setMetaErr(errors.New("heif: meta box has unsupported size"))
+	}
+	pbox, err = node.Parse()
+	if err != nil {
+		return nil, f.setMetaErr(fmt.Errorf("error parsing meta box: %v", err))
+	}
 	metabox := pbox.(*bmff.MetaBox)
 
 	for _, box := range metabox.Children {
@@ -209,6 +532,10 @@ func (f *File) getMeta() (*BoxMeta, error) {
 			meta.Properties = v
 		case *bmff.ItemLocationBox:
 			meta.ItemLocation = v
+		case *bmff.ItemDataBox:
+			meta.ItemData = v
+		case *bmff.ItemReferenceBox:
+			meta.ItemRefs = v
 		}
 	}
 
@@ -216,6 +543,45 @@ func (f *File) getMeta() (*BoxMeta, error) {
 	return f.meta, nil
 }
 
+// topLevelBox returns the file's first top-level box of type typ, or
+// nil if there is none. Errors reading the boxes after it, such as
+// trailing garbage, are ignored.
+func (f *File) topLevelBox(typ bmff.BoxType) (*bmff.Node, error) {
+	boxes, err := f.tree.Boxes()
+	for _, b := range boxes {
+		if b.Type == typ {
+			return b, nil
+		}
+	}
+	return nil, err
+}
+
+// Format returns the file's format according to the brands of its
+// FileTypeBox: "avif" for AVIF, "heic" for HEVC-coded HEIF (HEIC), or
+// "heif" for other HEIF files.
+func (f *File) Format() (string, error) {
+	meta, err := f.getMeta()
+	if err != nil {
+		return "", err
+	}
+	ft := meta.FileType
+	switch ft.MajorBrand {
+	case "avif", "avis":
+		return "avif", nil
+	case "heic", "heix", "heim", "heis", "hevc", "hevx":
+		return "heic", nil
+	}
+	switch {
+	case ft.HasBrand("avif") || ft.HasBrand("avis"):
+		return "avif", nil
+	case ft.HasBrand("heic") || ft.HasBrand("heix"):
+		return "heic", nil
+	case ft.HasBrand("mif1") || ft.HasBrand("msf1"):
+		return "heif", nil
+	}
+	return "", fmt.Errorf("heif: unknown file brand %q", ft.MajorBrand)
+}
+
 // PrimaryItem returns the HEIF file's primary item.
 func (f *File) PrimaryItem() (*Item, error) {
 	meta, err := f.getMeta()
@@ -225,7 +591,70 @@ func (f *File) PrimaryItem() (*Item, error) {
 	if meta.PrimaryItem == nil {
 		return nil, errors.New("heif: HEIF file lacks primary item box")
 	}
-	return f.ItemByID(uint32(meta.PrimaryItem.ItemID))
+	return f.ItemByID(meta.PrimaryItem.ItemID)
+}
+
+// references returns the IDs of the items referenced by item from with
+// references of type typ, in order.
+func (f *File) references(from uint32, typ string) ([]uint32, error) {
+	meta, err := f.getMeta()
+	if err != nil {
+		return nil, err
+	}
+	if meta.ItemRefs == nil {
+		return nil, nil
+	}
+	var ids []uint32
+	for _, ref := range meta.ItemRefs.References {
+		if ref.FromItemID == from && ref.Type.EqualString(typ) {
+			ids = append(ids, ref.ToItemIDs...)
+		}
+	}
+	return ids, nil
+}
+
+// referencing returns the IDs of the items with references of type
+// typ to item to.
+func (f *File) referencing(to uint32, typ string) ([]uint32, error) {
+	meta, err := f.getMeta()
+	if err != nil {
+		return nil, err
+	}
+	if meta.ItemRefs == nil {
+		return nil, nil
+	}
+	var ids []uint32
+	for _, ref := range meta.ItemRefs.References {
+		if !ref.Type.EqualString(typ) {
+			continue
+		}
+		for _, id := range ref.ToItemIDs {
+			if id == to {
+				ids = append(ids, ref.FromItemID)
+				break
+			}
+		}
+	}
+	return ids, nil
+}
+
+// Thumbnails returns the thumbnail images of item it, as declared by
+// their "thmb" item references, in file order. Use their
+// SpatialExtents method to pick one of a suitable size.
+func (f *File) Thumbnails(it *Item) ([]*Item, error) {
+	ids, err := f.referencing(it.ID, "thmb")
+	if err != nil {
+		return nil, err
+	}
+	var thumbs []*Item
+	for _, id := range ids {
+		thumb, err := f.ItemByID(id)
+		if err != nil {
+			return nil, fmt.Errorf("heif: thumbnail %d of item %d: %v", id, it.ID, err)
+		}
+		thumbs = append(thumbs, thumb)
+	}
+	return thumbs, nil
 }
 
 // ItemByID by returns the file's Item of a given ID.
@@ -241,7 +670,7 @@ func (f *File) ItemByID(id uint32) (*Item, error) {
 	}
 	if meta.ItemLocation != nil {
 		for _, ilbe := range meta.ItemLocation.Items {
-			if uint32(ilbe.ItemID) == id {
+			if ilbe.ItemID == id {
 				shallowCopy := ilbe
 				it.Location = &shallowCopy
 			}
@@ -249,7 +678,7 @@ func (f *File) ItemByID(id uint32) (*Item, error) {
 	}
 	if meta.ItemInfo != nil {
 		for _, iie := range meta.ItemInfo.ItemInfos {
-			if uint32(iie.ItemID) == id {
+			if iie.ItemID == id {
 				it.Info = iie
 			}
 		}
@@ -2,12 +2,21 @@ package heif
 
 import (
 	"bytes"
+	"compress/gzip"
 	"fmt"
+	"image"
+	"image/color"
+	"io"
+	"io/ioutil"
+	"math/rand"
 	"os"
+	"strings"
 	"testing"
 
 	"github.com/rwcarlsen/goexif/exif"
 	"github.com/rwcarlsen/goexif/tiff"
+
+	"go4.org/media/heif/bmff"
 )
 
 func TestAll(t *testing.T) {
@@ -111,3 +120,500 @@ type walkFunc func(exif.FieldName, *tiff.Tag) error
 func (f walkFunc) Walk(name exif.FieldName, tag *tiff.Tag) error {
 	return f(name, tag)
 }
+
+func TestDecode(t *testing.T) {
+	f, err := os.Open("testdata/thumbnail.heic")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+
+	cfg, format, err := image.DecodeConfig(f)
+	if err != nil {
+		t.Fatalf("DecodeConfig: %v", err)
+	}
+	if format != "heic" || cfg.Width != 320 || cfg.Height != 240 || cfg.ColorModel != color.YCbCrModel {
+		t.Errorf("DecodeConfig = %q, %+v; want heic, 320x240 YCbCr", format, cfg)
+	}
+
+	if _, err := f.Seek(0, io.SeekStart); err != nil {
+		t.Fatal(err)
+	}
+	img, format, err := image.Decode(f)
+	if err != nil {
+		t.Fatalf("Decode: %v", err)
+	}
+	if format != "heic" {
+		t.Errorf("format = %q; want heic", format)
+	}
+	ycc, ok := img.(*image.YCbCr)
+	if !ok {
+		t.Fatalf("decoded a %T; want *image.YCbCr", img)
+	}
+	if got, want := ycc.Rect, image.Rect(0, 0, 320, 240); got != want {
+		t.Errorf("bounds = %v; want %v", got, want)
+	}
+	// thumbnail.yuv.gz is the I420 output of libde265 for the HEVC
+	// stream of thumbnail.heic. HEVC decoding is exact, so the
+	// samples must match.
+	zf, err := os.Open("testdata/thumbnail.yuv.gz")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer zf.Close()
+	zr, err := gzip.NewReader(zf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ref, err := ioutil.ReadAll(zr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(ref) != 320*240*3/2 {
+		t.Fatalf("reference is %d bytes; want %d", len(ref), 320*240*3/2)
+	}
+	planes := []struct {
+		name         string
+		got          []byte
+		stride, w, h int
+	}{
+		{"Y", ycc.Y, ycc.YStride, 320, 240},
+		{"Cb", ycc.Cb, ycc.CStride, 160, 120},
+		{"Cr", ycc.Cr, ycc.CStride, 160, 120},
+	}
+	for _, p := range planes {
+		want := ref[:p.w*p.h]
+		ref = ref[p.w*p.h:]
+		diffs := 0
+		for y := 0; y < p.h; y++ {
+			for x := 0; x < p.w; x++ {
+				if g, w := p.got[y*p.stride+x], want[y*p.w+x]; g != w {
+					if diffs == 0 {
+						t.Errorf("%s(%d, %d) = %d; want %d", p.name, x, y, g, w)
+					}
+					diffs++
+				}
+			}
+		}
+		if diffs > 0 {
+			t.Errorf("%s plane: %d of %d samples differ from the reference", p.name, diffs, p.w*p.h)
+		}
+	}
+}
+
+func TestGridLayout(t *testing.T) {
+	f, err := os.Open("testdata/park.heic")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	it, err := Open(f).PrimaryItem()
+	if err != nil {
+		t.Fatal(err)
+	}
+	g, err := it.Grid()
+	if err != nil {
+		t.Fatalf("Grid: %v", err)
+	}
+	if want := (Grid{Rows: 6, Columns: 8, Width: 4032, Height: 3024}); *g != want {
+		t.Errorf("Grid = %+v; want %+v", *g, want)
+	}
+	tiles, err := it.Tiles()
+	if err != nil {
+		t.Fatalf("Tiles: %v", err)
+	}
+	if len(tiles) != 48 {
+		t.Fatalf("got %d tiles; want 48", len(tiles))
+	}
+	for i, tile := range tiles {
+		if tile.ID != uint32(i+1) {
+			t.Errorf("tile %d has ID %d; want %d", i, tile.ID, i+1)
+		}
+		if w, h, _ := tile.SpatialExtents(); w != 512 || h != 512 {
+			t.Errorf("tile %d is %dx%d; want 512x512", i, w, h)
+		}
+	}
+}
+
+func TestGridImage(t *testing.T) {
+	// grid.heic is a 2x2 grid of 320x240 tiles, items 1, 2, 2, 1,
+	// each holding the image of thumbnail.heic, cropped to 600x450.
+	thumb, err := decodeFile("testdata/thumbnail.heic")
+	if err != nil {
+		t.Fatal(err)
+	}
+	img, err := decodeFile("testdata/grid.heic")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, want := img.Bounds(), image.Rect(0, 0, 600, 450); got != want {
+		t.Fatalf("bounds = %v; want %v", got, want)
+	}
+	for y := 0; y < 450; y++ {
+		for x := 0; x < 600; x++ {
+			if got, want := img.At(x, y), thumb.At(x%320, y%240); got != want {
+				t.Fatalf("At(%d, %d) = %v; want %v", x, y, got, want)
+			}
+		}
+	}
+}
+
+func TestGridSelfReference(t *testing.T) {
+	orig, err := ioutil.ReadFile("testdata/grid.heic")
+	if err != nil {
+		t.Fatal(err)
+	}
+	// The dimg reference from grid item 3 to its tiles.
+	dimg := bytes.Index(orig, []byte("dimg\x00\x03\x00\x04"))
+	if dimg < 0 {
+		t.Fatal("dimg reference not found")
+	}
+	for tile := 0; tile < 4; tile++ {
+		data := append([]byte(nil), orig...)
+		// Make the tile the grid itself.
+		data[dimg+8+2*tile+1] = 3
+		_, err := Open(bytes.NewReader(data)).Image()
+		if err == nil || !strings.Contains(err.Error(), "has a grid as a tile") {
+			t.Errorf("tile %d referencing its grid: err = %v", tile, err)
+		}
+	}
+}
+
+func decodeFile(name string) (image.Image, error) {
+	f, err := os.Open(name)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	return Open(f).Image()
+}
+
+func TestThumbnails(t *testing.T) {
+	f, err := os.Open("testdata/park.heic")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	h := Open(f)
+	it, err := h.PrimaryItem()
+	if err != nil {
+		t.Fatal(err)
+	}
+	thumbs, err := h.Thumbnails(it)
+	if err != nil {
+		t.Fatalf("Thumbnails: %v", err)
+	}
+	if len(thumbs) != 1 {
+		t.Fatalf("got %d thumbnails; want 1", len(thumbs))
+	}
+	thumb := thumbs[0]
+	if thumb.ID != 50 {
+		t.Errorf("thumbnail ID = %d; want 50", thumb.ID)
+	}
+	if w, h, ok := thumb.SpatialExtents(); !ok || w != 320 || h != 240 {
+		t.Errorf("thumbnail SpatialExtents = %d, %d, %v; want 320, 240, true", w, h, ok)
+	}
+	data, err := thumb.Data()
+	if err != nil {
+		t.Fatalf("Data: %v", err)
+	}
+	want := make([]byte, 17653)
+	if _, err := f.ReadAt(want, 4067); err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(data, want) {
+		t.Errorf("thumbnail Data doesn't match the file's bytes")
+	}
+	if _, err := thumb.Image(); err != nil {
+		t.Errorf("thumbnail Image: %v", err)
+	}
+
+	// Thumbnails don't have thumbnails.
+	if thumbs, err := h.Thumbnails(thumb); err != nil || len(thumbs) != 0 {
+		t.Errorf("Thumbnails(thumbnail) = %v, %v; want none", thumbs, err)
+	}
+}
+
+func TestColorProperties(t *testing.T) {
+	f, err := os.Open("testdata/park.heic")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	it, err := Open(f).PrimaryItem()
+	if err != nil {
+		t.Fatal(err)
+	}
+	icc := it.ICCProfile()
+	if len(icc) != 548 || string(icc[36:40]) != "acsp" {
+		t.Errorf("ICCProfile = %d bytes, not a 548 byte ICC profile", len(icc))
+	}
+	if cp := it.ColorParameters(); cp != nil {
+		t.Errorf("ColorParameters = %+v; want nil", cp)
+	}
+	if got, want := fmt.Sprint(it.BitsPerChannel()), "[8 8 8]"; got != want {
+		t.Errorf("BitsPerChannel = %v; want %v", got, want)
+	}
+	tr, ok := it.DisplayTransform()
+	if want := (Transform{Crop: image.Rect(0, 0, 4032, 3024)}); !ok || tr != want {
+		t.Errorf("DisplayTransform = %+v, %v; want %+v, true", tr, ok, want)
+	}
+}
+
+func TestDisplayTransform(t *testing.T) {
+	ispe := &bmff.ImageSpatialExtentsProperty{ImageWidth: 100, ImageHeight: 80}
+	tests := []struct {
+		name   string
+		props  []bmff.Box
+		want   Transform
+		vw, vh int
+	}{
+		{
+			name:  "none",
+			props: []bmff.Box{ispe},
+			want:  Transform{Crop: image.Rect(0, 0, 100, 80)},
+			vw:    100, vh: 80,
+		},
+		{
+			name: "centered clap",
+			props: []bmff.Box{ispe, &bmff.CleanAperture{
+				WidthN: 50, WidthD: 1, HeightN: 40, HeightD: 1,
+				HorizOffsetN: 0, HorizOffsetD: 1, VertOffsetN: 0, VertOffsetD: 1,
+			}},
+			want: Transform{Crop: image.Rect(25, 20, 75, 60)},
+			vw:   50, vh: 40,
+		},
+		{
+			name: "offset clap, rotated and mirrored",
+			props: []bmff.Box{ispe, &bmff.CleanAperture{
+				WidthN: 100, WidthD: 2, HeightN: 40, HeightD: 1,
+				HorizOffsetN: -10, HorizOffsetD: 2, VertOffsetN: 20, VertOffsetD: 1,
+			}, &bmff.ImageRotation{Angle: 1}, &bmff.ImageMirror{Axis: 1}},
+			want: Transform{Crop: image.Rect(20, 40, 70, 80), Rotations: 1, Mirror: true, MirrorAxis: 1},
+			vw:   40, vh: 50,
+		},
+		{
+			name: "invalid clap",
+			props: []bmff.Box{ispe, &bmff.CleanAperture{
+				WidthN: 50, WidthD: 0, HeightN: 40, HeightD: 1, HorizOffsetD: 1, VertOffsetD: 1,
+			}, &bmff.ImageMirror{Axis: 0}},
+			want: Transform{Crop: image.Rect(0, 0, 100, 80), Mirror: true},
+			vw:   100, vh: 80,
+		},
+	}
+	for _, tt := range tests {
+		it := &Item{Properties: tt.props}
+		got, ok := it.DisplayTransform()
+		if !ok || got != tt.want {
+			t.Errorf("%s: DisplayTransform = %+v, %v; want %+v, true", tt.name, got, ok, tt.want)
+		}
+		if vw, vh, _ := it.VisualDimensions(); vw != tt.vw || vh != tt.vh {
+			t.Errorf("%s: VisualDimensions = %d, %d; want %d, %d", tt.name, vw, vh, tt.vw, tt.vh)
+		}
+	}
+}
+
+func TestMetadata(t *testing.T) {
+	f, err := os.Open("testdata/park.heic")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	h := Open(f)
+	xmp, err := h.XMP()
+	if err != nil {
+		t.Fatalf("XMP: %v", err)
+	}
+	if !bytes.Contains(xmp, []byte("<x:xmpmeta")) {
+		t.Errorf("XMP = %q; doesn't look like XMP", xmp)
+	}
+	icc, err := h.ICCProfile()
+	if err != nil || len(icc) != 548 {
+		t.Errorf("ICCProfile = %d bytes, %v; want 548 bytes", len(icc), err)
+	}
+	items, err := h.MetadataItems()
+	if err != nil {
+		t.Fatalf("MetadataItems: %v", err)
+	}
+	if len(items) != 1 || items[0].ID != 52 || items[0].Info.ContentType != "application/rdf+xml" {
+		t.Errorf("MetadataItems = %v; want item 52 of type application/rdf+xml", items)
+	}
+}
+
+// meta32.heic is a metadata-only file with 32-bit item IDs (infe
+// version 3, iloc version 2, pitm version 1), a version 0 infe, an
+// EXIF item in two extents, a gzipped XMP item, and a "uri " item.
+func TestMetadata32(t *testing.T) {
+	f, err := os.Open("testdata/meta32.heic")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	h := Open(f)
+	it, err := h.PrimaryItem()
+	if err != nil {
+		t.Fatalf("PrimaryItem: %v", err)
+	}
+	if it.ID != 0x10000 {
+		t.Errorf("primary item ID = %#x; want 0x10000", it.ID)
+	}
+	if cp := it.ColorParameters(); cp == nil || cp.ColorPrimaries != 1 || cp.TransferCharacteristics != 13 || cp.MatrixCoefficients != 6 || !cp.FullRange {
+		t.Errorf("ColorParameters = %+v; want sRGB nclx", cp)
+	}
+	if _, err := h.ICCProfile(); err != ErrNoICCProfile {
+		t.Errorf("ICCProfile error = %v; want ErrNoICCProfile", err)
+	}
+
+	exbuf, err := h.EXIF()
+	if err != nil {
+		t.Fatalf("EXIF: %v", err)
+	}
+	if got, want := fmt.Sprintf("%x", exbuf), "4578696600004d4d002a00000008000000000000"; got != want {
+		t.Errorf("EXIF = %s; want %s", got, want)
+	}
+
+	xmp, err := h.XMP()
+	if err != nil {
+		t.Fatalf("XMP: %v", err)
+	}
+	if !bytes.HasPrefix(xmp, []byte("<x:xmpmeta")) {
+		t.Errorf("XMP = %q; want decompressed XMP", xmp)
+	}
+
+	items, err := h.MetadataItems()
+	if err != nil {
+		t.Fatalf("MetadataItems: %v", err)
+	}
+	var got []string
+	for _, it := range items {
+		got = append(got, fmt.Sprintf("%#x %q %q %q %q", it.ID, it.Info.ItemType, it.Info.Name, it.Info.ContentType, it.Info.ItemURIType))
+	}
+	want := []string{
+		`0x10002 "mime" "" "application/rdf+xml" ""`,
+		`0x5 "mime" "note" "text/plain" ""`,
+		`0x10003 "uri " "" "" "urn:example:thing"`,
+	}
+	if fmt.Sprint(got) != fmt.Sprint(want) {
+		t.Errorf("MetadataItems =\n%s\nwant\n%s", strings.Join(got, "\n"), strings.Join(want, "\n"))
+	}
+	if data, err := items[1].Data(); err != nil || string(data) != "hello" {
+		t.Errorf("Data of version 0 item = %q, %v; want hello", data, err)
+	}
+}
+
+// rotate.avif is a synthetic AVIF file whose AV1 data isn't real.
+func TestAVIF(t *testing.T) {
+	f, err := os.Open("testdata/rotate.avif")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	h := Open(f)
+	if format, err := h.Format(); err != nil || format != "avif" {
+		t.Errorf("Format = %q, %v; want avif", format, err)
+	}
+	it, err := h.PrimaryItem()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := it.CodecType(); got != "av01" {
+		t.Errorf("CodecType = %q; want av01", got)
+	}
+	ac := it.AV1Config()
+	if ac == nil {
+		t.Fatal("no AV1Config")
+	}
+	if ac.BitDepth() != 10 || ac.Monochrome || !ac.ChromaSubsamplingX || !ac.ChromaSubsamplingY || len(ac.ConfigOBUs) != 13 {
+		t.Errorf("AV1Config = %+v; want 10-bit 4:2:0 with 13 bytes of config OBUs", ac)
+	}
+	if w, h, ok := it.VisualDimensions(); !ok || w != 480 || h != 640 {
+		t.Errorf("VisualDimensions = %d, %d, %v; want 480, 640, true", w, h, ok)
+	}
+	if got := fmt.Sprint(it.BitsPerChannel()); got != "[10 10 10]" {
+		t.Errorf("BitsPerChannel = %v; want [10 10 10]", got)
+	}
+	if exbuf, err := h.EXIF(); err != nil || !bytes.HasPrefix(exbuf, []byte("Exif\x00\x00MM")) {
+		t.Errorf("EXIF = %q, %v", exbuf, err)
+	}
+	if _, err := f.Seek(0, io.SeekStart); err != nil {
+		t.Fatal(err)
+	}
+	cfg, err := DecodeConfig(f)
+	if err != nil || cfg.Width != 640 || cfg.Height != 480 {
+		t.Errorf("DecodeConfig = %+v, %v; want 640x480", cfg, err)
+	}
+	if _, err := it.Image(); err == nil {
+		t.Errorf("Image of AV1 item succeeded")
+	}
+
+	for _, tt := range []struct{ file, format, codec string }{
+		{"testdata/park.heic", "heic", "hvc1"},
+		{"testdata/meta32.heic", "heic", "hvc1"}, // mif1, compatible with heic
+	} {
+		f, err := os.Open(tt.file)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer f.Close()
+		h := Open(f)
+		if format, err := h.Format(); err != nil || format != tt.format {
+			t.Errorf("%s: Format = %q, %v; want %q", tt.file, format, err, tt.format)
+		}
+		it, err := h.PrimaryItem()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got := it.CodecType(); got != tt.codec {
+			t.Errorf("%s: CodecType = %q; want %q", tt.file, got, tt.codec)
+		}
+	}
+}
+
+func TestImageUnsupported(t *testing.T) {
+	f, err := os.Open("testdata/park.heic")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	h := Open(f)
+	it, err := h.ItemByID(51) // EXIF
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := it.Image(); err == nil {
+		t.Errorf("Image of EXIF item succeeded; want error")
+	}
+}
+
+// TestDecodeCorrupt checks that decoding damaged files fails cleanly
+// rather than panicking.
+func TestDecodeCorrupt(t *testing.T) {
+	orig, err := ioutil.ReadFile("testdata/thumbnail.heic")
+	if err != nil {
+		t.Fatal(err)
+	}
+	rnd := rand.New(rand.NewSource(1))
+	iters := 200
+	if testing.Short() {
+		iters = 20
+	}
+	for i := 0; i < iters; i++ {
+		buf := append([]byte(nil), orig...)
+		switch i % 3 {
+		case 0:
+			buf = buf[:rnd.Intn(len(buf))]
+		default:
+			for n := 1 + rnd.Intn(8); n > 0; n-- {
+				buf[rnd.Intn(len(buf))] ^= byte(1 + rnd.Intn(255))
+			}
+		}
+		func() {
+			defer func() {
+				if e := recover(); e != nil {
+					t.Fatalf("iteration %d: panic: %v", i, e)
+				}
+			}()
+			Decode(bytes.NewReader(buf))
+		}()
+	}
+}
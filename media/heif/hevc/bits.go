@@ -0,0 +1,137 @@
+/*
+Copyright 2026 The go4 Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+     http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package hevc
+
+import "errors"
+
+var errShortData = errors.New("hevc: unexpected end of data")
+
+// unescapeRBSP returns the raw byte sequence payload of a NAL unit,
+// with emulation prevention bytes (the 0x03 in 0x000003) removed.
+func unescapeRBSP(nal []byte) []byte {
+	out := make([]byte, 0, len(nal))
+	zeros := 0
+	for _, b := range nal {
+		if zeros >= 2 && b == 3 {
+			zeros = 0
+			continue
+		}
+		if b == 0 {
+			zeros++
+		} else {
+			zeros = 0
+		}
+		out = append(out, b)
+	}
+	return out
+}
+
+// bitReader reads bits, most significant first, from an RBSP.
+// Reading past the end sets a sticky error and returns zeros.
+type bitReader struct {
+	buf []byte
+	pos int // in bits
+	err error
+}
+
+func (br *bitReader) bitsLeft() int { return len(br.buf)*8 - br.pos }
+
+func (br *bitReader) byteAligned() bool { return br.pos&7 == 0 }
+
+func (br *bitReader) alignByte() { br.pos = (br.pos + 7) &^ 7 }
+
+func (br *bitReader) bit() uint32 {
+	if br.pos >= len(br.buf)*8 {
+		br.err = errShortData
+		return 0
+	}
+	v := uint32(br.buf[br.pos>>3]>>(7-uint(br.pos&7))) & 1
+	br.pos++
+	return v
+}
+
+func (br *bitReader) flag() bool { return br.bit() == 1 }
+
+// u reads an n-bit unsigned integer, for n <= 32.
+func (br *bitReader) u(n int) uint32 {
+	var v uint32
+	for i := 0; i < n; i++ {
+		v = v<<1 | br.bit()
+	}
+	return v
+}
+
+func (br *bitReader) skip(n int) {
+	br.pos += n
+	if br.pos > len(br.buf)*8 {
+		br.err = errShortData
+	}
+}
+
+// ue reads an unsigned Exp-Golomb-coded integer.
+func (br *bitReader) ue() uint32 {
+	zeros := 0
+	for br.bit() == 0 {
+		if br.err != nil || zeros >= 32 {
+			if br.err == nil {
+				br.err = errors.New("hevc: invalid Exp-Golomb code")
+			}
+			return 0
+		}
+		zeros++
+	}
+	return (1<<uint(zeros) - 1) + br.u(zeros)
+}
+
+// se reads a signed Exp-Golomb-coded integer.
+func (br *bitReader) se() int32 {
+	v := br.ue()
+	if v&1 == 1 {
+		return int32((v + 1) / 2)
+	}
+	return -int32(v / 2)
+}
+
+// moreRBSPData reports whether there is more data before the
+// rbsp_trailing_bits.
+func (br *bitReader) moreRBSPData() bool {
+	if br.err != nil {
+		return false
+	}
+	last := len(br.buf) - 1
+	for last >= 0 && br.buf[last] == 0 {
+		last--
+	}
+	if last < 0 {
+		return false
+	}
+	// Bit position of the rbsp_stop_one_bit.
+	stop := last*8 + 7
+	for b := br.buf[last]; b&1 == 0; b >>= 1 {
+		stop--
+	}
+	return br.pos < stop
+}
+
+// log2Ceil returns Ceil(Log2(v)).
+func log2Ceil(v int) int {
+	n := 0
+	for (1 << uint(n)) < v {
+		n++
+	}
+	return n
+}
@@ -0,0 +1,227 @@
+/*
+Copyright 2026 The go4 Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+     http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package hevc
+
+// This file implements the CABAC arithmetic decoding engine of
+// section 9.3.4.3, reading the bitstream one bit at a time so that the
+// position after a terminating bin is exact (needed for PCM samples and
+// for the byte-aligned substreams of tiles and wavefronts).
+
+// ctxState is the state of one context variable.
+type ctxState struct {
+	state uint8 // pStateIdx
+	mps   uint8 // valMps
+}
+
+type cabac struct {
+	br     *bitReader
+	rng    uint32 // ivlCurrRange
+	offset uint32 // ivlOffset
+}
+
+// init initializes the arithmetic decoding engine (9.3.2.5) at the
+// current, byte-aligned, position of br.
+func (c *cabac) init() {
+	c.rng = 510
+	c.offset = c.br.u(9)
+}
+
+func (c *cabac) renorm() {
+	for c.rng < 256 {
+		c.rng <<= 1
+		c.offset = c.offset<<1 | c.br.bit()
+	}
+}
+
+// decodeBin decodes a context-coded bin (9.3.4.3.2).
+func (c *cabac) decodeBin(ctx *ctxState) uint32 {
+	lps := uint32(rangeTabLPS[ctx.state][(c.rng>>6)&3])
+	c.rng -= lps
+	var bin uint32
+	if c.offset >= c.rng {
+		bin = uint32(1 - ctx.mps)
+		c.offset -= c.rng
+		c.rng = lps
+		if ctx.state == 0 {
+			ctx.mps = 1 - ctx.mps
+		}
+		ctx.state = transIdxLPS[ctx.state]
+	} else {
+		bin = uint32(ctx.mps)
+		if ctx.state < 62 {
+			ctx.state++
+		}
+	}
+	c.renorm()
+	return bin
+}
+
+// decodeBypass decodes a bypass-coded bin (9.3.4.3.4).
+func (c *cabac) decodeBypass() uint32 {
+	c.offset = c.offset<<1 | c.br.bit()
+	if c.offset >= c.rng {
+		c.offset -= c.rng
+		return 1
+	}
+	return 0
+}
+
+// decodeBypassBits decodes n bypass-coded bins as a fixed-length
+// unsigned integer, most significant bit first.
+func (c *cabac) decodeBypassBits(n int) uint32 {
+	var v uint32
+	for i := 0; i < n; i++ {
+		v = v<<1 | c.decodeBypass()
+	}
+	return v
+}
+
+// decodeTerminate decodes a bin with the terminating process
+// (9.3.4.3.5). When it returns 1, the bitstream position is just past
+// the last bit of the arithmetic-coded data.
+func (c *cabac) decodeTerminate() uint32 {
+	c.rng -= 2
+	if c.offset >= c.rng {
+		return 1
+	}
+	c.renorm()
+	return 0
+}
+
+// initContext returns the initial state for a context variable with
+// the given initValue at slice QP qp (9.3.2.2).
+func initContext(initValue uint8, qp int) ctxState {
+	slope := int(initValue>>4)*5 - 45
+	offset := int(initValue&15)<<3 - 16
+	if qp < 0 {
+		qp = 0
+	} else if qp > 51 {
+		qp = 51
+	}
+	pre := (slope*qp)>>4 + offset
+	if pre < 1 {
+		pre = 1
+	} else if pre > 126 {
+		pre = 126
+	}
+	if pre <= 63 {
+		return ctxState{state: uint8(63 - pre), mps: 0}
+	}
+	return ctxState{state: uint8(pre - 64), mps: 1}
+}
+
+// Offsets of each syntax element's context variables within a
+// contextSet. Only the syntax elements found in I slices are present.
+const (
+	ctxSAOMerge            = 0
+	ctxSAOTypeIdx          = ctxSAOMerge + 1
+	ctxSplitCUFlag         = ctxSAOTypeIdx + 1
+	ctxCUTransquantBypass  = ctxSplitCUFlag + 3
+	ctxCUQPDeltaAbs        = ctxCUTransquantBypass + 1
+	ctxPartMode            = ctxCUQPDeltaAbs + 2
+	ctxPrevIntraLumaPred   = ctxPartMode + 1
+	ctxIntraChromaPredMode = ctxPrevIntraLumaPred + 1
+	ctxSplitTransformFlag  = ctxIntraChromaPredMode + 1
+	ctxCbfLuma             = ctxSplitTransformFlag + 3
+	ctxCbfChroma           = ctxCbfLuma + 2
+	ctxTransformSkipFlag   = ctxCbfChroma + 5
+	ctxLastSigCoeffXPrefix = ctxTransformSkipFlag + 2
+	ctxLastSigCoeffYPrefix = ctxLastSigCoeffXPrefix + 18
+	ctxCodedSubBlockFlag   = ctxLastSigCoeffYPrefix + 18
+	ctxSigCoeffFlag        = ctxCodedSubBlockFlag + 4
+	ctxCoeffAbsGreater1    = ctxSigCoeffFlag + 42
+	ctxCoeffAbsGreater2    = ctxCoeffAbsGreater1 + 24
+	numContexts            = ctxCoeffAbsGreater2 + 6
+)
+
+type contextSet [numContexts]ctxState
+
+// initValuesI are the context initValues for I slices (initType 0),
+// from tables 9-5 through 9-37, in the order of the ctx constants.
+var initValuesI = [numContexts]uint8{
+	// sao_merge_left_flag and sao_merge_up_flag
+	153,
+	// sao_type_idx_luma and sao_type_idx_chroma
+	200,
+	// split_cu_flag
+	139, 141, 157,
+	// cu_transquant_bypass_flag
+	154,
+	// cu_qp_delta_abs
+	154, 154,
+	// part_mode
+	184,
+	// prev_intra_luma_pred_flag
+	184,
+	// intra_chroma_pred_mode
+	63,
+	// split_transform_flag
+	153, 138, 138,
+	// cbf_luma
+	111, 141,
+	// cbf_cb and cbf_cr
+	94, 138, 182, 154, 154,
+	// transform_skip_flag, luma then chroma
+	139, 139,
+	// last_sig_coeff_x_prefix
+	110, 110, 124, 125, 140, 153, 125, 127, 140, 109, 111, 143, 127, 111, 79, 108, 123, 63,
+	// last_sig_coeff_y_prefix
+	110, 110, 124, 125, 140, 153, 125, 127, 140, 109, 111, 143, 127, 111, 79, 108, 123, 63,
+	// coded_sub_block_flag
+	91, 171, 134, 141,
+	// sig_coeff_flag
+	111, 111, 125, 110, 110, 94, 124, 108, 124, 107, 125, 141, 179, 153,
+	125, 107, 125, 141, 179, 153, 125, 107, 125, 141, 179, 153, 125, 140,
+	139, 182, 182, 152, 136, 152, 136, 153, 136, 139, 111, 136, 139, 111,
+	// coeff_abs_level_greater1_flag
+	140, 92, 137, 138, 140, 152, 138, 139, 153, 74, 149, 92, 139, 107,
+	122, 152, 140, 179, 166, 182, 140, 227, 122, 197,
+	// coeff_abs_level_greater2_flag
+	138, 153, 136, 167, 152, 152,
+}
+
+func (cs *contextSet) init(qp int) {
+	for i, v := range initValuesI {
+		cs[i] = initContext(v, qp)
+	}
+}
+
+var rangeTabLPS = [64][4]uint8{
+	{128, 176, 208, 240}, {128, 167, 197, 227}, {128, 158, 187, 216}, {123, 150, 178, 205},
+	{116, 142, 169, 195}, {111, 135, 160, 185}, {105, 128, 152, 175}, {100, 122, 144, 166},
+	{95, 116, 137, 158}, {90, 110, 130, 150}, {85, 104, 123, 142}, {81, 99, 117, 135},
+	{77, 94, 111, 128}, {73, 89, 105, 122}, {69, 85, 100, 116}, {66, 80, 95, 110},
+	{62, 76, 90, 104}, {59, 72, 86, 99}, {56, 69, 81, 94}, {53, 65, 77, 89},
+	{51, 62, 73, 85}, {48, 59, 69, 80}, {46, 56, 66, 76}, {43, 53, 63, 72},
+	{41, 50, 59, 69}, {39, 48, 56, 65}, {37, 45, 54, 62}, {35, 43, 51, 59},
+	{33, 41, 48, 56}, {32, 39, 46, 53}, {30, 37, 43, 50}, {29, 35, 41, 48},
+	{27, 33, 39, 45}, {26, 31, 37, 43}, {24, 30, 35, 41}, {23, 28, 33, 39},
+	{22, 27, 32, 37}, {21, 26, 30, 35}, {20, 24, 29, 33}, {19, 23, 27, 31},
+	{18, 22, 26, 30}, {17, 21, 25, 28}, {16, 20, 23, 27}, {15, 19, 22, 25},
+	{14, 18, 21, 24}, {14, 17, 20, 23}, {13, 16, 19, 22}, {12, 15, 18, 21},
+	{12, 14, 17, 20}, {11, 14, 16, 19}, {11, 13, 15, 18}, {10, 12, 15, 17},
+	{10, 12, 14, 16}, {9, 11, 13, 15}, {9, 11, 12, 14}, {8, 10, 12, 14},
+	{8, 9, 11, 13}, {7, 9, 11, 12}, {7, 9, 10, 12}, {7, 8, 10, 11},
+	{6, 8, 9, 11}, {6, 7, 9, 10}, {6, 7, 8, 9}, {2, 2, 2, 2},
+}
+
+var transIdxLPS = [64]uint8{
+	0, 0, 1, 2, 2, 4, 4, 5, 6, 7, 8, 9, 9, 11, 11, 12,
+	13, 13, 15, 15, 16, 16, 18, 18, 19, 19, 21, 21, 22, 22, 23, 24,
+	24, 25, 26, 26, 27, 27, 28, 29, 29, 30, 30, 30, 31, 32, 32, 33,
+	33, 33, 34, 34, 35, 35, 35, 36, 36, 36, 37, 37, 37, 38, 38, 63,
+}
@@ -0,0 +1,804 @@
+/*
+Copyright 2026 The go4 Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+     http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package hevc
+
+import (
+	"errors"
+	"sort"
+)
+
+// This file implements the slice segment data syntax of section 7.3.8,
+// reconstructing each block as it is parsed.
+
+// decodeSliceSegment decodes the slice segment data of sh, which
+// starts at byte dataOff of rbsp.
+func (p *picDecoder) decodeSliceSegment(sh *sliceHeader, rbsp []byte, dataOff int) error {
+	sps, pps := p.sps, p.pps
+	if p.log2MinCuQpDelta < sps.log2MinCbSize {
+		return errors.New("hevc: invalid diff_cu_qp_delta_depth")
+	}
+	if !sh.dependent {
+		p.lastIndependent = sh
+		p.firstQG = true
+	}
+	p.slices = append(p.slices, sh)
+	p.sliceIdx = int32(len(p.slices) - 1)
+	p.sh = sh
+
+	br := &bitReader{buf: rbsp, pos: 8 * dataOff}
+	p.cabac = cabac{br: br}
+	p.cabac.init()
+
+	n := sps.picWidthCtb * sps.picHeightCtb
+	log2Ctb := uint(sps.log2CtbSize)
+	ctbAddrTs := p.rsToTs[sh.segmentAddr]
+	for first := true; ; first = false {
+		ctbAddrRs := p.tsToRs[ctbAddrTs]
+		if p.ctbSlice[ctbAddrRs] >= 0 {
+			return errors.New("hevc: coding tree block decoded twice")
+		}
+		p.ctbSlice[ctbAddrRs] = p.sliceIdx
+		p.ctbAddr = ctbAddrRs
+		x, y := ctbAddrRs%sps.picWidthCtb, ctbAddrRs/sps.picWidthCtb
+		tileStart := ctbAddrTs == 0 || p.tileID[ctbAddrRs] != p.tileID[p.tsToRs[ctbAddrTs-1]]
+		rowStart := pps.entropyCodingSync && x == p.colBd[p.tileCol(x)]
+		if tileStart || rowStart {
+			p.firstQG = true
+		}
+
+		// Context variable initialization and synchronization
+		// (9.3.1).
+		switch {
+		case tileStart:
+			p.ctx.init(sh.qp)
+		case rowStart:
+			xT, yT := (x+1)<<log2Ctb, (y-1)<<log2Ctb
+			if p.available(x<<log2Ctb, y<<log2Ctb, xT, yT) {
+				p.ctx = p.wppCtx
+			} else {
+				p.ctx.init(sh.qp)
+			}
+		case first && sh.dependent:
+			p.ctx = p.dsCtx
+		case first:
+			p.ctx.init(sh.qp)
+		}
+
+		if sh.saoLuma || sh.saoChroma {
+			p.parseSAO(x, y)
+		}
+		p.codingQuadtree(x<<log2Ctb, y<<log2Ctb, sps.log2CtbSize, 0)
+		if p.err != nil {
+			return p.err
+		}
+		if br.err != nil {
+			return br.err
+		}
+		if pps.entropyCodingSync && x == p.colBd[p.tileCol(x)]+1 {
+			p.wppCtx = p.ctx
+		}
+
+		end := p.cabac.decodeTerminate() == 1 // end_of_slice_segment_flag
+		ctbAddrTs++
+		if end {
+			if pps.dependentSliceSegments {
+				p.dsCtx = p.ctx
+			}
+			break
+		}
+		if ctbAddrTs >= n {
+			return errors.New("hevc: slice segment data extends past the picture")
+		}
+		next := p.tsToRs[ctbAddrTs]
+		nx := next % sps.picWidthCtb
+		if (pps.tilesEnabled && p.tileID[next] != p.tileID[ctbAddrRs]) ||
+			(pps.entropyCodingSync && nx == p.colBd[p.tileCol(nx)]) {
+			if p.cabac.decodeTerminate() != 1 { // end_of_subset_one_bit
+				return errors.New("hevc: missing end_of_subset_one_bit")
+			}
+			br.alignByte()
+			p.cabac.init()
+		}
+	}
+	return br.err
+}
+
+func (p *picDecoder) setErr(err error) {
+	if p.err == nil {
+		p.err = err
+	}
+}
+
+// parseSAO parses the sao syntax structure of the CTB at (rx, ry).
+func (p *picDecoder) parseSAO(rx, ry int) {
+	sh, c := p.sh, &p.cabac
+	w := p.sps.picWidthCtb
+	addr := ry*w + rx
+	sao := &p.ctbSAO[addr]
+	if rx > 0 && addr-1 >= sh.sliceAddr && p.tileID[addr] == p.tileID[addr-1] {
+		if c.decodeBin(&p.ctx[ctxSAOMerge]) == 1 { // sao_merge_left_flag
+			*sao = p.ctbSAO[addr-1]
+			return
+		}
+	}
+	if ry > 0 && addr-w >= sh.sliceAddr && p.tileID[addr] == p.tileID[addr-w] {
+		if c.decodeBin(&p.ctx[ctxSAOMerge]) == 1 { // sao_merge_up_flag
+			*sao = p.ctbSAO[addr-w]
+			return
+		}
+	}
+	*sao = saoParams{}
+	for cIdx := 0; cIdx < p.nPlanes; cIdx++ {
+		if (cIdx == 0 && !sh.saoLuma) || (cIdx > 0 && !sh.saoChroma) {
+			continue
+		}
+		if cIdx == 2 {
+			sao.typeIdx[2] = sao.typeIdx[1]
+			sao.eoClass[2] = sao.eoClass[1]
+		} else if c.decodeBin(&p.ctx[ctxSAOTypeIdx]) == 1 {
+			sao.typeIdx[cIdx] = 1 + uint8(c.decodeBypass())
+		}
+		if sao.typeIdx[cIdx] == 0 {
+			continue
+		}
+		var abs [4]int8
+		for i := range abs {
+			for abs[i] < 7 && c.decodeBypass() == 1 {
+				abs[i]++
+			}
+		}
+		if sao.typeIdx[cIdx] == 1 {
+			for i := range abs {
+				if abs[i] != 0 && c.decodeBypass() == 1 {
+					abs[i] = -abs[i]
+				}
+			}
+			sao.bandPos[cIdx] = uint8(c.decodeBypassBits(5))
+			copy(sao.offset[cIdx][1:], abs[:])
+		} else {
+			sao.offset[cIdx] = [5]int8{0, abs[0], abs[1], -abs[2], -abs[3]}
+			if cIdx < 2 {
+				sao.eoClass[cIdx] = uint8(c.decodeBypassBits(2))
+			}
+		}
+	}
+}
+
+func (p *picDecoder) codingQuadtree(x0, y0, log2Size, depth int) {
+	sps := p.sps
+	size := 1 << uint(log2Size)
+	var split bool
+	if x0+size <= sps.width && y0+size <= sps.height && log2Size > sps.log2MinCbSize {
+		inc := 0
+		if p.available(x0, y0, x0-1, y0) && int(p.blkAt(x0-1, y0).ctDepth) > depth {
+			inc++
+		}
+		if p.available(x0, y0, x0, y0-1) && int(p.blkAt(x0, y0-1).ctDepth) > depth {
+			inc++
+		}
+		split = p.cabac.decodeBin(&p.ctx[ctxSplitCUFlag+inc]) == 1
+	} else {
+		split = log2Size > sps.log2MinCbSize
+	}
+	if log2Size >= p.log2MinCuQpDelta {
+		p.isCuQpDeltaCoded = false
+		p.cuQpDeltaVal = 0
+	}
+	if !split {
+		p.codingUnit(x0, y0, log2Size, depth)
+		return
+	}
+	half := size / 2
+	for i := 0; i < 4; i++ {
+		x1, y1 := x0+(i&1)*half, y0+(i>>1)*half
+		if x1 < sps.width && y1 < sps.height {
+			p.codingQuadtree(x1, y1, log2Size-1, depth+1)
+		}
+		if p.err != nil || p.cabac.br.err != nil {
+			return
+		}
+	}
+}
+
+// predictQP derives qPY_PRED for the quantization group at (xQg, yQg)
+// (8.6.1).
+func (p *picDecoder) predictQP(xQg, yQg int) {
+	prev := p.qpY
+	if p.firstQG {
+		prev = p.sh.qp
+		p.firstQG = false
+	}
+	mask := p.sps.ctbSize - 1
+	qpA, qpB := prev, prev
+	// The neighbors are only used if they are in the current CTB.
+	if xQg&mask != 0 {
+		qpA = int(p.blkAt(xQg-1, yQg).qpY)
+	}
+	if yQg&mask != 0 {
+		qpB = int(p.blkAt(xQg, yQg-1).qpY)
+	}
+	p.qpYPred = (qpA + qpB + 1) >> 1
+}
+
+func (p *picDecoder) setQP() {
+	p.qpY = (p.qpYPred + p.cuQpDeltaVal + 52) % 52
+}
+
+func (p *picDecoder) codingUnit(x0, y0, log2Size, depth int) {
+	sps, pps, c := p.sps, p.pps, &p.cabac
+	size := 1 << uint(log2Size)
+
+	qgMask := 1<<uint(p.log2MinCuQpDelta) - 1
+	if xQg, yQg := x0&^qgMask, y0&^qgMask; xQg != p.qgX || yQg != p.qgY {
+		p.qgX, p.qgY = xQg, yQg
+		p.predictQP(xQg, yQg)
+	}
+	p.setQP()
+
+	p.cuTransquantBypass = false
+	if pps.transquantBypassEnabled {
+		p.cuTransquantBypass = c.decodeBin(&p.ctx[ctxCUTransquantBypass]) == 1
+	}
+	var flags uint8
+	if p.cuTransquantBypass {
+		flags = blkNoFilter
+	}
+	nxn := false
+	if log2Size == sps.log2MinCbSize {
+		nxn = c.decodeBin(&p.ctx[ctxPartMode]) == 0
+	}
+	pcm := false
+	if !nxn && sps.pcmEnabled && log2Size >= sps.log2MinPCMCbSize && log2Size <= sps.log2MaxPCMCbSize {
+		pcm = c.decodeTerminate() == 1
+	}
+	if pcm {
+		if sps.pcmLoopFilterDisable {
+			flags = blkNoFilter
+		}
+		p.setBlk(x0, y0, size, func(b *blkInfo) {
+			*b = blkInfo{predMode: 1, ctDepth: uint8(depth), qpY: int8(p.qpY), flags: flags}
+		})
+		p.markEdges(x0, y0, size)
+		p.decodePCM(x0, y0, log2Size)
+		return
+	}
+
+	pbSize, numPB := size, 1
+	if nxn {
+		pbSize, numPB = size/2, 4
+	}
+	var prevFlag [4]bool
+	for i := 0; i < numPB; i++ {
+		prevFlag[i] = c.decodeBin(&p.ctx[ctxPrevIntraLumaPred]) == 1
+	}
+	var lumaMode0 int
+	for i := 0; i < numPB; i++ {
+		xPb, yPb := x0+(i&1)*pbSize, y0+(i>>1)*pbSize
+		cand := p.mpmCandidates(xPb, yPb)
+		var mode int
+		if prevFlag[i] {
+			idx := 0
+			for idx < 2 && c.decodeBypass() == 1 { // mpm_idx
+				idx++
+			}
+			mode = cand[idx]
+		} else {
+			mode = int(c.decodeBypassBits(5)) // rem_intra_luma_pred_mode
+			sort.Ints(cand[:])
+			for _, m := range cand {
+				if mode >= m {
+					mode++
+				}
+			}
+		}
+		if i == 0 {
+			lumaMode0 = mode
+		}
+		p.setBlk(xPb, yPb, pbSize, func(b *blkInfo) {
+			*b = blkInfo{predMode: uint8(mode), ctDepth: uint8(depth), qpY: int8(p.qpY), flags: flags}
+		})
+	}
+	if p.nPlanes == 3 {
+		v := 4
+		if c.decodeBin(&p.ctx[ctxIntraChromaPredMode]) == 1 {
+			v = int(c.decodeBypassBits(2))
+		}
+		if v == 4 {
+			p.chromaMode = lumaMode0
+		} else {
+			p.chromaMode = [4]int{0, 26, 10, 1}[v]
+			if p.chromaMode == lumaMode0 {
+				p.chromaMode = 34
+			}
+		}
+	}
+
+	p.intraSplit = nxn
+	p.maxTrafoDepth = sps.maxTrafoDepthIntra
+	if nxn {
+		p.maxTrafoDepth++
+	}
+	p.transformTree(x0, y0, x0, y0, log2Size, 0, 0, false, false)
+
+	// The QP may have changed with a cu_qp_delta_abs in the
+	// transform tree.
+	qp := int8(p.qpY)
+	p.setBlk(x0, y0, size, func(b *blkInfo) { b.qpY = qp })
+}
+
+// mpmCandidates returns candModeList for the prediction block at
+// (xPb, yPb) (8.4.2).
+func (p *picDecoder) mpmCandidates(xPb, yPb int) [3]int {
+	candA, candB := 1, 1 // INTRA_DC
+	if p.available(xPb, yPb, xPb-1, yPb) {
+		candA = int(p.blkAt(xPb-1, yPb).predMode)
+	}
+	ctbMask := p.sps.ctbSize - 1
+	if yPb&ctbMask != 0 && p.available(xPb, yPb, xPb, yPb-1) {
+		candB = int(p.blkAt(xPb, yPb-1).predMode)
+	}
+	if candA == candB {
+		if candA < 2 {
+			return [3]int{0, 1, 26}
+		}
+		return [3]int{candA, 2 + (candA+29)%32, 2 + (candA-2+1)%32}
+	}
+	switch {
+	case candA != 0 && candB != 0:
+		return [3]int{candA, candB, 0}
+	case candA != 1 && candB != 1:
+		return [3]int{candA, candB, 1}
+	}
+	return [3]int{candA, candB, 26}
+}
+
+// decodePCM reads the pcm_sample of a coding unit.
+func (p *picDecoder) decodePCM(x0, y0, log2Size int) {
+	sps := p.sps
+	br := p.cabac.br
+	br.alignByte() // pcm_alignment_zero_bit
+	size := 1 << uint(log2Size)
+	read := func(cIdx, x0, y0, size, depth int) {
+		plane, stride := p.planes[cIdx], p.stride[cIdx]
+		for y := 0; y < size; y++ {
+			for x := 0; x < size; x++ {
+				plane[(y0+y)*stride+x0+x] = uint8(br.u(depth) << uint(8-depth))
+			}
+		}
+	}
+	read(0, x0, y0, size, sps.pcmBitDepthY)
+	if p.nPlanes == 3 {
+		read(1, x0/2, y0/2, size/2, sps.pcmBitDepthC)
+		read(2, x0/2, y0/2, size/2, sps.pcmBitDepthC)
+	}
+	p.cabac.init()
+}
+
+func (p *picDecoder) transformTree(x0, y0, xBase, yBase, log2Size, depth, blkIdx int, parentCbfCb, parentCbfCr bool) {
+	sps, c := p.sps, &p.cabac
+	var split bool
+	if log2Size <= sps.log2MaxTbSize && log2Size > sps.log2MinTbSize && depth < p.maxTrafoDepth && !(p.intraSplit && depth == 0) {
+		split = c.decodeBin(&p.ctx[ctxSplitTransformFlag+5-log2Size]) == 1
+	} else {
+		split = log2Size > sps.log2MaxTbSize || (p.intraSplit && depth == 0)
+	}
+	var cbfCb, cbfCr bool
+	if p.nPlanes == 3 {
+		if log2Size > 2 {
+			if depth > 4 {
+				p.setErr(errors.New("hevc: transform tree too deep"))
+				return
+			}
+			if depth == 0 || parentCbfCb {
+				cbfCb = c.decodeBin(&p.ctx[ctxCbfChroma+depth]) == 1
+			}
+			if depth == 0 || parentCbfCr {
+				cbfCr = c.decodeBin(&p.ctx[ctxCbfChroma+depth]) == 1
+			}
+		} else {
+			// The chroma blocks of 4x4 luma blocks are coded
+			// with the last of them, using the parent's flags.
+			cbfCb, cbfCr = parentCbfCb, parentCbfCr
+		}
+	}
+	if split {
+		half := 1 << uint(log2Size-1)
+		for i := 0; i < 4; i++ {
+			p.transformTree(x0+(i&1)*half, y0+(i>>1)*half, x0, y0, log2Size-1, depth+1, i, cbfCb, cbfCr)
+			if p.err != nil || c.br.err != nil {
+				return
+			}
+		}
+		return
+	}
+	inc := 0
+	if depth == 0 {
+		inc = 1
+	}
+	cbfLuma := c.decodeBin(&p.ctx[ctxCbfLuma+inc]) == 1
+	p.transformUnit(x0, y0, xBase, yBase, log2Size, blkIdx, cbfLuma, cbfCb, cbfCr)
+}
+
+func (p *picDecoder) transformUnit(x0, y0, xBase, yBase, log2Size, blkIdx int, cbfLuma, cbfCb, cbfCr bool) {
+	if (cbfLuma || cbfCb || cbfCr) && p.pps.cuQPDeltaEnabled && !p.isCuQpDeltaCoded {
+		p.parseCuQpDelta()
+	}
+	p.markEdges(x0, y0, 1<<uint(log2Size))
+	p.reconstruct(0, x0, y0, log2Size, int(p.blkAt(x0, y0).predMode), cbfLuma)
+	if p.nPlanes != 3 {
+		return
+	}
+	if log2Size > 2 {
+		p.reconstruct(1, x0/2, y0/2, log2Size-1, p.chromaMode, cbfCb)
+		p.reconstruct(2, x0/2, y0/2, log2Size-1, p.chromaMode, cbfCr)
+	} else if blkIdx == 3 {
+		p.reconstruct(1, xBase/2, yBase/2, 2, p.chromaMode, cbfCb)
+		p.reconstruct(2, xBase/2, yBase/2, 2, p.chromaMode, cbfCr)
+	}
+}
+
+func (p *picDecoder) parseCuQpDelta() {
+	c := &p.cabac
+	v := 0
+	for v < 5 && c.decodeBin(&p.ctx[ctxCUQPDeltaAbs+min(v, 1)]) == 1 {
+		v++
+	}
+	if v == 5 {
+		// EG0 suffix.
+		k := 0
+		for c.decodeBypass() == 1 {
+			v += 1 << uint(k)
+			k++
+			if k > 16 {
+				p.setErr(errors.New("hevc: invalid cu_qp_delta_abs"))
+				return
+			}
+		}
+		v += int(c.decodeBypassBits(k))
+	}
+	if v > 0 && c.decodeBypass() == 1 {
+		v = -v
+	}
+	if v < -26 || v > 25 {
+		p.setErr(errors.New("hevc: cu_qp_delta out of range"))
+		return
+	}
+	p.isCuQpDeltaCoded = true
+	p.cuQpDeltaVal = v
+	p.setQP()
+}
+
+// markEdges marks the left and top edges of a transform block for
+// deblocking, unless they must not be filtered.
+func (p *picDecoder) markEdges(x0, y0, size int) {
+	if p.sh.deblockingDisabled {
+		return
+	}
+	if x0&7 == 0 && x0 > 0 && p.filterAcross(p.ctbAddrOf(x0-1, y0)) {
+		for y := y0; y < y0+size && y < p.sps.height; y += 4 {
+			p.blkAt(x0, y).flags |= blkEdgeV
+		}
+	}
+	if y0&7 == 0 && y0 > 0 && p.filterAcross(p.ctbAddrOf(x0, y0-1)) {
+		for x := x0; x < x0+size && x < p.sps.width; x += 4 {
+			p.blkAt(x, y0).flags |= blkEdgeH
+		}
+	}
+}
+
+// filterAcross reports whether the deblocking filter may filter the
+// boundary between the current CTB and the preceding CTB nb.
+func (p *picDecoder) filterAcross(nb int) bool {
+	if nb == p.ctbAddr {
+		return true
+	}
+	if p.slices[p.ctbSlice[nb]].sliceAddr != p.sh.sliceAddr && !p.sh.loopFilterAcrossSlices {
+		return false
+	}
+	return p.tileID[nb] == p.tileID[p.ctbAddr] || p.pps.loopFilterAcrossTiles
+}
+
+// reconstruct predicts, and if cbf is set, decodes and adds the
+// residual of, the transform block of component cIdx at (x0, y0), in
+// that component's samples.
+func (p *picDecoder) reconstruct(cIdx, x0, y0, log2Size, predMode int, cbf bool) {
+	p.predictIntra(cIdx, x0, y0, log2Size, predMode)
+	if cbf {
+		p.residualCoding(cIdx, x0, y0, log2Size, predMode)
+	}
+}
+
+// ctxIdxMap gives sig_coeff_flag contexts in 4x4 blocks.
+var ctxIdxMap = [16]uint8{0, 1, 4, 5, 2, 3, 4, 5, 6, 6, 8, 8, 7, 7, 8, 8}
+
+func (p *picDecoder) residualCoding(cIdx, x0, y0, log2Size, predMode int) {
+	c, pps := &p.cabac, p.pps
+	size := 1 << uint(log2Size)
+	coeffs := p.coeffs[:size*size]
+	for i := range coeffs {
+		coeffs[i] = 0
+	}
+
+	transformSkip := false
+	if pps.transformSkipEnabled && !p.cuTransquantBypass && log2Size == 2 {
+		transformSkip = c.decodeBin(&p.ctx[ctxTransformSkipFlag+min(cIdx, 1)]) == 1
+	}
+
+	// last_sig_coeff_{x,y}_{prefix,suffix}
+	var ctxOffset, ctxShift int
+	if cIdx == 0 {
+		ctxOffset, ctxShift = 3*(log2Size-2)+(log2Size-1)>>2, (log2Size+1)>>2
+	} else {
+		ctxOffset, ctxShift = 15, log2Size-2
+	}
+	prefix := func(base int) int {
+		v := 0
+		for v < 2*log2Size-1 && c.decodeBin(&p.ctx[base+ctxOffset+v>>uint(ctxShift)]) == 1 {
+			v++
+		}
+		return v
+	}
+	suffix := func(prefix int) int {
+		if prefix <= 3 {
+			return prefix
+		}
+		n := uint(prefix>>1 - 1)
+		return 1<<n*(2+prefix&1) + int(c.decodeBypassBits(int(n)))
+	}
+	lastX := prefix(ctxLastSigCoeffXPrefix)
+	lastY := prefix(ctxLastSigCoeffYPrefix)
+	lastX = suffix(lastX)
+	lastY = suffix(lastY)
+
+	scanIdx := 0
+	if log2Size == 2 || (log2Size == 3 && cIdx == 0) {
+		switch {
+		case predMode >= 6 && predMode <= 14:
+			scanIdx = 2
+		case predMode >= 22 && predMode <= 30:
+			scanIdx = 1
+		}
+	}
+	if scanIdx == 2 {
+		lastX, lastY = lastY, lastX
+	}
+
+	log2Sb := log2Size - 2
+	sbWidth := 1 << uint(log2Sb)
+	sbScan := scanOrder[log2Sb][scanIdx]
+	posScan := scanOrder[2][scanIdx]
+	lastSubBlock, lastScanPos := 0, 0
+	for i, s := range sbScan {
+		if int(s.x) == lastX>>2 && int(s.y) == lastY>>2 {
+			lastSubBlock = i
+		}
+	}
+	for n, s := range posScan {
+		if int(s.x) == lastX&3 && int(s.y) == lastY&3 {
+			lastScanPos = n
+		}
+	}
+
+	var csbf [8][8]bool // coded_sub_block_flag, [xS][yS]
+	greater1Ctx := 1
+	signHiding := pps.signDataHiding && !p.cuTransquantBypass
+	for i := lastSubBlock; i >= 0; i-- {
+		xS, yS := int(sbScan[i].x), int(sbScan[i].y)
+		prevCsbf := 0
+		if xS < sbWidth-1 && csbf[xS+1][yS] {
+			prevCsbf |= 1
+		}
+		if yS < sbWidth-1 && csbf[xS][yS+1] {
+			prevCsbf |= 2
+		}
+		inferSbDc := false
+		if i < lastSubBlock && i > 0 {
+			inc := min(prevCsbf, 1)
+			if cIdx > 0 {
+				inc += 2
+			}
+			csbf[xS][yS] = c.decodeBin(&p.ctx[ctxCodedSubBlockFlag+inc]) == 1
+			inferSbDc = true
+		} else {
+			csbf[xS][yS] = true
+		}
+		if !csbf[xS][yS] {
+			continue
+		}
+
+		// sig_coeff_flag, collecting the significant scan
+		// positions in decoding order.
+		var sig [16]uint8
+		numSig := 0
+		start := 15
+		if i == lastSubBlock {
+			sig[0] = uint8(lastScanPos)
+			numSig = 1
+			start = lastScanPos - 1
+		}
+		for n := start; n >= 0; n-- {
+			xP, yP := int(posScan[n].x), int(posScan[n].y)
+			if n == 0 && inferSbDc {
+				sig[numSig] = 0
+				numSig++
+				break
+			}
+			var sigCtx int
+			switch {
+			case log2Size == 2:
+				sigCtx = int(ctxIdxMap[yP<<2+xP])
+			case xS == 0 && yS == 0 && xP == 0 && yP == 0:
+				sigCtx = 0
+			default:
+				switch prevCsbf {
+				case 0:
+					switch {
+					case xP+yP == 0:
+						sigCtx = 2
+					case xP+yP < 3:
+						sigCtx = 1
+					}
+				case 1:
+					sigCtx = 2 - min(yP, 2)
+				case 2:
+					sigCtx = 2 - min(xP, 2)
+				default:
+					sigCtx = 2
+				}
+				if cIdx == 0 {
+					if xS > 0 || yS > 0 {
+						sigCtx += 3
+					}
+					if log2Size == 3 {
+						if scanIdx == 0 {
+							sigCtx += 9
+						} else {
+							sigCtx += 15
+						}
+					} else {
+						sigCtx += 21
+					}
+				} else if log2Size == 3 {
+					sigCtx += 9
+				} else {
+					sigCtx += 12
+				}
+			}
+			if cIdx > 0 {
+				sigCtx += 27
+			}
+			if c.decodeBin(&p.ctx[ctxSigCoeffFlag+sigCtx]) == 1 {
+				sig[numSig] = uint8(n)
+				numSig++
+				inferSbDc = false
+			}
+		}
+		if numSig == 0 {
+			continue
+		}
+
+		// coeff_abs_level_greater1_flag and
+		// coeff_abs_level_greater2_flag
+		ctxSet := 0
+		if i > 0 && cIdx == 0 {
+			ctxSet = 2
+		}
+		if greater1Ctx == 0 {
+			ctxSet++
+		}
+		greater1Ctx = 1
+		var level [16]int
+		firstG1 := -1
+		for k := 0; k < numSig; k++ {
+			level[k] = 1
+			if k >= 8 {
+				continue
+			}
+			inc := ctxSet*4 + min(greater1Ctx, 3)
+			if cIdx > 0 {
+				inc += 16
+			}
+			if c.decodeBin(&p.ctx[ctxCoeffAbsGreater1+inc]) == 1 {
+				level[k] = 2
+				greater1Ctx = 0
+				if firstG1 < 0 {
+					firstG1 = k
+				}
+			} else if greater1Ctx > 0 {
+				greater1Ctx++
+			}
+		}
+		if firstG1 >= 0 {
+			inc := ctxSet
+			if cIdx > 0 {
+				inc += 4
+			}
+			level[firstG1] += int(c.decodeBin(&p.ctx[ctxCoeffAbsGreater2+inc]))
+		}
+
+		// coeff_sign_flag
+		hidden := signHiding && int(sig[0])-int(sig[numSig-1]) > 3
+		numSigns := numSig
+		if hidden {
+			numSigns--
+		}
+		signs := c.decodeBypassBits(numSigns) << uint(32-numSigns)
+
+		// coeff_abs_level_remaining
+		rice := uint(0)
+		sumAbs := 0
+		for k := 0; k < numSig; k++ {
+			base := 1
+			if k < 8 {
+				base = 2
+				if k == firstG1 {
+					base = 3
+				}
+			}
+			if level[k] == base {
+				level[k] += p.coeffAbsLevelRemaining(rice)
+				if level[k] > 3<<rice && rice < 4 {
+					rice++
+				}
+			}
+			v := level[k]
+			if k < numSigns && signs&(1<<31>>uint(k)) != 0 {
+				v = -v
+			}
+			if hidden {
+				sumAbs += level[k]
+				if k == numSig-1 && sumAbs&1 == 1 {
+					v = -v
+				}
+			}
+			pos := posScan[sig[k]]
+			coeffs[(yS<<2+int(pos.y))*size+xS<<2+int(pos.x)] = int32(v)
+		}
+	}
+	if p.err != nil {
+		return
+	}
+	p.addResidual(cIdx, x0, y0, log2Size, transformSkip)
+}
+
+func (p *picDecoder) coeffAbsLevelRemaining(rice uint) int {
+	c := &p.cabac
+	prefix := 0
+	for c.decodeBypass() == 1 {
+		prefix++
+		if prefix > 32 {
+			p.setErr(errors.New("hevc: invalid coeff_abs_level_remaining"))
+			return 0
+		}
+	}
+	if prefix <= 3 {
+		return prefix<<rice + int(c.decodeBypassBits(int(rice)))
+	}
+	n := prefix - 3 + int(rice)
+	if n > 32 {
+		p.setErr(errors.New("hevc: invalid coeff_abs_level_remaining"))
+		return 0
+	}
+	return (1<<uint(prefix-3)+2)<<rice + int(c.decodeBypassBits(n))
+}
+
+func min(a, b int) int {
+	if a < b {
+		return a
+	}
+	return b
+}
@@ -0,0 +1,308 @@
+/*
+Copyright 2026 The go4 Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+     http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package hevc
+
+// This file implements the in-loop filters: deblocking (8.7.2) and
+// sample adaptive offset (8.7.3).
+
+var betaTable = [52]int{
+	0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0,
+	6, 7, 8, 9, 10, 11, 12, 13, 14, 15, 16, 17, 18, 20, 22, 24,
+	26, 28, 30, 32, 34, 36, 38, 40, 42, 44, 46, 48, 50, 52, 54, 56,
+	58, 60, 62, 64,
+}
+
+var tcTable = [54]int{
+	0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0,
+	1, 1, 1, 1, 1, 1, 1, 1, 1, 2, 2, 2, 2, 3, 3, 3, 3, 4, 4, 4,
+	5, 5, 6, 6, 7, 8, 9, 10, 11, 13, 14, 16, 18, 20, 22, 24,
+}
+
+// deblock applies the deblocking filter to the whole picture: first
+// to all vertical edges, then to all horizontal ones. In I slices,
+// every edge has a boundary strength of 2.
+func (p *picDecoder) deblock() {
+	sps := p.sps
+	for _, vertical := range []bool{true, false} {
+		flag := uint8(blkEdgeV)
+		if !vertical {
+			flag = blkEdgeH
+		}
+		for y := 0; y < sps.height; y += 4 {
+			for x := 0; x < sps.width; x += 4 {
+				if p.blkAt(x, y).flags&flag == 0 {
+					continue
+				}
+				p.filterLuma(x, y, vertical)
+				if p.nPlanes == 3 {
+					// Chroma edges are on an 8x8 chroma
+					// sample grid.
+					if (vertical && x&15 == 0) || (!vertical && y&15 == 0) {
+						p.filterChroma(x, y, vertical)
+					}
+				}
+			}
+		}
+	}
+}
+
+// edgeParams returns the blocks on either side of the edge segment at
+// luma location (x, y), and the slice containing the q side.
+func (p *picDecoder) edgeParams(x, y int, vertical bool) (bp, bq *blkInfo, sh *sliceHeader) {
+	bq = p.blkAt(x, y)
+	if vertical {
+		bp = p.blkAt(x-1, y)
+	} else {
+		bp = p.blkAt(x, y-1)
+	}
+	return bp, bq, p.slices[p.ctbSlice[p.ctbAddrOf(x, y)]]
+}
+
+// filterLuma filters the four-sample luma edge segment at (x, y).
+func (p *picDecoder) filterLuma(x, y int, vertical bool) {
+	bp, bq, sh := p.edgeParams(x, y, vertical)
+	qpL := (int(bq.qpY) + int(bp.qpY) + 1) >> 1
+	beta := betaTable[clip3(0, 51, qpL+sh.betaOffsetDiv2*2)]
+	tc := tcTable[clip3(0, 53, qpL+2+sh.tcOffsetDiv2*2)]
+
+	pix, stride := p.planes[0], p.stride[0]
+	off := y*stride + x
+	across, along := 1, stride
+	if !vertical {
+		across, along = stride, 1
+	}
+	// P and Q return sample k of line i on either side of the edge.
+	P := func(i, k int) int { return int(pix[off+i*along-(k+1)*across]) }
+	Q := func(i, k int) int { return int(pix[off+i*along+k*across]) }
+
+	dp0 := abs(P(0, 2) - 2*P(0, 1) + P(0, 0))
+	dp3 := abs(P(3, 2) - 2*P(3, 1) + P(3, 0))
+	dq0 := abs(Q(0, 2) - 2*Q(0, 1) + Q(0, 0))
+	dq3 := abs(Q(3, 2) - 2*Q(3, 1) + Q(3, 0))
+	dpq0, dpq3 := dp0+dq0, dp3+dq3
+	if dpq0+dpq3 >= beta {
+		return
+	}
+	strongLine := func(i, dpq int) bool {
+		return dpq < beta>>2 &&
+			abs(P(i, 3)-P(i, 0))+abs(Q(i, 0)-Q(i, 3)) < beta>>3 &&
+			abs(P(i, 0)-Q(i, 0)) < (5*tc+1)>>1
+	}
+	strong := strongLine(0, 2*dpq0) && strongLine(3, 2*dpq3)
+	side := (beta + beta>>1) >> 3
+	dEp := dp0+dp3 < side
+	dEq := dq0+dq3 < side
+	noP := bp.flags&blkNoFilter != 0
+	noQ := bq.flags&blkNoFilter != 0
+
+	for i := 0; i < 4; i++ {
+		p0, p1, p2, p3 := P(i, 0), P(i, 1), P(i, 2), P(i, 3)
+		q0, q1, q2, q3 := Q(i, 0), Q(i, 1), Q(i, 2), Q(i, 3)
+		setP := func(k, v int) {
+			if !noP {
+				pix[off+i*along-(k+1)*across] = clip8(v)
+			}
+		}
+		setQ := func(k, v int) {
+			if !noQ {
+				pix[off+i*along+k*across] = clip8(v)
+			}
+		}
+		if strong {
+			tc2 := 2 * tc
+			setP(0, clip3(p0-tc2, p0+tc2, (p2+2*p1+2*p0+2*q0+q1+4)>>3))
+			setP(1, clip3(p1-tc2, p1+tc2, (p2+p1+p0+q0+2)>>2))
+			setP(2, clip3(p2-tc2, p2+tc2, (2*p3+3*p2+p1+p0+q0+4)>>3))
+			setQ(0, clip3(q0-tc2, q0+tc2, (p1+2*p0+2*q0+2*q1+q2+4)>>3))
+			setQ(1, clip3(q1-tc2, q1+tc2, (p0+q0+q1+q2+2)>>2))
+			setQ(2, clip3(q2-tc2, q2+tc2, (p0+q0+q1+3*q2+2*q3+4)>>3))
+			continue
+		}
+		delta := (9*(q0-p0) - 3*(q1-p1) + 8) >> 4
+		if abs(delta) >= tc*10 {
+			continue
+		}
+		delta = clip3(-tc, tc, delta)
+		setP(0, p0+delta)
+		setQ(0, q0-delta)
+		if dEp {
+			setP(1, p1+clip3(-(tc>>1), tc>>1, (((p2+p0+1)>>1)-p1+delta)>>1))
+		}
+		if dEq {
+			setQ(1, q1+clip3(-(tc>>1), tc>>1, (((q2+q0+1)>>1)-q1-delta)>>1))
+		}
+	}
+}
+
+// filterChroma filters the chroma edge segments corresponding to the
+// luma edge segment at (x, y).
+func (p *picDecoder) filterChroma(x, y int, vertical bool) {
+	bp, bq, sh := p.edgeParams(x, y, vertical)
+	qpi := (int(bq.qpY) + int(bp.qpY) + 1) >> 1
+	noP := bp.flags&blkNoFilter != 0
+	noQ := bq.flags&blkNoFilter != 0
+	for cIdx := 1; cIdx < 3; cIdx++ {
+		offset := p.pps.cbQPOffset
+		if cIdx == 2 {
+			offset = p.pps.crQPOffset
+		}
+		qpc := chromaQP(qpi + offset)
+		tc := tcTable[clip3(0, 53, qpc+2+sh.tcOffsetDiv2*2)]
+		if tc == 0 {
+			continue
+		}
+		pix, stride := p.planes[cIdx], p.stride[cIdx]
+		off := (y/2)*stride + x/2
+		across, along := 1, stride
+		if !vertical {
+			across, along = stride, 1
+		}
+		for i := 0; i < 2; i++ {
+			o := off + i*along
+			p0, p1 := int(pix[o-across]), int(pix[o-2*across])
+			q0, q1 := int(pix[o]), int(pix[o+across])
+			delta := clip3(-tc, tc, ((((q0 - p0) << 2) + p1 - q1 + 4) >> 3))
+			if !noP {
+				pix[o-across] = clip8(p0 + delta)
+			}
+			if !noQ {
+				pix[o] = clip8(q0 - delta)
+			}
+		}
+	}
+}
+
+// saoEdgeOffsets are the (hPos, vPos) of the two neighbors compared
+// by each edge offset class.
+var saoEdgeOffsets = [4][2][2]int{
+	{{-1, 0}, {1, 0}},
+	{{0, -1}, {0, 1}},
+	{{-1, -1}, {1, 1}},
+	{{1, -1}, {-1, 1}},
+}
+
+// applySAO applies the sample adaptive offset filter to the deblocked
+// picture.
+func (p *picDecoder) applySAO() {
+	used := false
+	for _, sh := range p.slices {
+		used = used || sh.saoLuma || sh.saoChroma
+	}
+	if !used {
+		return
+	}
+	for cIdx := 0; cIdx < p.nPlanes; cIdx++ {
+		src := append([]uint8(nil), p.planes[cIdx]...)
+		for addr := range p.ctbSAO {
+			p.saoCTB(cIdx, addr, src)
+		}
+	}
+}
+
+// saoCTB applies SAO to component cIdx of the CTB at raster address
+// addr, reading the deblocked samples from src.
+func (p *picDecoder) saoCTB(cIdx, addr int, src []uint8) {
+	sh := p.slices[p.ctbSlice[addr]]
+	if (cIdx == 0 && !sh.saoLuma) || (cIdx > 0 && !sh.saoChroma) {
+		return
+	}
+	sao := &p.ctbSAO[addr]
+	typ := sao.typeIdx[cIdx]
+	if typ == 0 {
+		return
+	}
+	offset := &sao.offset[cIdx]
+	shift := uint(0)
+	if cIdx > 0 {
+		shift = 1
+	}
+	ctbSize := p.sps.ctbSize >> shift
+	x0 := (addr % p.sps.picWidthCtb) * ctbSize
+	y0 := (addr / p.sps.picWidthCtb) * ctbSize
+	x1, y1 := min(x0+ctbSize, p.pw[cIdx]), min(y0+ctbSize, p.ph[cIdx])
+	dst, stride := p.planes[cIdx], p.stride[cIdx]
+	noFilter := func(x, y int) bool {
+		return p.blkAt(x<<shift, y<<shift).flags&blkNoFilter != 0
+	}
+
+	if typ == 1 { // band offset
+		var table [32]int
+		for k := 0; k < 4; k++ {
+			table[(k+int(sao.bandPos[cIdx]))&31] = int(offset[k+1])
+		}
+		for y := y0; y < y1; y++ {
+			for x := x0; x < x1; x++ {
+				if noFilter(x, y) {
+					continue
+				}
+				v := src[y*stride+x]
+				dst[y*stride+x] = clip8(int(v) + table[v>>3])
+			}
+		}
+		return
+	}
+
+	nb := saoEdgeOffsets[sao.eoClass[cIdx]]
+	for y := y0; y < y1; y++ {
+	pixel:
+		for x := x0; x < x1; x++ {
+			if noFilter(x, y) {
+				continue
+			}
+			cur := int(src[y*stride+x])
+			edgeIdx := 2
+			for _, d := range nb {
+				xN, yN := x+d[0], y+d[1]
+				if xN < 0 || yN < 0 || xN >= p.pw[cIdx] || yN >= p.ph[cIdx] {
+					continue pixel
+				}
+				if xN < x0 || yN < y0 || xN >= x1 || yN >= y1 {
+					if !p.saoAcross(addr, p.ctbAddrOf(xN<<shift, yN<<shift)) {
+						continue pixel
+					}
+				}
+				n := int(src[yN*stride+xN])
+				switch {
+				case cur < n:
+					edgeIdx--
+				case cur > n:
+					edgeIdx++
+				}
+			}
+			// Map edgeIdx 0, 1, 2 to 1, 2, 0.
+			if edgeIdx <= 2 {
+				edgeIdx = (edgeIdx + 1) % 3
+			}
+			dst[y*stride+x] = clip8(cur + int(offset[edgeIdx]))
+		}
+	}
+}
+
+// saoAcross reports whether SAO in CTB cur may use samples of the
+// neighboring CTB nb.
+func (p *picDecoder) saoAcross(cur, nb int) bool {
+	sc, sn := p.slices[p.ctbSlice[cur]], p.slices[p.ctbSlice[nb]]
+	if sc.sliceAddr != sn.sliceAddr {
+		if p.rsToTs[nb] < p.rsToTs[cur] && !sc.loopFilterAcrossSlices {
+			return false
+		}
+		if p.rsToTs[cur] < p.rsToTs[nb] && !sn.loopFilterAcrossSlices {
+			return false
+		}
+	}
+	return p.pps.loopFilterAcrossTiles || p.tileID[cur] == p.tileID[nb]
+}
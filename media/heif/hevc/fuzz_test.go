@@ -0,0 +1,59 @@
+//go:build go1.18
+// +build go1.18
+
+/*
+Copyright 2026 The go4 Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+     http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package hevc
+
+import (
+	"io/ioutil"
+	"path/filepath"
+	"testing"
+)
+
+// maxFuzzPixels bounds the size of the pictures FuzzDecode decodes,
+// keeping each input fast and its memory use small.
+const maxFuzzPixels = 320 * 240
+
+// FuzzDecode decodes its input as NAL units with 4 byte length
+// prefixes. The seeds in testdata are HEVC streams from the heif
+// package's test files.
+func FuzzDecode(f *testing.F) {
+	files, _ := filepath.Glob("testdata/*.hevc")
+	for _, name := range files {
+		data, err := ioutil.ReadFile(name)
+		if err == nil {
+			f.Add(data)
+		}
+	}
+	f.Fuzz(func(t *testing.T, data []byte) {
+		nalus, err := SplitNALUnits(data, 4)
+		if err != nil {
+			return
+		}
+		for _, nal := range nalus {
+			if len(nal) < 2 || int(nal[0]>>1) != nalSPS {
+				continue
+			}
+			sps, err := parseSPS(unescapeRBSP(nal))
+			if err == nil && sps.width*sps.height > maxFuzzPixels {
+				return
+			}
+		}
+		Decode(nalus)
+	})
+}
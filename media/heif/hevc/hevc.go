@@ -0,0 +1,161 @@
+/*
+Copyright 2026 The go4 Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+     http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Package hevc decodes HEVC (H.265) intra-coded pictures, as used for
+// the images in HEIF files.
+//
+// Only the subset of HEVC needed for still images is implemented:
+// pictures made entirely of I slices, in the Main and Main Still
+// Picture profiles (8-bit 4:2:0, or 8-bit monochrome). Tiles, wavefront
+// parallel processing, PCM, scaling lists, transform skip, lossless
+// coding units, and the deblocking and sample adaptive offset filters
+// are all supported.
+//
+// This package makes no API compatibility promises; it exists
+// primarily for use by the go4.org/media/heif package.
+package hevc // import "go4.org/media/heif/hevc"
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"image"
+)
+
+// ErrUnsupported is returned (possibly wrapped) when a bitstream uses
+// HEVC features this package doesn't implement, such as inter
+// prediction or bit depths above 8.
+var ErrUnsupported = errors.New("hevc: unsupported feature")
+
+// SplitNALUnits splits data, a sequence of NAL units each prefixed by
+// its big-endian length in lengthSize bytes, into its NAL units. This
+// is the format of HEVC samples in ISO BMFF files, where lengthSize is
+// the hvcC box's lengthSizeMinusOne plus one.
+func SplitNALUnits(data []byte, lengthSize int) ([][]byte, error) {
+	if lengthSize != 1 && lengthSize != 2 && lengthSize != 4 {
+		return nil, fmt.Errorf("hevc: invalid NAL unit length size %d", lengthSize)
+	}
+	var nalus [][]byte
+	for len(data) > 0 {
+		if len(data) < lengthSize {
+			return nil, errShortData
+		}
+		var n uint32
+		switch lengthSize {
+		case 1:
+			n = uint32(data[0])
+		case 2:
+			n = uint32(binary.BigEndian.Uint16(data))
+		case 4:
+			n = binary.BigEndian.Uint32(data)
+		}
+		data = data[lengthSize:]
+		if uint64(n) > uint64(len(data)) {
+			return nil, errShortData
+		}
+		nalus = append(nalus, data[:n])
+		data = data[n:]
+	}
+	return nalus, nil
+}
+
+// Decode decodes the first picture found in nalus, a sequence of NAL
+// units (without start codes or length prefixes). The parameter sets
+// (SPS and PPS) the picture refers to must precede its slices.
+//
+// The returned image is an *image.YCbCr with 4:2:0 subsampling, or an
+// *image.Gray for monochrome pictures, cropped to the conformance
+// window.
+func Decode(nalus [][]byte) (image.Image, error) {
+	d := new(decoder)
+	for _, nal := range nalus {
+		if len(nal) < 2 {
+			return nil, errors.New("hevc: short NAL unit")
+		}
+		if nal[0]&0x80 != 0 {
+			return nil, errors.New("hevc: forbidden_zero_bit set")
+		}
+		nalType := int(nal[0] >> 1)
+		layerID := int(nal[0]&1)<<5 | int(nal[1]>>3)
+		if layerID != 0 {
+			continue
+		}
+		switch {
+		case nalType == nalSPS:
+			sps, err := parseSPS(unescapeRBSP(nal))
+			if err != nil {
+				return nil, err
+			}
+			d.sps[sps.id] = sps
+		case nalType == nalPPS:
+			pps, err := parsePPS(unescapeRBSP(nal))
+			if err != nil {
+				return nil, err
+			}
+			d.pps[pps.id] = pps
+		case nalType <= nalRsvIRAP23:
+			if nalType > 21 || (nalType >= 10 && nalType <= 15) {
+				continue // reserved
+			}
+			done, err := d.decodeSliceSegment(unescapeRBSP(nal), nalType)
+			if err != nil {
+				return nil, err
+			}
+			if done {
+				return d.pic.finish()
+			}
+		}
+	}
+	if d.pic == nil {
+		return nil, errors.New("hevc: no picture found")
+	}
+	return d.pic.finish()
+}
+
+// decoder holds the parameter sets and the picture being decoded.
+type decoder struct {
+	sps [16]*seqParams
+	pps [64]*picParams
+	pic *picDecoder
+}
+
+// decodeSliceSegment decodes a slice segment NAL unit. It returns
+// done when the slice segment starts a new picture after the one
+// already being decoded; the segment is then not decoded.
+func (d *decoder) decodeSliceSegment(rbsp []byte, nalType int) (done bool, err error) {
+	var prev *sliceHeader
+	if d.pic != nil {
+		prev = d.pic.lastIndependent
+	}
+	sh, dataOff, err := d.parseSliceHeader(rbsp, nalType, prev)
+	if err != nil {
+		return false, err
+	}
+	if sh.firstSliceSegmentInPic {
+		if d.pic != nil {
+			return true, nil
+		}
+		pps := d.pps[sh.ppsID]
+		if d.pic, err = newPicDecoder(d.sps[pps.spsID], pps); err != nil {
+			return false, err
+		}
+	} else if d.pic == nil {
+		return false, errors.New("hevc: missing first slice segment of picture")
+	} else if d.pps[sh.ppsID] != d.pic.pps {
+		return false, errors.New("hevc: slice segments of a picture refer to different PPSs")
+	}
+	return false, d.pic.decodeSliceSegment(sh, rbsp, dataOff)
+}
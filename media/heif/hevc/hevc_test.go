@@ -0,0 +1,96 @@
+/*
+Copyright 2026 The go4 Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+     http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package hevc
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestSplitNALUnits(t *testing.T) {
+	data := []byte{0, 0, 0, 2, 0x40, 0x01, 0, 0, 0, 1, 0x42}
+	got, err := SplitNALUnits(data, 4)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := [][]byte{{0x40, 0x01}, {0x42}}; !reflect.DeepEqual(got, want) {
+		t.Errorf("SplitNALUnits = %q; want %q", got, want)
+	}
+	if _, err := SplitNALUnits(data[:len(data)-1], 4); err == nil {
+		t.Error("SplitNALUnits of truncated data succeeded")
+	}
+	if _, err := SplitNALUnits(data, 3); err == nil {
+		t.Error("SplitNALUnits with length size 3 succeeded")
+	}
+}
+
+func TestUnescapeRBSP(t *testing.T) {
+	got := unescapeRBSP([]byte{1, 0, 0, 3, 1, 0, 0, 3, 0, 3})
+	if want := []byte{1, 0, 0, 1, 0, 0, 0, 3}; !reflect.DeepEqual(got, want) {
+		t.Errorf("unescapeRBSP = %v; want %v", got, want)
+	}
+}
+
+func TestExpGolomb(t *testing.T) {
+	// 1, 010, 011, 00100, 00101: ue 0 through 4.
+	br := &bitReader{buf: []byte{0xa6, 0x42, 0x80}}
+	for want := uint32(0); want < 5; want++ {
+		if got := br.ue(); got != want {
+			t.Errorf("ue = %d; want %d", got, want)
+		}
+	}
+	br = &bitReader{buf: []byte{0xa6, 0x42, 0x80}}
+	for _, want := range []int32{0, 1, -1, 2, -2} {
+		if got := br.se(); got != want {
+			t.Errorf("se = %d; want %d", got, want)
+		}
+	}
+	if br.err != nil {
+		t.Errorf("unexpected error %v", br.err)
+	}
+	br.ue()
+	if br.err == nil {
+		t.Error("reading past the end didn't set an error")
+	}
+}
+
+func TestTransMatrix(t *testing.T) {
+	// Spot checks against equation 8-319.
+	tests := []struct {
+		k    int
+		want []int32
+	}{
+		{0, []int32{64, 64, 64, 64}},
+		{8, []int32{83, 36, -36, -83}},
+		{16, []int32{64, -64, -64, 64}},
+		{24, []int32{36, -83, 83, -36}},
+		{4, []int32{89, 75, 50, 18, -18, -50, -75, -89}},
+		{1, []int32{90, 90, 88, 85, 82, 78, 73, 67, 61, 54, 46, 38, 31, 22, 13, 4}},
+	}
+	for _, tt := range tests {
+		if got := transMatrix[tt.k][:len(tt.want)]; !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("transMatrix[%d] = %v; want %v", tt.k, got, tt.want)
+		}
+	}
+}
+
+func TestScanOrder(t *testing.T) {
+	want := []scanPos{{0, 0}, {0, 1}, {1, 0}, {0, 2}, {1, 1}, {2, 0}, {0, 3}, {1, 2}}
+	if got := scanOrder[2][0][:8]; !reflect.DeepEqual(got, want) {
+		t.Errorf("diagonal scan = %v; want %v", got, want)
+	}
+}
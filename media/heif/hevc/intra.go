@@ -0,0 +1,224 @@
+/*
+Copyright 2026 The go4 Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+     http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package hevc
+
+// This file implements intra sample prediction (8.4.4.2).
+
+var intraPredAngle = [35]int{
+	0, 0, 32, 26, 21, 17, 13, 9, 5, 2, 0, -2, -5, -9, -13, -17, -21, -26,
+	-32, -26, -21, -17, -13, -9, -5, -2, 0, 2, 5, 9, 13, 17, 21, 26, 32,
+}
+
+// invAngle is indexed by predModeIntra-11.
+var invAngle = [15]int{
+	-4096, -1638, -910, -630, -482, -390, -315, -256, -315, -390, -482, -630, -910, -1638, -4096,
+}
+
+func clip8(v int) uint8 {
+	if v < 0 {
+		return 0
+	}
+	if v > 255 {
+		return 255
+	}
+	return uint8(v)
+}
+
+func abs(v int) int {
+	if v < 0 {
+		return -v
+	}
+	return v
+}
+
+// predictIntra writes the intra prediction of the transform block of
+// component cIdx at (x0, y0), in that component's samples, to the
+// picture.
+func (p *picDecoder) predictIntra(cIdx, x0, y0, log2Size, mode int) {
+	n := 1 << uint(log2Size)
+	plane, stride := p.planes[cIdx], p.stride[cIdx]
+	shift := uint(0)
+	if cIdx > 0 {
+		shift = 1
+	}
+
+	// The reference samples, from the bottom of the left column up
+	// to the top-left corner (index 2n) and then along the top row:
+	// p[-1][y] is ref[2n-1-y] and p[x][-1] is ref[2n+1+x].
+	ref := p.ref[:4*n+1]
+	var avail [4*32 + 1]bool
+	any := false
+	xC, yC := x0<<shift, y0<<shift
+	for i := range ref {
+		xN, yN := x0-1, y0-1
+		if i < 2*n {
+			yN = y0 + 2*n - 1 - i
+		} else if i > 2*n {
+			xN = x0 + i - 2*n - 1
+		}
+		if p.available(xC, yC, xN<<shift, yN<<shift) {
+			ref[i] = int(plane[yN*stride+xN])
+			avail[i] = true
+			any = true
+		}
+	}
+	// Substitution of unavailable samples (8.4.4.2.2).
+	if !any {
+		for i := range ref {
+			ref[i] = 128
+		}
+	} else {
+		if !avail[0] {
+			for i := 1; i < len(ref); i++ {
+				if avail[i] {
+					ref[0] = ref[i]
+					break
+				}
+			}
+		}
+		for i := 1; i < len(ref); i++ {
+			if !avail[i] {
+				ref[i] = ref[i-1]
+			}
+		}
+	}
+
+	// Filtering of neighbouring samples (8.4.4.2.3).
+	if cIdx == 0 && mode != 1 && n != 4 {
+		thres := 0 // intraHorVerDistThres
+		switch n {
+		case 8:
+			thres = 7
+		case 16:
+			thres = 1
+		}
+		if min(abs(mode-26), abs(mode-10)) > thres {
+			f := p.refTmp[:len(ref)]
+			corner, bottom, topRight := ref[2*n], ref[0], ref[4*n]
+			if p.sps.strongIntraSmoothing && n == 32 &&
+				abs(corner+topRight-2*ref[3*n]) < 8 && abs(corner+bottom-2*ref[n]) < 8 {
+				for y := 0; y < 63; y++ {
+					f[2*n-1-y] = ((63-y)*corner + (y+1)*bottom + 32) >> 6
+				}
+				for x := 0; x < 63; x++ {
+					f[2*n+1+x] = ((63-x)*corner + (x+1)*topRight + 32) >> 6
+				}
+				f[0], f[2*n], f[4*n] = bottom, corner, topRight
+			} else {
+				f[0], f[4*n] = ref[0], ref[4*n]
+				for i := 1; i < 4*n; i++ {
+					f[i] = (ref[i-1] + 2*ref[i] + ref[i+1] + 2) >> 2
+				}
+			}
+			ref = f
+		}
+	}
+	left := func(y int) int { return ref[2*n-1-y] }
+	top := func(x int) int { return ref[2*n+1+x] }
+	dst := plane[y0*stride+x0:]
+
+	switch {
+	case mode == 0: // INTRA_PLANAR
+		for y := 0; y < n; y++ {
+			for x := 0; x < n; x++ {
+				dst[y*stride+x] = uint8(((n-1-x)*left(y) + (x+1)*top(n) +
+					(n-1-y)*top(x) + (y+1)*left(n) + n) >> uint(log2Size+1))
+			}
+		}
+	case mode == 1: // INTRA_DC
+		dc := n
+		for i := 0; i < n; i++ {
+			dc += left(i) + top(i)
+		}
+		dc >>= uint(log2Size + 1)
+		for y := 0; y < n; y++ {
+			for x := 0; x < n; x++ {
+				dst[y*stride+x] = uint8(dc)
+			}
+		}
+		if cIdx == 0 && n < 32 {
+			dst[0] = uint8((left(0) + 2*dc + top(0) + 2) >> 2)
+			for x := 1; x < n; x++ {
+				dst[x] = uint8((top(x) + 3*dc + 2) >> 2)
+			}
+			for y := 1; y < n; y++ {
+				dst[y*stride] = uint8((left(y) + 3*dc + 2) >> 2)
+			}
+		}
+	default:
+		p.predictAngular(dst, stride, n, cIdx, mode, left, top)
+	}
+}
+
+// predictAngular implements INTRA_ANGULAR2 through INTRA_ANGULAR34
+// (8.4.4.2.6).
+func (p *picDecoder) predictAngular(dst []uint8, stride, n, cIdx, mode int, left, top func(int) int) {
+	angle := intraPredAngle[mode]
+	vertical := mode >= 18
+	// main is the reference array along the prediction direction's
+	// primary axis and side the other one.
+	main, side := top, left
+	if !vertical {
+		main, side = left, top
+	}
+	// ref[k] of the specification is buf[n+k].
+	var buf [3*32 + 1]int
+	for k := 0; k <= n; k++ {
+		buf[n+k] = main(k - 1)
+	}
+	if angle < 0 {
+		if (n*angle)>>5 < -1 {
+			inv := invAngle[mode-11]
+			for k := (n * angle) >> 5; k < 0; k++ {
+				buf[n+k] = side(-1 + (k*inv+128)>>8)
+			}
+		}
+	} else {
+		for k := n + 1; k <= 2*n; k++ {
+			buf[n+k] = main(k - 1)
+		}
+	}
+	for j := 0; j < n; j++ { // along the main axis's perpendicular
+		idx := ((j + 1) * angle) >> 5
+		fact := ((j + 1) * angle) & 31
+		for i := 0; i < n; i++ {
+			var v int
+			if fact != 0 {
+				v = ((32-fact)*buf[n+i+idx+1] + fact*buf[n+i+idx+2] + 16) >> 5
+			} else {
+				v = buf[n+i+idx+1]
+			}
+			if vertical {
+				dst[j*stride+i] = uint8(v)
+			} else {
+				dst[i*stride+j] = uint8(v)
+			}
+		}
+	}
+	if cIdx == 0 && n < 32 && angle == 0 {
+		// Boundary smoothing for the pure vertical and horizontal
+		// modes.
+		for j := 0; j < n; j++ {
+			v := clip8(main(0) + (side(j)-side(-1))>>1)
+			if vertical {
+				dst[j*stride] = v
+			} else {
+				dst[j] = v
+			}
+		}
+	}
+}
@@ -0,0 +1,545 @@
+/*
+Copyright 2026 The go4 Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+     http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package hevc
+
+import (
+	"errors"
+	"fmt"
+)
+
+// seqParams holds the parts of a sequence parameter set (SPS) needed to
+// decode intra pictures.
+type seqParams struct {
+	id                 uint32
+	chromaFormatIdc    int
+	width, height      int    // in luma samples
+	confWin            [4]int // left, right, top, bottom offsets, in chroma units
+	bitDepthY          int
+	bitDepthC          int
+	log2MaxPOCLsb      int
+	log2MinCbSize      int
+	log2CtbSize        int
+	log2MinTbSize      int
+	log2MaxTbSize      int
+	maxTrafoDepthIntra int
+	scalingListEnabled bool
+	scalingList        *scalingList // nil if default or disabled
+	ampEnabled         bool
+	saoEnabled         bool
+
+	pcmEnabled           bool
+	pcmBitDepthY         int
+	pcmBitDepthC         int
+	log2MinPCMCbSize     int
+	log2MaxPCMCbSize     int
+	pcmLoopFilterDisable bool
+
+	stRPS                   []stRefPicSet
+	longTermRefPicsPresent  bool
+	numLongTermRefPicsSPS   int
+	temporalMVPEnabled      bool
+	strongIntraSmoothing    bool
+	separateColourPlaneFlag bool
+
+	// Derived values:
+	ctbSize      int
+	picWidthCtb  int
+	picHeightCtb int
+}
+
+// stRefPicSet is a parsed st_ref_pic_set. Only the number of
+// pictures is retained, as is needed to parse subsequent sets.
+type stRefPicSet struct {
+	deltaPOC []int32 // negative ones first, then positive
+	numNeg   int
+}
+
+func (s *stRefPicSet) numDeltaPOCs() int { return len(s.deltaPOC) }
+
+func parseProfileTierLevel(br *bitReader, maxSubLayersMinus1 int) {
+	br.skip(2 + 1 + 5 + 32 + 4 + 43 + 1 + 8) // general profile, tier, level
+	var profilePresent, levelPresent [8]bool
+	for i := 0; i < maxSubLayersMinus1; i++ {
+		profilePresent[i] = br.flag()
+		levelPresent[i] = br.flag()
+	}
+	if maxSubLayersMinus1 > 0 {
+		for i := maxSubLayersMinus1; i < 8; i++ {
+			br.skip(2)
+		}
+	}
+	for i := 0; i < maxSubLayersMinus1; i++ {
+		if profilePresent[i] {
+			br.skip(88)
+		}
+		if levelPresent[i] {
+			br.skip(8)
+		}
+	}
+}
+
+func parseSPS(rbsp []byte) (*seqParams, error) {
+	br := &bitReader{buf: rbsp}
+	br.skip(16) // NAL unit header
+	sps := new(seqParams)
+	br.skip(4) // sps_video_parameter_set_id
+	maxSubLayersMinus1 := int(br.u(3))
+	br.skip(1) // sps_temporal_id_nesting_flag
+	parseProfileTierLevel(br, maxSubLayersMinus1)
+	sps.id = br.ue()
+	if sps.id > 15 {
+		return nil, fmt.Errorf("hevc: invalid SPS id %d", sps.id)
+	}
+	sps.chromaFormatIdc = int(br.ue())
+	if sps.chromaFormatIdc == 3 {
+		sps.separateColourPlaneFlag = br.flag()
+	}
+	sps.width = int(br.ue())
+	sps.height = int(br.ue())
+	if br.flag() { // conformance_window_flag
+		for i := range sps.confWin {
+			sps.confWin[i] = int(br.ue())
+		}
+	}
+	sps.bitDepthY = int(br.ue()) + 8
+	sps.bitDepthC = int(br.ue()) + 8
+	sps.log2MaxPOCLsb = int(br.ue()) + 4
+	subLayerOrderingInfo := br.flag()
+	start := maxSubLayersMinus1
+	if subLayerOrderingInfo {
+		start = 0
+	}
+	for i := start; i <= maxSubLayersMinus1; i++ {
+		br.ue() // sps_max_dec_pic_buffering_minus1
+		br.ue() // sps_max_num_reorder_pics
+		br.ue() // sps_max_latency_increase_plus1
+	}
+	sps.log2MinCbSize = int(br.ue()) + 3
+	sps.log2CtbSize = sps.log2MinCbSize + int(br.ue())
+	sps.log2MinTbSize = int(br.ue()) + 2
+	sps.log2MaxTbSize = sps.log2MinTbSize + int(br.ue())
+	br.ue() // max_transform_hierarchy_depth_inter
+	sps.maxTrafoDepthIntra = int(br.ue())
+	sps.scalingListEnabled = br.flag()
+	if sps.scalingListEnabled {
+		sps.scalingList = defaultScalingList()
+		if br.flag() { // sps_scaling_list_data_present_flag
+			if err := sps.scalingList.parse(br); err != nil {
+				return nil, err
+			}
+		}
+	}
+	sps.ampEnabled = br.flag()
+	sps.saoEnabled = br.flag()
+	sps.pcmEnabled = br.flag()
+	if sps.pcmEnabled {
+		sps.pcmBitDepthY = int(br.u(4)) + 1
+		sps.pcmBitDepthC = int(br.u(4)) + 1
+		sps.log2MinPCMCbSize = int(br.ue()) + 3
+		sps.log2MaxPCMCbSize = sps.log2MinPCMCbSize + int(br.ue())
+		sps.pcmLoopFilterDisable = br.flag()
+	}
+	numSTRPS := int(br.ue())
+	if numSTRPS > 64 {
+		return nil, fmt.Errorf("hevc: invalid num_short_term_ref_pic_sets %d", numSTRPS)
+	}
+	sps.stRPS = make([]stRefPicSet, 0, numSTRPS)
+	for i := 0; i < numSTRPS; i++ {
+		rps, err := parseSTRefPicSet(br, i, sps.stRPS)
+		if err != nil {
+			return nil, err
+		}
+		sps.stRPS = append(sps.stRPS, rps)
+	}
+	sps.longTermRefPicsPresent = br.flag()
+	if sps.longTermRefPicsPresent {
+		sps.numLongTermRefPicsSPS = int(br.ue())
+		if sps.numLongTermRefPicsSPS > 32 {
+			return nil, errors.New("hevc: invalid num_long_term_ref_pics_sps")
+		}
+		for i := 0; i < sps.numLongTermRefPicsSPS; i++ {
+			br.skip(sps.log2MaxPOCLsb) // lt_ref_pic_poc_lsb_sps
+			br.skip(1)                 // used_by_curr_pic_lt_sps_flag
+		}
+	}
+	sps.temporalMVPEnabled = br.flag()
+	sps.strongIntraSmoothing = br.flag()
+	// The VUI and SPS extensions that follow aren't needed.
+	if br.err != nil {
+		return nil, br.err
+	}
+	return sps, sps.validate()
+}
+
+func (sps *seqParams) validate() error {
+	switch {
+	case sps.chromaFormatIdc != 0 && sps.chromaFormatIdc != 1:
+		return fmt.Errorf("%w: chroma_format_idc %d", ErrUnsupported, sps.chromaFormatIdc)
+	case sps.bitDepthY != 8 || (sps.chromaFormatIdc != 0 && sps.bitDepthC != 8):
+		return fmt.Errorf("%w: bit depth %d/%d", ErrUnsupported, sps.bitDepthY, sps.bitDepthC)
+	case sps.log2CtbSize < 4 || sps.log2CtbSize > 6:
+		return fmt.Errorf("hevc: invalid CTB size 2^%d", sps.log2CtbSize)
+	case sps.log2MinTbSize >= sps.log2MinCbSize || sps.log2MaxTbSize > 5 || sps.log2MaxTbSize > sps.log2CtbSize:
+		return errors.New("hevc: invalid transform block sizes")
+	case sps.width <= 0 || sps.height <= 0 || sps.width > 16888 || sps.height > 16888:
+		return fmt.Errorf("hevc: invalid picture size %dx%d", sps.width, sps.height)
+	case sps.width%(1<<uint(sps.log2MinCbSize)) != 0 || sps.height%(1<<uint(sps.log2MinCbSize)) != 0:
+		return errors.New("hevc: picture size not a multiple of the minimum coding block size")
+	case sps.pcmEnabled && (sps.pcmBitDepthY > sps.bitDepthY || sps.pcmBitDepthC > sps.bitDepthC ||
+		sps.log2MaxPCMCbSize > 5 || sps.log2MaxPCMCbSize > sps.log2CtbSize):
+		return errors.New("hevc: invalid PCM parameters")
+	}
+	sps.ctbSize = 1 << uint(sps.log2CtbSize)
+	sps.picWidthCtb = (sps.width + sps.ctbSize - 1) / sps.ctbSize
+	sps.picHeightCtb = (sps.height + sps.ctbSize - 1) / sps.ctbSize
+	return nil
+}
+
+func parseSTRefPicSet(br *bitReader, idx int, prev []stRefPicSet) (stRefPicSet, error) {
+	var rps stRefPicSet
+	interRPSPred := false
+	if idx != 0 {
+		interRPSPred = br.flag()
+	}
+	if interRPSPred {
+		deltaIdx := 1
+		if idx == len(prev) {
+			// Only in slice headers; idx is num_short_term_ref_pic_sets.
+			deltaIdx = int(br.ue()) + 1
+		}
+		if deltaIdx > idx {
+			return rps, errors.New("hevc: invalid delta_idx_minus1")
+		}
+		ref := &prev[idx-deltaIdx]
+		sign := br.flag()
+		deltaRPS := int32(br.ue()) + 1
+		if sign {
+			deltaRPS = -deltaRPS
+		}
+		n := ref.numDeltaPOCs()
+		used := make([]bool, n+1)
+		useDelta := make([]bool, n+1)
+		for j := 0; j <= n; j++ {
+			used[j] = br.flag()
+			useDelta[j] = true
+			if !used[j] {
+				useDelta[j] = br.flag()
+			}
+		}
+		// Derive the new delta POCs (equations 7-61 and 7-62),
+		// keeping negative ones sorted in decreasing order and
+		// positive ones in increasing order.
+		refNeg := ref.deltaPOC[:ref.numNeg]
+		refPos := ref.deltaPOC[ref.numNeg:]
+		var neg, pos []int32
+		for j := len(refPos) - 1; j >= 0; j-- {
+			if d := refPos[j] + deltaRPS; d < 0 && useDelta[ref.numNeg+j] {
+				neg = append(neg, d)
+			}
+		}
+		if deltaRPS < 0 && useDelta[n] {
+			neg = append(neg, deltaRPS)
+		}
+		for j := 0; j < len(refNeg); j++ {
+			if d := refNeg[j] + deltaRPS; d < 0 && useDelta[j] {
+				neg = append(neg, d)
+			}
+		}
+		for j := len(refNeg) - 1; j >= 0; j-- {
+			if d := refNeg[j] + deltaRPS; d > 0 && useDelta[j] {
+				pos = append(pos, d)
+			}
+		}
+		if deltaRPS > 0 && useDelta[n] {
+			pos = append(pos, deltaRPS)
+		}
+		for j := 0; j < len(refPos); j++ {
+			if d := refPos[j] + deltaRPS; d > 0 && useDelta[ref.numNeg+j] {
+				pos = append(pos, d)
+			}
+		}
+		rps.numNeg = len(neg)
+		rps.deltaPOC = append(neg, pos...)
+	} else {
+		numNeg := br.ue()
+		numPos := br.ue()
+		if numNeg > 16 || numPos > 16 {
+			return rps, errors.New("hevc: invalid short-term reference picture set")
+		}
+		rps.numNeg = int(numNeg)
+		var poc int32
+		for i := 0; i < int(numNeg); i++ {
+			poc -= int32(br.ue()) + 1
+			br.skip(1) // used_by_curr_pic_s0_flag
+			rps.deltaPOC = append(rps.deltaPOC, poc)
+		}
+		poc = 0
+		for i := 0; i < int(numPos); i++ {
+			poc += int32(br.ue()) + 1
+			br.skip(1) // used_by_curr_pic_s1_flag
+			rps.deltaPOC = append(rps.deltaPOC, poc)
+		}
+	}
+	if len(rps.deltaPOC) > 32 {
+		return rps, errors.New("hevc: invalid short-term reference picture set")
+	}
+	return rps, br.err
+}
+
+// picParams holds the parts of a picture parameter set (PPS) needed to
+// decode intra pictures.
+type picParams struct {
+	id, spsID                    uint32
+	dependentSliceSegments       bool
+	outputFlagPresent            bool
+	numExtraSliceHeaderBits      int
+	signDataHiding               bool
+	cabacInitPresent             bool
+	initQP                       int
+	constrainedIntraPred         bool
+	transformSkipEnabled         bool
+	cuQPDeltaEnabled             bool
+	diffCuQPDeltaDepth           int
+	cbQPOffset, crQPOffset       int
+	sliceChromaQPOffsetsPresent  bool
+	transquantBypassEnabled      bool
+	tilesEnabled                 bool
+	entropyCodingSync            bool
+	numTileCols, numTileRows     int
+	uniformSpacing               bool
+	colWidths, rowHeights        []int // explicit sizes, in CTBs, if !uniformSpacing
+	loopFilterAcrossTiles        bool
+	loopFilterAcrossSlices       bool
+	deblockingOverrideEnabled    bool
+	deblockingDisabled           bool
+	betaOffsetDiv2, tcOffsetDiv2 int
+	scalingList                  *scalingList // nil if not present
+	listsModificationPresent     bool
+	sliceHeaderExtensionPresent  bool
+}
+
+func parsePPS(rbsp []byte) (*picParams, error) {
+	br := &bitReader{buf: rbsp}
+	br.skip(16) // NAL unit header
+	pps := &picParams{
+		loopFilterAcrossTiles: true,
+		numTileCols:           1,
+		numTileRows:           1,
+		uniformSpacing:        true,
+	}
+	pps.id = br.ue()
+	pps.spsID = br.ue()
+	if pps.id > 63 || pps.spsID > 15 {
+		return nil, errors.New("hevc: invalid PPS")
+	}
+	pps.dependentSliceSegments = br.flag()
+	pps.outputFlagPresent = br.flag()
+	pps.numExtraSliceHeaderBits = int(br.u(3))
+	pps.signDataHiding = br.flag()
+	pps.cabacInitPresent = br.flag()
+	br.ue() // num_ref_idx_l0_default_active_minus1
+	br.ue() // num_ref_idx_l1_default_active_minus1
+	pps.initQP = 26 + int(br.se())
+	pps.constrainedIntraPred = br.flag()
+	pps.transformSkipEnabled = br.flag()
+	pps.cuQPDeltaEnabled = br.flag()
+	if pps.cuQPDeltaEnabled {
+		pps.diffCuQPDeltaDepth = int(br.ue())
+	}
+	pps.cbQPOffset = int(br.se())
+	pps.crQPOffset = int(br.se())
+	pps.sliceChromaQPOffsetsPresent = br.flag()
+	br.skip(1) // weighted_pred_flag
+	br.skip(1) // weighted_bipred_flag
+	pps.transquantBypassEnabled = br.flag()
+	pps.tilesEnabled = br.flag()
+	pps.entropyCodingSync = br.flag()
+	if pps.tilesEnabled {
+		pps.numTileCols = int(br.ue()) + 1
+		pps.numTileRows = int(br.ue()) + 1
+		if pps.numTileCols > 64 || pps.numTileRows > 64 {
+			return nil, errors.New("hevc: too many tiles")
+		}
+		pps.uniformSpacing = br.flag()
+		if !pps.uniformSpacing {
+			for i := 0; i < pps.numTileCols-1; i++ {
+				pps.colWidths = append(pps.colWidths, int(br.ue())+1)
+			}
+			for i := 0; i < pps.numTileRows-1; i++ {
+				pps.rowHeights = append(pps.rowHeights, int(br.ue())+1)
+			}
+		}
+		pps.loopFilterAcrossTiles = br.flag()
+	}
+	pps.loopFilterAcrossSlices = br.flag()
+	if br.flag() { // deblocking_filter_control_present_flag
+		pps.deblockingOverrideEnabled = br.flag()
+		pps.deblockingDisabled = br.flag()
+		if !pps.deblockingDisabled {
+			pps.betaOffsetDiv2 = int(br.se())
+			pps.tcOffsetDiv2 = int(br.se())
+		}
+	}
+	if br.flag() { // pps_scaling_list_data_present_flag
+		pps.scalingList = defaultScalingList()
+		if err := pps.scalingList.parse(br); err != nil {
+			return nil, err
+		}
+	}
+	pps.listsModificationPresent = br.flag()
+	br.ue() // log2_parallel_merge_level_minus2
+	pps.sliceHeaderExtensionPresent = br.flag()
+	// PPS extensions aren't used by the Main profiles.
+	if br.err != nil {
+		return nil, br.err
+	}
+	if pps.cbQPOffset < -12 || pps.cbQPOffset > 12 || pps.crQPOffset < -12 || pps.crQPOffset > 12 {
+		return nil, errors.New("hevc: invalid chroma QP offset")
+	}
+	return pps, nil
+}
+
+// scalingList holds the ScalingFactor arrays, indexed by sizeId (0 for
+// 4x4 through 3 for 32x32) and matrixId, each in raster order.
+type scalingList struct {
+	factors [4][6][]uint8
+}
+
+var defaultScalingIntra = [64]uint8{
+	16, 16, 16, 16, 16, 16, 16, 16, 16, 16, 17, 16, 17, 16, 17, 18,
+	17, 18, 18, 17, 18, 21, 19, 20, 21, 20, 19, 21, 24, 22, 22, 24,
+	24, 22, 22, 24, 25, 25, 27, 30, 27, 25, 25, 29, 31, 35, 35, 31,
+	29, 36, 41, 44, 41, 36, 47, 54, 54, 47, 65, 70, 65, 88, 88, 115,
+}
+
+var defaultScalingInter = [64]uint8{
+	16, 16, 16, 16, 16, 16, 16, 16, 16, 16, 17, 17, 17, 17, 17, 18,
+	18, 18, 18, 18, 18, 20, 20, 20, 20, 20, 20, 20, 24, 24, 24, 24,
+	24, 24, 24, 24, 25, 25, 25, 25, 25, 25, 25, 28, 28, 28, 28, 28,
+	28, 33, 33, 33, 33, 33, 41, 41, 41, 41, 54, 54, 54, 71, 71, 91,
+}
+
+// defaultList returns the default ScalingList coefficients (in
+// up-right diagonal scan order) for sizeID and matrixID.
+func defaultList(sizeID, matrixID int) []uint8 {
+	if sizeID == 0 {
+		l := make([]uint8, 16)
+		for i := range l {
+			l[i] = 16
+		}
+		return l
+	}
+	if matrixID < 3 {
+		return defaultScalingIntra[:]
+	}
+	return defaultScalingInter[:]
+}
+
+func defaultScalingList() *scalingList {
+	sl := new(scalingList)
+	for sizeID := 0; sizeID < 4; sizeID++ {
+		for matrixID := 0; matrixID < 6; matrixID++ {
+			sl.setList(sizeID, matrixID, defaultList(sizeID, matrixID), 16)
+		}
+	}
+	return sl
+}
+
+// setList sets the scaling factors for sizeID and matrixID from coefs,
+// the ScalingList coefficients in up-right diagonal scan order, and
+// dc, the DC coefficient for 16x16 and 32x32 lists.
+func (sl *scalingList) setList(sizeID, matrixID int, coefs []uint8, dc uint8) {
+	size := 4 << uint(sizeID)
+	f := make([]uint8, size*size)
+	if sizeID == 0 {
+		for i, pos := range scanOrder[2][0] {
+			f[int(pos.y)*4+int(pos.x)] = coefs[i]
+		}
+	} else {
+		ratio := size / 8
+		for i, pos := range scanOrder[3][0] {
+			for j := 0; j < ratio; j++ {
+				for k := 0; k < ratio; k++ {
+					f[(int(pos.y)*ratio+j)*size+int(pos.x)*ratio+k] = coefs[i]
+				}
+			}
+		}
+		if sizeID > 1 {
+			f[0] = dc
+		}
+	}
+	sl.factors[sizeID][matrixID] = f
+}
+
+// parse parses scaling_list_data.
+func (sl *scalingList) parse(br *bitReader) error {
+	var lists [4][6][]uint8
+	var dcs [4][6]uint8
+	for sizeID := 0; sizeID < 4; sizeID++ {
+		step := 1
+		if sizeID == 3 {
+			step = 3
+		}
+		for matrixID := 0; matrixID < 6; matrixID += step {
+			coefNum := 64
+			if sizeID == 0 {
+				coefNum = 16
+			}
+			if !br.flag() { // scaling_list_pred_mode_flag
+				delta := int(br.ue()) * step
+				if delta > matrixID {
+					return errors.New("hevc: invalid scaling_list_pred_matrix_id_delta")
+				}
+				if delta == 0 {
+					lists[sizeID][matrixID] = defaultList(sizeID, matrixID)
+					dcs[sizeID][matrixID] = 16
+				} else {
+					ref := matrixID - delta
+					lists[sizeID][matrixID] = lists[sizeID][ref]
+					dcs[sizeID][matrixID] = dcs[sizeID][ref]
+				}
+			} else {
+				next := 8
+				if sizeID > 1 {
+					dc := int(br.se()) + 8
+					if dc < 1 || dc > 255 {
+						return errors.New("hevc: invalid scaling_list_dc_coef_minus8")
+					}
+					next = dc
+					dcs[sizeID][matrixID] = uint8(dc)
+				}
+				l := make([]uint8, coefNum)
+				for i := range l {
+					delta := int(br.se())
+					next = (next + delta + 256) % 256
+					l[i] = uint8(next)
+				}
+				lists[sizeID][matrixID] = l
+				if sizeID <= 1 {
+					dcs[sizeID][matrixID] = l[0]
+				}
+			}
+			sl.setList(sizeID, matrixID, lists[sizeID][matrixID], dcs[sizeID][matrixID])
+		}
+	}
+	// The 32x32 chroma lists are only used for 4:4:4; copy them
+	// from the 16x16 ones as in the range extensions.
+	for _, m := range []int{1, 2, 4, 5} {
+		sl.factors[3][m] = sl.factors[3][m-m%3]
+	}
+	return br.err
+}
@@ -0,0 +1,306 @@
+/*
+Copyright 2026 The go4 Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+     http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package hevc
+
+import (
+	"errors"
+	"image"
+)
+
+// Flags in blkInfo.flags.
+const (
+	blkNoFilter = 1 << iota // PCM with loop filter disabled, or lossless; in-loop filters leave it alone
+	blkEdgeV                // deblock the vertical edge on the left of this block
+	blkEdgeH                // deblock the horizontal edge at the top of this block
+)
+
+// blkInfo is per 4x4 luma block decoding state.
+type blkInfo struct {
+	predMode uint8 // IntraPredModeY (INTRA_DC for PCM)
+	ctDepth  uint8
+	qpY      int8
+	flags    uint8
+}
+
+// saoParams are the sample adaptive offset parameters of a CTB.
+type saoParams struct {
+	typeIdx [3]uint8 // 0: not applied, 1: band offset, 2: edge offset
+	bandPos [3]uint8
+	eoClass [3]uint8
+	offset  [3][5]int8 // SaoOffsetVal
+}
+
+// picDecoder decodes the slice segments of one picture.
+type picDecoder struct {
+	sps *seqParams
+	pps *picParams
+
+	planes  [3][]uint8
+	stride  [3]int
+	pw, ph  [3]int // plane sizes
+	nPlanes int
+
+	// Per CTB state, in raster scan order.
+	ctbSlice []int32 // index into slices, or -1 if not decoded
+	ctbSAO   []saoParams
+	slices   []*sliceHeader
+
+	// Tiles.
+	colBd, rowBd []int // tile boundaries, in CTBs; len is numTileCols+1 and numTileRows+1
+	rsToTs       []int
+	tsToRs       []int
+	tileID       []int // indexed by raster scan address
+
+	blkW, blkH int // in 4x4 blocks
+	blk        []blkInfo
+
+	lastIndependent *sliceHeader
+
+	// Contexts saved for wavefront and dependent slice segment
+	// synchronization.
+	wppCtx, dsCtx contextSet
+
+	log2MinCuQpDelta int
+	scaling          *scalingList // nil if scaling lists are disabled
+
+	// Slice decoding state.
+	sh       *sliceHeader
+	sliceIdx int32
+	cabac    cabac
+	ctx      contextSet
+	ctbAddr  int   // raster scan address of the current CTB
+	err      error // first semantic error in the slice data
+
+	// Coding unit state.
+	cuTransquantBypass bool
+	intraSplit         bool
+	maxTrafoDepth      int
+	chromaMode         int
+	isCuQpDeltaCoded   bool
+	cuQpDeltaVal       int
+	qpY                int
+	qpYPred            int
+	qgX, qgY           int  // current quantization group
+	firstQG            bool // next quantization group is the first in a slice, tile or CTB row
+
+	coeffs   [32 * 32]int32
+	residual [32 * 32]int32
+	ref      [4*32 + 1]int // intra reference samples
+	refTmp   [4*32 + 1]int
+}
+
+func newPicDecoder(sps *seqParams, pps *picParams) (*picDecoder, error) {
+	p := &picDecoder{sps: sps, pps: pps}
+	p.nPlanes = 1
+	p.pw[0], p.ph[0] = sps.width, sps.height
+	if sps.chromaFormatIdc == 1 {
+		p.nPlanes = 3
+		p.pw[1], p.ph[1] = sps.width/2, sps.height/2
+		p.pw[2], p.ph[2] = p.pw[1], p.ph[1]
+	}
+	for i := 0; i < p.nPlanes; i++ {
+		p.stride[i] = p.pw[i]
+		p.planes[i] = make([]uint8, p.pw[i]*p.ph[i])
+	}
+	n := sps.picWidthCtb * sps.picHeightCtb
+	p.ctbSlice = make([]int32, n)
+	for i := range p.ctbSlice {
+		p.ctbSlice[i] = -1
+	}
+	p.ctbSAO = make([]saoParams, n)
+	p.blkW = (sps.width + 3) / 4
+	p.blkH = (sps.height + 3) / 4
+	p.blk = make([]blkInfo, p.blkW*p.blkH)
+	p.log2MinCuQpDelta = sps.log2CtbSize - pps.diffCuQPDeltaDepth
+	p.qgX, p.qgY = -1, -1
+	if sps.scalingListEnabled {
+		switch {
+		case pps.scalingList != nil:
+			p.scaling = pps.scalingList
+		case sps.scalingList != nil:
+			p.scaling = sps.scalingList
+		default:
+			p.scaling = defaultScalingList()
+		}
+	}
+	if err := p.setupTiles(); err != nil {
+		return nil, err
+	}
+	return p, nil
+}
+
+// setupTiles derives the tile boundaries and scan conversions of
+// section 6.5.1.
+func (p *picDecoder) setupTiles() error {
+	sps, pps := p.sps, p.pps
+	w, h := sps.picWidthCtb, sps.picHeightCtb
+	sizes := func(n, total int, explicit []int) []int {
+		bd := make([]int, n+1)
+		for i := 0; i < n; i++ {
+			if pps.uniformSpacing {
+				bd[i+1] = ((i + 1) * total) / n
+			} else if i < n-1 {
+				bd[i+1] = bd[i] + explicit[i]
+			} else {
+				bd[i+1] = total
+			}
+		}
+		return bd
+	}
+	p.colBd = sizes(pps.numTileCols, w, pps.colWidths)
+	p.rowBd = sizes(pps.numTileRows, h, pps.rowHeights)
+	for _, bd := range [][]int{p.colBd, p.rowBd} {
+		for i := 1; i < len(bd); i++ {
+			if bd[i] <= bd[i-1] {
+				return errors.New("hevc: invalid tile sizes")
+			}
+		}
+	}
+
+	p.rsToTs = make([]int, w*h)
+	p.tsToRs = make([]int, w*h)
+	p.tileID = make([]int, w*h)
+	ts := 0
+	for ty := 0; ty < pps.numTileRows; ty++ {
+		for tx := 0; tx < pps.numTileCols; tx++ {
+			for y := p.rowBd[ty]; y < p.rowBd[ty+1]; y++ {
+				for x := p.colBd[tx]; x < p.colBd[tx+1]; x++ {
+					rs := y*w + x
+					p.rsToTs[rs] = ts
+					p.tsToRs[ts] = rs
+					p.tileID[rs] = ty*pps.numTileCols + tx
+					ts++
+				}
+			}
+		}
+	}
+	return nil
+}
+
+// tileCol returns the tile column index containing CTB column x.
+func (p *picDecoder) tileCol(x int) int {
+	i := 0
+	for x >= p.colBd[i+1] {
+		i++
+	}
+	return i
+}
+
+func (p *picDecoder) blkAt(x, y int) *blkInfo {
+	return &p.blk[(y>>2)*p.blkW+x>>2]
+}
+
+// setBlk calls fn for each 4x4 block in the given luma area.
+func (p *picDecoder) setBlk(x0, y0, size int, fn func(b *blkInfo)) {
+	x1, y1 := x0+size, y0+size
+	if x1 > p.sps.width {
+		x1 = p.sps.width
+	}
+	if y1 > p.sps.height {
+		y1 = p.sps.height
+	}
+	for y := y0; y < y1; y += 4 {
+		row := p.blk[(y>>2)*p.blkW:]
+		for x := x0; x < x1; x += 4 {
+			fn(&row[x>>2])
+		}
+	}
+}
+
+func (p *picDecoder) ctbAddrOf(x, y int) int {
+	return (y>>uint(p.sps.log2CtbSize))*p.sps.picWidthCtb + x>>uint(p.sps.log2CtbSize)
+}
+
+// zAddr returns the decoding order of the 4x4 luma block containing
+// (x, y): its CTB's tile scan address followed by its z-scan order
+// within the CTB. It plays the role of MinTbAddrZs.
+func (p *picDecoder) zAddr(x, y int) int {
+	log2Ctb := uint(p.sps.log2CtbSize)
+	mask := 1<<log2Ctb - 1
+	ts := p.rsToTs[p.ctbAddrOf(x, y)]
+	return ts<<(2*(log2Ctb-2)) | int(zOrder[((y&mask)>>2)<<4|(x&mask)>>2])
+}
+
+// zOrder maps a 4x4 block's position within a CTB, (y<<4 | x) in
+// units of 4 samples, to its z-scan order.
+var zOrder [256]uint8
+
+func init() {
+	for y := 0; y < 16; y++ {
+		for x := 0; x < 16; x++ {
+			var z uint8
+			for b := uint(0); b < 4; b++ {
+				z |= uint8((x>>b)&1) << (2 * b)
+				z |= uint8((y>>b)&1) << (2*b + 1)
+			}
+			zOrder[y<<4|x] = z
+		}
+	}
+}
+
+// available implements the z-scan order block availability process of
+// section 6.4.1: whether the luma location (xN, yN) has been decoded
+// and is usable for prediction of the block at (xC, yC).
+func (p *picDecoder) available(xC, yC, xN, yN int) bool {
+	if xN < 0 || yN < 0 || xN >= p.sps.width || yN >= p.sps.height {
+		return false
+	}
+	if p.zAddr(xN, yN) > p.zAddr(xC, yC) {
+		return false
+	}
+	ctbN, ctbC := p.ctbAddrOf(xN, yN), p.ctbAddrOf(xC, yC)
+	sN, sC := p.ctbSlice[ctbN], p.ctbSlice[ctbC]
+	if sN < 0 || p.slices[sN].sliceAddr != p.slices[sC].sliceAddr {
+		return false
+	}
+	return p.tileID[ctbN] == p.tileID[ctbC]
+}
+
+// finish applies the in-loop filters and returns the decoded picture.
+func (p *picDecoder) finish() (image.Image, error) {
+	for _, s := range p.ctbSlice {
+		if s < 0 {
+			return nil, errors.New("hevc: picture is missing slices")
+		}
+	}
+	p.deblock()
+	p.applySAO()
+
+	sps := p.sps
+	sub := 1
+	if p.nPlanes == 3 {
+		sub = 2
+	}
+	crop := image.Rect(sps.confWin[0]*sub, sps.confWin[2]*sub,
+		sps.width-sps.confWin[1]*sub, sps.height-sps.confWin[3]*sub)
+	if crop.Empty() {
+		return nil, errors.New("hevc: empty conformance window")
+	}
+	full := image.Rect(0, 0, sps.width, sps.height)
+	if p.nPlanes == 1 {
+		return (&image.Gray{Pix: p.planes[0], Stride: p.stride[0], Rect: full}).SubImage(crop), nil
+	}
+	return (&image.YCbCr{
+		Y:              p.planes[0],
+		Cb:             p.planes[1],
+		Cr:             p.planes[2],
+		YStride:        p.stride[0],
+		CStride:        p.stride[1],
+		SubsampleRatio: image.YCbCrSubsampleRatio420,
+		Rect:           full,
+	}).SubImage(crop), nil
+}
@@ -0,0 +1,52 @@
+/*
+Copyright 2026 The go4 Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+     http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package hevc
+
+type scanPos struct{ x, y uint8 }
+
+// scanOrder is indexed by log2 of the block size (0 through 3), the
+// scan index (0: up-right diagonal, 1: horizontal, 2: vertical), and
+// the scan position. See section 6.5.3 through 6.5.5.
+var scanOrder [4][3][]scanPos
+
+func init() {
+	for log2 := 0; log2 < 4; log2++ {
+		size := 1 << uint(log2)
+		diag := make([]scanPos, 0, size*size)
+		x, y := 0, 0
+		for len(diag) < size*size {
+			for y >= 0 {
+				if x < size && y < size {
+					diag = append(diag, scanPos{uint8(x), uint8(y)})
+				}
+				y--
+				x++
+			}
+			y = x
+			x = 0
+		}
+		hor := make([]scanPos, 0, size*size)
+		ver := make([]scanPos, 0, size*size)
+		for i := 0; i < size; i++ {
+			for j := 0; j < size; j++ {
+				hor = append(hor, scanPos{uint8(j), uint8(i)})
+				ver = append(ver, scanPos{uint8(i), uint8(j)})
+			}
+		}
+		scanOrder[log2] = [3][]scanPos{diag, hor, ver}
+	}
+}
@@ -0,0 +1,223 @@
+/*
+Copyright 2026 The go4 Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+     http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package hevc
+
+import (
+	"errors"
+	"fmt"
+)
+
+// NAL unit types used by this package.
+const (
+	nalBLAWLP     = 16
+	nalIDRWRADL   = 19
+	nalIDRNLP     = 20
+	nalRsvIRAP23  = 23
+	nalVPS        = 32
+	nalSPS        = 33
+	nalPPS        = 34
+	sliceTypeB    = 0
+	sliceTypeP    = 1
+	sliceTypeI    = 2
+	maxSliceTypes = 3
+)
+
+// sliceHeader is a parsed slice_segment_header. For dependent slice
+// segments, the fields not in the segment header are copied from the
+// preceding independent slice segment.
+type sliceHeader struct {
+	firstSliceSegmentInPic bool
+	ppsID                  uint32
+	dependent              bool
+	segmentAddr            int // slice_segment_address, in raster scan
+	sliceAddr              int // SliceAddrRs
+	sliceType              int
+	saoLuma, saoChroma     bool
+	qp                     int // SliceQpY
+	cbQPOffset, crQPOffset int
+	deblockingDisabled     bool
+	betaOffsetDiv2         int
+	tcOffsetDiv2           int
+	loopFilterAcrossSlices bool
+}
+
+// parseSliceHeader parses the slice segment header of a VCL NAL unit
+// in rbsp. It returns the header and the byte offset in rbsp at which
+// the slice segment data starts. prev is the header of the previous
+// independent slice segment of the picture, if any.
+func (d *decoder) parseSliceHeader(rbsp []byte, nalType int, prev *sliceHeader) (*sliceHeader, int, error) {
+	br := &bitReader{buf: rbsp}
+	br.skip(16) // NAL unit header
+	sh := new(sliceHeader)
+	sh.firstSliceSegmentInPic = br.flag()
+	if nalType >= nalBLAWLP && nalType <= nalRsvIRAP23 {
+		br.skip(1) // no_output_of_prior_pics_flag
+	}
+	sh.ppsID = br.ue()
+	if sh.ppsID > 63 || d.pps[sh.ppsID] == nil {
+		return nil, 0, fmt.Errorf("hevc: slice refers to missing PPS %d", sh.ppsID)
+	}
+	pps := d.pps[sh.ppsID]
+	sps := d.sps[pps.spsID]
+	if sps == nil {
+		return nil, 0, fmt.Errorf("hevc: PPS refers to missing SPS %d", pps.spsID)
+	}
+	if !sh.firstSliceSegmentInPic {
+		if pps.dependentSliceSegments {
+			sh.dependent = br.flag()
+		}
+		n := sps.picWidthCtb * sps.picHeightCtb
+		sh.segmentAddr = int(br.u(log2Ceil(n)))
+		if sh.segmentAddr >= n {
+			return nil, 0, errors.New("hevc: invalid slice_segment_address")
+		}
+	}
+	if sh.dependent {
+		if prev == nil {
+			return nil, 0, errors.New("hevc: dependent slice segment without a preceding slice")
+		}
+		addr := sh.segmentAddr
+		*sh = *prev
+		sh.firstSliceSegmentInPic = false
+		sh.dependent = true
+		sh.segmentAddr = addr
+	} else {
+		sh.sliceAddr = sh.segmentAddr
+		br.skip(pps.numExtraSliceHeaderBits) // slice_reserved_flag
+		sh.sliceType = int(br.ue())
+		if sh.sliceType >= maxSliceTypes {
+			return nil, 0, errors.New("hevc: invalid slice_type")
+		}
+		if sh.sliceType != sliceTypeI {
+			return nil, 0, fmt.Errorf("%w: inter-coded slices", ErrUnsupported)
+		}
+		if pps.outputFlagPresent {
+			br.skip(1) // pic_output_flag
+		}
+		if sps.separateColourPlaneFlag {
+			br.skip(2) // colour_plane_id
+		}
+		if nalType != nalIDRWRADL && nalType != nalIDRNLP {
+			if err := skipRefPicSets(br, sps); err != nil {
+				return nil, 0, err
+			}
+		}
+		if sps.saoEnabled {
+			sh.saoLuma = br.flag()
+			if sps.chromaFormatIdc != 0 {
+				sh.saoChroma = br.flag()
+			}
+		}
+		// P and B slice fields would go here.
+		sh.qp = pps.initQP + int(br.se())
+		if sh.qp < 0 || sh.qp > 51 {
+			return nil, 0, fmt.Errorf("hevc: invalid slice QP %d", sh.qp)
+		}
+		if pps.sliceChromaQPOffsetsPresent {
+			sh.cbQPOffset = int(br.se())
+			sh.crQPOffset = int(br.se())
+			if sh.cbQPOffset < -12 || sh.cbQPOffset > 12 || sh.crQPOffset < -12 || sh.crQPOffset > 12 {
+				return nil, 0, errors.New("hevc: invalid slice chroma QP offset")
+			}
+		}
+		override := false
+		if pps.deblockingOverrideEnabled {
+			override = br.flag()
+		}
+		sh.deblockingDisabled = pps.deblockingDisabled
+		sh.betaOffsetDiv2 = pps.betaOffsetDiv2
+		sh.tcOffsetDiv2 = pps.tcOffsetDiv2
+		if override {
+			sh.deblockingDisabled = br.flag()
+			if !sh.deblockingDisabled {
+				sh.betaOffsetDiv2 = int(br.se())
+				sh.tcOffsetDiv2 = int(br.se())
+			}
+		}
+		sh.loopFilterAcrossSlices = pps.loopFilterAcrossSlices
+		if pps.loopFilterAcrossSlices && (sh.saoLuma || sh.saoChroma || !sh.deblockingDisabled) {
+			sh.loopFilterAcrossSlices = br.flag()
+		}
+	}
+	if pps.tilesEnabled || pps.entropyCodingSync {
+		// The entry points aren't needed: the bit-exact CABAC
+		// engine finds each substream itself.
+		n := int(br.ue())
+		if n > sps.picWidthCtb*sps.picHeightCtb {
+			return nil, 0, errors.New("hevc: invalid num_entry_point_offsets")
+		}
+		if n > 0 {
+			bits := int(br.ue()) + 1
+			if bits > 32 {
+				return nil, 0, errors.New("hevc: invalid offset_len_minus1")
+			}
+			br.skip(n * bits)
+		}
+	}
+	if pps.sliceHeaderExtensionPresent {
+		br.skip(8 * int(br.ue()))
+	}
+	// byte_alignment()
+	if br.bit() != 1 {
+		return nil, 0, errors.New("hevc: invalid slice header alignment bit")
+	}
+	br.alignByte()
+	if br.err != nil {
+		return nil, 0, br.err
+	}
+	return sh, br.pos / 8, nil
+}
+
+// skipRefPicSets skips the reference picture set syntax in the slice
+// header of a non-IDR picture.
+func skipRefPicSets(br *bitReader, sps *seqParams) error {
+	br.skip(sps.log2MaxPOCLsb) // slice_pic_order_cnt_lsb
+	if !br.flag() {            // short_term_ref_pic_set_sps_flag
+		if _, err := parseSTRefPicSet(br, len(sps.stRPS), sps.stRPS); err != nil {
+			return err
+		}
+	} else if len(sps.stRPS) > 1 {
+		br.skip(log2Ceil(len(sps.stRPS))) // short_term_ref_pic_set_idx
+	}
+	if sps.longTermRefPicsPresent {
+		numLongTermSPS := 0
+		if sps.numLongTermRefPicsSPS > 0 {
+			numLongTermSPS = int(br.ue())
+		}
+		numLongTermPics := int(br.ue())
+		if numLongTermSPS > sps.numLongTermRefPicsSPS || numLongTermPics > 32 {
+			return errors.New("hevc: invalid long-term reference pictures")
+		}
+		for i := 0; i < numLongTermSPS+numLongTermPics; i++ {
+			if i < numLongTermSPS {
+				if sps.numLongTermRefPicsSPS > 1 {
+					br.skip(log2Ceil(sps.numLongTermRefPicsSPS)) // lt_idx_sps
+				}
+			} else {
+				br.skip(sps.log2MaxPOCLsb) // poc_lsb_lt
+				br.skip(1)                 // used_by_curr_pic_lt_flag
+			}
+			if br.flag() { // delta_poc_msb_present_flag
+				br.ue() // delta_poc_msb_cycle_lt
+			}
+		}
+	}
+	if sps.temporalMVPEnabled {
+		br.skip(1) // slice_temporal_mvp_enabled_flag
+	}
+	return br.err
+}
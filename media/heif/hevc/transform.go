@@ -0,0 +1,177 @@
+/*
+Copyright 2026 The go4 Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+     http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package hevc
+
+// This file implements scaling, transformation and reconstruction of
+// residuals (8.6.2 through 8.6.7).
+
+var levelScale = [6]int64{40, 45, 51, 57, 64, 72}
+
+// chromaQPTable maps qPi from 30 through 43 to QpC for 4:2:0.
+var chromaQPTable = [14]int{29, 30, 31, 32, 33, 33, 34, 34, 35, 35, 36, 36, 37, 37}
+
+func chromaQP(qpi int) int {
+	switch {
+	case qpi < 30:
+		return qpi
+	case qpi > 43:
+		return qpi - 6
+	}
+	return chromaQPTable[qpi-30]
+}
+
+// transMatrix is the 32x32 transform matrix of equation 8-319;
+// transMatrix[k] is the basis function of frequency k. The matrices of
+// the smaller transforms are made of every (32/N)th row, truncated.
+var transMatrix [32][32]int32
+
+// dstMatrix is the 4x4 transform for intra luma blocks (8-317).
+var dstMatrix = [4][4]int32{
+	{29, 55, 74, 84},
+	{74, 74, 0, -74},
+	{84, -29, -74, 55},
+	{55, -84, 74, -29},
+}
+
+func init() {
+	// cosTab[m] is the matrix coefficient for an angle of m*pi/64.
+	cosTab := [33]int32{
+		64, 90, 90, 90, 89, 88, 87, 85, 83, 82, 80, 78, 75, 73, 70, 67,
+		64, 61, 57, 54, 50, 46, 43, 38, 36, 31, 25, 22, 18, 13, 9, 4, 0,
+	}
+	for k := 0; k < 32; k++ {
+		for n := 0; n < 32; n++ {
+			m := k * (2*n + 1) % 128
+			var v int32
+			switch {
+			case m <= 32:
+				v = cosTab[m]
+			case m <= 64:
+				v = -cosTab[64-m]
+			case m <= 96:
+				v = -cosTab[m-64]
+			default:
+				v = cosTab[128-m]
+			}
+			transMatrix[k][n] = v
+		}
+	}
+}
+
+// addResidual scales and transforms the coefficients in p.coeffs and
+// adds the resulting residual to the predicted transform block of
+// component cIdx at (x0, y0).
+func (p *picDecoder) addResidual(cIdx, x0, y0, log2Size int, transformSkip bool) {
+	n := 1 << uint(log2Size)
+	coeffs := p.coeffs[:n*n]
+	res := p.residual[:n*n]
+
+	if p.cuTransquantBypass {
+		copy(res, coeffs)
+	} else {
+		qp := p.qpY
+		switch cIdx {
+		case 1:
+			qp = chromaQP(clip3(0, 57, qp+p.pps.cbQPOffset+p.sh.cbQPOffset))
+		case 2:
+			qp = chromaQP(clip3(0, 57, qp+p.pps.crQPOffset+p.sh.crQPOffset))
+		}
+		// Scaling process for transform coefficients (8.6.3).
+		var factors []uint8
+		if p.scaling != nil && !(transformSkip && n > 4) {
+			factors = p.scaling.factors[log2Size-2][cIdx]
+		}
+		bdShift := uint(log2Size + 3)
+		scale := levelScale[qp%6] << uint(qp/6)
+		for i, c := range coeffs {
+			if c == 0 {
+				continue
+			}
+			m := int64(16)
+			if factors != nil {
+				m = int64(factors[i])
+			}
+			coeffs[i] = int32(clip3(-32768, 32767, int((int64(c)*m*scale+1<<(bdShift-1))>>bdShift)))
+		}
+
+		switch {
+		case transformSkip:
+			for i, d := range coeffs {
+				res[i] = (d<<7 + 1<<11) >> 12
+			}
+		case cIdx == 0 && n == 4:
+			transform2D(res, coeffs, n, func(k, i int) int32 { return dstMatrix[k][i] })
+		default:
+			step := 32 / n
+			transform2D(res, coeffs, n, func(k, i int) int32 { return transMatrix[k*step][i] })
+		}
+	}
+
+	plane, stride := p.planes[cIdx], p.stride[cIdx]
+	for y := 0; y < n; y++ {
+		row := plane[(y0+y)*stride+x0:]
+		for x := 0; x < n; x++ {
+			row[x] = clip8(int(row[x]) + int(res[y*n+x]))
+		}
+	}
+}
+
+// transform2D applies the two-stage inverse transform of 8.6.4.2 to
+// the n by n coefficients d, writing the residual to r. coef(k, i) is
+// the transform matrix coefficient of frequency k at position i.
+func transform2D(r, d []int32, n int, coef func(k, i int) int32) {
+	var g [32 * 32]int32
+	// Vertical: each column.
+	for x := 0; x < n; x++ {
+		last := -1
+		for k := 0; k < n; k++ {
+			if d[k*n+x] != 0 {
+				last = k
+			}
+		}
+		for y := 0; y < n; y++ {
+			var e int64
+			for k := 0; k <= last; k++ {
+				e += int64(coef(k, y)) * int64(d[k*n+x])
+			}
+			g[y*n+x] = int32(clip3(-32768, 32767, int((e+64)>>7)))
+		}
+	}
+	// Horizontal: each row.
+	for y := 0; y < n; y++ {
+		row := g[y*n : y*n+n]
+		for x := 0; x < n; x++ {
+			var e int64
+			for k, v := range row {
+				if v != 0 {
+					e += int64(coef(k, x)) * int64(v)
+				}
+			}
+			r[y*n+x] = int32((e + 2048) >> 12)
+		}
+	}
+}
+
+func clip3(lo, hi, v int) int {
+	if v < lo {
+		return lo
+	}
+	if v > hi {
+		return hi
+	}
+	return v
+}
@@ -0,0 +1,178 @@
+/*
+Copyright 2026 The go4 Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+     http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package heif
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"image"
+	"image/color"
+	"io"
+	"io/ioutil"
+
+	"go4.org/media/heif/bmff"
+	"go4.org/media/heif/hevc"
+)
+
+func init() {
+	for _, brand := range []string{"heic", "heix"} {
+		image.RegisterFormat("heic", "????ftyp"+brand, Decode, DecodeConfig)
+	}
+	for _, brand := range []string{"mif1", "msf1"} {
+		image.RegisterFormat("heif", "????ftyp"+brand, Decode, DecodeConfig)
+	}
+}
+
+// Decode decodes the primary image of the HEIF file read from r.
+// The file is read into memory; use Open and File.Image to decode
+// from an io.ReaderAt instead.
+func Decode(r io.Reader) (image.Image, error) {
+	f, err := openReader(r)
+	if err != nil {
+		return nil, err
+	}
+	return f.Image()
+}
+
+// DecodeConfig returns the color model and dimensions of the primary
+// image of the HEIF file read from r, without decoding it.
+func DecodeConfig(r io.Reader) (image.Config, error) {
+	f, err := openReader(r)
+	if err != nil {
+		return image.Config{}, err
+	}
+	it, err := f.PrimaryItem()
+	if err != nil {
+		return image.Config{}, err
+	}
+	width, height, ok := it.SpatialExtents()
+	if !ok {
+		return image.Config{}, errors.New("heif: primary item lacks spatial extents")
+	}
+	cfg := image.Config{ColorModel: color.YCbCrModel, Width: width, Height: height}
+	coded := it.codedItem()
+	if hc := coded.hevcConfig(); hc != nil && hc.ChromaFormat == 0 {
+		cfg.ColorModel = color.GrayModel
+	}
+	if ac := coded.AV1Config(); ac != nil && ac.Monochrome {
+		cfg.ColorModel = color.GrayModel
+	}
+	return cfg, nil
+}
+
+func openReader(r io.Reader) (*File, error) {
+	if ra, ok := r.(io.ReaderAt); ok {
+		return Open(ra), nil
+	}
+	slurp, err := ioutil.ReadAll(r)
+	if err != nil {
+		return nil, err
+	}
+	return Open(bytes.NewReader(slurp)), nil
+}
+
+// Image decodes the file's primary image. See Item.Image.
+func (f *File) Image() (image.Image, error) {
+	it, err := f.PrimaryItem()
+	if err != nil {
+		return nil, err
+	}
+	return it.Image()
+}
+
+// Image decodes the item's image. HEVC-coded ("hvc1") items and grids
+// ("grid") of them are currently supported; AV1-coded ("av01") items,
+// as found in AVIF files, are not.
+//
+// The image is returned as coded: it is not cropped, rotated or
+// mirrored according to the item's properties (see DisplayTransform).
+func (it *Item) Image() (image.Image, error) {
+	typ := ""
+	if it.Info != nil {
+		typ = it.Info.ItemType
+	}
+	switch typ {
+	case "hvc1":
+		return it.hevcImage()
+	case "grid":
+		return it.gridImage()
+	}
+	return nil, fmt.Errorf("heif: can't decode item %d of unsupported type %q", it.ID, typ)
+}
+
+// hevcImage decodes an "hvc1" item.
+func (it *Item) hevcImage() (image.Image, error) {
+	hc := it.hevcConfig()
+	if hc == nil {
+		return nil, fmt.Errorf("heif: item %d lacks an hvcC property", it.ID)
+	}
+	data, err := it.Data()
+	if err != nil {
+		return nil, err
+	}
+	var nalus [][]byte
+	for _, arr := range hc.NALArrays {
+		nalus = append(nalus, arr.NALUnits...)
+	}
+	coded, err := hevc.SplitNALUnits(data, int(hc.LengthSizeMinusOne)+1)
+	if err != nil {
+		return nil, fmt.Errorf("heif: item %d: %v", it.ID, err)
+	}
+	return hevc.Decode(append(nalus, coded...))
+}
+
+// CodecType returns the item type of the item's coded image, such as
+// "hvc1" for HEVC or "av01" for AV1. For grid items, it's that of their
+// first tile.
+func (it *Item) CodecType() string {
+	if it := it.codedItem(); it.Info != nil {
+		return it.Info.ItemType
+	}
+	return ""
+}
+
+// codedItem returns it, or its first tile if it's a grid.
+func (it *Item) codedItem() *Item {
+	if it.Info != nil && it.Info.ItemType == "grid" {
+		if tiles, err := it.Tiles(); err == nil && len(tiles) > 0 {
+			return tiles[0]
+		}
+	}
+	return it
+}
+
+// AV1Config returns the item's "av1C" AV1 configuration property, or
+// nil if it has none.
+func (it *Item) AV1Config() *bmff.AV1ConfigurationBox {
+	for _, p := range it.Properties {
+		if p, ok := p.(*bmff.AV1ConfigurationBox); ok {
+			return p
+		}
+	}
+	return nil
+}
+
+// hevcConfig returns the item's hvcC property, or nil.
+func (it *Item) hevcConfig() *bmff.HEVCConfigurationBox {
+	for _, p := range it.Properties {
+		if p, ok := p.(*bmff.HEVCConfigurationBox); ok {
+			return p
+		}
+	}
+	return nil
+}
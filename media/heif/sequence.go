@@ -0,0 +1,245 @@
+/*
+Copyright 2026 The go4 Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+     http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package heif
+
+import (
+	"errors"
+	"fmt"
+	"time"
+
+	"go4.org/media/heif/bmff"
+)
+
+// maxFrames is the largest number of frames a Sequence may have.
+const maxFrames = 1 << 20
+
+// Sequence is a track of a HEIF file, such as an image sequence
+// (burst) or a video.
+type Sequence struct {
+	f *File
+
+	TrackID       uint32
+	HandlerType   string // "pict" for image sequences, "vide" for video
+	Width, Height int    // from the track header
+	Timescale     uint32 // units per second of frame times
+	Duration      uint64 // in Timescale units
+
+	// CodecType is the type of the track's first sample entry, such
+	// as "hvc1" for HEVC. SampleEntry is that entry, if it's a visual
+	// one, holding the codec configuration.
+	CodecType   string
+	SampleEntry *bmff.VisualSampleEntry
+
+	Frames []Frame
+}
+
+// Frame is one sample (coded image) of a Sequence.
+type Frame struct {
+	Time     uint64 // decoding time, in the Sequence's Timescale units
+	Duration uint32 // in the Sequence's Timescale units
+	Offset   int64  // of the frame's data in the file
+	Size     uint32 // of the frame's data
+}
+
+// FrameTime returns the decoding time of frame i.
+func (s *Sequence) FrameTime(i int) time.Duration {
+	return bmff.Duration(s.Frames[i].Time, s.Timescale)
+}
+
+// FrameData reads the coded data of frame i.
+func (s *Sequence) FrameData(i int) ([]byte, error) {
+	fr := s.Frames[i]
+	if fr.Size > maxItemSize {
+		return nil, fmt.Errorf("heif: frame %d has unsupported size", i)
+	}
+	buf := make([]byte, fr.Size)
+	if _, err := s.f.ra.ReadAt(buf, fr.Offset); err != nil {
+		return nil, fmt.Errorf("heif: reading frame %d: %v", i, err)
+	}
+	return buf, nil
+}
+
+// Sequences returns the file's tracks, in file order. Files without a
+// "moov" box have none.
+func (f *File) Sequences() ([]*Sequence, error) {
+	node, err := f.topLevelBox(bmff.TypeMoov)
+	if err != nil || node == nil {
+		return nil, err
+	}
+	if node.Size == -1 || node.Size > maxItemSize {
+		return nil, errors.New("heif: moov box has unsupported size")
+	}
+	pbox, err := node.Parse()
+	if err != nil {
+		return nil, fmt.Errorf("heif: parsing moov box: %v", err)
+	}
+	moov, ok := pbox.(*bmff.ContainerBox)
+	if !ok {
+		return nil, errors.New("heif: unexpected moov box type")
+	}
+	var seqs []*Sequence
+	for _, b := range moov.Children {
+		if !b.Type().EqualString("trak") {
+			continue
+		}
+		s, err := f.parseTrack(b)
+		if err != nil {
+			return nil, err
+		}
+		seqs = append(seqs, s)
+	}
+	return seqs, nil
+}
+
+// parseTrack returns the Sequence of the "trak" box b.
+func (f *File) parseTrack(b bmff.Box) (*Sequence, error) {
+	s := &Sequence{f: f}
+	trak, err := b.Parse()
+	if err != nil {
+		return nil, err
+	}
+	path := func(typs ...string) (bmff.Box, error) {
+		box := trak
+		for _, typ := range typs {
+			if box, err = bmff.Child(box, typ); err != nil {
+				return nil, err
+			}
+		}
+		if box == nil {
+			return nil, fmt.Errorf("heif: track lacks a %q box", typs[len(typs)-1])
+		}
+		return box, nil
+	}
+	var boxes [8]bmff.Box
+	for i, p := range [][]string{
+		{"tkhd"},
+		{"mdia", "mdhd"},
+		{"mdia", "hdlr"},
+		{"mdia", "minf", "stbl", "stsd"},
+		{"mdia", "minf", "stbl", "stts"},
+		{"mdia", "minf", "stbl", "stsz"},
+		{"mdia", "minf", "stbl", "stsc"},
+	} {
+		if boxes[i], err = path(p...); err != nil {
+			return nil, err
+		}
+	}
+	// Chunk offsets are in a "stco" box, or a "co64" one if large.
+	stbl, err := path("mdia", "minf", "stbl")
+	if err != nil {
+		return nil, err
+	}
+	for _, typ := range []string{"stco", "co64"} {
+		if boxes[7], err = bmff.Child(stbl, typ); err != nil {
+			return nil, err
+		}
+		if boxes[7] != nil {
+			break
+		}
+	}
+	if boxes[7] == nil {
+		return nil, errors.New("heif: track lacks chunk offsets")
+	}
+	tkhd, ok1 := boxes[0].(*bmff.TrackHeaderBox)
+	mdhd, ok2 := boxes[1].(*bmff.MediaHeaderBox)
+	hdlr, ok3 := boxes[2].(*bmff.HandlerBox)
+	stsd, ok4 := boxes[3].(*bmff.SampleDescriptionBox)
+	stts, ok5 := boxes[4].(*bmff.TimeToSampleBox)
+	stsz, ok6 := boxes[5].(*bmff.SampleSizeBox)
+	stsc, ok7 := boxes[6].(*bmff.SampleToChunkBox)
+	stco, ok8 := boxes[7].(*bmff.ChunkOffsetBox)
+	if !(ok1 && ok2 && ok3 && ok4 && ok5 && ok6 && ok7 && ok8) {
+		return nil, errors.New("heif: track has unexpected box types")
+	}
+
+	s.TrackID = tkhd.TrackID
+	s.Width, s.Height = int(tkhd.Width>>16), int(tkhd.Height>>16)
+	s.HandlerType = hdlr.HandlerType
+	s.Timescale = mdhd.Timescale
+	s.Duration = mdhd.Duration
+	if len(stsd.Children) > 0 {
+		s.CodecType = stsd.Children[0].Type().String()
+		if pb, err := stsd.Children[0].Parse(); err == nil {
+			s.SampleEntry, _ = pb.(*bmff.VisualSampleEntry)
+		}
+	}
+	if s.Frames, err = buildFrames(stts, stsz, stsc, stco); err != nil {
+		return nil, fmt.Errorf("heif: track %d: %v", s.TrackID, err)
+	}
+	return s, nil
+}
+
+// buildFrames expands a track's sample tables into its frames.
+func buildFrames(stts *bmff.TimeToSampleBox, stsz *bmff.SampleSizeBox, stsc *bmff.SampleToChunkBox, stco *bmff.ChunkOffsetBox) ([]Frame, error) {
+	count := int64(stsz.SampleCount)
+	if count > maxFrames {
+		return nil, fmt.Errorf("too many frames (%d)", count)
+	}
+	if stsz.SampleSize == 0 && int64(len(stsz.Sizes)) != count {
+		return nil, errors.New("sample size table is short")
+	}
+	frames := make([]Frame, count)
+	for i := range frames {
+		if stsz.SampleSize != 0 {
+			frames[i].Size = stsz.SampleSize
+		} else {
+			frames[i].Size = stsz.Sizes[i]
+		}
+	}
+
+	var i int64
+	var t uint64
+	for _, e := range stts.Entries {
+		for j := uint32(0); j < e.SampleCount && i < count; j++ {
+			frames[i].Time = t
+			frames[i].Duration = e.SampleDelta
+			t += uint64(e.SampleDelta)
+			i++
+		}
+	}
+	if i < count {
+		return nil, errors.New("time-to-sample table is short")
+	}
+
+	i = 0
+	sci := 0 // index in stsc.Entries
+	for ci, chunkOff := range stco.Offsets {
+		if i == count {
+			break
+		}
+		chunk := uint32(ci + 1)
+		for sci+1 < len(stsc.Entries) && stsc.Entries[sci+1].FirstChunk <= chunk {
+			sci++
+		}
+		if len(stsc.Entries) == 0 || stsc.Entries[sci].FirstChunk > chunk {
+			return nil, fmt.Errorf("sample-to-chunk table lacks chunk %d", chunk)
+		}
+		off := chunkOff
+		for k := uint32(0); k < stsc.Entries[sci].SamplesPerChunk && i < count; k++ {
+			if off > 1<<62 {
+				return nil, errors.New("invalid chunk offset")
+			}
+			frames[i].Offset = int64(off)
+			off += uint64(frames[i].Size)
+			i++
+		}
+	}
+	if i < count {
+		return nil, errors.New("chunk tables are short")
+	}
+	return frames, nil
+}
@@ -0,0 +1,137 @@
+/*
+Copyright 2026 The go4 Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+     http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package heif
+
+import (
+	"bytes"
+	"errors"
+	"io/ioutil"
+	"os"
+	"strings"
+	"testing"
+	"time"
+
+	"go4.org/media/heif/bmff"
+)
+
+// sequence.heic is a synthetic file with two tracks: an HEVC image
+// sequence of 3 frames in two chunks (stco), and an AVC video of 2
+// frames of constant size (co64, version 1 headers). The frame data
+// is fake.
+func TestSequences(t *testing.T) {
+	f, err := os.Open("testdata/sequence.heic")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	seqs, err := Open(f).Sequences()
+	if err != nil {
+		t.Fatalf("Sequences: %v", err)
+	}
+	if len(seqs) != 2 {
+		t.Fatalf("got %d sequences; want 2", len(seqs))
+	}
+
+	type frame struct {
+		time time.Duration
+		data string
+	}
+	tests := []struct {
+		id             uint32
+		handler, codec string
+		width, height  int
+		timescale      uint32
+		duration       uint64
+		frames         []frame
+	}{
+		{1, "pict", "hvc1", 320, 240, 30, 4, []frame{
+			{0, strings.Repeat("A", 10)},
+			{33333333, strings.Repeat("B", 20)},
+			{66666666, strings.Repeat("C", 30)},
+		}},
+		{2, "vide", "avc1", 64, 48, 600, 1200, []frame{
+			{0, "DDDDD"},
+			{time.Second, "EEEEE"},
+		}},
+	}
+	for i, tt := range tests {
+		s := seqs[i]
+		if s.TrackID != tt.id || s.HandlerType != tt.handler || s.CodecType != tt.codec ||
+			s.Width != tt.width || s.Height != tt.height || s.Timescale != tt.timescale || s.Duration != tt.duration {
+			t.Errorf("sequence %d = %+v; want %+v", i, s, tt)
+		}
+		if s.SampleEntry == nil {
+			t.Errorf("sequence %d has no sample entry", i)
+		} else if s.SampleEntry.Width != uint16(tt.width) || s.SampleEntry.CompressorName != "test" {
+			t.Errorf("sequence %d sample entry = %+v", i, s.SampleEntry)
+		}
+		if len(s.Frames) != len(tt.frames) {
+			t.Errorf("sequence %d has %d frames; want %d", i, len(s.Frames), len(tt.frames))
+			continue
+		}
+		for j, want := range tt.frames {
+			if got := s.FrameTime(j); got != want.time {
+				t.Errorf("sequence %d frame %d time = %v; want %v", i, j, got, want.time)
+			}
+			data, err := s.FrameData(j)
+			if err != nil || string(data) != want.data {
+				t.Errorf("sequence %d frame %d data = %q, %v; want %q", i, j, data, err, want.data)
+			}
+		}
+	}
+
+	// The HEVC configuration is in the sample entry.
+	var hvcC *bmff.HEVCConfigurationBox
+	for _, c := range seqs[0].SampleEntry.Children {
+		if pb, err := c.Parse(); err == nil {
+			hvcC, _ = pb.(*bmff.HEVCConfigurationBox)
+		}
+	}
+	if hvcC == nil || len(hvcC.NALArrays) != 3 {
+		t.Errorf("sample entry hvcC = %v; want 3 NAL arrays", hvcC)
+	}
+}
+
+func TestSequencesBadChunkOffsets(t *testing.T) {
+	data, err := ioutil.ReadFile("testdata/sequence.heic")
+	if err != nil {
+		t.Fatal(err)
+	}
+	// Claim more chunk offsets than the "stco" box holds.
+	i := bytes.Index(data, []byte("stco"))
+	if i < 0 {
+		t.Fatal("no stco box")
+	}
+	copy(data[i+8:], []byte{0xff, 0xff, 0xff, 0xff})
+	_, err = Open(bytes.NewReader(data)).Sequences()
+	var pe *bmff.ParseError
+	if !errors.As(err, &pe) || pe.Type.String() != "stco" {
+		t.Errorf("Sequences error = %v; want stco ParseError", err)
+	}
+}
+
+func TestNoSequences(t *testing.T) {
+	f, err := os.Open("testdata/park.heic")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	seqs, err := Open(f).Sequences()
+	if err != nil || len(seqs) != 0 {
+		t.Errorf("Sequences = %v, %v; want none", seqs, err)
+	}
+}
@@ -0,0 +1,74 @@
+/*
+Copyright 2026 The go4 Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+     http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package imagemeta
+
+import (
+	"io"
+
+	"go4.org/media/heif"
+)
+
+// readHEIF reads the metadata of a HEIF or AVIF file.
+func readHEIF(r io.ReaderAt) (*Metadata, error) {
+	hf := heif.Open(r)
+	format, err := hf.Format()
+	if err != nil {
+		return nil, err
+	}
+	m := &Metadata{Format: format}
+	it, err := hf.PrimaryItem()
+	if err != nil {
+		return nil, err
+	}
+	m.Width, m.Height, _ = it.SpatialExtents()
+	axis, mirror := it.Mirror()
+	m.Orientation = heifOrientation(it.Rotations(), mirror, axis)
+
+	// EXIF and XMP items that can't be read, such as those past the
+	// end of a truncated file, are treated as missing: the rest of
+	// the metadata is still useful.
+	if ex, err := hf.EXIF(); err == nil {
+		m.EXIF = trimEXIF(ex)
+	}
+	if xmp, err := hf.XMP(); err == nil {
+		m.XMP = xmp
+	}
+	m.ICCProfile, err = hf.ICCProfile()
+	if err != nil && err != heif.ErrNoICCProfile {
+		return nil, err
+	}
+	return m, nil
+}
+
+// heifOrientation returns the EXIF orientation equivalent to the given
+// counter-clockwise rotations followed by an optional mirroring, as
+// returned by heif.Item's Rotations and Mirror methods.
+func heifOrientation(rotations int, mirror bool, axis int) int {
+	// By rotations; then mirrored about a vertical axis, then a
+	// horizontal one.
+	table := [4][3]int{
+		{1, 2, 4},
+		{8, 7, 5},
+		{3, 4, 2},
+		{6, 5, 7},
+	}
+	col := 0
+	if mirror {
+		col = 1 + axis&1
+	}
+	return table[rotations&3][col]
+}
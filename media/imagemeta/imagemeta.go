@@ -0,0 +1,159 @@
+/*
+Copyright 2026 The go4 Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+     http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Package imagemeta reads the metadata of JPEG, PNG, WebP, HEIF and
+// AVIF images: their dimensions, orientation, EXIF, XMP and ICC color
+// profile.
+//
+// Images are read through an io.ReaderAt, and only the bytes holding
+// the metadata and the structure leading to it are read; the image
+// data itself is skipped.
+package imagemeta // import "go4.org/media/imagemeta"
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"io"
+)
+
+// ErrUnknownFormat is returned by Read for files that aren't in one
+// of the supported formats.
+var ErrUnknownFormat = errors.New("imagemeta: unknown image format")
+
+// Metadata is the metadata of an image.
+type Metadata struct {
+	// Format is "jpeg", "png", "webp", "heic", "heif" or "avif".
+	Format string
+
+	// Width and Height are the dimensions of the image as stored,
+	// before Orientation is applied.
+	Width, Height int
+
+	// Orientation is the transform needed to display the image, as
+	// an EXIF orientation value in the range [1,8]. It's 1 if the
+	// image has no orientation metadata. For HEIF and AVIF images,
+	// it's derived from the rotation and mirroring properties of
+	// the primary image, which take precedence over EXIF.
+	Orientation int
+
+	// EXIF is the raw EXIF data, starting with the TIFF header, or
+	// nil if the image has none. For HEIF and AVIF images, it's
+	// also nil if the EXIF item can't be read.
+	EXIF []byte
+
+	// XMP is the XMP packet, or nil if the image has none. As with
+	// EXIF, an unreadable HEIF or AVIF item is treated as missing.
+	XMP []byte
+
+	// ICCProfile is the ICC color profile, or nil if the image has
+	// none.
+	ICCProfile []byte
+}
+
+// maxChunkSize is the largest metadata chunk read into memory.
+const maxChunkSize = 16 << 20
+
+// Read reads the metadata of the image in r, whose format is detected
+// from its first bytes.
+func Read(r io.ReaderAt) (*Metadata, error) {
+	var hdr [12]byte
+	n, err := r.ReadAt(hdr[:], 0)
+	if n < len(hdr) {
+		if err == nil || err == io.EOF {
+			err = ErrUnknownFormat
+		}
+		return nil, err
+	}
+	var m *Metadata
+	switch {
+	case bytes.HasPrefix(hdr[:], jpegSOI):
+		m, err = readJPEG(r)
+	case bytes.HasPrefix(hdr[:], pngSignature):
+		m, err = readPNG(r)
+	case string(hdr[:4]) == "RIFF" && string(hdr[8:12]) == "WEBP":
+		m, err = readWebP(r)
+	case string(hdr[4:8]) == "ftyp":
+		m, err = readHEIF(r)
+	default:
+		return nil, ErrUnknownFormat
+	}
+	if err != nil {
+		return nil, err
+	}
+	if m.Orientation == 0 {
+		m.Orientation = exifOrientation(m.EXIF)
+	}
+	return m, nil
+}
+
+// readFull reads n bytes of r at off.
+func readFull(r io.ReaderAt, off int64, n int) ([]byte, error) {
+	buf := make([]byte, n)
+	nr, err := r.ReadAt(buf, off)
+	if nr == n {
+		return buf, nil
+	}
+	if err == nil || err == io.EOF {
+		err = io.ErrUnexpectedEOF
+	}
+	return nil, err
+}
+
+// exifHeader is the prefix of EXIF data in JPEG APP1 segments, which
+// other formats sometimes keep.
+var exifHeader = []byte("Exif\x00\x00")
+
+// trimEXIF returns the EXIF data ex without its exifHeader, if any.
+func trimEXIF(ex []byte) []byte {
+	return bytes.TrimPrefix(ex, exifHeader)
+}
+
+// exifOrientation returns the orientation of the first IFD of the
+// EXIF data ex, or 1 if it has none.
+func exifOrientation(ex []byte) int {
+	if len(ex) < 8 {
+		return 1
+	}
+	var bo binary.ByteOrder
+	switch string(ex[:4]) {
+	case "II*\x00":
+		bo = binary.LittleEndian
+	case "MM\x00*":
+		bo = binary.BigEndian
+	default:
+		return 1
+	}
+	off := uint64(bo.Uint32(ex[4:]))
+	if off+2 > uint64(len(ex)) {
+		return 1
+	}
+	n := uint64(bo.Uint16(ex[off:]))
+	for i, p := uint64(0), off+2; i < n && p+12 <= uint64(len(ex)); i, p = i+1, p+12 {
+		const (
+			tagOrientation = 0x0112
+			typeShort      = 3
+		)
+		if bo.Uint16(ex[p:]) != tagOrientation || bo.Uint16(ex[p+2:]) != typeShort {
+			continue
+		}
+		if o := int(bo.Uint16(ex[p+8:])); o >= 1 && o <= 8 {
+			return o
+		}
+		return 1
+	}
+	return 1
+}
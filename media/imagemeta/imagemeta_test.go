@@ -0,0 +1,314 @@
+/*
+Copyright 2026 The go4 Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+     http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package imagemeta
+
+import (
+	"bytes"
+	"compress/zlib"
+	"encoding/binary"
+	"hash/crc32"
+	"image"
+	"image/jpeg"
+	"image/png"
+	"math/rand"
+	"os"
+	"testing"
+)
+
+// tiffWithOrientation returns big-endian EXIF data whose first IFD
+// holds only an orientation tag.
+func tiffWithOrientation(o uint16) []byte {
+	b := []byte("MM\x00*\x00\x00\x00\x08\x00\x01")
+	b = append(b, 0x01, 0x12, 0, 3, 0, 0, 0, 1, byte(o>>8), byte(o), 0, 0)
+	return append(b, 0, 0, 0, 0) // no next IFD
+}
+
+func testImage(w, h int) image.Image {
+	m := image.NewRGBA(image.Rect(0, 0, w, h))
+	rnd := rand.New(rand.NewSource(1))
+	for i := range m.Pix {
+		m.Pix[i] = byte(rnd.Intn(256))
+	}
+	return m
+}
+
+// jpegSegment returns a JPEG segment with the given marker and body.
+func jpegSegment(marker byte, body ...[]byte) []byte {
+	b := bytes.Join(body, nil)
+	return append([]byte{0xff, marker, byte((len(b) + 2) >> 8), byte(len(b) + 2)}, b...)
+}
+
+func testJPEG(t *testing.T, w, h int) []byte {
+	var buf bytes.Buffer
+	if err := jpeg.Encode(&buf, testImage(w, h), nil); err != nil {
+		t.Fatal(err)
+	}
+	segs := bytes.Join([][]byte{
+		jpegSegment(markerAPP1, exifHeader, tiffWithOrientation(6)),
+		jpegSegment(markerAPP1, xmpHeader, []byte("<x:xmpmeta/>")),
+		// ICC profile chunks, out of order.
+		jpegSegment(markerAPP2, iccHeader, []byte{2, 2}, []byte("-profile")),
+		jpegSegment(markerAPP2, iccHeader, []byte{1, 2}, []byte("icc")),
+	}, nil)
+	b := buf.Bytes()
+	return append(append(b[:2:2], segs...), b[2:]...)
+}
+
+// pngChunk returns a PNG chunk of type typ.
+func pngChunk(typ string, data ...[]byte) []byte {
+	d := bytes.Join(data, nil)
+	b := make([]byte, 4, 12+len(d))
+	binary.BigEndian.PutUint32(b, uint32(len(d)))
+	b = append(append(b, typ...), d...)
+	var crc [4]byte
+	binary.BigEndian.PutUint32(crc[:], crc32.ChecksumIEEE(b[4:]))
+	return append(b, crc[:]...)
+}
+
+func deflate(b []byte) []byte {
+	var buf bytes.Buffer
+	zw := zlib.NewWriter(&buf)
+	zw.Write(b)
+	zw.Close()
+	return buf.Bytes()
+}
+
+func testPNG(t *testing.T, w, h int) []byte {
+	var buf bytes.Buffer
+	if err := png.Encode(&buf, testImage(w, h)); err != nil {
+		t.Fatal(err)
+	}
+	b := buf.Bytes()
+	ihdrEnd := len(pngSignature) + 8 + 13 + 4
+	chunks := bytes.Join([][]byte{
+		pngChunk("iCCP", []byte("sRGB\x00\x00"), deflate([]byte("icc-profile"))),
+		pngChunk("iTXt", []byte("Comment\x00\x00\x00\x00\x00"), []byte("not XMP")),
+		pngChunk("iTXt", []byte(xmpKeyword+"\x00\x01\x00\x00\x00"), deflate([]byte("<x:xmpmeta/>"))),
+	}, nil)
+	b = append(append(b[:ihdrEnd:ihdrEnd], chunks...), b[ihdrEnd:]...)
+	// eXIf after the image data, as some writers do.
+	iend := len(b) - 12
+	return append(append(b[:iend:iend], pngChunk("eXIf", tiffWithOrientation(3))...), b[iend:]...)
+}
+
+// webpChunk returns a RIFF chunk of type typ, padded to an even size.
+func webpChunk(typ string, data []byte) []byte {
+	b := append([]byte(typ), 0, 0, 0, 0)
+	binary.LittleEndian.PutUint32(b[4:], uint32(len(data)))
+	b = append(b, data...)
+	if len(data)%2 == 1 {
+		b = append(b, 0)
+	}
+	return b
+}
+
+func riff(chunks ...[]byte) []byte {
+	body := append([]byte("WEBP"), bytes.Join(chunks, nil)...)
+	b := append([]byte("RIFF"), 0, 0, 0, 0)
+	binary.LittleEndian.PutUint32(b[4:], uint32(len(body)))
+	return append(b, body...)
+}
+
+// vp8lHeader returns the start of a lossless WebP bitstream.
+func vp8lHeader(w, h int) []byte {
+	bits := uint32(w-1) | uint32(h-1)<<14
+	return []byte{0x2f, byte(bits), byte(bits >> 8), byte(bits >> 16), byte(bits >> 24), 0}
+}
+
+func TestRead(t *testing.T) {
+	vp8x := []byte{0x2c, 0, 0, 0, 99, 0, 0, 49, 0, 0} // ICC, EXIF, XMP; 100x50
+	tests := []struct {
+		name string
+		data []byte
+		want Metadata
+	}{
+		{
+			name: "jpeg",
+			data: testJPEG(t, 30, 20),
+			want: Metadata{Format: "jpeg", Width: 30, Height: 20, Orientation: 6,
+				EXIF: tiffWithOrientation(6), XMP: []byte("<x:xmpmeta/>"), ICCProfile: []byte("icc-profile")},
+		},
+		{
+			name: "png",
+			data: testPNG(t, 30, 20),
+			want: Metadata{Format: "png", Width: 30, Height: 20, Orientation: 3,
+				EXIF: tiffWithOrientation(3), XMP: []byte("<x:xmpmeta/>"), ICCProfile: []byte("icc-profile")},
+		},
+		{
+			name: "webp extended",
+			data: riff(
+				webpChunk("VP8X", vp8x),
+				webpChunk("ICCP", []byte("icc-profile")),
+				webpChunk("VP8L", vp8lHeader(100, 50)),
+				webpChunk("EXIF", append(exifHeader, tiffWithOrientation(8)...)),
+				webpChunk("XMP ", []byte("<x:xmpmeta/>")),
+			),
+			want: Metadata{Format: "webp", Width: 100, Height: 50, Orientation: 8,
+				EXIF: tiffWithOrientation(8), XMP: []byte("<x:xmpmeta/>"), ICCProfile: []byte("icc-profile")},
+		},
+		{
+			name: "webp lossless",
+			data: riff(webpChunk("VP8L", vp8lHeader(7, 3))),
+			want: Metadata{Format: "webp", Width: 7, Height: 3, Orientation: 1},
+		},
+		{
+			name: "webp lossy",
+			data: riff(webpChunk("VP8 ", []byte{0x50, 0x02, 0x00, 0x9d, 0x01, 0x2a, 0x40, 0x01, 0xf0, 0x00, 0, 0})),
+			want: Metadata{Format: "webp", Width: 320, Height: 240, Orientation: 1},
+		},
+	}
+	for _, tt := range tests {
+		got, err := Read(bytes.NewReader(tt.data))
+		if err != nil {
+			t.Errorf("%s: %v", tt.name, err)
+			continue
+		}
+		if !equalMetadata(got, &tt.want) {
+			t.Errorf("%s: got %+q; want %+q", tt.name, got, tt.want)
+		}
+	}
+}
+
+func equalMetadata(a, b *Metadata) bool {
+	return a.Format == b.Format && a.Width == b.Width && a.Height == b.Height &&
+		a.Orientation == b.Orientation && bytes.Equal(a.EXIF, b.EXIF) &&
+		bytes.Equal(a.XMP, b.XMP) && bytes.Equal(a.ICCProfile, b.ICCProfile)
+}
+
+func TestReadHEIF(t *testing.T) {
+	tests := []struct {
+		file          string
+		format        string
+		width, height int
+		orientation   int
+		exif          bool
+	}{
+		{"park.heic", "heic", 4032, 3024, 1, true},
+		{"rotate.avif", "avif", 640, 480, 8, true},
+		// The EXIF item of rotate.heic is past the end of the file.
+		{"rotate.heic", "heic", 4032, 3024, 6, false},
+	}
+	for _, tt := range tests {
+		f, err := os.Open("../heif/testdata/" + tt.file)
+		if err != nil {
+			t.Fatal(err)
+		}
+		m, err := Read(f)
+		f.Close()
+		if err != nil {
+			t.Errorf("%s: %v", tt.file, err)
+			continue
+		}
+		if m.Format != tt.format || m.Width != tt.width || m.Height != tt.height || m.Orientation != tt.orientation {
+			t.Errorf("%s: got format %q, %dx%d, orientation %d; want %q, %dx%d, %d", tt.file,
+				m.Format, m.Width, m.Height, m.Orientation, tt.format, tt.width, tt.height, tt.orientation)
+		}
+		if (m.EXIF != nil) != tt.exif {
+			t.Errorf("%s: has EXIF = %v; want %v", tt.file, m.EXIF != nil, tt.exif)
+		}
+		if m.EXIF != nil && !bytes.HasPrefix(m.EXIF, []byte("MM\x00*")) && !bytes.HasPrefix(m.EXIF, []byte("II*\x00")) {
+			t.Errorf("%s: EXIF doesn't start with a TIFF header: %q", tt.file, m.EXIF[:8])
+		}
+	}
+}
+
+func TestHEIFOrientation(t *testing.T) {
+	tests := []struct {
+		rotations int
+		mirror    bool
+		axis      int
+		want      int
+	}{
+		{0, false, 0, 1},
+		{0, true, 0, 2},
+		{2, false, 0, 3},
+		{0, true, 1, 4},
+		{1, true, 1, 5},
+		{3, false, 0, 6},
+		{1, true, 0, 7},
+		{1, false, 0, 8},
+		{3, true, 0, 5},
+		{2, true, 1, 2},
+	}
+	for _, tt := range tests {
+		if got := heifOrientation(tt.rotations, tt.mirror, tt.axis); got != tt.want {
+			t.Errorf("heifOrientation(%d, %v, %d) = %d; want %d", tt.rotations, tt.mirror, tt.axis, got, tt.want)
+		}
+	}
+}
+
+type countingReaderAt struct {
+	r *bytes.Reader
+	n int64
+}
+
+func (r *countingReaderAt) ReadAt(p []byte, off int64) (int, error) {
+	n, err := r.r.ReadAt(p, off)
+	r.n += int64(n)
+	return n, err
+}
+
+func TestReadsOnlyMetadata(t *testing.T) {
+	for _, data := range [][]byte{testJPEG(t, 400, 400), testPNG(t, 400, 400)} {
+		cr := &countingReaderAt{r: bytes.NewReader(data)}
+		m, err := Read(cr)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if cr.n > 1<<10 {
+			t.Errorf("%s: read %d bytes of %d", m.Format, cr.n, len(data))
+		}
+	}
+}
+
+func TestReadErrors(t *testing.T) {
+	if _, err := Read(bytes.NewReader([]byte("GIF89a......"))); err != ErrUnknownFormat {
+		t.Errorf("GIF: got error %v; want ErrUnknownFormat", err)
+	}
+	if _, err := Read(bytes.NewReader(nil)); err != ErrUnknownFormat {
+		t.Errorf("empty: got error %v; want ErrUnknownFormat", err)
+	}
+	jpg := testJPEG(t, 10, 10)
+	if _, err := Read(bytes.NewReader(jpg[:40])); err == nil {
+		t.Error("truncated JPEG: no error")
+	}
+	if _, err := Read(bytes.NewReader(riff(webpChunk("ICCP", []byte("x"))))); err == nil {
+		t.Error("WebP without image: no error")
+	}
+}
+
+func TestEXIFOrientation(t *testing.T) {
+	le := []byte("II*\x00\x08\x00\x00\x00\x02\x00")
+	le = append(le, 0x0f, 0x01, 2, 0, 4, 0, 0, 0, 0, 0, 0, 0) // Make
+	le = append(le, 0x12, 0x01, 3, 0, 1, 0, 0, 0, 5, 0, 0, 0)
+	tests := []struct {
+		ex   []byte
+		want int
+	}{
+		{nil, 1},
+		{tiffWithOrientation(7), 7},
+		{tiffWithOrientation(9), 1},
+		{le, 5},
+		{le[:20], 1}, // truncated
+		{[]byte("MM\x00*\xff\xff\xff\xff"), 1},
+	}
+	for i, tt := range tests {
+		if got := exifOrientation(tt.ex); got != tt.want {
+			t.Errorf("%d. exifOrientation = %d; want %d", i, got, tt.want)
+		}
+	}
+}
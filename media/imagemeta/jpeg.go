@@ -0,0 +1,143 @@
+/*
+Copyright 2026 The go4 Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+     http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package imagemeta
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"sort"
+)
+
+var jpegSOI = []byte{0xff, 0xd8}
+
+// JPEG segment markers.
+const (
+	markerSOF0  = 0xc0
+	markerDHT   = 0xc4
+	markerJPG   = 0xc8
+	markerDAC   = 0xcc
+	markerSOF15 = 0xcf
+	markerRST0  = 0xd0
+	markerRST7  = 0xd7
+	markerEOI   = 0xd9
+	markerSOS   = 0xda
+	markerAPP1  = 0xe1
+	markerAPP2  = 0xe2
+	markerTEM   = 0x01
+)
+
+var (
+	xmpHeader = []byte("http://ns.adobe.com/xap/1.0/\x00")
+	iccHeader = []byte("ICC_PROFILE\x00")
+)
+
+// readJPEG reads the segments of a JPEG file up to its first scan.
+func readJPEG(r io.ReaderAt) (*Metadata, error) {
+	m := &Metadata{Format: "jpeg"}
+	iccChunks := map[byte][]byte{}
+	off := int64(len(jpegSOI))
+	for {
+		hdr, err := readFull(r, off, 2)
+		if err != nil {
+			return nil, fmt.Errorf("imagemeta: reading JPEG marker: %v", err)
+		}
+		if hdr[0] != 0xff {
+			return nil, fmt.Errorf("imagemeta: invalid JPEG marker at offset %d", off)
+		}
+		marker := hdr[1]
+		off += 2
+		switch {
+		case marker == 0xff:
+			// Fill byte.
+			off--
+			continue
+		case marker == markerTEM || marker >= markerRST0 && marker <= markerRST7:
+			continue
+		case marker == markerSOS || marker == markerEOI:
+			if m.Width == 0 {
+				return nil, errors.New("imagemeta: JPEG lacks a frame header")
+			}
+			m.ICCProfile = joinICC(iccChunks)
+			return m, nil
+		}
+		lenb, err := readFull(r, off, 2)
+		if err != nil {
+			return nil, fmt.Errorf("imagemeta: reading JPEG segment: %v", err)
+		}
+		n := int(binary.BigEndian.Uint16(lenb)) - 2
+		if n < 0 {
+			return nil, fmt.Errorf("imagemeta: invalid JPEG segment length at offset %d", off)
+		}
+		body := off + 2
+		off = body + int64(n)
+
+		switch {
+		case marker >= markerSOF0 && marker <= markerSOF15 &&
+			marker != markerDHT && marker != markerJPG && marker != markerDAC:
+			// Precision, height, width.
+			if n < 5 {
+				return nil, errors.New("imagemeta: JPEG frame header too short")
+			}
+			b, err := readFull(r, body, 5)
+			if err != nil {
+				return nil, err
+			}
+			m.Height = int(binary.BigEndian.Uint16(b[1:]))
+			m.Width = int(binary.BigEndian.Uint16(b[3:]))
+		case marker == markerAPP1 || marker == markerAPP2:
+			seg, err := readFull(r, body, n)
+			if err != nil {
+				return nil, fmt.Errorf("imagemeta: reading JPEG APP segment: %v", err)
+			}
+			switch {
+			case marker == markerAPP1 && bytes.HasPrefix(seg, exifHeader):
+				if m.EXIF == nil {
+					m.EXIF = seg[len(exifHeader):]
+				}
+			case marker == markerAPP1 && bytes.HasPrefix(seg, xmpHeader):
+				if m.XMP == nil {
+					m.XMP = seg[len(xmpHeader):]
+				}
+			case marker == markerAPP2 && bytes.HasPrefix(seg, iccHeader) && len(seg) >= len(iccHeader)+2:
+				// Sequence number, from 1, and chunk count.
+				seq := seg[len(iccHeader)]
+				iccChunks[seq] = seg[len(iccHeader)+2:]
+			}
+		}
+	}
+}
+
+// joinICC returns the ICC profile split across the given APP2
+// segments, by sequence number, or nil if there are none.
+func joinICC(chunks map[byte][]byte) []byte {
+	if len(chunks) == 0 {
+		return nil
+	}
+	seqs := make([]int, 0, len(chunks))
+	for seq := range chunks {
+		seqs = append(seqs, int(seq))
+	}
+	sort.Ints(seqs)
+	var icc []byte
+	for _, seq := range seqs {
+		icc = append(icc, chunks[byte(seq)]...)
+	}
+	return icc
+}
@@ -0,0 +1,132 @@
+/*
+Copyright 2026 The go4 Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+     http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package imagemeta
+
+import (
+	"bytes"
+	"compress/zlib"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+)
+
+var pngSignature = []byte("\x89PNG\r\n\x1a\n")
+
+// xmpKeyword is the keyword of the iTXt chunk holding XMP.
+const xmpKeyword = "XML:com.adobe.xmp"
+
+// readPNG reads the chunks of a PNG file, skipping the image data.
+func readPNG(r io.ReaderAt) (*Metadata, error) {
+	m := &Metadata{Format: "png"}
+	off := int64(len(pngSignature))
+	for first := true; ; first = false {
+		hdr, err := readFull(r, off, 8)
+		if err != nil {
+			return nil, fmt.Errorf("imagemeta: reading PNG chunk: %v", err)
+		}
+		n := int64(binary.BigEndian.Uint32(hdr))
+		typ := string(hdr[4:8])
+		body := off + 8
+		off = body + n + 4 // and the CRC
+		if first != (typ == "IHDR") {
+			return nil, errors.New("imagemeta: PNG doesn't start with an IHDR chunk")
+		}
+		switch typ {
+		case "IEND":
+			return m, nil
+		case "IHDR", "eXIf", "iCCP", "iTXt":
+		default:
+			continue
+		}
+		if n > maxChunkSize {
+			return nil, fmt.Errorf("imagemeta: PNG %s chunk of %d bytes is too large", typ, n)
+		}
+		data, err := readFull(r, body, int(n))
+		if err != nil {
+			return nil, fmt.Errorf("imagemeta: reading PNG %s chunk: %v", typ, err)
+		}
+		switch typ {
+		case "IHDR":
+			if len(data) < 8 {
+				return nil, errors.New("imagemeta: PNG IHDR chunk too short")
+			}
+			m.Width = int(binary.BigEndian.Uint32(data))
+			m.Height = int(binary.BigEndian.Uint32(data[4:]))
+		case "eXIf":
+			m.EXIF = trimEXIF(data)
+		case "iCCP":
+			// Profile name, NUL, compression method, compressed
+			// profile.
+			i := bytes.IndexByte(data, 0)
+			if i < 0 || i+2 > len(data) || data[i+1] != 0 {
+				continue
+			}
+			if icc, err := inflate(data[i+2:]); err == nil {
+				m.ICCProfile = icc
+			}
+		case "iTXt":
+			if xmp, ok := parseITXt(data, xmpKeyword); ok {
+				m.XMP = xmp
+			}
+		}
+	}
+}
+
+// parseITXt returns the text of the iTXt chunk data if its keyword is
+// keyword.
+func parseITXt(data []byte, keyword string) (text []byte, ok bool) {
+	// Keyword, NUL, compression flag, compression method, language
+	// tag, NUL, translated keyword, NUL, text.
+	k := []byte(keyword + "\x00")
+	if !bytes.HasPrefix(data, k) || len(data) < len(k)+2 {
+		return nil, false
+	}
+	compressed := data[len(k)] == 1
+	rest := data[len(k)+2:]
+	for i := 0; i < 2; i++ {
+		j := bytes.IndexByte(rest, 0)
+		if j < 0 {
+			return nil, false
+		}
+		rest = rest[j+1:]
+	}
+	if !compressed {
+		return rest, true
+	}
+	text, err := inflate(rest)
+	return text, err == nil
+}
+
+// inflate returns the zlib-decompressed data, up to maxChunkSize
+// bytes.
+func inflate(data []byte) ([]byte, error) {
+	zr, err := zlib.NewReader(bytes.NewReader(data))
+	if err != nil {
+		return nil, err
+	}
+	defer zr.Close()
+	out, err := ioutil.ReadAll(io.LimitReader(zr, maxChunkSize+1))
+	if err != nil {
+		return nil, err
+	}
+	if len(out) > maxChunkSize {
+		return nil, errors.New("imagemeta: decompressed PNG chunk too large")
+	}
+	return out, nil
+}
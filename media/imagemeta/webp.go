@@ -0,0 +1,117 @@
+/*
+Copyright 2026 The go4 Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+     http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package imagemeta
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+)
+
+// readWebP reads the chunks of a WebP file, skipping the image data.
+func readWebP(r io.ReaderAt) (*Metadata, error) {
+	m := &Metadata{Format: "webp"}
+	hdr, err := readFull(r, 0, 12)
+	if err != nil {
+		return nil, err
+	}
+	end := 8 + int64(binary.LittleEndian.Uint32(hdr[4:]))
+	haveCanvas := false
+	for off := int64(12); off+8 <= end; {
+		hdr, err := readFull(r, off, 8)
+		if err == io.ErrUnexpectedEOF && m.Width != 0 {
+			break // truncated file; we have what we need
+		}
+		if err != nil {
+			return nil, fmt.Errorf("imagemeta: reading WebP chunk: %v", err)
+		}
+		typ := string(hdr[:4])
+		n := int64(binary.LittleEndian.Uint32(hdr[4:]))
+		body := off + 8
+		off = body + n + n&1 // chunks are padded to an even size
+
+		var want int64 // bytes of the chunk to read
+		switch typ {
+		case "VP8X":
+			want = 10
+		case "VP8 ":
+			want = 10
+		case "VP8L":
+			want = 5
+		case "ICCP", "EXIF", "XMP ":
+			want = n
+		default:
+			continue
+		}
+		if n < want {
+			return nil, fmt.Errorf("imagemeta: WebP %q chunk too short", typ)
+		}
+		if want > maxChunkSize {
+			return nil, fmt.Errorf("imagemeta: WebP %q chunk of %d bytes is too large", typ, n)
+		}
+		data, err := readFull(r, body, int(want))
+		if err != nil {
+			return nil, fmt.Errorf("imagemeta: reading WebP %q chunk: %v", typ, err)
+		}
+		switch typ {
+		case "VP8X":
+			// Flags, reserved, 24-bit canvas width and height,
+			// minus one.
+			m.Width = int(uint24(data[4:])) + 1
+			m.Height = int(uint24(data[7:])) + 1
+			haveCanvas = true
+		case "VP8 ":
+			// Frame tag, start code, 14-bit width and height,
+			// each with a 2-bit scale.
+			if haveCanvas {
+				continue
+			}
+			if data[3] != 0x9d || data[4] != 0x01 || data[5] != 0x2a {
+				return nil, errors.New("imagemeta: invalid WebP VP8 frame header")
+			}
+			m.Width = int(binary.LittleEndian.Uint16(data[6:]) & 0x3fff)
+			m.Height = int(binary.LittleEndian.Uint16(data[8:]) & 0x3fff)
+		case "VP8L":
+			// Signature, then 14-bit width and height minus one.
+			if haveCanvas {
+				continue
+			}
+			if data[0] != 0x2f {
+				return nil, errors.New("imagemeta: invalid WebP VP8L header")
+			}
+			bits := binary.LittleEndian.Uint32(data[1:])
+			m.Width = int(bits&0x3fff) + 1
+			m.Height = int(bits>>14&0x3fff) + 1
+		case "ICCP":
+			m.ICCProfile = data
+		case "EXIF":
+			m.EXIF = trimEXIF(data)
+		case "XMP ":
+			m.XMP = data
+		}
+	}
+	if m.Width == 0 {
+		return nil, errors.New("imagemeta: WebP lacks an image")
+	}
+	return m, nil
+}
+
+// uint24 returns the little-endian 24-bit integer at the start of b.
+func uint24(b []byte) uint32 {
+	return uint32(b[0]) | uint32(b[1])<<8 | uint32(b[2])<<16
+}
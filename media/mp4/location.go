@@ -0,0 +1,114 @@
+/*
+Copyright 2026 The go4 Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+     http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package mp4
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// Location is a point on the Earth.
+type Location struct {
+	Latitude, Longitude float64 // in degrees; north and east are positive
+	Altitude            float64 // in meters, if HasAltitude
+	HasAltitude         bool
+}
+
+// ParseISO6709 parses an ISO 6709 location string, such as
+// "+37.7749-122.4194+010.000/", as found in the "\xa9xyz" box of
+// QuickTime files. Latitude and longitude may be in degrees, degrees
+// and minutes (±DDMM.M, ±DDDMM.M) or degrees, minutes and seconds
+// (±DDMMSS.S, ±DDDMMSS.S).
+func ParseISO6709(s string) (Location, error) {
+	var loc Location
+	fail := func() (Location, error) {
+		return Location{}, fmt.Errorf("mp4: invalid ISO 6709 location %q", s)
+	}
+	rest := strings.TrimSuffix(strings.TrimSpace(s), "/")
+	var parts []string
+	// A coordinate reference system may follow the coordinates.
+	for rest != "" && !strings.HasPrefix(rest, "CRS") {
+		if rest[0] != '+' && rest[0] != '-' {
+			return fail()
+		}
+		i := 1
+		for i < len(rest) && (rest[i] == '.' || '0' <= rest[i] && rest[i] <= '9') {
+			i++
+		}
+		parts = append(parts, rest[:i])
+		rest = rest[i:]
+	}
+	if len(parts) < 2 || len(parts) > 3 {
+		return fail()
+	}
+	var ok bool
+	if loc.Latitude, ok = parseAngle(parts[0], 2); !ok || loc.Latitude < -90 || loc.Latitude > 90 {
+		return fail()
+	}
+	if loc.Longitude, ok = parseAngle(parts[1], 3); !ok || loc.Longitude < -180 || loc.Longitude > 180 {
+		return fail()
+	}
+	if len(parts) == 3 {
+		alt, err := strconv.ParseFloat(parts[2], 64)
+		if err != nil {
+			return fail()
+		}
+		loc.Altitude, loc.HasAltitude = alt, true
+	}
+	return loc, nil
+}
+
+// parseAngle parses a signed ISO 6709 angle whose degrees have
+// degDigits integer digits.
+func parseAngle(s string, degDigits int) (float64, bool) {
+	sign := 1.0
+	if s[0] == '-' {
+		sign = -1
+	}
+	s = s[1:]
+	intLen := strings.IndexByte(s, '.')
+	if intLen < 0 {
+		intLen = len(s)
+	}
+	v, err := strconv.ParseFloat(s, 64)
+	if err != nil || intLen < degDigits {
+		return 0, false
+	}
+	var deg float64
+	switch intLen - degDigits {
+	case 0: // degrees
+		deg = v
+	case 2: // degrees and minutes
+		d, m := float64(int(v/100)), v-float64(int(v/100))*100
+		if m >= 60 {
+			return 0, false
+		}
+		deg = d + m/60
+	case 4: // degrees, minutes and seconds
+		d := float64(int(v / 10000))
+		m := float64(int(v/100)) - d*100
+		sec := v - float64(int(v/100))*100
+		if m >= 60 || sec >= 60 {
+			return 0, false
+		}
+		deg = d + m/60 + sec/3600
+	default:
+		return 0, false
+	}
+	return sign * deg, true
+}
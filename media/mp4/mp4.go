@@ -0,0 +1,270 @@
+/*
+Copyright 2026 The go4 Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+     http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Package mp4 reads the metadata of MP4 and QuickTime (MOV) movie
+// files, such as their duration, dimensions, codecs, creation time
+// and location.
+package mp4 // import "go4.org/media/mp4"
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"time"
+
+	"go4.org/media/heif/bmff"
+)
+
+// maxMoovSize is the largest "moov" box that Parse reads.
+const maxMoovSize = 64 << 20
+
+// ErrNoMoov is returned by Parse for files without a "moov" box.
+var ErrNoMoov = errors.New("mp4: file lacks a moov box")
+
+// Info is the metadata of a movie file.
+type Info struct {
+	// Brand is the file's major brand, such as "isom", "mp42" or
+	// "qt  ". It's empty for QuickTime files without an "ftyp" box.
+	Brand string
+
+	Duration         time.Duration
+	CreationTime     time.Time // zero if unknown
+	ModificationTime time.Time // zero if unknown
+
+	// Width, Height, Rotation and VideoCodec describe the first
+	// video track, if any.
+	Width, Height int
+	Rotation      int    // degrees clockwise to display the video: 0, 90, 180 or 270
+	VideoCodec    string // sample entry type, such as "avc1" or "hvc1"
+
+	// AudioCodec is the sample entry type of the first audio track,
+	// such as "mp4a", if any.
+	AudioCodec string
+
+	// Location is from the QuickTime "\xa9xyz" user data, if present
+	// and valid.
+	Location *Location
+
+	Tracks []*Track
+}
+
+// Track is one track of a movie file.
+type Track struct {
+	ID          uint32
+	HandlerType string // such as "vide" or "soun"
+	Codec       string // type of the first sample entry, such as "avc1"
+	Duration    time.Duration
+
+	// Width and Height are the track's presentation size, before
+	// rotation. They're zero for tracks that aren't visual.
+	Width, Height int
+	Rotation      int // from the track's matrix: 0, 90, 180 or 270
+}
+
+// Parse reads the metadata of the MP4 or QuickTime file in r.
+//
+// If r implements io.Seeker, the media data is skipped without being
+// read.
+func Parse(r io.Reader) (*Info, error) {
+	br := bmff.NewReader(r)
+	info := new(Info)
+	for {
+		b, err := br.ReadBox()
+		if err == io.EOF {
+			return nil, ErrNoMoov
+		}
+		if err != nil {
+			return nil, fmt.Errorf("mp4: %v", err)
+		}
+		switch b.Type().String() {
+		case "ftyp":
+			pb, err := b.Parse()
+			if err != nil {
+				return nil, fmt.Errorf("mp4: parsing ftyp box: %v", err)
+			}
+			if ft, ok := pb.(*bmff.FileTypeBox); ok {
+				info.Brand = ft.MajorBrand
+			}
+		case "moov":
+			if b.Size() == 0 || b.Size() > maxMoovSize {
+				return nil, errors.New("mp4: moov box has unsupported size")
+			}
+			pb, err := b.Parse()
+			if err != nil {
+				return nil, fmt.Errorf("mp4: parsing moov box: %v", err)
+			}
+			moov, ok := pb.(*bmff.ContainerBox)
+			if !ok {
+				return nil, errors.New("mp4: unexpected moov box type")
+			}
+			if err := info.parseMoov(moov); err != nil {
+				return nil, err
+			}
+			return info, nil
+		}
+	}
+}
+
+func (info *Info) parseMoov(moov *bmff.ContainerBox) error {
+	b, err := bmff.Child(moov, "mvhd")
+	if err != nil {
+		return err
+	}
+	mvhd, ok := b.(*bmff.MovieHeaderBox)
+	if !ok {
+		return errors.New("mp4: moov lacks an mvhd box")
+	}
+	info.Duration = bmff.Duration(mvhd.Duration, mvhd.Timescale)
+	info.CreationTime = fileTime(mvhd.CreationTime)
+	info.ModificationTime = fileTime(mvhd.ModificationTime)
+
+	for _, c := range moov.Children {
+		if !c.Type().EqualString("trak") {
+			continue
+		}
+		t, err := parseTrack(c)
+		if err != nil {
+			return err
+		}
+		info.Tracks = append(info.Tracks, t)
+		switch t.HandlerType {
+		case "vide":
+			if info.VideoCodec == "" {
+				info.Width, info.Height = t.Width, t.Height
+				info.Rotation = t.Rotation
+				info.VideoCodec = t.Codec
+			}
+		case "soun":
+			if info.AudioCodec == "" {
+				info.AudioCodec = t.Codec
+			}
+		}
+		// Fragmented files may have no duration in their mvhd.
+		if t.Duration > info.Duration && mvhd.Duration == 0 {
+			info.Duration = t.Duration
+		}
+	}
+
+	udta, err := bmff.Child(moov, "udta")
+	if err != nil {
+		return err
+	}
+	b, err = bmff.Child(udta, "\xa9xyz")
+	if err != nil {
+		return err
+	}
+	if xyz, ok := b.(*bmff.UserDataText); ok {
+		// Malformed locations are ignored.
+		if loc, err := ParseISO6709(xyz.Text); err == nil {
+			info.Location = &loc
+		}
+	}
+	return nil
+}
+
+// parseTrack returns the Track of the "trak" box b.
+func parseTrack(b bmff.Box) (*Track, error) {
+	trak, err := b.Parse()
+	if err != nil {
+		return nil, fmt.Errorf("mp4: parsing trak box: %v", err)
+	}
+	path := func(typs ...string) (bmff.Box, error) {
+		box := trak
+		for _, typ := range typs {
+			if box, err = bmff.Child(box, typ); err != nil {
+				return nil, err
+			}
+		}
+		return box, nil
+	}
+	t := new(Track)
+	b, err = path("tkhd")
+	if err != nil {
+		return nil, err
+	}
+	tkhd, ok := b.(*bmff.TrackHeaderBox)
+	if !ok {
+		return nil, errors.New("mp4: track lacks a tkhd box")
+	}
+	t.ID = tkhd.TrackID
+	t.Width, t.Height = int(tkhd.Width>>16), int(tkhd.Height>>16)
+	t.Rotation = rotation(tkhd.Matrix)
+
+	if b, err = path("mdia", "mdhd"); err != nil {
+		return nil, err
+	}
+	if mdhd, ok := b.(*bmff.MediaHeaderBox); ok {
+		t.Duration = bmff.Duration(mdhd.Duration, mdhd.Timescale)
+	}
+	if b, err = path("mdia", "hdlr"); err != nil {
+		return nil, err
+	}
+	if hdlr, ok := b.(*bmff.HandlerBox); ok {
+		t.HandlerType = hdlr.HandlerType
+	}
+	if b, err = path("mdia", "minf", "stbl", "stsd"); err != nil {
+		return nil, err
+	}
+	if stsd, ok := b.(*bmff.SampleDescriptionBox); ok && len(stsd.Children) > 0 {
+		entry := stsd.Children[0]
+		t.Codec = entry.Type().String()
+		// Fall back to the sample entry's size for visual tracks
+		// whose header lacks one.
+		if ve, ok := parsed(entry).(*bmff.VisualSampleEntry); ok && t.Width == 0 && t.Height == 0 {
+			t.Width, t.Height = int(ve.Width), int(ve.Height)
+		}
+	}
+	return t, nil
+}
+
+// parsed returns the parsed b, or nil if b doesn't parse.
+func parsed(b bmff.Box) bmff.Box {
+	pb, err := b.Parse()
+	if err != nil {
+		return nil
+	}
+	return pb
+}
+
+// epochOffset is the number of seconds from 1904-01-01, the origin
+// of times in movie files, to the Unix epoch.
+const epochOffset = 2082844800
+
+// fileTime returns the time secs seconds after 1904-01-01 UTC, or the
+// zero time if secs is zero.
+func fileTime(secs uint64) time.Time {
+	if secs == 0 {
+		return time.Time{}
+	}
+	return time.Unix(int64(secs)-epochOffset, 0).UTC()
+}
+
+// rotation returns the clockwise rotation, in degrees, of the
+// transformation matrix m, or 0 if m isn't a rotation by a multiple
+// of 90 degrees.
+func rotation(m [9]int32) int {
+	const one = 1 << 16 // in 16.16 fixed point
+	a, b, c, d := m[0], m[1], m[3], m[4]
+	switch {
+	case a == 0 && b == one && c == -one && d == 0:
+		return 90
+	case a == -one && b == 0 && c == 0 && d == -one:
+		return 180
+	case a == 0 && b == -one && c == one && d == 0:
+		return 270
+	}
+	return 0
+}
@@ -0,0 +1,154 @@
+/*
+Copyright 2026 The go4 Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+     http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package mp4
+
+import (
+	"bytes"
+	"io/ioutil"
+	"math"
+	"os"
+	"testing"
+	"time"
+)
+
+func parseFile(t *testing.T, name string) *Info {
+	t.Helper()
+	f, err := os.Open(name)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	info, err := Parse(f)
+	if err != nil {
+		t.Fatalf("Parse(%s): %v", name, err)
+	}
+	return info
+}
+
+func TestParseMP4(t *testing.T) {
+	info := parseFile(t, "testdata/sample.mp4")
+	if info.Brand != "isom" {
+		t.Errorf("Brand = %q; want isom", info.Brand)
+	}
+	if want := 12345 * time.Millisecond; info.Duration != want {
+		t.Errorf("Duration = %v; want %v", info.Duration, want)
+	}
+	if want := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC); !info.CreationTime.Equal(want) {
+		t.Errorf("CreationTime = %v; want %v", info.CreationTime, want)
+	}
+	if info.Width != 1920 || info.Height != 1080 || info.Rotation != 90 {
+		t.Errorf("video = %dx%d rotated %d; want 1920x1080 rotated 90", info.Width, info.Height, info.Rotation)
+	}
+	if info.VideoCodec != "avc1" || info.AudioCodec != "mp4a" {
+		t.Errorf("codecs = %q, %q; want avc1, mp4a", info.VideoCodec, info.AudioCodec)
+	}
+	if len(info.Tracks) != 2 {
+		t.Fatalf("got %d tracks; want 2", len(info.Tracks))
+	}
+	if tr := info.Tracks[0]; tr.ID != 1 || tr.HandlerType != "vide" || tr.Duration != 12345*time.Millisecond {
+		t.Errorf("track 0 = %+v", tr)
+	}
+	if tr := info.Tracks[1]; tr.ID != 2 || tr.HandlerType != "soun" || tr.Duration != 12*time.Second || tr.Width != 0 {
+		t.Errorf("track 1 = %+v", tr)
+	}
+	want := &Location{Latitude: 37.7749, Longitude: -122.4194, Altitude: 10, HasAltitude: true}
+	if info.Location == nil || *info.Location != *want {
+		t.Errorf("Location = %+v; want %+v", info.Location, want)
+	}
+}
+
+func TestParseMOV(t *testing.T) {
+	info := parseFile(t, "testdata/sample.mov")
+	if info.Brand != "qt  " {
+		t.Errorf("Brand = %q; want qt", info.Brand)
+	}
+	if info.Duration != 2500*time.Millisecond {
+		t.Errorf("Duration = %v; want 2.5s", info.Duration)
+	}
+	if want := time.Date(2024, 1, 1, 0, 1, 0, 0, time.UTC); !info.CreationTime.Equal(want) {
+		t.Errorf("CreationTime = %v; want %v", info.CreationTime, want)
+	}
+	// The track header has no size; it comes from the sample entry.
+	if info.Width != 640 || info.Height != 480 || info.Rotation != 180 || info.VideoCodec != "hvc1" {
+		t.Errorf("video = %dx%d rotated %d, codec %q; want 640x480 rotated 180, hvc1", info.Width, info.Height, info.Rotation, info.VideoCodec)
+	}
+	if info.AudioCodec != "" {
+		t.Errorf("AudioCodec = %q; want none", info.AudioCodec)
+	}
+	if loc := info.Location; loc == nil || math.Abs(loc.Latitude-48.1173) > 1e-9 || math.Abs(loc.Longitude+11.516666666) > 1e-6 || loc.HasAltitude {
+		t.Errorf("Location = %+v", loc)
+	}
+}
+
+// Parse must not depend on its reader being seekable.
+func TestParseUnseekable(t *testing.T) {
+	data, err := ioutil.ReadFile("testdata/sample.mp4")
+	if err != nil {
+		t.Fatal(err)
+	}
+	info, err := Parse(ioutil.NopCloser(bytes.NewReader(data)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if info.VideoCodec != "avc1" {
+		t.Errorf("VideoCodec = %q; want avc1", info.VideoCodec)
+	}
+}
+
+func TestParseNoMoov(t *testing.T) {
+	data := []byte("\x00\x00\x00\x10ftypisom\x00\x00\x00\x00")
+	if _, err := Parse(bytes.NewReader(data)); err != ErrNoMoov {
+		t.Errorf("Parse = %v; want ErrNoMoov", err)
+	}
+}
+
+func TestParseISO6709(t *testing.T) {
+	tests := []struct {
+		in   string
+		want Location
+		bad  bool
+	}{
+		{in: "+37.7749-122.4194/", want: Location{Latitude: 37.7749, Longitude: -122.4194}},
+		{in: "+37.7749-122.4194+010.000/", want: Location{Latitude: 37.7749, Longitude: -122.4194, Altitude: 10, HasAltitude: true}},
+		{in: "-3345.5+15112.5-002.5/", want: Location{Latitude: -33.758333333333333, Longitude: 151.208333333333333, Altitude: -2.5, HasAltitude: true}},
+		{in: "+401213.1-0750015.1/", want: Location{Latitude: 40.203638888888889, Longitude: -75.004194444444444}},
+		{in: "+35.6895+139.6917+040.000CRSWGS_84/", want: Location{Latitude: 35.6895, Longitude: 139.6917, Altitude: 40, HasAltitude: true}},
+		{in: "", bad: true},
+		{in: "+37.7749/", bad: true},
+		{in: "37.7749-122.4194/", bad: true},
+		{in: "+97.0+010.0/", bad: true},
+		{in: "+3760.0+01000.0/", bad: true},
+		{in: "+1.0+010.0/", bad: true},
+	}
+	for _, tt := range tests {
+		got, err := ParseISO6709(tt.in)
+		if tt.bad {
+			if err == nil {
+				t.Errorf("ParseISO6709(%q) = %+v; want error", tt.in, got)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("ParseISO6709(%q): %v", tt.in, err)
+			continue
+		}
+		if math.Abs(got.Latitude-tt.want.Latitude) > 1e-9 || math.Abs(got.Longitude-tt.want.Longitude) > 1e-9 ||
+			got.Altitude != tt.want.Altitude || got.HasAltitude != tt.want.HasAltitude {
+			t.Errorf("ParseISO6709(%q) = %+v; want %+v", tt.in, got, tt.want)
+		}
+	}
+}
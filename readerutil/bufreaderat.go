@@ -16,10 +16,17 @@ limitations under the License.
 
 package readerutil
 
-import "io"
+import (
+	"errors"
+	"io"
+	"io/ioutil"
+	"os"
+	"sync"
+)
 
 // NewBufferingReaderAt returns an io.ReaderAt that reads from r as
 // necessary and keeps a copy of all data read in memory.
+// For large or unbounded inputs, use NewBoundedBufferingReaderAt.
 func NewBufferingReaderAt(r io.Reader) io.ReaderAt {
 	return &bufReaderAt{r: r}
 }
@@ -46,3 +53,198 @@ func (br *bufReaderAt) ReadAt(p []byte, off int64) (n int, err error) {
 	}
 	return
 }
+
+// BufferingOptions configures a BufferingReaderAt.
+type BufferingOptions struct {
+	// MaxMemory is the number of bytes kept in memory. Past it, all
+	// the data read is moved to a temporary file. If zero,
+	// DefaultMaxMemory is used.
+	MaxMemory int64
+
+	// TempDir is the directory of the temporary file. If empty, the
+	// default directory for temporary files is used.
+	TempDir string
+}
+
+// DefaultMaxMemory is the default BufferingOptions.MaxMemory.
+const DefaultMaxMemory = 32 << 20
+
+var errBufferingClosed = errors.New("readerutil: read from closed BufferingReaderAt")
+
+// BufferingReaderAt is an io.ReaderAt reading from an io.Reader as
+// necessary, which keeps a copy of the data read in memory up to a
+// limit, and in a temporary file past it.
+//
+// It is safe for concurrent use. Its Close method must be called to
+// remove the temporary file.
+type BufferingReaderAt struct {
+	r    io.Reader
+	opts BufferingOptions
+
+	// fillMu is held while reading from r, so that reads of data
+	// already buffered don't wait for r.
+	fillMu sync.Mutex
+
+	mu     sync.Mutex // guards the fields below
+	n      int64      // bytes read from r
+	mem    []byte     // the n bytes read, if file is nil
+	file   *os.File   // the n bytes read, past MaxMemory
+	eof    bool       // r is at EOF
+	err    error      // non-EOF error reading from r, sticky
+	closed bool
+}
+
+// NewBoundedBufferingReaderAt returns a BufferingReaderAt that reads
+// from r. A nil opts means the default options.
+func NewBoundedBufferingReaderAt(r io.Reader, opts *BufferingOptions) *BufferingReaderAt {
+	br := &BufferingReaderAt{r: r}
+	if opts != nil {
+		br.opts = *opts
+	}
+	if br.opts.MaxMemory <= 0 {
+		br.opts.MaxMemory = DefaultMaxMemory
+	}
+	return br
+}
+
+// ReadAt implements io.ReaderAt, reading from the underlying reader
+// up to off+len(p) if necessary.
+func (br *BufferingReaderAt) ReadAt(p []byte, off int64) (n int, err error) {
+	if off < 0 {
+		return 0, errNegativeOffset
+	}
+	end := off + int64(len(p))
+	if br.needFill(end) {
+		br.fillMu.Lock()
+		br.fill(end)
+		br.fillMu.Unlock()
+	}
+	br.mu.Lock()
+	defer br.mu.Unlock()
+	if br.closed {
+		return 0, errBufferingClosed
+	}
+	if off < br.n {
+		want := p
+		if avail := br.n - off; int64(len(want)) > avail {
+			want = want[:avail]
+		}
+		if br.file != nil {
+			n, err = br.file.ReadAt(want, off)
+			if err != nil && n < len(want) {
+				return n, err
+			}
+		} else {
+			n = copy(want, br.mem[off:])
+		}
+	}
+	if n == len(p) {
+		return n, nil
+	}
+	if br.err != nil {
+		return n, br.err
+	}
+	return n, io.EOF
+}
+
+// needFill reports whether br.r must be read for br.n to reach end.
+func (br *BufferingReaderAt) needFill(end int64) bool {
+	br.mu.Lock()
+	defer br.mu.Unlock()
+	return br.n < end && !br.eof && br.err == nil && !br.closed
+}
+
+// fill reads from br.r until br.n is at least end, or it can't. It
+// must be called with br.fillMu held; br.mu is only held to store
+// what was read.
+func (br *BufferingReaderAt) fill(end int64) {
+	var buf []byte
+	for br.needFill(end) {
+		br.mu.Lock()
+		rem := end - br.n
+		br.mu.Unlock()
+		if buf == nil {
+			size := rem
+			if size > 32<<10 {
+				size = 32 << 10
+			}
+			buf = make([]byte, size)
+		}
+		want := buf
+		if int64(len(want)) > rem {
+			want = want[:rem]
+		}
+		n, err := br.r.Read(want)
+		br.mu.Lock()
+		if n > 0 && !br.closed {
+			if werr := br.store(want[:n]); werr != nil {
+				br.err = werr
+			}
+		}
+		if err == io.EOF {
+			br.eof = true
+		} else if err != nil && br.err == nil {
+			br.err = err
+		}
+		br.mu.Unlock()
+	}
+}
+
+// store appends p to the data read, spilling it to a temporary file
+// if it's too large for memory. br.mu must be held.
+func (br *BufferingReaderAt) store(p []byte) error {
+	if br.file == nil && br.n+int64(len(p)) > br.opts.MaxMemory {
+		f, err := ioutil.TempFile(br.opts.TempDir, "bufreaderat")
+		if err != nil {
+			return err
+		}
+		if _, err := f.Write(br.mem); err != nil {
+			f.Close()
+			os.Remove(f.Name())
+			return err
+		}
+		br.file = f
+		br.mem = nil
+	}
+	if br.file != nil {
+		if _, err := br.file.WriteAt(p, br.n); err != nil {
+			return err
+		}
+	} else {
+		br.mem = append(br.mem, p...)
+	}
+	br.n += int64(len(p))
+	return nil
+}
+
+// Size returns the size of the underlying reader's data, once it has
+// been read to EOF, or -1 before then.
+func (br *BufferingReaderAt) Size() int64 {
+	br.mu.Lock()
+	defer br.mu.Unlock()
+	if !br.eof {
+		return -1
+	}
+	return br.n
+}
+
+// Close releases the memory and removes the temporary file used by
+// br. It does not close the underlying reader.
+func (br *BufferingReaderAt) Close() error {
+	br.mu.Lock()
+	defer br.mu.Unlock()
+	if br.closed {
+		return nil
+	}
+	br.closed = true
+	br.mem = nil
+	if br.file == nil {
+		return nil
+	}
+	err := br.file.Close()
+	if rerr := os.Remove(br.file.Name()); err == nil {
+		err = rerr
+	}
+	br.file = nil
+	return err
+}
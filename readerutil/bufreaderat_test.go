@@ -16,7 +16,17 @@ limitations under the License.
 
 package readerutil
 
-import "testing"
+import (
+	"bytes"
+	"errors"
+	"io"
+	"io/ioutil"
+	"os"
+	"sync"
+	"testing"
+	"testing/iotest"
+	"time"
+)
 
 type trackingReader struct {
 	off       int
@@ -68,3 +78,155 @@ func TestBufferingReaderAt(t *testing.T) {
 		}
 	}
 }
+
+func TestBoundedBufferingReaderAt(t *testing.T) {
+	data := make([]byte, 1000)
+	for i := range data {
+		data[i] = byte(i * 7)
+	}
+	dir, err := ioutil.TempDir("", "bufreaderat")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	for _, maxMem := range []int64{0, 100} {
+		br := NewBoundedBufferingReaderAt(iotest.OneByteReader(bytes.NewReader(data)), &BufferingOptions{
+			MaxMemory: maxMem,
+			TempDir:   dir,
+		})
+		for _, tt := range []struct {
+			off, n int64
+		}{{10, 50}, {0, 20}, {50, 200}, {0, 1000}, {990, 10}} {
+			got := make([]byte, tt.n)
+			if n, err := br.ReadAt(got, tt.off); n != len(got) || err != nil {
+				t.Fatalf("MaxMemory %d: ReadAt(%d, %d) = %d, %v", maxMem, tt.n, tt.off, n, err)
+			}
+			if !bytes.Equal(got, data[tt.off:tt.off+tt.n]) {
+				t.Fatalf("MaxMemory %d: ReadAt(%d, %d) read wrong data", maxMem, tt.n, tt.off)
+			}
+		}
+		if got := br.Size(); got != -1 {
+			t.Errorf("MaxMemory %d: Size before EOF = %d; want -1", maxMem, got)
+		}
+		buf := make([]byte, 10)
+		if n, err := br.ReadAt(buf, 995); n != 5 || err != io.EOF {
+			t.Errorf("MaxMemory %d: ReadAt past EOF = %d, %v; want 5, EOF", maxMem, n, err)
+		}
+		if got := br.Size(); got != int64(len(data)) {
+			t.Errorf("MaxMemory %d: Size = %d; want %d", maxMem, got, len(data))
+		}
+
+		files, _ := ioutil.ReadDir(dir)
+		if spilled := len(files) > 0; spilled != (maxMem == 100) {
+			t.Errorf("MaxMemory %d: spilled to %d files", maxMem, len(files))
+		}
+		if err := br.Close(); err != nil {
+			t.Fatal(err)
+		}
+		if files, _ := ioutil.ReadDir(dir); len(files) != 0 {
+			t.Errorf("MaxMemory %d: %d temporary files left after Close", maxMem, len(files))
+		}
+		if _, err := br.ReadAt(buf, 0); err == nil {
+			t.Errorf("MaxMemory %d: ReadAt after Close succeeded", maxMem)
+		}
+	}
+}
+
+type errReader struct{ err error }
+
+func (r errReader) Read([]byte) (int, error) { return 0, r.err }
+
+func TestBoundedBufferingReaderAtError(t *testing.T) {
+	errBoom := errors.New("boom")
+	r := io.MultiReader(bytes.NewReader([]byte("hello")), errReader{errBoom})
+	br := NewBoundedBufferingReaderAt(r, nil)
+	defer br.Close()
+	buf := make([]byte, 10)
+	if n, err := br.ReadAt(buf, 0); n != 5 || err != errBoom {
+		t.Errorf("ReadAt = %d, %v; want 5, %v", n, err, errBoom)
+	}
+	if n, err := br.ReadAt(buf[:3], 1); n != 3 || err != nil || string(buf[:3]) != "ell" {
+		t.Errorf("ReadAt of buffered data = %d, %v, %q", n, err, buf[:3])
+	}
+	if br.Size() != -1 {
+		t.Errorf("Size = %d after an error; want -1", br.Size())
+	}
+}
+
+func TestBoundedBufferingReaderAtConcurrent(t *testing.T) {
+	data := bytes.Repeat([]byte("0123456789"), 1000)
+	br := NewBoundedBufferingReaderAt(bytes.NewReader(data), &BufferingOptions{MaxMemory: 1000})
+	defer br.Close()
+	var wg sync.WaitGroup
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			buf := make([]byte, 100)
+			for off := int64(i * 10); off+100 <= int64(len(data)); off += 997 {
+				if _, err := br.ReadAt(buf, off); err != nil {
+					t.Error(err)
+					return
+				}
+				if !bytes.Equal(buf, data[off:off+100]) {
+					t.Errorf("wrong data at offset %d", off)
+					return
+				}
+			}
+		}(i)
+	}
+	wg.Wait()
+}
+
+// blockingReader returns data, then signals blocked and blocks until
+// unblock is closed, returning EOF.
+type blockingReader struct {
+	data             []byte
+	blocked, unblock chan struct{}
+}
+
+func (r *blockingReader) Read(p []byte) (int, error) {
+	if len(r.data) > 0 {
+		n := copy(p, r.data)
+		r.data = r.data[n:]
+		return n, nil
+	}
+	close(r.blocked)
+	<-r.unblock
+	return 0, io.EOF
+}
+
+func TestBoundedBufferingReaderAtBufferedDuringFill(t *testing.T) {
+	r := &blockingReader{data: []byte("hello"), blocked: make(chan struct{}), unblock: make(chan struct{})}
+	br := NewBoundedBufferingReaderAt(r, nil)
+	defer br.Close()
+	buf := make([]byte, 5)
+	if _, err := br.ReadAt(buf, 0); err != nil {
+		t.Fatal(err)
+	}
+
+	done := make(chan error, 1)
+	go func() {
+		_, err := br.ReadAt(make([]byte, 10), 0)
+		done <- err
+	}()
+	<-r.blocked
+	read := make(chan struct{})
+	go func() {
+		defer close(read)
+		if n, err := br.ReadAt(buf[:3], 1); n != 3 || err != nil || string(buf[:3]) != "ell" {
+			t.Errorf("ReadAt of buffered data = %d, %v, %q", n, err, buf[:3])
+		}
+	}()
+	select {
+	case <-read:
+	case <-time.After(10 * time.Second):
+		t.Error("ReadAt of buffered data waited for the underlying reader")
+	}
+	close(r.unblock)
+	<-read
+	if err := <-done; err != io.EOF {
+		t.Errorf("ReadAt past the end = %v; want EOF", err)
+	}
+}
@@ -0,0 +1,315 @@
+/*
+Copyright 2026 The go4 Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+     http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package readerutil
+
+import (
+	"container/list"
+	"errors"
+	"io"
+	"sync"
+)
+
+// CachingReaderAt is a SizeReaderAt caching the data of another one in
+// fixed-size blocks, for wrapping ReaderAts for which each read is
+// expensive, such as ranges of network objects.
+//
+// Reads are rounded out to whole blocks, aligned on multiples of the
+// block size, and runs of adjacent blocks missing from the cache are
+// read with a single read of the underlying ReaderAt. The least
+// recently used blocks are evicted past the cache's capacity, and
+// concurrent reads of the same block are served by a single read.
+//
+// It is safe for concurrent use. Its Close method must be called to
+// stop read-ahead.
+type CachingReaderAt struct {
+	ra        SizeReaderAt
+	size      int64
+	blockSize int64
+	maxBlocks int
+
+	aheadWG sync.WaitGroup // for the read-ahead goroutine
+
+	mu         sync.Mutex
+	lru        *list.List              // of *cachedBlock, most recently used first
+	blocks     map[int64]*list.Element // by block index
+	pending    map[int64]*blockFetch   // blocks being read, by index
+	readAhead  int                     // blocks
+	next       int64                   // offset following the last read
+	aheadFirst int64                   // blocks left to read ahead, if aheadFirst <= aheadLast
+	aheadLast  int64
+	aheadBusy  bool // the read-ahead goroutine is running
+	closed     bool
+}
+
+type cachedBlock struct {
+	idx  int64
+	data []byte
+}
+
+// A blockFetch is a read of a block, complete once done is closed.
+//
+// Fetches are tracked per block instead of with a singleflight.Group
+// (go4.org/syncutil/singleflight) because a run of adjacent blocks is
+// read with a single read. A Group only lets callers share a whole
+// call with the same key, so a caller couldn't wait for one block in
+// the middle of another caller's run.
+type blockFetch struct {
+	done chan struct{}
+	data []byte
+	err  error
+}
+
+var errCachingClosed = errors.New("readerutil: read from closed CachingReaderAt")
+
+// NewCachingReaderAt returns a CachingReaderAt reading from ra in
+// blocks of blockSize bytes, caching up to maxBlocks of them.
+func NewCachingReaderAt(ra SizeReaderAt, blockSize, maxBlocks int) *CachingReaderAt {
+	if blockSize <= 0 {
+		panic("readerutil: non-positive block size")
+	}
+	if maxBlocks <= 0 {
+		panic("readerutil: non-positive maximum number of blocks")
+	}
+	return &CachingReaderAt{
+		ra:        ra,
+		size:      ra.Size(),
+		blockSize: int64(blockSize),
+		maxBlocks: maxBlocks,
+		lru:       list.New(),
+		blocks:    make(map[int64]*list.Element),
+		pending:   make(map[int64]*blockFetch),
+	}
+}
+
+// SetReadAhead sets the number of blocks read in the background after
+// those of a read continuing where the previous one stopped. Zero,
+// the default, disables read-ahead. A single goroutine reads ahead,
+// and no more blocks are read ahead than fit in the cache alongside
+// those of the read.
+func (c *CachingReaderAt) SetReadAhead(blocks int) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.readAhead = blocks
+}
+
+// Size returns the size of the underlying ReaderAt.
+func (c *CachingReaderAt) Size() int64 { return c.size }
+
+// ReadAt implements io.ReaderAt.
+func (c *CachingReaderAt) ReadAt(p []byte, off int64) (n int, err error) {
+	if done, err := readAtBounds(p, off, c.size); done {
+		return 0, err
+	}
+	end := off + int64(len(p))
+	if end > c.size {
+		end = c.size
+	}
+	first, last := off/c.blockSize, (end-1)/c.blockSize
+	c.startReadAhead(off, end)
+	fetches, err := c.fetchBlocks(first, last)
+	if err != nil {
+		return 0, err
+	}
+	pos := off
+	for i, f := range fetches {
+		<-f.done
+		if f.err != nil {
+			return n, f.err
+		}
+		m := copy(p[n:end-off], f.data[pos-(first+int64(i))*c.blockSize:])
+		n += m
+		pos += int64(m)
+	}
+	if n < len(p) {
+		return n, io.EOF
+	}
+	return n, nil
+}
+
+// startReadAhead hands the blocks following the read from off to end
+// to the read-ahead goroutine, starting it if needed, if read-ahead is
+// enabled and the read is sequential.
+func (c *CachingReaderAt) startReadAhead(off, end int64) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	sequential := off == c.next && off != 0
+	c.next = end
+	if !sequential || c.closed {
+		return
+	}
+	first, last := off/c.blockSize, (end-1)/c.blockSize
+	// Blocks read ahead mustn't evict those of this read, nor each
+	// other.
+	n := int64(c.readAhead)
+	if room := int64(c.maxBlocks) - (last - first + 1); n > room {
+		n = room
+	}
+	if n <= 0 {
+		return
+	}
+	c.aheadFirst, c.aheadLast = last+1, last+n
+	if max := (c.size - 1) / c.blockSize; c.aheadLast > max {
+		c.aheadLast = max
+	}
+	if !c.aheadBusy && c.aheadFirst <= c.aheadLast {
+		c.aheadBusy = true
+		c.aheadWG.Add(1)
+		go c.readAheadLoop()
+	}
+}
+
+// readAheadLoop reads the blocks handed over by startReadAhead until
+// there are none left.
+func (c *CachingReaderAt) readAheadLoop() {
+	defer c.aheadWG.Done()
+	for {
+		c.mu.Lock()
+		first, last := c.aheadFirst, c.aheadLast
+		if c.closed || first > last {
+			c.aheadBusy = false
+			c.mu.Unlock()
+			return
+		}
+		c.aheadFirst = last + 1
+		c.mu.Unlock()
+		c.fetchBlocks(first, last)
+	}
+}
+
+// cached returns the data of the block idx if it's in the cache, and
+// marks it as the most recently used.
+func (c *CachingReaderAt) cached(idx int64) []byte {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.cachedLocked(idx)
+}
+
+func (c *CachingReaderAt) cachedLocked(idx int64) []byte {
+	e, ok := c.blocks[idx]
+	if !ok {
+		return nil
+	}
+	c.lru.MoveToFront(e)
+	return e.Value.(*cachedBlock).data
+}
+
+// fetchBlocks returns the fetches of the blocks first through last.
+// Blocks in the cache are complete fetches, and blocks being read by
+// another caller are that caller's fetches. The runs of remaining
+// blocks are read before fetchBlocks returns.
+func (c *CachingReaderAt) fetchBlocks(first, last int64) ([]*blockFetch, error) {
+	fetches := make([]*blockFetch, last-first+1)
+	c.mu.Lock()
+	if c.closed {
+		c.mu.Unlock()
+		return nil, errCachingClosed
+	}
+	var mine []bool
+	for i := range fetches {
+		idx := first + int64(i)
+		if data := c.cachedLocked(idx); data != nil {
+			fetches[i] = &blockFetch{done: make(chan struct{}), data: data}
+			close(fetches[i].done)
+		} else if f, ok := c.pending[idx]; ok {
+			fetches[i] = f
+		} else {
+			if mine == nil {
+				mine = make([]bool, len(fetches))
+			}
+			fetches[i] = &blockFetch{done: make(chan struct{})}
+			c.pending[idx] = fetches[i]
+			mine[i] = true
+		}
+	}
+	c.mu.Unlock()
+
+	for i := 0; i < len(mine); {
+		if !mine[i] {
+			i++
+			continue
+		}
+		j := i + 1
+		for j < len(mine) && mine[j] {
+			j++
+		}
+		c.fetchRun(first+int64(i), fetches[i:j])
+		i = j
+	}
+	return fetches, nil
+}
+
+// fetchRun reads the blocks of fetches, starting at block idx, with a
+// single read of the underlying ReaderAt, and completes the fetches.
+func (c *CachingReaderAt) fetchRun(idx int64, fetches []*blockFetch) {
+	off := idx * c.blockSize
+	end := off + int64(len(fetches))*c.blockSize
+	if end > c.size {
+		end = c.size
+	}
+	buf := make([]byte, end-off)
+	n, err := c.ra.ReadAt(buf, off)
+	if n == len(buf) {
+		err = nil
+	} else if err == nil || err == io.EOF {
+		err = io.ErrUnexpectedEOF
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	for i, f := range fetches {
+		if err != nil {
+			f.err = err
+		} else {
+			// Copy each block, so that evicting it frees its memory.
+			b := buf[int64(i)*c.blockSize:]
+			if int64(len(b)) > c.blockSize {
+				b = b[:c.blockSize]
+			}
+			f.data = append([]byte(nil), b...)
+			c.add(idx+int64(i), f.data)
+		}
+		delete(c.pending, idx+int64(i))
+		close(f.done)
+	}
+}
+
+// add adds the block idx to the cache, evicting the least recently
+// used blocks if the cache is full. c.mu must be held.
+func (c *CachingReaderAt) add(idx int64, data []byte) {
+	if _, ok := c.blocks[idx]; ok || c.closed {
+		return
+	}
+	c.blocks[idx] = c.lru.PushFront(&cachedBlock{idx: idx, data: data})
+	for c.lru.Len() > c.maxBlocks {
+		e := c.lru.Back()
+		c.lru.Remove(e)
+		delete(c.blocks, e.Value.(*cachedBlock).idx)
+	}
+}
+
+// Close stops read-ahead, waiting for a background read in progress
+// to finish, and releases the cache. It does not close the underlying
+// ReaderAt. Reads fail after Close.
+func (c *CachingReaderAt) Close() error {
+	c.mu.Lock()
+	c.closed = true
+	c.lru.Init()
+	c.blocks = make(map[int64]*list.Element)
+	c.mu.Unlock()
+	c.aheadWG.Wait()
+	return nil
+}
@@ -0,0 +1,248 @@
+/*
+Copyright 2026 The go4 Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+     http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package readerutil
+
+import (
+	"bytes"
+	"io"
+	"sync"
+	"testing"
+	"time"
+)
+
+// recordingReaderAt records the reads of a SizeReaderAt.
+type recordingReaderAt struct {
+	SizeReaderAt
+	gate chan struct{} // if non-nil, each read waits to receive from it once recorded
+
+	mu    sync.Mutex
+	reads []int64 // offsets
+}
+
+func (r *recordingReaderAt) ReadAt(p []byte, off int64) (int, error) {
+	r.mu.Lock()
+	r.reads = append(r.reads, off)
+	r.mu.Unlock()
+	if r.gate != nil {
+		<-r.gate
+	}
+	return r.SizeReaderAt.ReadAt(p, off)
+}
+
+func (r *recordingReaderAt) numReads() int {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return len(r.reads)
+}
+
+func testData(n int) []byte {
+	b := make([]byte, n)
+	for i := range b {
+		b[i] = byte(i % 251)
+	}
+	return b
+}
+
+func TestCachingReaderAt(t *testing.T) {
+	data := testData(1050)
+	rr := &recordingReaderAt{SizeReaderAt: io.NewSectionReader(bytes.NewReader(data), 0, int64(len(data)))}
+	c := NewCachingReaderAt(rr, 100, 3)
+	if c.Size() != 1050 {
+		t.Fatalf("Size = %d", c.Size())
+	}
+	for _, tt := range []struct {
+		off, n    int64
+		wantReads []int64 // cumulative
+	}{
+		{10, 20, []int64{0}},
+		{30, 70, []int64{0}},             // same block
+		{90, 20, []int64{0, 100}},        // spans two blocks
+		{250, 100, []int64{0, 100, 200}}, // blocks 2 and 3 in one read
+		{0, 10, []int64{0, 100, 200, 0}}, // block 0 was evicted
+		{1000, 50, []int64{0, 100, 200, 0, 1000}},
+	} {
+		buf := make([]byte, tt.n)
+		n, err := c.ReadAt(buf, tt.off)
+		if n != len(buf) || err != nil {
+			t.Fatalf("ReadAt(%d bytes at %d) = %d, %v", tt.n, tt.off, n, err)
+		}
+		if !bytes.Equal(buf, data[tt.off:tt.off+tt.n]) {
+			t.Fatalf("ReadAt(%d bytes at %d) read wrong data", tt.n, tt.off)
+		}
+		if !equalInt64s(rr.reads, tt.wantReads) {
+			t.Fatalf("after ReadAt(%d bytes at %d), underlying reads at %v; want %v", tt.n, tt.off, rr.reads, tt.wantReads)
+		}
+	}
+
+	buf := make([]byte, 100)
+	if n, err := c.ReadAt(buf, 1000); n != 50 || err != io.EOF {
+		t.Errorf("ReadAt past EOF = %d, %v; want 50, EOF", n, err)
+	}
+	if n, err := c.ReadAt(buf, 2000); n != 0 || err != io.EOF {
+		t.Errorf("ReadAt after EOF = %d, %v; want 0, EOF", n, err)
+	}
+}
+
+func TestCachingReaderAtSingleflight(t *testing.T) {
+	data := testData(100)
+	rr := &recordingReaderAt{
+		SizeReaderAt: io.NewSectionReader(bytes.NewReader(data), 0, int64(len(data))),
+		gate:         make(chan struct{}),
+	}
+	c := NewCachingReaderAt(rr, 100, 1)
+	var wg sync.WaitGroup
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			buf := make([]byte, 10)
+			if _, err := c.ReadAt(buf, int64(i*10)); err != nil {
+				t.Error(err)
+			} else if !bytes.Equal(buf, data[i*10:i*10+10]) {
+				t.Errorf("wrong data at offset %d", i*10)
+			}
+		}(i)
+	}
+	time.Sleep(10 * time.Millisecond) // let the reads pile up
+	close(rr.gate)
+	wg.Wait()
+	if n := rr.numReads(); n != 1 {
+		t.Errorf("%d underlying reads; want 1", n)
+	}
+}
+
+func TestCachingReaderAtReadAhead(t *testing.T) {
+	data := testData(1000)
+	rr := &recordingReaderAt{SizeReaderAt: io.NewSectionReader(bytes.NewReader(data), 0, int64(len(data)))}
+	c := NewCachingReaderAt(rr, 100, 10)
+	c.SetReadAhead(2)
+	buf := make([]byte, 50)
+	for off := int64(0); off < 200; off += 50 {
+		if _, err := c.ReadAt(buf, off); err != nil {
+			t.Fatal(err)
+		}
+	}
+	// The reads at 50, 100 and 150 were sequential, so blocks 2 and
+	// 3 are read ahead.
+	deadline := time.Now().Add(5 * time.Second)
+	for c.cached(3) == nil && time.Now().Before(deadline) {
+		time.Sleep(time.Millisecond)
+	}
+	for idx := int64(0); idx < 4; idx++ {
+		if c.cached(idx) == nil {
+			t.Errorf("block %d not cached", idx)
+		}
+	}
+	if n := rr.numReads(); n > 4 {
+		t.Errorf("%d underlying reads; want at most 4", n)
+	}
+
+	// Random reads don't read ahead.
+	if _, err := c.ReadAt(buf, 800); err != nil {
+		t.Fatal(err)
+	}
+	time.Sleep(10 * time.Millisecond)
+	if c.cached(9) != nil {
+		t.Error("block 9 was read ahead after a random read")
+	}
+}
+
+func TestCachingReaderAtReadAheadKeepsRead(t *testing.T) {
+	data := testData(1000)
+	rr := &recordingReaderAt{SizeReaderAt: io.NewSectionReader(bytes.NewReader(data), 0, int64(len(data)))}
+	c := NewCachingReaderAt(rr, 100, 3)
+	defer c.Close()
+	c.SetReadAhead(10)
+	buf := make([]byte, 200)
+	for off := int64(0); off < 400; off += 200 {
+		if _, err := c.ReadAt(buf, off); err != nil {
+			t.Fatal(err)
+		}
+	}
+	// Only one block fits in the cache next to the two just read.
+	deadline := time.Now().Add(5 * time.Second)
+	for c.cached(4) == nil && time.Now().Before(deadline) {
+		time.Sleep(time.Millisecond)
+	}
+	for idx := int64(2); idx < 5; idx++ {
+		if c.cached(idx) == nil {
+			t.Errorf("block %d not cached", idx)
+		}
+	}
+	if c.cached(5) != nil {
+		t.Error("block 5 was read ahead past the cache's capacity")
+	}
+}
+
+func TestCachingReaderAtClose(t *testing.T) {
+	data := testData(1000)
+	rr := &recordingReaderAt{
+		SizeReaderAt: io.NewSectionReader(bytes.NewReader(data), 0, int64(len(data))),
+		gate:         make(chan struct{}, 10),
+	}
+	c := NewCachingReaderAt(rr, 100, 10)
+	buf := make([]byte, 100)
+	rr.gate <- struct{}{}
+	if _, err := c.ReadAt(buf, 0); err != nil {
+		t.Fatal(err)
+	}
+	rr.gate <- struct{}{}
+	if _, err := c.ReadAt(buf[:50], 100); err != nil {
+		t.Fatal(err)
+	}
+	// A sequential read of cached data starts reading ahead, without
+	// reading itself; wait for the read-ahead of blocks 2 through 6
+	// to reach the gate.
+	c.SetReadAhead(5)
+	if _, err := c.ReadAt(buf[:50], 150); err != nil {
+		t.Fatal(err)
+	}
+	deadline := time.Now().Add(5 * time.Second)
+	for rr.numReads() < 3 && time.Now().Before(deadline) {
+		time.Sleep(time.Millisecond)
+	}
+	closed := make(chan struct{})
+	go func() {
+		c.Close()
+		close(closed)
+	}()
+	select {
+	case <-closed:
+		t.Fatal("Close returned before the read-ahead finished")
+	case <-time.After(10 * time.Millisecond):
+	}
+	rr.gate <- struct{}{}
+	<-closed
+	if n := rr.numReads(); n != 3 {
+		t.Errorf("%d underlying reads; want 3", n)
+	}
+	if _, err := c.ReadAt(buf, 0); err == nil {
+		t.Error("ReadAt after Close succeeded")
+	}
+}
+
+func equalInt64s(a, b []int64) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,234 @@
+/*
+Copyright 2026 The go4 Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+     http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package readerutil
+
+import (
+	"context"
+	"errors"
+	"io"
+	"time"
+)
+
+// readDeadliner is implemented by readers, such as net.Conn and
+// os.File pipes, whose in-flight reads can be interrupted.
+type readDeadliner interface {
+	SetReadDeadline(t time.Time) error
+}
+
+// longAgo is a deadline in the past, to interrupt reads.
+var longAgo = time.Unix(1, 0)
+
+// deadliner returns r as a readDeadliner if its SetReadDeadline method
+// works, clearing any read deadline of r, or else nil. An *os.File has
+// the method, but for files that can't be polled, such as regular
+// files, it fails with os.ErrNoDeadline.
+func deadliner(r io.Reader) readDeadliner {
+	d, ok := r.(readDeadliner)
+	if !ok || d.SetReadDeadline(time.Time{}) != nil {
+		return nil
+	}
+	return d
+}
+
+// WithContext returns an io.Reader reading from r until ctx is done,
+// after which reads fail with ctx.Err().
+//
+// A read in progress when ctx is done is interrupted if r has a
+// working SetReadDeadline method, like net.Conn; WithContext clears
+// r's read deadline. Otherwise it's abandoned: the call returns
+// immediately while the read of r continues in the background, and r
+// must no longer be used.
+func WithContext(ctx context.Context, r io.Reader) io.Reader {
+	return &ctxReader{ctx: ctx, r: r, d: deadliner(r)}
+}
+
+type ctxReader struct {
+	ctx context.Context
+	r   io.Reader
+	d   readDeadliner // r, if its reads can be interrupted
+	buf []byte        // for reads in the background
+}
+
+func (cr *ctxReader) Read(p []byte) (int, error) {
+	if err := cr.ctx.Err(); err != nil {
+		return 0, err
+	}
+	done := cr.ctx.Done()
+	if done == nil {
+		return cr.r.Read(p)
+	}
+	if cr.d != nil {
+		n, err := readInterrupting(cr.d, cr.r, p, done)
+		if cerr := cr.ctx.Err(); cerr != nil && err != nil {
+			err = cerr
+		}
+		return n, err
+	}
+	n, err := readAbandoning(cr.r, p, &cr.buf, done)
+	if err == errAbandoned {
+		return 0, cr.ctx.Err()
+	}
+	return n, err
+}
+
+// ReaderAtWithContext returns an io.ReaderAt reading from ra until ctx
+// is done, after which reads fail with ctx.Err().
+//
+// Reads in progress when ctx is done are abandoned: the calls return
+// immediately while the reads of ra continue in the background, into
+// buffers of their own.
+func ReaderAtWithContext(ctx context.Context, ra io.ReaderAt) io.ReaderAt {
+	return &ctxReaderAt{ctx: ctx, ra: ra}
+}
+
+type ctxReaderAt struct {
+	ctx context.Context
+	ra  io.ReaderAt
+}
+
+func (cr *ctxReaderAt) ReadAt(p []byte, off int64) (int, error) {
+	if err := cr.ctx.Err(); err != nil {
+		return 0, err
+	}
+	done := cr.ctx.Done()
+	if done == nil {
+		return cr.ra.ReadAt(p, off)
+	}
+	n, err := readAbandoning(readerAtFunc(func(b []byte) (int, error) {
+		return cr.ra.ReadAt(b, off)
+	}), p, nil, done)
+	if err == errAbandoned {
+		return 0, cr.ctx.Err()
+	}
+	return n, err
+}
+
+type readerAtFunc func(p []byte) (int, error)
+
+func (f readerAtFunc) Read(p []byte) (int, error) { return f(p) }
+
+// readInterrupting reads from r into p, setting the read deadline of
+// r, which is d, to the past if abort is closed first.
+func readInterrupting(d readDeadliner, r io.Reader, p []byte, abort <-chan struct{}) (int, error) {
+	finished := make(chan struct{})
+	defer close(finished)
+	go func() {
+		select {
+		case <-abort:
+			d.SetReadDeadline(longAgo)
+		case <-finished:
+		}
+	}()
+	return r.Read(p)
+}
+
+// errAbandoned is returned by readAbandoning for abandoned reads.
+var errAbandoned = errors.New("readerutil: read abandoned")
+
+// readAbandoning reads from r into p in another goroutine, returning
+// early with errAbandoned if abort is closed first. If buf is non-nil,
+// it holds the buffer to read into in the background, which is reused
+// across calls.
+func readAbandoning(r io.Reader, p []byte, buf *[]byte, abort <-chan struct{}) (int, error) {
+	var b []byte
+	if buf != nil && cap(*buf) >= len(p) {
+		b = (*buf)[:len(p)]
+	} else {
+		b = make([]byte, len(p))
+	}
+	type result struct {
+		n   int
+		err error
+	}
+	c := make(chan result, 1)
+	go func() {
+		n, err := r.Read(b)
+		c <- result{n, err}
+	}()
+	select {
+	case res := <-c:
+		if buf != nil {
+			*buf = b
+		}
+		return copy(p, b[:res.n]), res.err
+	case <-abort:
+		if buf != nil {
+			*buf = nil // still in use
+		}
+		return 0, errAbandoned
+	}
+}
+
+// ErrIdleTimeout is returned by readers from NewIdleTimeoutReader
+// when no data was read for their timeout.
+var ErrIdleTimeout = errors.New("readerutil: no data read before idle timeout")
+
+// NewIdleTimeoutReader returns an io.Reader reading from r that fails
+// with ErrIdleTimeout once no data has been read from r for the
+// duration timeout, either because a read is blocked or because reads
+// return no data.
+//
+// A blocked read is interrupted if r has a working SetReadDeadline
+// method, like net.Conn, which is called before each read. Otherwise
+// it's abandoned, as with WithContext.
+func NewIdleTimeoutReader(r io.Reader, timeout time.Duration) io.Reader {
+	return &idleTimeoutReader{r: r, d: deadliner(r), timeout: timeout}
+}
+
+type idleTimeoutReader struct {
+	r        io.Reader
+	d        readDeadliner // r, if its reads can be interrupted
+	timeout  time.Duration
+	buf      []byte
+	progress time.Time // of the last read with data, or zero before the first read
+	err      error     // sticky ErrIdleTimeout
+}
+
+func (ir *idleTimeoutReader) Read(p []byte) (n int, err error) {
+	if ir.err != nil {
+		return 0, ir.err
+	}
+	now := time.Now()
+	if ir.progress.IsZero() {
+		ir.progress = now
+	}
+	remain := ir.timeout - now.Sub(ir.progress)
+	if remain <= 0 {
+		ir.err = ErrIdleTimeout
+		return 0, ir.err
+	}
+	if ir.d != nil && ir.d.SetReadDeadline(now.Add(remain)) == nil {
+		n, err = ir.r.Read(p)
+		if te, ok := err.(interface{ Timeout() bool }); ok && te.Timeout() && n == 0 {
+			ir.err = ErrIdleTimeout
+			return 0, ir.err
+		}
+	} else {
+		abort := make(chan struct{})
+		t := time.AfterFunc(remain, func() { close(abort) })
+		n, err = readAbandoning(ir.r, p, &ir.buf, abort)
+		t.Stop()
+		if err == errAbandoned {
+			ir.err = ErrIdleTimeout
+			return 0, ir.err
+		}
+	}
+	if n > 0 {
+		ir.progress = time.Now()
+	}
+	return n, err
+}
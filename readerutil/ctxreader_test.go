@@ -0,0 +1,193 @@
+/*
+Copyright 2026 The go4 Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+     http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package readerutil
+
+import (
+	"context"
+	"io"
+	"io/ioutil"
+	"net"
+	"os"
+	"strings"
+	"testing"
+	"time"
+)
+
+// blockingReaderAt is an io.ReaderAt whose reads block until unblock
+// is closed.
+type blockingReaderAt struct {
+	unblock chan struct{}
+}
+
+func (r blockingReaderAt) ReadAt(p []byte, off int64) (int, error) {
+	<-r.unblock
+	return 0, io.EOF
+}
+
+// expectReturn fails t if fn doesn't return within a few seconds.
+func expectReturn(t *testing.T, what string, fn func()) {
+	t.Helper()
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		fn()
+	}()
+	select {
+	case <-done:
+	case <-time.After(5 * time.Second):
+		t.Fatalf("%s didn't return", what)
+	}
+}
+
+func TestWithContext(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	got, err := ioutil.ReadAll(WithContext(ctx, strings.NewReader("hello")))
+	if err != nil || string(got) != "hello" {
+		t.Fatalf("ReadAll = %q, %v", got, err)
+	}
+
+	pr, pw := io.Pipe()
+	defer pw.Close()
+	netr, netw := net.Pipe()
+	defer netw.Close()
+	for name, r := range map[string]io.Reader{"pipe": pr, "net.Pipe": netr} {
+		ctx, cancel := context.WithCancel(context.Background())
+		cr := WithContext(ctx, r)
+		time.AfterFunc(10*time.Millisecond, cancel)
+		expectReturn(t, name+" Read", func() {
+			if _, err := cr.Read(make([]byte, 10)); err != context.Canceled {
+				t.Errorf("%s: Read error = %v; want context.Canceled", name, err)
+			}
+		})
+		if _, err := cr.Read(make([]byte, 10)); err != context.Canceled {
+			t.Errorf("%s: Read after cancel error = %v; want context.Canceled", name, err)
+		}
+	}
+}
+
+func TestReaderAtWithContext(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	ra := ReaderAtWithContext(ctx, strings.NewReader("hello, world"))
+	buf := make([]byte, 5)
+	if n, err := ra.ReadAt(buf, 7); n != 5 || err != nil || string(buf) != "world" {
+		t.Fatalf("ReadAt = %d, %v, %q", n, err, buf)
+	}
+	cancel()
+	if _, err := ra.ReadAt(buf, 0); err != context.Canceled {
+		t.Errorf("ReadAt after cancel error = %v; want context.Canceled", err)
+	}
+
+	br := blockingReaderAt{make(chan struct{})}
+	defer close(br.unblock)
+	ctx, cancel = context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	ra = ReaderAtWithContext(ctx, br)
+	expectReturn(t, "ReadAt", func() {
+		if _, err := ra.ReadAt(buf, 0); err != context.DeadlineExceeded {
+			t.Errorf("ReadAt error = %v; want context.DeadlineExceeded", err)
+		}
+	})
+}
+
+// noDeadlineReader is a reader whose SetReadDeadline method fails, like
+// that of an *os.File of a regular file, and whose reads block until
+// unblock is closed.
+type noDeadlineReader struct {
+	unblock chan struct{}
+}
+
+func (r noDeadlineReader) Read(p []byte) (int, error) {
+	<-r.unblock
+	return 0, io.EOF
+}
+
+func (noDeadlineReader) SetReadDeadline(time.Time) error { return os.ErrNoDeadline }
+
+func TestNoDeadlineReader(t *testing.T) {
+	r := noDeadlineReader{make(chan struct{})}
+	defer close(r.unblock)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	cr := WithContext(ctx, r)
+	expectReturn(t, "WithContext Read", func() {
+		if _, err := cr.Read(make([]byte, 10)); err != context.DeadlineExceeded {
+			t.Errorf("WithContext Read error = %v; want context.DeadlineExceeded", err)
+		}
+	})
+
+	ir := NewIdleTimeoutReader(r, 10*time.Millisecond)
+	expectReturn(t, "idle timeout Read", func() {
+		if _, err := ir.Read(make([]byte, 10)); err != ErrIdleTimeout {
+			t.Errorf("idle timeout Read error = %v; want ErrIdleTimeout", err)
+		}
+	})
+}
+
+// zeroReader returns no data and no error.
+type zeroReader struct{}
+
+func (zeroReader) Read(p []byte) (int, error) { return 0, nil }
+
+func TestIdleTimeoutReader(t *testing.T) {
+	const timeout = 100 * time.Millisecond
+
+	pr, pw := io.Pipe()
+	defer pw.Close()
+	netr, netw := net.Pipe()
+	defer netw.Close()
+	for name, rw := range map[string]struct {
+		r io.Reader
+		w io.Writer
+	}{"pipe": {pr, pw}, "net.Pipe": {netr, netw}} {
+		// Writes more frequent than the timeout keep the reader
+		// going for longer than it.
+		go func(w io.Writer) {
+			for i := 0; i < 10; i++ {
+				time.Sleep(timeout / 5)
+				w.Write([]byte("x"))
+			}
+		}(rw.w)
+		ir := NewIdleTimeoutReader(rw.r, timeout)
+		buf := make([]byte, 1)
+		for i := 0; i < 10; i++ {
+			if _, err := ir.Read(buf); err != nil {
+				t.Fatalf("%s: Read %d: %v", name, i, err)
+			}
+		}
+		expectReturn(t, name+" Read", func() {
+			if _, err := ir.Read(buf); err != ErrIdleTimeout {
+				t.Errorf("%s: Read error = %v; want ErrIdleTimeout", name, err)
+			}
+		})
+	}
+
+	ir := NewIdleTimeoutReader(zeroReader{}, timeout)
+	expectReturn(t, "Read of zeroReader", func() {
+		for {
+			_, err := ir.Read(make([]byte, 1))
+			if err == nil {
+				continue
+			}
+			if err != ErrIdleTimeout {
+				t.Errorf("Read of zeroReader error = %v; want ErrIdleTimeout", err)
+			}
+			return
+		}
+	})
+}
@@ -23,21 +23,42 @@ import (
 
 // NewMultiReaderAt is like io.MultiReader but produces a ReaderAt
 // (and Size), instead of just a reader.
+//
+// It's the same as Concat.
 func NewMultiReaderAt(parts ...SizeReaderAt) SizeReaderAt {
-	m := &multiRA{
-		parts: make([]offsetAndSource, 0, len(parts)),
-	}
-	var off int64
+	return Concat(parts...)
+}
+
+// Concat returns the concatenation of parts.
+//
+// Parts that are themselves concatenations are flattened, so reads
+// find the parts they need with a binary search regardless of how the
+// concatenation was built.
+func Concat(parts ...SizeReaderAt) SizeReaderAt {
+	m := &multiRA{}
 	for _, p := range parts {
-		m.parts = append(m.parts, offsetAndSource{off, p})
-		off += p.Size()
+		m.add(p)
 	}
-	m.size = off
 	return m
 }
 
+func (m *multiRA) add(p SizeReaderAt) {
+	if pm, ok := p.(*multiRA); ok {
+		for _, p := range pm.parts {
+			m.add(p.SizeReaderAt)
+		}
+		return
+	}
+	size := p.Size()
+	if size == 0 {
+		return
+	}
+	m.parts = append(m.parts, offsetAndSource{m.size, size, p})
+	m.size += size
+}
+
 type offsetAndSource struct {
-	off int64
+	off, size int64
 	SizeReaderAt
 }
 
@@ -48,44 +69,64 @@ type multiRA struct {
 
 func (m *multiRA) Size() int64 { return m.size }
 
-func (m *multiRA) ReadAt(p []byte, off int64) (n int, err error) {
-	wantN := len(p)
-
-	// Skip past the requested offset.
-	skipParts := sort.Search(len(m.parts), func(i int) bool {
-		// This function returns whether parts[i] will
-		// contribute any bytes to our output.
-		part := m.parts[i]
-		return part.off+part.Size() > off
+// partAt returns the index of the part containing the byte at off,
+// which must be in [0, m.size).
+func (m *multiRA) partAt(off int64) int {
+	return sort.Search(len(m.parts), func(i int) bool {
+		return m.parts[i].off+m.parts[i].size > off
 	})
-	parts := m.parts[skipParts:]
+}
 
-	// How far to skip in the first part.
-	needSkip := off
-	if len(parts) > 0 {
-		needSkip -= parts[0].off
+// forRange calls fn with each part covering the n bytes at off, in
+// order, along with the offset and length of the range in the part. It
+// stops at the first error.
+func (m *multiRA) forRange(off, n int64, fn func(part SizeReaderAt, off, n int64) error) error {
+	end := off + n
+	for i := m.partAt(off); i < len(m.parts) && m.parts[i].off < end; i++ {
+		part := m.parts[i]
+		pstart := off - part.off
+		if pstart < 0 {
+			pstart = 0
+		}
+		pend := end - part.off
+		if pend > part.size {
+			pend = part.size
+		}
+		if err := fn(part.SizeReaderAt, pstart, pend-pstart); err != nil {
+			return err
+		}
 	}
+	return nil
+}
 
-	for len(parts) > 0 && len(p) > 0 {
+func (m *multiRA) ReadAt(p []byte, off int64) (n int, err error) {
+	if done, err := readAtBounds(p, off, m.size); done {
+		return 0, err
+	}
+	wantN := len(p)
+	if rem := m.size - off; int64(len(p)) > rem {
+		p = p[:rem]
+	}
+	for i := m.partAt(off); len(p) > 0; i++ {
+		part := m.parts[i]
+		skip := off - part.off
 		readP := p
-		partSize := parts[0].Size()
-		if int64(len(readP)) > partSize-needSkip {
-			readP = readP[:partSize-needSkip]
-		}
-		pn, err0 := parts[0].ReadAt(readP, needSkip)
-		if err0 != nil {
-			return n, err0
+		if int64(len(readP)) > part.size-skip {
+			readP = readP[:part.size-skip]
 		}
+		pn, err := part.ReadAt(readP, skip)
 		n += pn
-		p = p[pn:]
-		if int64(pn)+needSkip == partSize {
-			parts = parts[1:]
+		if pn < len(readP) {
+			if err == nil || err == io.EOF {
+				err = io.ErrUnexpectedEOF // part shorter than its Size
+			}
+			return n, err
 		}
-		needSkip = 0
+		p = p[pn:]
+		off += int64(pn)
 	}
-
-	if n != wantN {
-		err = io.ErrUnexpectedEOF
+	if n < wantN {
+		return n, io.EOF
 	}
-	return
+	return n, nil
 }
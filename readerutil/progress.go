@@ -0,0 +1,178 @@
+/*
+Copyright 2026 The go4 Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+     http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package readerutil
+
+import (
+	"io"
+	"math"
+	"time"
+)
+
+// Progress describes how far a ProgressReader has read.
+type Progress struct {
+	Done  int64 // bytes read so far
+	Total int64 // bytes expected, or -1 if unknown
+
+	// Rate is the recent throughput in bytes per second, as a moving
+	// average over about RateWindow.
+	Rate float64
+
+	// Elapsed is the time since the first read.
+	Elapsed time.Duration
+
+	// Remaining is the estimated time until Total bytes are read,
+	// or -1 if unknown.
+	Remaining time.Duration
+
+	// Finished is whether the underlying reader returned an error,
+	// io.EOF or another, in which case this is the last report.
+	Finished bool
+}
+
+// RateWindow is the period over which Progress.Rate is averaged.
+const RateWindow = 5 * time.Second
+
+// rateSampleInterval is the minimum period between samples of the rate.
+const rateSampleInterval = 100 * time.Millisecond
+
+// ProgressReader wraps a Reader, calling Func to report its progress
+// as it's read. No locking is performed.
+type ProgressReader struct {
+	Reader io.Reader
+
+	// Func is called with the progress after each Every bytes and
+	// each Interval, whichever comes first, and once more when the
+	// Reader returns an error or io.EOF. Zero fields are ignored.
+	// Func is called from Read.
+	Func     func(Progress)
+	Every    int64
+	Interval time.Duration
+
+	// Total is the expected number of bytes. Zero or negative means
+	// unknown, so a ProgressReader can be declared without setting it.
+	Total int64
+
+	now        func() time.Time
+	start      time.Time
+	done       int64
+	lastReport time.Time
+	lastDone   int64 // at lastReport
+
+	rate       float64
+	sampleTime time.Time
+	sampleDone int64 // at sampleTime
+	finished   bool
+}
+
+// NewProgressReader returns a ProgressReader reading from r and
+// reporting its progress to fn every second. Its Total is set with
+// Size, which may seek r.
+func NewProgressReader(r io.Reader, fn func(Progress)) *ProgressReader {
+	pr := &ProgressReader{
+		Reader:   r,
+		Func:     fn,
+		Interval: time.Second,
+		Total:    -1,
+	}
+	if size, ok := Size(r); ok {
+		pr.Total = size
+	}
+	return pr
+}
+
+func (pr *ProgressReader) Read(p []byte) (n int, err error) {
+	now := pr.clock()
+	if pr.start.IsZero() {
+		pr.start, pr.lastReport, pr.sampleTime = now, now, now
+	}
+	n, err = pr.Reader.Read(p)
+	if n == 0 && err == nil {
+		return
+	}
+	now = pr.clock()
+	pr.done += int64(n)
+	pr.sample(now)
+	switch {
+	case err != nil:
+		if !pr.finished {
+			pr.finished = true
+			pr.report(now)
+		}
+	case pr.Every > 0 && pr.done-pr.lastDone >= pr.Every,
+		pr.Interval > 0 && now.Sub(pr.lastReport) >= pr.Interval:
+		pr.report(now)
+	}
+	return
+}
+
+func (pr *ProgressReader) clock() time.Time {
+	if pr.now != nil {
+		return pr.now()
+	}
+	return time.Now()
+}
+
+// sample updates the moving average of the rate, if enough time has
+// passed since the last sample.
+func (pr *ProgressReader) sample(now time.Time) {
+	dt := now.Sub(pr.sampleTime)
+	if dt < rateSampleInterval {
+		return
+	}
+	inst := float64(pr.done-pr.sampleDone) / dt.Seconds()
+	if pr.sampleDone == 0 && pr.rate == 0 {
+		pr.rate = inst
+	} else {
+		alpha := 1 - math.Exp(-dt.Seconds()/RateWindow.Seconds())
+		pr.rate += alpha * (inst - pr.rate)
+	}
+	pr.sampleTime, pr.sampleDone = now, pr.done
+}
+
+// Progress returns the current progress of pr.
+func (pr *ProgressReader) Progress() Progress {
+	return pr.progress(pr.clock())
+}
+
+func (pr *ProgressReader) progress(now time.Time) Progress {
+	p := Progress{
+		Done:      pr.done,
+		Total:     pr.Total,
+		Rate:      pr.rate,
+		Remaining: -1,
+		Finished:  pr.finished,
+	}
+	if !pr.start.IsZero() {
+		p.Elapsed = now.Sub(pr.start)
+	}
+	switch {
+	case pr.Total <= 0:
+		p.Total = -1
+	case pr.done >= pr.Total:
+		p.Remaining = 0
+	case pr.rate > 0:
+		p.Remaining = time.Duration(float64(pr.Total-pr.done) / pr.rate * float64(time.Second))
+	}
+	return p
+}
+
+func (pr *ProgressReader) report(now time.Time) {
+	pr.lastReport, pr.lastDone = now, pr.done
+	if pr.Func != nil {
+		pr.Func(pr.progress(now))
+	}
+}
@@ -0,0 +1,110 @@
+/*
+Copyright 2026 The go4 Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+     http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package readerutil
+
+import (
+	"bytes"
+	"io"
+	"math"
+	"testing"
+	"time"
+)
+
+// clockReader is a reader whose reads each advance a fake clock.
+type clockReader struct {
+	r    io.Reader
+	now  time.Time
+	step time.Duration
+}
+
+func (cr *clockReader) Read(p []byte) (int, error) {
+	cr.now = cr.now.Add(cr.step)
+	return cr.r.Read(p)
+}
+
+func TestProgressReader(t *testing.T) {
+	data := bytes.NewReader(make([]byte, 20000))
+	cr := &clockReader{r: data, now: time.Unix(1e9, 0), step: 100 * time.Millisecond}
+	var reports []Progress
+	pr := NewProgressReader(data, func(p Progress) { reports = append(reports, p) })
+	pr.Reader = cr
+	pr.now = func() time.Time { return cr.now }
+	if pr.Total != 20000 {
+		t.Fatalf("Total = %d; want 20000", pr.Total)
+	}
+
+	// 1000 bytes per 100ms read: 10000 bytes per second.
+	buf := make([]byte, 1000)
+	for {
+		if _, err := pr.Read(buf); err != nil {
+			break
+		}
+	}
+	// Reports after 1s of reads, after 2s, and at EOF.
+	if len(reports) != 3 {
+		t.Fatalf("got %d reports: %+v", len(reports), reports)
+	}
+	mid := reports[0]
+	if mid.Done != 10000 || mid.Total != 20000 || mid.Finished {
+		t.Errorf("first report = %+v", mid)
+	}
+	if math.Abs(mid.Rate-10000) > 1 {
+		t.Errorf("Rate = %v; want 10000", mid.Rate)
+	}
+	if mid.Remaining != time.Second {
+		t.Errorf("Remaining = %v; want 1s", mid.Remaining)
+	}
+	last := reports[2]
+	if last.Done != 20000 || !last.Finished || last.Remaining != 0 || last.Elapsed != 2100*time.Millisecond {
+		t.Errorf("last report = %+v", last)
+	}
+}
+
+func TestProgressReaderEvery(t *testing.T) {
+	// A zero Total, as in a ProgressReader declared without one, is
+	// unknown like a negative one.
+	for _, total := range []int64{-1, 0} {
+		var reports []Progress
+		pr := &ProgressReader{
+			Reader: bytes.NewReader(make([]byte, 10000)),
+			Func:   func(p Progress) { reports = append(reports, p) },
+			Every:  3000,
+			Total:  total,
+		}
+		buf := make([]byte, 1000)
+		for {
+			if _, err := pr.Read(buf); err == io.EOF {
+				break
+			} else if err != nil {
+				t.Fatal(err)
+			}
+		}
+		var done []int64
+		for _, p := range reports {
+			done = append(done, p.Done)
+			if p.Total != -1 || p.Remaining != -1 {
+				t.Errorf("Total %d: Total, Remaining = %d, %v; want unknown", total, p.Total, p.Remaining)
+			}
+		}
+		if !equalInt64s(done, []int64{3000, 6000, 9000, 10000}) {
+			t.Errorf("Total %d: reports at %v", total, done)
+		}
+		if p := pr.Progress(); p.Done != 10000 || !p.Finished {
+			t.Errorf("Total %d: Progress = %+v", total, p)
+		}
+	}
+}
@@ -0,0 +1,220 @@
+/*
+Copyright 2026 The go4 Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+     http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package readerutil
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"sync"
+	"time"
+)
+
+// A TokenBucket limits the rate at which the readers and writers
+// sharing it transfer bytes, so they can all draw from one budget.
+//
+// Tokens, one per byte, accumulate at the bucket's rate, up to its
+// burst size, and are taken by the transfers. The rate and burst size
+// can be changed at any time. A TokenBucket is safe for concurrent use.
+type TokenBucket struct {
+	mu      sync.Mutex
+	rate    float64 // bytes per second, or 0 if unlimited
+	burst   int
+	tokens  float64
+	last    time.Time     // when tokens was last updated
+	changed chan struct{} // closed when rate or burst change
+}
+
+// NewTokenBucket returns a TokenBucket allowing bytesPerSec bytes per
+// second with bursts of up to burst bytes, which is also the largest
+// amount transferred at once. It starts full. A bytesPerSec of zero or
+// less means no limit. A burst of zero or less means one second's
+// worth of bytes.
+func NewTokenBucket(bytesPerSec int64, burst int) *TokenBucket {
+	b := &TokenBucket{changed: make(chan struct{})}
+	b.SetRate(bytesPerSec, burst)
+	b.tokens = float64(b.burst)
+	return b
+}
+
+// SetRate changes the rate and burst size of b, as for
+// NewTokenBucket. Transfers waiting for tokens wait according to the
+// new rate.
+func (b *TokenBucket) SetRate(bytesPerSec int64, burst int) {
+	if burst < 1 {
+		const maxInt = int(^uint(0) >> 1)
+		switch {
+		case bytesPerSec < 1:
+			burst = 1 // unlimited, so unused
+		case bytesPerSec > int64(maxInt):
+			burst = maxInt
+		default:
+			burst = int(bytesPerSec)
+		}
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.advance(time.Now())
+	if bytesPerSec < 0 {
+		bytesPerSec = 0
+	}
+	b.rate = float64(bytesPerSec)
+	b.burst = burst
+	if b.tokens > float64(burst) {
+		b.tokens = float64(burst)
+	}
+	close(b.changed)
+	b.changed = make(chan struct{})
+}
+
+// advance adds the tokens accumulated since b.last.
+func (b *TokenBucket) advance(now time.Time) {
+	if !b.last.IsZero() {
+		b.tokens += now.Sub(b.last).Seconds() * b.rate
+		if b.tokens > float64(b.burst) {
+			b.tokens = float64(b.burst)
+		}
+	}
+	b.last = now
+}
+
+// maxChunk returns the burst size, the largest number of tokens that
+// may be taken at once, or 0 if b is unlimited.
+func (b *TokenBucket) maxChunk() int {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.rate == 0 {
+		return 0
+	}
+	return b.burst
+}
+
+// WaitN waits until n tokens are available and takes them. It returns
+// ctx.Err() if ctx is done first, in which case no tokens are taken.
+// It's an error for n to exceed the burst size.
+func (b *TokenBucket) WaitN(ctx context.Context, n int) error {
+	_, err := b.take(ctx, n, false)
+	return err
+}
+
+// take waits for n tokens and takes them, like WaitN. If partial, it
+// takes at most the burst size instead of failing for larger n. It
+// returns the number of tokens taken.
+func (b *TokenBucket) take(ctx context.Context, n int, partial bool) (int, error) {
+	for {
+		b.mu.Lock()
+		if b.rate == 0 {
+			b.mu.Unlock()
+			return n, nil
+		}
+		m := n
+		if m > b.burst {
+			if !partial {
+				burst := b.burst
+				b.mu.Unlock()
+				return 0, fmt.Errorf("readerutil: waiting for %d tokens exceeds the burst size of %d", n, burst)
+			}
+			m = b.burst
+		}
+		b.advance(time.Now())
+		if b.tokens >= float64(m) {
+			b.tokens -= float64(m)
+			b.mu.Unlock()
+			return m, nil
+		}
+		wait := time.Duration((float64(m) - b.tokens) / b.rate * float64(time.Second))
+		changed := b.changed
+		b.mu.Unlock()
+
+		t := time.NewTimer(wait)
+		select {
+		case <-ctx.Done():
+			t.Stop()
+			return 0, ctx.Err()
+		case <-changed:
+			t.Stop()
+		case <-t.C:
+		}
+	}
+}
+
+// NewRateLimitedReader returns an io.Reader reading from r no faster
+// than b allows. Each read returns at most b's burst size and waits
+// for the tokens of the bytes it read after reading them. If ctx is
+// done while waiting, the read returns ctx.Err() along with the bytes
+// read.
+func NewRateLimitedReader(ctx context.Context, r io.Reader, b *TokenBucket) io.Reader {
+	return &rateLimitedReader{ctx: ctx, r: r, b: b}
+}
+
+type rateLimitedReader struct {
+	ctx context.Context
+	r   io.Reader
+	b   *TokenBucket
+}
+
+func (rr *rateLimitedReader) Read(p []byte) (int, error) {
+	if err := rr.ctx.Err(); err != nil {
+		return 0, err
+	}
+	if max := rr.b.maxChunk(); max > 0 && len(p) > max {
+		p = p[:max]
+	}
+	n, err := rr.r.Read(p)
+	for paid := 0; paid < n; {
+		m, werr := rr.b.take(rr.ctx, n-paid, true)
+		if werr != nil {
+			return n, werr
+		}
+		paid += m
+	}
+	return n, err
+}
+
+// NewRateLimitedWriter returns an io.Writer writing to w no faster
+// than b allows, in chunks of at most b's burst size, waiting for the
+// tokens of each chunk before writing it. If ctx is done while
+// waiting, the write returns ctx.Err() along with the number of bytes
+// written.
+func NewRateLimitedWriter(ctx context.Context, w io.Writer, b *TokenBucket) io.Writer {
+	return &rateLimitedWriter{ctx: ctx, w: w, b: b}
+}
+
+type rateLimitedWriter struct {
+	ctx context.Context
+	w   io.Writer
+	b   *TokenBucket
+}
+
+func (rw *rateLimitedWriter) Write(p []byte) (n int, err error) {
+	for len(p) > 0 {
+		m, err := rw.b.take(rw.ctx, len(p), true)
+		if err != nil {
+			return n, err
+		}
+		wn, err := rw.w.Write(p[:m])
+		n += wn
+		if err == nil && wn < m {
+			err = io.ErrShortWrite
+		}
+		if err != nil {
+			return n, err
+		}
+		p = p[m:]
+	}
+	return n, nil
+}
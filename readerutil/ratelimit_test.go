@@ -0,0 +1,128 @@
+/*
+Copyright 2026 The go4 Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+     http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package readerutil
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"io/ioutil"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestTokenBucketShared(t *testing.T) {
+	// Two readers of 2000 bytes share 20000 bytes per second, after
+	// an initial burst of 1000: 3000 bytes take 150ms.
+	b := NewTokenBucket(20000, 1000)
+	start := time.Now()
+	var wg sync.WaitGroup
+	for i := 0; i < 2; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			r := NewRateLimitedReader(context.Background(), bytes.NewReader(make([]byte, 2000)), b)
+			if n, err := io.Copy(ioutil.Discard, r); n != 2000 || err != nil {
+				t.Errorf("Copy = %d, %v", n, err)
+			}
+		}()
+	}
+	wg.Wait()
+	if d := time.Since(start); d < 140*time.Millisecond || d > 5*time.Second {
+		t.Errorf("reads took %v; want about 150ms", d)
+	}
+}
+
+func TestRateLimitedWriter(t *testing.T) {
+	b := NewTokenBucket(50000, 1000)
+	var buf bytes.Buffer
+	w := NewRateLimitedWriter(context.Background(), &buf, b)
+	data := testData(5000)
+	start := time.Now()
+	if n, err := w.Write(data); n != len(data) || err != nil {
+		t.Fatalf("Write = %d, %v", n, err)
+	}
+	if !bytes.Equal(buf.Bytes(), data) {
+		t.Error("wrong data written")
+	}
+	if d := time.Since(start); d < 75*time.Millisecond {
+		t.Errorf("Write took %v; want about 80ms", d)
+	}
+}
+
+func TestTokenBucketCancel(t *testing.T) {
+	b := NewTokenBucket(1, 10)
+	if err := b.WaitN(context.Background(), 10); err != nil {
+		t.Fatal(err)
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	start := time.Now()
+	if err := b.WaitN(ctx, 5); err != context.DeadlineExceeded {
+		t.Errorf("WaitN error = %v; want context.DeadlineExceeded", err)
+	}
+	if d := time.Since(start); d > 5*time.Second {
+		t.Errorf("WaitN took %v after its context was done", d)
+	}
+
+	w := NewRateLimitedWriter(ctx, ioutil.Discard, b)
+	if _, err := w.Write([]byte("x")); err != context.DeadlineExceeded {
+		t.Errorf("Write error = %v; want context.DeadlineExceeded", err)
+	}
+
+	if err := b.WaitN(context.Background(), 11); err == nil {
+		t.Error("WaitN of more than the burst size succeeded")
+	}
+}
+
+func TestTokenBucketDefaultBurst(t *testing.T) {
+	// The burst size defaults to a second's worth.
+	b := NewTokenBucket(1000, 0)
+	if err := b.WaitN(context.Background(), 1000); err != nil {
+		t.Errorf("WaitN of the default burst size: %v", err)
+	}
+	if err := b.WaitN(context.Background(), 1001); err == nil {
+		t.Error("WaitN of more than the default burst size succeeded")
+	}
+}
+
+func TestTokenBucketSetRate(t *testing.T) {
+	b := NewTokenBucket(1, 10)
+	if err := b.WaitN(context.Background(), 10); err != nil {
+		t.Fatal(err)
+	}
+	done := make(chan error, 1)
+	go func() { done <- b.WaitN(context.Background(), 10) }()
+	time.Sleep(10 * time.Millisecond)
+	b.SetRate(1e6, 10)
+	select {
+	case err := <-done:
+		if err != nil {
+			t.Error(err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("WaitN didn't return after the rate increased")
+	}
+
+	// Unlimited.
+	b.SetRate(0, 10)
+	r := NewRateLimitedReader(context.Background(), bytes.NewReader(make([]byte, 1<<20)), b)
+	if n, err := io.Copy(ioutil.Discard, r); n != 1<<20 || err != nil {
+		t.Errorf("Copy = %d, %v", n, err)
+	}
+}
@@ -18,6 +18,7 @@ limitations under the License.
 package readerutil // import "go4.org/readerutil"
 
 import (
+	"errors"
 	"expvar"
 	"io"
 )
@@ -42,6 +43,24 @@ type ReaderAtCloser interface {
 	io.Closer
 }
 
+var errNegativeOffset = errors.New("readerutil: negative offset")
+
+// readAtBounds handles the reads at off of a ReaderAt of size bytes
+// that read nothing: if off is negative or at least size, it returns
+// done and the error ReadAt returns.
+func readAtBounds(p []byte, off, size int64) (done bool, err error) {
+	switch {
+	case off < 0:
+		return true, errNegativeOffset
+	case off >= size:
+		if len(p) == 0 {
+			return true, nil
+		}
+		return true, io.EOF
+	}
+	return false, nil
+}
+
 // TODO(wathiede): make sure all the stat readers work with code that
 // type asserts ReadFrom/WriteTo.
 
@@ -0,0 +1,146 @@
+/*
+Copyright 2026 The go4 Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+     http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package readerutil
+
+import (
+	"errors"
+	"io"
+)
+
+// NewReadSeeker returns an io.ReadSeeker reading ra from its start.
+// The returned value also implements io.ReaderAt and io.WriterTo,
+// whose WriteTo method writes concatenations part by part and Zeros
+// without reading them.
+func NewReadSeeker(ra SizeReaderAt) io.ReadSeeker {
+	return &readSeeker{ra: ra}
+}
+
+type readSeeker struct {
+	ra  SizeReaderAt
+	off int64
+}
+
+func (rs *readSeeker) Read(p []byte) (int, error) {
+	n, err := rs.ra.ReadAt(p, rs.off)
+	rs.off += int64(n)
+	if n > 0 && err == io.EOF {
+		err = nil
+	}
+	return n, err
+}
+
+func (rs *readSeeker) ReadAt(p []byte, off int64) (int, error) {
+	return rs.ra.ReadAt(p, off)
+}
+
+func (rs *readSeeker) Seek(offset int64, whence int) (int64, error) {
+	switch whence {
+	case io.SeekStart:
+	case io.SeekCurrent:
+		offset += rs.off
+	case io.SeekEnd:
+		offset += rs.ra.Size()
+	default:
+		return 0, errors.New("readerutil: invalid whence")
+	}
+	if offset < 0 {
+		return 0, errors.New("readerutil: negative position")
+	}
+	rs.off = offset
+	return offset, nil
+}
+
+func (rs *readSeeker) WriteTo(w io.Writer) (int64, error) {
+	size := rs.ra.Size()
+	if rs.off >= size {
+		return 0, nil
+	}
+	wr := &rangeWriter{w: w}
+	n, err := wr.write(rs.ra, rs.off, size-rs.off)
+	rs.off += n
+	return n, err
+}
+
+// rangeWriter writes ranges of SizeReaderAts to w.
+type rangeWriter struct {
+	w     io.Writer
+	buf   []byte
+	zeros []byte
+}
+
+const rangeWriterBufSize = 32 << 10
+
+// write writes the n bytes of ra at off to w.
+func (rw *rangeWriter) write(ra SizeReaderAt, off, n int64) (written int64, err error) {
+	switch ra := ra.(type) {
+	case *sliceRA:
+		return rw.write(ra.ra, ra.off+off, n)
+	case *multiRA:
+		err := ra.forRange(off, n, func(part SizeReaderAt, off, n int64) error {
+			pn, err := rw.write(part, off, n)
+			written += pn
+			return err
+		})
+		return written, err
+	case zeroRA:
+		if rw.zeros == nil {
+			rw.zeros = make([]byte, rangeWriterBufSize)
+		}
+		for written < n {
+			chunk := rw.zeros
+			if rem := n - written; int64(len(chunk)) > rem {
+				chunk = chunk[:rem]
+			}
+			wn, err := rw.w.Write(chunk)
+			written += int64(wn)
+			if err == nil && wn < len(chunk) {
+				err = io.ErrShortWrite
+			}
+			if err != nil {
+				return written, err
+			}
+		}
+		return written, nil
+	}
+	if rw.buf == nil {
+		rw.buf = make([]byte, rangeWriterBufSize)
+	}
+	for written < n {
+		chunk := rw.buf
+		if rem := n - written; int64(len(chunk)) > rem {
+			chunk = chunk[:rem]
+		}
+		rn, rerr := ra.ReadAt(chunk, off+written)
+		if rn > 0 {
+			wn, err := rw.w.Write(chunk[:rn])
+			written += int64(wn)
+			if err == nil && wn < rn {
+				err = io.ErrShortWrite
+			}
+			if err != nil {
+				return written, err
+			}
+		}
+		if rn < len(chunk) {
+			if rerr == nil || rerr == io.EOF {
+				rerr = io.ErrUnexpectedEOF
+			}
+			return written, rerr
+		}
+	}
+	return written, nil
+}
@@ -19,24 +19,65 @@ limitations under the License.
 package singlereader // import "go4.org/readerutil/singlereader"
 
 import (
+	"container/list"
+	"expvar"
+	"os"
 	"sync"
+	"time"
 
 	"go4.org/readerutil"
 	"go4.org/syncutil/singleflight"
 	"go4.org/wkfs"
 )
 
-var (
-	openerGroup singleflight.Group
+// An Opener opens files for reading, sharing one file descriptor
+// between concurrent users of the same path.
+//
+// The zero value is ready to use and closes each file as soon as its
+// last user closes it, like Open. Setting IdleTimeout keeps files open
+// for reuse after that, subject to MaxOpen.
+//
+// An Opener must not be copied after first use.
+type Opener struct {
+	// OpenFunc opens path. If nil, wkfs.Open is used.
+	OpenFunc func(path string) (readerutil.ReaderAtCloser, error)
 
-	openFileMu sync.Mutex // guards openFiles
-	openFiles  = make(map[string]*openFile)
-)
+	// MaxOpen, if positive, is the number of files to keep open.
+	// When it is exceeded, idle files are closed in least recently
+	// used order. Files in use are never closed, so MaxOpen may be
+	// exceeded while they're held.
+	MaxOpen int
+
+	// IdleTimeout is how long a file is kept open after its last
+	// user closes it. If zero, it is closed immediately. If
+	// negative, it is kept until evicted because of MaxOpen.
+	IdleTimeout time.Duration
+
+	// Stats, if non-nil, counts "hits" (opens served by an already
+	// open file), "opens" (files opened) and "evictions" (idle files
+	// closed because of MaxOpen or IdleTimeout).
+	Stats *expvar.Map
+
+	group singleflight.Group
+
+	mu    sync.Mutex // guards following
+	files map[string]*openFile
+	idle  list.List // of *openFile with refCount 0, most recently used first
+}
+
+// defaultOpener is used by Open. Its stats are published with expvar
+// as "singlereader".
+var defaultOpener = Opener{Stats: expvar.NewMap("singlereader")}
 
 type openFile struct {
-	wkfs.File
-	path     string // map key of openFiles
+	readerutil.ReaderAtCloser
+	file     wkfs.File // the same file, if it is a wkfs.File
+	o        *Opener
+	path     string // map key of o.files
 	refCount int
+
+	elem    *list.Element // in o.idle, or nil if in use
+	idleGen int           // incremented each time the file becomes idle
 }
 
 type openFileHandle struct {
@@ -45,9 +86,10 @@ type openFileHandle struct {
 }
 
 func (f *openFileHandle) Close() error {
-	openFileMu.Lock()
+	o := f.o
+	o.mu.Lock()
 	if f.closed {
-		openFileMu.Unlock()
+		o.mu.Unlock()
 		return nil
 	}
 	f.closed = true
@@ -55,64 +97,197 @@ func (f *openFileHandle) Close() error {
 	if f.refCount < 0 {
 		panic("unexpected negative refcount")
 	}
-	zero := f.refCount == 0
-	if zero {
-		delete(openFiles, f.path)
-	}
-	openFileMu.Unlock()
-	if !zero {
+	if f.refCount > 0 {
+		o.mu.Unlock()
 		return nil
 	}
-	return f.openFile.File.Close()
+	if o.IdleTimeout == 0 {
+		delete(o.files, f.path)
+		o.mu.Unlock()
+		return f.ReaderAtCloser.Close()
+	}
+	f.elem = o.idle.PushFront(f.openFile)
+	f.idleGen++
+	if o.IdleTimeout > 0 {
+		of, gen := f.openFile, f.idleGen
+		time.AfterFunc(o.IdleTimeout, func() { o.expire(of, gen) })
+	}
+	evicted := o.evictLocked()
+	o.mu.Unlock()
+	closeAll(evicted)
+	return nil
+}
+
+// wkfsFileHandle is an openFileHandle of a wkfs.File, with its other
+// methods. Like the file's offset, they're shared by all its users.
+type wkfsFileHandle struct {
+	*openFileHandle
+}
+
+func (h wkfsFileHandle) Read(p []byte) (int, error) { return h.file.Read(p) }
+
+func (h wkfsFileHandle) Seek(offset int64, whence int) (int64, error) {
+	return h.file.Seek(offset, whence)
+}
+
+func (h wkfsFileHandle) Name() string { return h.file.Name() }
+
+func (h wkfsFileHandle) Stat() (os.FileInfo, error) { return h.file.Stat() }
+
+// newHandle returns a new handle of of, which is a wkfs.File if the
+// file is one.
+func newHandle(of *openFile) readerutil.ReaderAtCloser {
+	h := &openFileHandle{false, of}
+	if of.file != nil {
+		return wkfsFileHandle{h}
+	}
+	return h
 }
 
 // Open opens the given file path for reading, reusing existing file descriptors
-// when possible.
+// when possible. It uses an Opener whose Stats are published with
+// expvar as the map "singlereader".
 func Open(path string) (readerutil.ReaderAtCloser, error) {
-	openFileMu.Lock()
-	of := openFiles[path]
-	if of != nil {
-		of.refCount++
-		openFileMu.Unlock()
-		return &openFileHandle{false, of}, nil
+	return defaultOpener.Open(path)
+}
+
+// Open opens the given file path for reading, reusing an open file
+// descriptor for path when possible.
+//
+// If the opened file is a wkfs.File, as it is without an OpenFunc, so
+// is the returned value. Its Read and Seek methods share the file's
+// offset with the other users of path.
+func (o *Opener) Open(path string) (readerutil.ReaderAtCloser, error) {
+	o.mu.Lock()
+	if of := o.files[path]; of != nil {
+		o.acquireLocked(of)
+		o.mu.Unlock()
+		o.count("hits")
+		return newHandle(of), nil
 	}
-	openFileMu.Unlock() // release the lock while we call os.Open
+	o.mu.Unlock() // release the lock while we call OpenFunc
 
 	winner := false // this goroutine made it into Do's func
 
 	// Returns an *openFile
-	resi, err := openerGroup.Do(path, func() (interface{}, error) {
+	resi, err := o.group.Do(path, func() (interface{}, error) {
 		winner = true
-		f, err := wkfs.Open(path)
+		f, err := o.open(path)
 		if err != nil {
 			return nil, err
 		}
+		o.count("opens")
 		of := &openFile{
-			File:     f,
-			path:     path,
-			refCount: 1,
+			ReaderAtCloser: f,
+			o:              o,
+			path:           path,
+			refCount:       1,
+		}
+		of.file, _ = f.(wkfs.File)
+		o.mu.Lock()
+		if o.files == nil {
+			o.files = make(map[string]*openFile)
 		}
-		openFileMu.Lock()
-		openFiles[path] = of
-		openFileMu.Unlock()
+		o.files[path] = of
+		evicted := o.evictLocked()
+		o.mu.Unlock()
+		closeAll(evicted)
 		return of, nil
 	})
 	if err != nil {
 		return nil, err
 	}
-	of = resi.(*openFile)
+	of := resi.(*openFile)
 
-	// If our os.Open was dup-suppressed, we have to increment our
+	// If our open was dup-suppressed, we have to increment our
 	// reference count.
 	if !winner {
-		openFileMu.Lock()
-		if of.refCount == 0 {
+		o.mu.Lock()
+		if o.files[path] != of {
 			// Winner already closed it. Try again (rare).
-			openFileMu.Unlock()
-			return Open(path)
+			o.mu.Unlock()
+			return o.Open(path)
+		}
+		o.acquireLocked(of)
+		o.mu.Unlock()
+		o.count("hits")
+	}
+	return newHandle(of), nil
+}
+
+// CloseIdle closes all files not currently in use, returning the
+// first error encountered.
+func (o *Opener) CloseIdle() error {
+	o.mu.Lock()
+	var idle []*openFile
+	for o.idle.Len() > 0 {
+		idle = append(idle, o.removeIdleLocked(o.idle.Back()))
+	}
+	o.mu.Unlock()
+	return closeAll(idle)
+}
+
+func (o *Opener) open(path string) (readerutil.ReaderAtCloser, error) {
+	if o.OpenFunc != nil {
+		return o.OpenFunc(path)
+	}
+	return wkfs.Open(path)
+}
+
+func (o *Opener) count(key string) {
+	if o.Stats != nil {
+		o.Stats.Add(key, 1)
+	}
+}
+
+// acquireLocked adds a reference to of, which must be in o.files.
+func (o *Opener) acquireLocked(of *openFile) {
+	if of.elem != nil {
+		o.idle.Remove(of.elem)
+		of.elem = nil
+	}
+	of.refCount++
+}
+
+// removeIdleLocked removes the idle file at e from o, returning it for
+// the caller to close.
+func (o *Opener) removeIdleLocked(e *list.Element) *openFile {
+	of := o.idle.Remove(e).(*openFile)
+	of.elem = nil
+	delete(o.files, of.path)
+	return of
+}
+
+// evictLocked removes least recently used idle files while more than
+// MaxOpen are open, returning them for the caller to close.
+func (o *Opener) evictLocked() (evicted []*openFile) {
+	for o.MaxOpen > 0 && len(o.files) > o.MaxOpen && o.idle.Len() > 0 {
+		evicted = append(evicted, o.removeIdleLocked(o.idle.Back()))
+		o.count("evictions")
+	}
+	return evicted
+}
+
+// expire closes of if it has stayed idle since it became idle for the
+// gen'th time.
+func (o *Opener) expire(of *openFile, gen int) {
+	o.mu.Lock()
+	if of.elem == nil || of.idleGen != gen {
+		o.mu.Unlock()
+		return
+	}
+	o.removeIdleLocked(of.elem)
+	o.mu.Unlock()
+	o.count("evictions")
+	of.ReaderAtCloser.Close()
+}
+
+func closeAll(files []*openFile) error {
+	var firstErr error
+	for _, of := range files {
+		if err := of.ReaderAtCloser.Close(); err != nil && firstErr == nil {
+			firstErr = err
 		}
-		of.refCount++
-		openFileMu.Unlock()
 	}
-	return &openFileHandle{false, of}, nil
+	return firstErr
 }
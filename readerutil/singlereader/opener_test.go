@@ -18,11 +18,19 @@ package singlereader
 
 import (
 	"bytes"
+	"expvar"
 	"fmt"
+	"io"
 	"io/ioutil"
 	"os"
 	"runtime"
+	"strings"
+	"sync"
 	"testing"
+	"time"
+
+	"go4.org/readerutil"
+	"go4.org/wkfs"
 )
 
 func TestOpenSingle(t *testing.T) {
@@ -75,3 +83,198 @@ func TestOpenSingle(t *testing.T) {
 		}
 	}
 }
+
+type fakeFile struct {
+	*strings.Reader
+	closed *int
+}
+
+var fakeMu sync.Mutex // guards fakeFile.closed, for idle timeouts
+
+func (f fakeFile) Close() error {
+	fakeMu.Lock()
+	defer fakeMu.Unlock()
+	*f.closed++
+	return nil
+}
+
+// fakeFS returns an Opener whose files are strings, and a map from
+// path to the number of times it was closed.
+func fakeFS(o *Opener) (closes map[string]*int) {
+	closes = make(map[string]*int)
+	o.OpenFunc = func(path string) (readerutil.ReaderAtCloser, error) {
+		if closes[path] == nil {
+			closes[path] = new(int)
+		}
+		return fakeFile{strings.NewReader(path), closes[path]}, nil
+	}
+	o.Stats = new(expvar.Map).Init()
+	return closes
+}
+
+func checkStats(t *testing.T, o *Opener, want string) {
+	t.Helper()
+	var got []string
+	o.Stats.Do(func(kv expvar.KeyValue) {
+		got = append(got, kv.Key+"="+kv.Value.String())
+	})
+	if s := strings.Join(got, " "); s != want {
+		t.Errorf("stats = %q; want %q", s, want)
+	}
+}
+
+// statValue returns the value of the counter key of m, or 0.
+func statValue(m *expvar.Map, key string) int64 {
+	if v, ok := m.Get(key).(*expvar.Int); ok {
+		return v.Value()
+	}
+	return 0
+}
+
+func openClose(t *testing.T, o *Opener, path string) {
+	t.Helper()
+	rac, err := o.Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	buf := make([]byte, len(path))
+	if _, err := rac.ReadAt(buf, 0); err != nil || string(buf) != path {
+		t.Fatalf("ReadAt = %q, %v; want %q", buf, err, path)
+	}
+	if err := rac.Close(); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestOpenFileMethods(t *testing.T) {
+	f, err := ioutil.TempFile("", "foo")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.Remove(f.Name())
+	contents := "Some file contents"
+	if _, err := f.WriteString(contents); err != nil {
+		t.Fatal(err)
+	}
+	f.Close()
+
+	stats := expvar.Get("singlereader").(*expvar.Map)
+	opens := statValue(stats, "opens")
+	rac, err := Open(f.Name())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer rac.Close()
+	if got := statValue(stats, "opens"); got != opens+1 {
+		t.Errorf("published opens = %d after Open; want %d", got, opens+1)
+	}
+	wf, ok := rac.(wkfs.File)
+	if !ok {
+		t.Fatalf("Open returned a %T; want a wkfs.File", rac)
+	}
+	if wf.Name() != f.Name() {
+		t.Errorf("Name = %q; want %q", wf.Name(), f.Name())
+	}
+	if fi, err := wf.Stat(); err != nil || fi.Size() != int64(len(contents)) {
+		t.Errorf("Stat = %v, %v; want size %d", fi, err, len(contents))
+	}
+	if _, err := wf.Seek(5, io.SeekStart); err != nil {
+		t.Fatal(err)
+	}
+	if got, err := ioutil.ReadAll(wf); err != nil || string(got) != contents[5:] {
+		t.Errorf("ReadAll after Seek = %q, %v; want %q", got, err, contents[5:])
+	}
+
+	o := new(Opener)
+	fakeFS(o)
+	rac, err = o.Open("a")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer rac.Close()
+	if _, ok := rac.(wkfs.File); ok {
+		t.Error("Open of a file that isn't a wkfs.File returned a wkfs.File")
+	}
+}
+
+func TestOpenerNoRetention(t *testing.T) {
+	o := new(Opener)
+	closes := fakeFS(o)
+	a, err := o.Open("a")
+	if err != nil {
+		t.Fatal(err)
+	}
+	openClose(t, o, "a")
+	if *closes["a"] != 0 {
+		t.Fatal("closed while in use")
+	}
+	a.Close()
+	a.Close()
+	if *closes["a"] != 1 {
+		t.Fatalf("closed %d times after last Close; want 1", *closes["a"])
+	}
+	openClose(t, o, "a")
+	checkStats(t, o, "hits=1 opens=2")
+}
+
+func TestOpenerIdleLRU(t *testing.T) {
+	o := &Opener{MaxOpen: 2, IdleTimeout: -1}
+	closes := fakeFS(o)
+	openClose(t, o, "a")
+	openClose(t, o, "b")
+	openClose(t, o, "a") // hit; b is now least recently used
+	openClose(t, o, "c") // evicts b
+	if *closes["a"] != 0 || *closes["b"] != 1 || *closes["c"] != 0 {
+		t.Errorf("closes a=%d b=%d c=%d; want 0 1 0", *closes["a"], *closes["b"], *closes["c"])
+	}
+	checkStats(t, o, "evictions=1 hits=1 opens=3")
+
+	// In-use files aren't evicted, even over budget.
+	var held []readerutil.ReaderAtCloser
+	for _, path := range []string{"x", "y", "z"} {
+		rac, err := o.Open(path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		held = append(held, rac)
+	}
+	if *closes["a"] != 1 || *closes["c"] != 1 {
+		t.Errorf("idle files not evicted for held ones")
+	}
+	for _, rac := range held {
+		rac.Close()
+	}
+	if n := len(o.files); n != 2 {
+		t.Errorf("%d files open after releasing; want 2", n)
+	}
+	if err := o.CloseIdle(); err != nil {
+		t.Fatal(err)
+	}
+	if len(o.files) != 0 || *closes["x"]+*closes["y"]+*closes["z"] != 3 {
+		t.Errorf("CloseIdle left %d files open", len(o.files))
+	}
+}
+
+func TestOpenerIdleTimeout(t *testing.T) {
+	o := &Opener{IdleTimeout: 10 * time.Millisecond}
+	closes := fakeFS(o)
+	openClose(t, o, "a")
+	openClose(t, o, "a")
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		fakeMu.Lock()
+		n := *closes["a"]
+		fakeMu.Unlock()
+		if n > 0 {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatal("idle file not closed")
+		}
+		time.Sleep(time.Millisecond)
+	}
+	if len(o.files) != 0 {
+		t.Errorf("%d files open after idle timeout", len(o.files))
+	}
+	checkStats(t, o, "evictions=1 hits=1 opens=1")
+}
@@ -0,0 +1,111 @@
+/*
+Copyright 2026 The go4 Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+     http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package readerutil
+
+import (
+	"io"
+)
+
+// Slice returns the n bytes of ra starting at off, like
+// io.NewSectionReader. The slice is truncated to the end of ra.
+//
+// Slices of slices, of concatenations and of Zeros are simplified: a
+// slice of a concatenation is the concatenation of the slices of the
+// parts it covers.
+func Slice(ra SizeReaderAt, off, n int64) SizeReaderAt {
+	if off < 0 || n < 0 {
+		panic("readerutil: negative Slice offset or length")
+	}
+	size := ra.Size()
+	if off > size {
+		off = size
+	}
+	if n > size-off {
+		n = size - off
+	}
+	if off == 0 && n == size {
+		return ra
+	}
+	switch ra := ra.(type) {
+	case *sliceRA:
+		return &sliceRA{ra: ra.ra, off: ra.off + off, size: n}
+	case zeroRA:
+		return zeroRA(n)
+	case *multiRA:
+		m := &multiRA{}
+		ra.forRange(off, n, func(part SizeReaderAt, off, n int64) error {
+			m.add(Slice(part, off, n))
+			return nil
+		})
+		return m
+	}
+	return &sliceRA{ra: ra, off: off, size: n}
+}
+
+type sliceRA struct {
+	ra   SizeReaderAt
+	off  int64
+	size int64
+}
+
+func (s *sliceRA) Size() int64 { return s.size }
+
+func (s *sliceRA) ReadAt(p []byte, off int64) (int, error) {
+	if done, err := readAtBounds(p, off, s.size); done {
+		return 0, err
+	}
+	short := false
+	if rem := s.size - off; int64(len(p)) > rem {
+		p = p[:rem]
+		short = true
+	}
+	n, err := s.ra.ReadAt(p, s.off+off)
+	if n == len(p) {
+		err = nil
+		if short {
+			err = io.EOF
+		}
+	}
+	return n, err
+}
+
+// Zeros returns a SizeReaderAt of n zero bytes.
+func Zeros(n int64) SizeReaderAt {
+	if n < 0 {
+		panic("readerutil: negative Zeros length")
+	}
+	return zeroRA(n)
+}
+
+type zeroRA int64
+
+func (z zeroRA) Size() int64 { return int64(z) }
+
+func (z zeroRA) ReadAt(p []byte, off int64) (int, error) {
+	if done, err := readAtBounds(p, off, int64(z)); done {
+		return 0, err
+	}
+	var err error
+	if rem := int64(z) - off; int64(len(p)) > rem {
+		p = p[:rem]
+		err = io.EOF
+	}
+	for i := range p {
+		p[i] = 0
+	}
+	return len(p), err
+}
@@ -0,0 +1,160 @@
+/*
+Copyright 2026 The go4 Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+     http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package readerutil
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"math/rand"
+	"strings"
+	"testing"
+)
+
+// randomRA returns a random composition of Slice, Concat and Zeros,
+// along with its expected contents.
+func randomRA(rnd *rand.Rand, depth int) (SizeReaderAt, []byte) {
+	switch k := rnd.Intn(4); {
+	case depth == 0 || k == 0:
+		b := make([]byte, rnd.Intn(20))
+		rnd.Read(b)
+		return bytes.NewReader(b), b
+	case k == 1:
+		n := rnd.Intn(20)
+		return Zeros(int64(n)), make([]byte, n)
+	case k == 2:
+		ra, want := randomRA(rnd, depth-1)
+		off := rnd.Intn(len(want) + 2)
+		n := rnd.Intn(len(want) + 2)
+		end := off + n
+		if off > len(want) {
+			off = len(want)
+		}
+		if end > len(want) {
+			end = len(want)
+		}
+		return Slice(ra, int64(off), int64(n)), want[off:end]
+	}
+	var parts []SizeReaderAt
+	var want []byte
+	for i := rnd.Intn(5); i >= 0; i-- {
+		ra, b := randomRA(rnd, depth-1)
+		parts = append(parts, ra)
+		want = append(want, b...)
+	}
+	return Concat(parts...), want
+}
+
+func TestSliceConcatZeros(t *testing.T) {
+	rnd := rand.New(rand.NewSource(1))
+	for iter := 0; iter < 200; iter++ {
+		ra, want := randomRA(rnd, 4)
+		if ra.Size() != int64(len(want)) {
+			t.Fatalf("%d: Size = %d; want %d", iter, ra.Size(), len(want))
+		}
+		for off := 0; off <= len(want); off++ {
+			for n := 0; off+n <= len(want)+1; n++ {
+				buf := make([]byte, n)
+				got, err := ra.ReadAt(buf, int64(off))
+				wantN := n
+				if off+n > len(want) {
+					wantN = len(want) - off
+				}
+				if got != wantN || !bytes.Equal(buf[:got], want[off:off+wantN]) {
+					t.Fatalf("%d: ReadAt(%d bytes at %d) = %d, %q; want %d, %q", iter, n, off, got, buf[:got], wantN, want[off:off+wantN])
+				}
+				// Empty reads at the end may return EOF, as
+				// those of bytes.Reader do.
+				if n > 0 && (wantN < n) != (err == io.EOF) || err != nil && err != io.EOF {
+					t.Fatalf("%d: ReadAt(%d bytes at %d) error = %v", iter, n, off, err)
+				}
+			}
+		}
+
+		rs := NewReadSeeker(ra)
+		if _, err := rs.Seek(int64(len(want)/2), io.SeekStart); err != nil {
+			t.Fatal(err)
+		}
+		var buf bytes.Buffer
+		if n, err := rs.(io.WriterTo).WriteTo(&buf); n != int64(len(want)-len(want)/2) || err != nil {
+			t.Fatalf("%d: WriteTo = %d, %v", iter, n, err)
+		}
+		if !bytes.Equal(buf.Bytes(), want[len(want)/2:]) {
+			t.Fatalf("%d: WriteTo wrote %q; want %q", iter, buf.Bytes(), want[len(want)/2:])
+		}
+	}
+}
+
+func TestSliceSimplifies(t *testing.T) {
+	r := strings.NewReader("0123456789")
+	s := Slice(Slice(r, 2, 6), 1, 3)
+	if sr, ok := s.(*sliceRA); !ok || sr.ra != SizeReaderAt(r) || sr.off != 3 {
+		t.Errorf("slice of slice = %#v", s)
+	}
+	if _, ok := Slice(Zeros(10), 2, 3).(zeroRA); !ok {
+		t.Error("slice of Zeros isn't Zeros")
+	}
+	c := Concat(Concat(r, Zeros(5)), Concat(r, r))
+	if got := len(c.(*multiRA).parts); got != 4 {
+		t.Errorf("nested Concat has %d parts; want 4", got)
+	}
+	if got := len(Slice(c, 12, 10).(*multiRA).parts); got != 2 {
+		t.Errorf("slice of Concat has %d parts; want 2", got)
+	}
+}
+
+func TestConcatManyParts(t *testing.T) {
+	const n = 10000
+	parts := make([]SizeReaderAt, n)
+	var want strings.Builder
+	for i := range parts {
+		s := fmt.Sprint(i)
+		parts[i] = strings.NewReader(s)
+		want.WriteString(s)
+	}
+	c := Concat(parts...)
+	got, err := ioutil.ReadAll(NewReadSeeker(c))
+	if err != nil || string(got) != want.String() {
+		t.Fatalf("ReadAll = %d bytes, %v", len(got), err)
+	}
+	buf := make([]byte, 7)
+	if _, err := c.ReadAt(buf, 30000); err != nil || string(buf) != want.String()[30000:30007] {
+		t.Errorf("ReadAt = %q, %v", buf, err)
+	}
+}
+
+func TestReadSeeker(t *testing.T) {
+	rs := NewReadSeeker(Concat(strings.NewReader("hello, "), Zeros(2), strings.NewReader("world")))
+	if pos, err := rs.Seek(-5, io.SeekEnd); pos != 9 || err != nil {
+		t.Fatalf("Seek = %d, %v", pos, err)
+	}
+	got, err := ioutil.ReadAll(rs)
+	if err != nil || string(got) != "world" {
+		t.Fatalf("ReadAll = %q, %v", got, err)
+	}
+	if pos, err := rs.Seek(-9, io.SeekCurrent); pos != 5 || err != nil {
+		t.Fatalf("Seek = %d, %v", pos, err)
+	}
+	got = make([]byte, 4)
+	if _, err := io.ReadFull(rs, got); err != nil || string(got) != ", \x00\x00" {
+		t.Fatalf("Read = %q, %v", got, err)
+	}
+	if _, err := rs.Seek(-20, io.SeekCurrent); err == nil {
+		t.Error("Seek to a negative position succeeded")
+	}
+}
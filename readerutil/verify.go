@@ -0,0 +1,146 @@
+/*
+Copyright 2026 The go4 Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+     http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package readerutil
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"hash"
+	"io"
+)
+
+// ErrChecksumMismatch is returned, possibly wrapped, by verifying
+// readers when the data read doesn't match its expected digest.
+var ErrChecksumMismatch = errors.New("readerutil: checksum mismatch")
+
+// NewVerifyingReader returns an io.Reader reading from r and writing
+// the data read to h. When r is at EOF, the reader compares the sum of
+// h with want and returns ErrChecksumMismatch instead of io.EOF if
+// they differ.
+//
+// The data read before the mismatch is detected is returned as usual,
+// so callers must not act on it until they get io.EOF.
+func NewVerifyingReader(r io.Reader, h hash.Hash, want []byte) io.Reader {
+	return &verifyingReader{r: r, h: h, want: want}
+}
+
+type verifyingReader struct {
+	r    io.Reader
+	h    hash.Hash
+	want []byte
+	err  error // sticky io.EOF or ErrChecksumMismatch
+}
+
+func (vr *verifyingReader) Read(p []byte) (int, error) {
+	if vr.err != nil {
+		return 0, vr.err
+	}
+	n, err := vr.r.Read(p)
+	vr.h.Write(p[:n])
+	if err == io.EOF {
+		if bytes.Equal(vr.h.Sum(nil), vr.want) {
+			vr.err = io.EOF
+		} else {
+			vr.err = ErrChecksumMismatch
+		}
+		err = vr.err
+	}
+	return n, err
+}
+
+// BlockManifest holds the digests of consecutive fixed-size blocks of
+// data.
+type BlockManifest struct {
+	// BlockSize is the size of every block but the last, which may
+	// be shorter.
+	BlockSize int64
+
+	// Digests are the digests of the blocks, in order.
+	Digests [][]byte
+
+	// NewHash returns the hash computing the digests.
+	NewHash func() hash.Hash
+}
+
+// NewVerifyingReaderAt returns a SizeReaderAt reading from ra and
+// verifying the digest of every block it reads against m. Reads fail
+// with an error wrapping ErrChecksumMismatch if they cover a block
+// that doesn't match.
+//
+// The blocks covered by each read are read and hashed in full. Wrap
+// the returned SizeReaderAt with NewCachingReaderAt, with the same
+// block size, to avoid doing it repeatedly.
+func NewVerifyingReaderAt(ra SizeReaderAt, m BlockManifest) (SizeReaderAt, error) {
+	if m.BlockSize <= 0 || m.NewHash == nil {
+		return nil, errors.New("readerutil: invalid block manifest")
+	}
+	size := ra.Size()
+	if want := (size + m.BlockSize - 1) / m.BlockSize; int64(len(m.Digests)) != want {
+		return nil, fmt.Errorf("readerutil: block manifest has %d digests for %d blocks", len(m.Digests), want)
+	}
+	return &verifyingReaderAt{ra: ra, size: size, m: m}, nil
+}
+
+type verifyingReaderAt struct {
+	ra   SizeReaderAt
+	size int64
+	m    BlockManifest
+}
+
+func (vr *verifyingReaderAt) Size() int64 { return vr.size }
+
+func (vr *verifyingReaderAt) ReadAt(p []byte, off int64) (n int, err error) {
+	if done, err := readAtBounds(p, off, vr.size); done {
+		return 0, err
+	}
+	end := off + int64(len(p))
+	if end > vr.size {
+		end = vr.size
+	}
+	bs := vr.m.BlockSize
+	h := vr.m.NewHash()
+	var buf []byte
+	for idx := off / bs; idx*bs < end; idx++ {
+		start := idx * bs
+		blockSize := bs
+		if start+blockSize > vr.size {
+			blockSize = vr.size - start
+		}
+		if int64(cap(buf)) < blockSize {
+			buf = make([]byte, blockSize)
+		}
+		block := buf[:blockSize]
+		if rn, err := vr.ra.ReadAt(block, start); rn < len(block) {
+			if err == nil || err == io.EOF {
+				err = io.ErrUnexpectedEOF
+			}
+			return n, err
+		}
+		h.Reset()
+		h.Write(block)
+		if !bytes.Equal(h.Sum(nil), vr.m.Digests[idx]) {
+			return n, fmt.Errorf("readerutil: block %d: %w", idx, ErrChecksumMismatch)
+		}
+		from := off + int64(n) - start
+		n += copy(p[n:end-off], block[from:])
+	}
+	if n < len(p) {
+		return n, io.EOF
+	}
+	return n, nil
+}
@@ -0,0 +1,116 @@
+/*
+Copyright 2026 The go4 Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+     http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package readerutil
+
+import (
+	"bytes"
+	"crypto/sha1"
+	"errors"
+	"hash"
+	"io"
+	"io/ioutil"
+	"strings"
+	"testing"
+	"testing/iotest"
+)
+
+func sha1Sum(b []byte) []byte {
+	s := sha1.Sum(b)
+	return s[:]
+}
+
+func TestVerifyingReader(t *testing.T) {
+	const data = "hello, world"
+	got, err := ioutil.ReadAll(NewVerifyingReader(iotest.HalfReader(strings.NewReader(data)), sha1.New(), sha1Sum([]byte(data))))
+	if err != nil || string(got) != data {
+		t.Errorf("ReadAll = %q, %v", got, err)
+	}
+
+	r := NewVerifyingReader(strings.NewReader(data), sha1.New(), sha1Sum([]byte("hello, World")))
+	if _, err := ioutil.ReadAll(r); err != ErrChecksumMismatch {
+		t.Errorf("ReadAll error = %v; want ErrChecksumMismatch", err)
+	}
+	if _, err := r.Read(make([]byte, 1)); err != ErrChecksumMismatch {
+		t.Errorf("Read after mismatch error = %v; want ErrChecksumMismatch", err)
+	}
+
+	// Data returned with io.EOF is hashed too.
+	r = NewVerifyingReader(iotest.DataErrReader(strings.NewReader(data)), sha1.New(), sha1Sum([]byte(data)))
+	if got, err := ioutil.ReadAll(r); err != nil || string(got) != data {
+		t.Errorf("ReadAll with DataErrReader = %q, %v", got, err)
+	}
+}
+
+func blockManifest(data []byte, blockSize int) BlockManifest {
+	m := BlockManifest{BlockSize: int64(blockSize), NewHash: func() hash.Hash { return sha1.New() }}
+	for len(data) > 0 {
+		n := blockSize
+		if n > len(data) {
+			n = len(data)
+		}
+		m.Digests = append(m.Digests, sha1Sum(data[:n]))
+		data = data[n:]
+	}
+	return m
+}
+
+func TestVerifyingReaderAt(t *testing.T) {
+	data := testData(1050)
+	m := blockManifest(data, 100)
+	ra, err := NewVerifyingReaderAt(bytes.NewReader(data), m)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if ra.Size() != 1050 {
+		t.Errorf("Size = %d", ra.Size())
+	}
+	for _, tt := range []struct{ off, n int64 }{{0, 10}, {95, 10}, {0, 1050}, {1049, 1}, {250, 500}} {
+		buf := make([]byte, tt.n)
+		if n, err := ra.ReadAt(buf, tt.off); n != len(buf) || err != nil {
+			t.Fatalf("ReadAt(%d bytes at %d) = %d, %v", tt.n, tt.off, n, err)
+		}
+		if !bytes.Equal(buf, data[tt.off:tt.off+tt.n]) {
+			t.Fatalf("ReadAt(%d bytes at %d) read wrong data", tt.n, tt.off)
+		}
+	}
+	buf := make([]byte, 100)
+	if n, err := ra.ReadAt(buf, 1000); n != 50 || err != io.EOF {
+		t.Errorf("ReadAt past EOF = %d, %v; want 50, EOF", n, err)
+	}
+
+	// Corrupt block 5.
+	bad := append([]byte(nil), data...)
+	bad[555] ^= 1
+	ra, err = NewVerifyingReaderAt(bytes.NewReader(bad), m)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := ra.ReadAt(buf[:10], 420); err != nil {
+		t.Errorf("ReadAt of a good block: %v", err)
+	}
+	n, err := ra.ReadAt(buf, 450)
+	if !errors.Is(err, ErrChecksumMismatch) {
+		t.Errorf("ReadAt of a bad block error = %v; want ErrChecksumMismatch", err)
+	}
+	if n != 50 {
+		t.Errorf("ReadAt of a bad block read %d bytes; want the 50 of the good block", n)
+	}
+
+	if _, err := NewVerifyingReaderAt(bytes.NewReader(data[:1000]), m); err == nil {
+		t.Error("NewVerifyingReaderAt accepted a manifest with too many blocks")
+	}
+}
@@ -56,6 +56,7 @@ func OpenFile(name string, flag int, perm os.FileMode) (FileWriter, error) {
 	return fs(name).OpenFile(name, flag, perm)
 }
 func Remove(name string) error { return fs(name).Remove(name) }
+
 func Create(name string) (FileWriter, error) {
 	// like os.Create but WRONLY instead of RDWR because we don't
 	// expose a Reader here.
@@ -63,12 +64,19 @@ func Create(name string) (FileWriter, error) {
 }
 
 func fs(name string) FileSystem {
+	_, fs := fsPrefix(name)
+	return fs
+}
+
+// fsPrefix returns the filesystem of name and the prefix it's
+// registered with, which is empty for the OS filesystem.
+func fsPrefix(name string) (string, FileSystem) {
 	for pfx, fs := range wkFS {
 		if strings.HasPrefix(name, pfx) {
-			return fs
+			return pfx, fs
 		}
 	}
-	return osFS{}
+	return "", osFS{}
 }
 
 type osFS struct{}
@@ -81,6 +89,9 @@ func (osFS) OpenFile(name string, flag int, perm os.FileMode) (FileWriter, error
 	return os.OpenFile(name, flag, perm)
 }
 func (osFS) Remove(name string) error { return os.Remove(name) }
+func (osFS) Rename(oldpath, newpath string) error {
+	return os.Rename(oldpath, newpath)
+}
 
 type FileSystem interface {
 	Open(name string) (File, error)
@@ -91,6 +102,11 @@ type FileSystem interface {
 	Remove(name string) error
 }
 
+// Renamer is implemented by a FileSystem that can rename files.
+type Renamer interface {
+	Rename(oldpath, newpath string) error
+}
+
 // well-known filesystems
 var wkFS = map[string]FileSystem{}
 
@@ -133,3 +149,40 @@ func ReadFile(filename string) ([]byte, error) {
 	defer f.Close()
 	return ioutil.ReadAll(f)
 }
+
+// Rename renames oldpath to newpath, replacing newpath if it exists.
+// If both paths are on the same filesystem and it implements Renamer,
+// its Rename method is used. Otherwise oldpath is copied to newpath
+// and then removed, which is not atomic.
+func Rename(oldpath, newpath string) error {
+	opfx, ofs := fsPrefix(oldpath)
+	npfx, _ := fsPrefix(newpath)
+	if r, ok := ofs.(Renamer); ok && opfx == npfx {
+		return r.Rename(oldpath, newpath)
+	}
+	if err := copyFile(newpath, oldpath); err != nil {
+		return err
+	}
+	return Remove(oldpath)
+}
+
+func copyFile(dst, src string) error {
+	r, err := Open(src)
+	if err != nil {
+		return err
+	}
+	defer r.Close()
+	fi, err := r.Stat()
+	if err != nil {
+		return err
+	}
+	w, err := OpenFile(dst, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, fi.Mode().Perm())
+	if err != nil {
+		return err
+	}
+	_, err = io.Copy(w, r)
+	if err1 := w.Close(); err == nil {
+		err = err1
+	}
+	return err
+}
@@ -0,0 +1,369 @@
+/*
+Copyright 2026 The go4 Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+     http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package writerutil
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+	"sync"
+)
+
+// Policy says when a write to a FanOut succeeds.
+type Policy int
+
+const (
+	// FailFast writes to each destination in turn, failing the
+	// write at the first destination that fails, like
+	// io.MultiWriter.
+	FailFast Policy = iota
+
+	// BestEffort writes to every destination, succeeding if at
+	// least one destination succeeds.
+	BestEffort
+
+	// Quorum writes to every destination, succeeding if at least
+	// FanOut.Quorum destinations succeed.
+	Quorum
+)
+
+func (p Policy) String() string {
+	switch p {
+	case FailFast:
+		return "FailFast"
+	case BestEffort:
+		return "BestEffort"
+	case Quorum:
+		return "Quorum"
+	}
+	return fmt.Sprintf("Policy(%d)", int(p))
+}
+
+// ErrQueueFull is the error recorded for an asynchronous destination
+// whose queue was full when written to.
+var ErrQueueFull = errors.New("writerutil: destination queue full")
+
+// errRemoved is returned by writes to an asynchronous destination
+// removed during a Write, which then doesn't count as a destination.
+var errRemoved = errors.New("writerutil: destination removed")
+
+// FanOut is an io.Writer duplicating its writes to a set of
+// destinations, succeeding according to its Policy.
+//
+// A destination that fails is not written to again: its error is
+// returned by Destination.Err and counts as a failure in every later
+// write, until the destination is removed.
+//
+// Destinations may be added and removed concurrently with writes.
+// Writes are serialized.
+type FanOut struct {
+	Policy Policy
+
+	// Quorum is the number of destinations that must succeed for a
+	// write to succeed under the Quorum policy. If zero or negative,
+	// a majority of the destinations is needed.
+	Quorum int
+
+	wmu sync.Mutex // serializes Write
+
+	mu    sync.Mutex // guards dests
+	dests []*Destination
+}
+
+// A Destination is a writer added to a FanOut.
+type Destination struct {
+	// Name identifies the destination in errors.
+	Name string
+
+	// Required, if set, makes every write fail when this
+	// destination fails, regardless of the FanOut's Policy. It must
+	// be set before the destination is first written to.
+	Required bool
+
+	w     io.Writer
+	queue chan []byte   // nil if synchronous
+	done  chan struct{} // closed when the queue is drained
+
+	mu      sync.Mutex // guards following
+	err     error
+	removed bool // queue is closed
+}
+
+// NewFanOut returns a FanOut with the given policy and no destinations.
+func NewFanOut(policy Policy) *FanOut {
+	return &FanOut{Policy: policy}
+}
+
+// Add adds w as a destination of f. Writes to w are done in the
+// caller's goroutine.
+func (f *FanOut) Add(name string, w io.Writer) *Destination {
+	d := &Destination{Name: name, w: w}
+	f.add(d)
+	return d
+}
+
+// AddAsync adds w as a destination of f, written to from its own
+// goroutine. Each write to f is copied and queued for w, with at most
+// queue writes pending; writing to f while the queue is full fails the
+// destination with ErrQueueFull. An error from w is recorded when it
+// happens, and reported by the next write to f.
+func (f *FanOut) AddAsync(name string, w io.Writer, queue int) *Destination {
+	if queue < 1 {
+		queue = 1
+	}
+	d := &Destination{
+		Name:  name,
+		w:     w,
+		queue: make(chan []byte, queue),
+		done:  make(chan struct{}),
+	}
+	go d.run()
+	f.add(d)
+	return d
+}
+
+func (f *FanOut) add(d *Destination) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.dests = append(f.dests, d)
+}
+
+// Remove removes d from f. If d is asynchronous, Remove waits for its
+// queued writes to finish. Removing a destination that is not in f
+// does nothing.
+func (f *FanOut) Remove(d *Destination) {
+	f.mu.Lock()
+	found := false
+	for i, d2 := range f.dests {
+		if d2 == d {
+			f.dests = append(f.dests[:i:i], f.dests[i+1:]...)
+			found = true
+			break
+		}
+	}
+	f.mu.Unlock()
+	if found && d.queue != nil {
+		d.mu.Lock()
+		d.removed = true
+		close(d.queue)
+		d.mu.Unlock()
+		<-d.done
+	}
+}
+
+// Destinations returns the destinations of f.
+func (f *FanOut) Destinations() []*Destination {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return append([]*Destination(nil), f.dests...)
+}
+
+// Failed returns the destinations of f that have failed.
+func (f *FanOut) Failed() []*Destination {
+	var failed []*Destination
+	for _, d := range f.Destinations() {
+		if d.Err() != nil {
+			failed = append(failed, d)
+		}
+	}
+	return failed
+}
+
+// Close removes all destinations from f, waiting for the queues of
+// asynchronous destinations to drain. It returns a *FanOutError
+// listing the destinations that failed, if any. The destinations'
+// writers are not closed.
+func (f *FanOut) Close() error {
+	dests := f.Destinations()
+	for _, d := range dests {
+		f.Remove(d)
+	}
+	var failed []*DestinationError
+	for _, d := range dests {
+		if err := d.Err(); err != nil {
+			failed = append(failed, &DestinationError{d, err})
+		}
+	}
+	if failed != nil {
+		return &FanOutError{Total: len(dests), Failed: failed}
+	}
+	return nil
+}
+
+// Write writes p to the destinations of f. It returns len(p) and a
+// nil error if the write succeeded according to f's Policy, and zero
+// and a *FanOutError otherwise.
+//
+// A failed write may still have reached some destinations: those not
+// listed in the FanOutError received all of p. Under FailFast, they
+// are the destinations before the one that failed.
+//
+// Writing to a FanOut without destinations succeeds.
+func (f *FanOut) Write(p []byte) (n int, err error) {
+	f.wmu.Lock()
+	defer f.wmu.Unlock()
+	dests := f.Destinations()
+	total := 0
+	var failed []*DestinationError
+	requiredFailed := false
+	for _, d := range dests {
+		err := d.write(p)
+		if err == errRemoved {
+			continue
+		}
+		total++
+		if err != nil {
+			failed = append(failed, &DestinationError{d, err})
+			if d.Required {
+				requiredFailed = true
+			}
+			if f.Policy == FailFast {
+				break
+			}
+		}
+	}
+	if failed == nil {
+		return len(p), nil
+	}
+	ok := total - len(failed)
+	switch {
+	case requiredFailed, f.Policy == FailFast:
+	case f.Policy == BestEffort && ok >= 1,
+		f.Policy == Quorum && ok >= f.quorum(total):
+		return len(p), nil
+	}
+	return 0, &FanOutError{Total: total, Failed: failed}
+}
+
+func (f *FanOut) quorum(n int) int {
+	if f.Quorum > 0 {
+		return f.Quorum
+	}
+	return n/2 + 1
+}
+
+// Err returns the error that made d fail, or nil.
+func (d *Destination) Err() error {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	return d.err
+}
+
+func (d *Destination) setErr(err error) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if d.err == nil {
+		d.err = err
+	}
+}
+
+func (d *Destination) write(p []byte) error {
+	if d.queue != nil {
+		return d.enqueue(p)
+	}
+	if err := d.Err(); err != nil {
+		return err
+	}
+	n, err := d.w.Write(p)
+	if err == nil && n < len(p) {
+		err = io.ErrShortWrite
+	}
+	if err != nil {
+		d.setErr(err)
+	}
+	return err
+}
+
+func (d *Destination) enqueue(p []byte) error {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	switch {
+	case d.err != nil:
+		return d.err
+	case d.removed:
+		// Removed during a Write.
+		return errRemoved
+	}
+	select {
+	case d.queue <- append([]byte(nil), p...):
+		return nil
+	default:
+		d.err = ErrQueueFull
+		return d.err
+	}
+}
+
+// run writes the queue of an asynchronous destination until it's
+// closed, discarding writes once one has failed.
+func (d *Destination) run() {
+	defer close(d.done)
+	failed := false
+	for p := range d.queue {
+		if failed {
+			continue
+		}
+		n, err := d.w.Write(p)
+		if err == nil && n < len(p) {
+			err = io.ErrShortWrite
+		}
+		if err != nil {
+			d.setErr(err)
+			failed = true
+		}
+	}
+}
+
+// A DestinationError records the failure of a destination.
+type DestinationError struct {
+	Dest *Destination
+	Err  error
+}
+
+func (e *DestinationError) Error() string {
+	return fmt.Sprintf("writerutil: destination %q: %v", e.Dest.Name, e.Err)
+}
+
+func (e *DestinationError) Unwrap() error { return e.Err }
+
+// A FanOutError is returned by FanOut when a write fails. It lists
+// the destinations that failed.
+type FanOutError struct {
+	Total  int // number of destinations written to
+	Failed []*DestinationError
+}
+
+func (e *FanOutError) Error() string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "writerutil: %d of %d destinations failed", len(e.Failed), e.Total)
+	for _, de := range e.Failed {
+		fmt.Fprintf(&b, "; %q: %v", de.Dest.Name, de.Err)
+	}
+	return b.String()
+}
+
+// Tee returns a writer that writes to w and to each of copies. Writes
+// fail if w fails; copies that fail are dropped silently. It is
+// a FanOut with the BestEffort policy where w is Required.
+func Tee(w io.Writer, copies ...io.Writer) io.Writer {
+	f := NewFanOut(BestEffort)
+	f.Add("primary", w).Required = true
+	for i, c := range copies {
+		f.Add(fmt.Sprintf("copy %d", i), c)
+	}
+	return f
+}
@@ -0,0 +1,215 @@
+/*
+Copyright 2026 The go4 Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+     http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package writerutil
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"testing"
+)
+
+var errBoom = errors.New("boom")
+
+// failWriter fails every write after the first ok bytes.
+type failWriter struct {
+	ok  int
+	buf bytes.Buffer
+}
+
+func (w *failWriter) Write(p []byte) (int, error) {
+	if w.buf.Len()+len(p) > w.ok {
+		return 0, errBoom
+	}
+	return w.buf.Write(p)
+}
+
+func TestFanOutPolicies(t *testing.T) {
+	tests := []struct {
+		policy Policy
+		quorum int
+		ok     []int // bytes each destination accepts
+		wantOK bool
+		nWrote int // destinations written to
+	}{
+		{FailFast, 0, []int{10, 10}, true, 2},
+		{FailFast, 0, []int{0, 10}, false, 0},
+		{FailFast, 0, []int{10, 0, 10}, false, 1},
+		{BestEffort, 0, []int{0, 0, 10}, true, 1},
+		{BestEffort, 0, []int{0, 0}, false, 0},
+		{Quorum, 0, []int{10, 0, 10}, true, 2},
+		{Quorum, 0, []int{10, 0, 0}, false, 1},
+		{Quorum, 1, []int{10, 0, 0}, true, 1},
+		{Quorum, 0, []int{10, 10, 0, 0}, false, 2},
+	}
+	for i, tt := range tests {
+		f := NewFanOut(tt.policy)
+		f.Quorum = tt.quorum
+		var ws []*failWriter
+		for _, ok := range tt.ok {
+			w := &failWriter{ok: ok}
+			ws = append(ws, w)
+			f.Add("", w)
+		}
+		n, err := f.Write([]byte("hello"))
+		if (err == nil) != tt.wantOK || (err == nil) != (n == 5) {
+			t.Errorf("%d. %v: Write = %d, %v", i, tt.policy, n, err)
+		}
+		var fe *FanOutError
+		if err != nil && !errors.As(err, &fe) {
+			t.Errorf("%d. error %T is not a *FanOutError", i, err)
+		}
+		wrote := 0
+		for _, w := range ws {
+			if w.buf.String() == "hello" {
+				wrote++
+			}
+		}
+		if wrote != tt.nWrote {
+			t.Errorf("%d. %v: wrote to %d destinations; want %d", i, tt.policy, wrote, tt.nWrote)
+		}
+	}
+}
+
+func TestFanOutFailedDestination(t *testing.T) {
+	f := NewFanOut(BestEffort)
+	good := new(bytes.Buffer)
+	bad := &failWriter{ok: 3}
+	f.Add("good", good)
+	db := f.Add("bad", bad)
+	for _, s := range []string{"abc", "def", "ghi"} {
+		if _, err := f.Write([]byte(s)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if got := f.Failed(); len(got) != 1 || got[0] != db || db.Err() != errBoom {
+		t.Fatalf("Failed = %v; want bad destination", got)
+	}
+	// A failed destination isn't written to again, even if it
+	// would accept the write.
+	bad.ok = 100
+	f.Write([]byte("jkl"))
+	if bad.buf.String() != "abc" {
+		t.Errorf("failed destination got %q", bad.buf.String())
+	}
+	f.Remove(db)
+	if len(f.Destinations()) != 1 || f.Failed() != nil {
+		t.Errorf("destination not removed")
+	}
+	if err := f.Close(); err != nil {
+		t.Errorf("Close = %v", err)
+	}
+	if good.String() != "abcdefghijkl" {
+		t.Errorf("good destination got %q", good.String())
+	}
+}
+
+// gateWriter blocks writes until its gate is closed.
+type gateWriter struct {
+	gate chan struct{}
+	buf  bytes.Buffer
+}
+
+func (w *gateWriter) Write(p []byte) (int, error) {
+	<-w.gate
+	return w.buf.Write(p)
+}
+
+func TestFanOutAsync(t *testing.T) {
+	f := NewFanOut(BestEffort)
+	syncBuf := new(bytes.Buffer)
+	slow := &gateWriter{gate: make(chan struct{})}
+	f.Add("sync", syncBuf)
+	d := f.AddAsync("slow", slow, 2)
+
+	// The slow destination's goroutine takes the first write and
+	// blocks, then two more fit in the queue; eventually one
+	// overflows it.
+	for i := 0; d.Err() == nil; i++ {
+		if i == 10 {
+			t.Fatal("queue never filled")
+		}
+		if _, err := f.Write([]byte{'a' + byte(i)}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if d.Err() != ErrQueueFull {
+		t.Fatalf("Err = %v; want ErrQueueFull", d.Err())
+	}
+	close(slow.gate)
+	err := f.Close()
+	var fe *FanOutError
+	if !errors.As(err, &fe) || len(fe.Failed) != 1 || fe.Failed[0].Dest != d || !errors.Is(fe.Failed[0], ErrQueueFull) {
+		t.Errorf("Close = %v", err)
+	}
+	if n := slow.buf.Len(); n < 2 || n > 3 || !bytes.HasPrefix(syncBuf.Bytes(), slow.buf.Bytes()) {
+		t.Errorf("slow destination got %q; sync got %q", slow.buf.Bytes(), syncBuf.Bytes())
+	}
+}
+
+func TestFanOutAsyncError(t *testing.T) {
+	f := NewFanOut(FailFast)
+	d := f.AddAsync("bad", &failWriter{ok: 0}, 10)
+	if _, err := f.Write([]byte("x")); err != nil {
+		t.Fatalf("queued write failed: %v", err)
+	}
+	f.Remove(d)
+	if d.Err() != errBoom {
+		t.Errorf("Err = %v; want %v", d.Err(), errBoom)
+	}
+}
+
+func TestFanOutRemovedDuringWrite(t *testing.T) {
+	f := NewFanOut(Quorum)
+	f.Add("good", new(bytes.Buffer))
+	f.Add("bad", &failWriter{})
+	d := f.AddAsync("removed", new(bytes.Buffer), 1)
+	// Remove d as if Remove ran after Write listed the destinations.
+	d.mu.Lock()
+	d.removed = true
+	close(d.queue)
+	d.mu.Unlock()
+	<-d.done
+
+	// The removed destination is neither a success nor a failure,
+	// leaving one success of two destinations: no majority.
+	_, err := f.Write([]byte("abc"))
+	fe, ok := err.(*FanOutError)
+	if !ok {
+		t.Fatalf("Write error = %v; want a *FanOutError", err)
+	}
+	if fe.Total != 2 || len(fe.Failed) != 1 || fe.Failed[0].Err != errBoom {
+		t.Errorf("Write error = %v; want 1 of 2 destinations failed with errBoom", err)
+	}
+}
+
+func TestTee(t *testing.T) {
+	var primary, copy1 bytes.Buffer
+	bad := &failWriter{ok: 0}
+	w := Tee(&primary, bad, &copy1)
+	if _, err := io.WriteString(w, "hello"); err != nil {
+		t.Fatal(err)
+	}
+	if primary.String() != "hello" || copy1.String() != "hello" {
+		t.Errorf("got %q, %q", primary.String(), copy1.String())
+	}
+	w = Tee(&failWriter{ok: 0}, &copy1)
+	var fe *FanOutError
+	if _, err := io.WriteString(w, "x"); !errors.As(err, &fe) || !errors.Is(fe.Failed[0], errBoom) {
+		t.Errorf("write with failed primary = %v", err)
+	}
+}
@@ -0,0 +1,347 @@
+/*
+Copyright 2026 The go4 Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+     http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package writerutil
+
+import (
+	"compress/gzip"
+	"errors"
+	"io"
+	"os"
+	"os/signal"
+	"strconv"
+	"sync"
+	"time"
+
+	"go4.org/wkfs"
+)
+
+var errRotatingFileClosed = errors.New("writerutil: write to closed RotatingFile")
+
+// RotatingFile is an io.WriteCloser appending to the file at Path,
+// which it rotates when it grows too large or too old. Rotated files
+// are named Path.1 (the most recent), Path.2, and so on, with a ".gz"
+// suffix if compressed. Paths are opened with go4.org/wkfs.
+//
+// On file systems that can't append to files, such as Google Cloud
+// Storage, an existing file at Path is rotated when opened, or
+// replaced if Keep is zero, so that every open starts a new file.
+//
+// The file is opened on the first write. The fields must not be
+// changed after that. Methods are safe for concurrent use.
+type RotatingFile struct {
+	Path string
+
+	// MaxSize, if positive, is the size in bytes after which the
+	// file is rotated. A file is rotated before a write that would
+	// make it exceed MaxSize, unless it is empty, so a single large
+	// write is never split.
+	MaxSize int64
+
+	// MaxAge, if positive, is how long the file is written to
+	// before it's rotated, counted from when it was opened.
+	MaxAge time.Duration
+
+	// Keep is the number of rotated files to keep. If zero, the
+	// file is truncated when rotated.
+	Keep int
+
+	// Compress is whether rotated files are gzip-compressed. The
+	// compression is done in the background.
+	Compress bool
+
+	// Perm is the permission used to create files. If zero, 0644
+	// is used.
+	Perm os.FileMode
+
+	mu          sync.Mutex // guards following
+	f           wkfs.FileWriter
+	size        int64
+	opened      time.Time
+	closed      bool
+	now         func() time.Time // or nil for time.Now
+	compressWG  sync.WaitGroup
+	compressMu  sync.Mutex // guards compressErr
+	compressErr error
+}
+
+func (rf *RotatingFile) Write(p []byte) (n int, err error) {
+	rf.mu.Lock()
+	defer rf.mu.Unlock()
+	if rf.closed {
+		return 0, errRotatingFileClosed
+	}
+	if rf.f == nil {
+		if err := rf.open(0); err != nil {
+			return 0, err
+		}
+	}
+	if rf.due(len(p)) {
+		if err := rf.rotate(); err != nil {
+			return 0, err
+		}
+	}
+	n, err = rf.f.Write(p)
+	rf.size += int64(n)
+	return n, err
+}
+
+// due reports whether the file should be rotated before writing n
+// more bytes.
+func (rf *RotatingFile) due(n int) bool {
+	if rf.MaxSize > 0 && rf.size > 0 && rf.size+int64(n) > rf.MaxSize {
+		return true
+	}
+	return rf.MaxAge > 0 && rf.clock().Sub(rf.opened) >= rf.MaxAge
+}
+
+func (rf *RotatingFile) clock() time.Time {
+	if rf.now != nil {
+		return rf.now()
+	}
+	return time.Now()
+}
+
+// open opens rf.Path for appending, with the additional flags.
+func (rf *RotatingFile) open(flag int) error {
+	perm := rf.Perm
+	if perm == 0 {
+		perm = 0644
+	}
+	f, err := wkfs.OpenFile(rf.Path, os.O_WRONLY|os.O_CREATE|os.O_APPEND|flag, perm)
+	if err != nil {
+		if os.IsPermission(err) {
+			return err
+		}
+		// The file system may not support appending.
+		return rf.create(perm, err)
+	}
+	fi, err := wkfs.Stat(rf.Path)
+	if err != nil {
+		f.Close()
+		return err
+	}
+	rf.f, rf.size, rf.opened = f, fi.Size(), rf.clock()
+	return nil
+}
+
+// create opens rf.Path as a new empty file, after moving an existing
+// one away if rotated files are kept. It returns appendErr, the error
+// from opening Path for appending, if Path can't be created either.
+func (rf *RotatingFile) create(perm os.FileMode, appendErr error) error {
+	fi, err := wkfs.Stat(rf.Path)
+	switch {
+	case err != nil && !os.IsNotExist(err):
+		return appendErr
+	case err == nil && fi.IsDir():
+		return appendErr
+	case err == nil && rf.Keep > 0 && fi.Size() > 0:
+		if err := rf.moveAway(); err != nil {
+			return err
+		}
+	}
+	f, err := wkfs.OpenFile(rf.Path, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, perm)
+	if err != nil {
+		return appendErr
+	}
+	rf.f, rf.size, rf.opened = f, 0, rf.clock()
+	return nil
+}
+
+// Rotate rotates the file now, unless it hasn't been opened yet.
+func (rf *RotatingFile) Rotate() error {
+	rf.mu.Lock()
+	defer rf.mu.Unlock()
+	if rf.closed {
+		return errRotatingFileClosed
+	}
+	if rf.f == nil {
+		return nil
+	}
+	return rf.rotate()
+}
+
+func (rf *RotatingFile) rotate() error {
+	err := rf.f.Close()
+	rf.f = nil
+	if err != nil {
+		return err
+	}
+	if rf.Keep <= 0 {
+		return rf.open(os.O_TRUNC)
+	}
+	if err := rf.moveAway(); err != nil {
+		return err
+	}
+	return rf.open(0)
+}
+
+// moveAway renames rf.Path to Path.1, shifting the older generations
+// and compressing the new one in the background if configured.
+func (rf *RotatingFile) moveAway() error {
+	// Finish compressing the previous generation before moving it.
+	rf.compressWG.Wait()
+	if err := rf.shift(); err != nil {
+		return err
+	}
+	gen1 := rf.generation(1)
+	if err := wkfs.Rename(rf.Path, gen1); err != nil {
+		return err
+	}
+	if rf.Compress {
+		rf.compressWG.Add(1)
+		go func() {
+			defer rf.compressWG.Done()
+			if err := compressFile(gen1); err != nil {
+				rf.compressMu.Lock()
+				if rf.compressErr == nil {
+					rf.compressErr = err
+				}
+				rf.compressMu.Unlock()
+			}
+		}()
+	}
+	return nil
+}
+
+func (rf *RotatingFile) generation(n int) string {
+	return rf.Path + "." + strconv.Itoa(n)
+}
+
+// shift removes the oldest rotated file and renames the others to
+// make room for a new Path.1.
+func (rf *RotatingFile) shift() error {
+	for _, suffix := range []string{"", ".gz"} {
+		name := rf.generation(rf.Keep) + suffix
+		if err := wkfs.Remove(name); err != nil && !os.IsNotExist(err) {
+			return err
+		}
+	}
+	for n := rf.Keep - 1; n >= 1; n-- {
+		for _, suffix := range []string{"", ".gz"} {
+			old := rf.generation(n) + suffix
+			if _, err := wkfs.Stat(old); os.IsNotExist(err) {
+				continue
+			}
+			if err := wkfs.Rename(old, rf.generation(n+1)+suffix); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// compressFile gzips name to name.gz and removes name.
+func compressFile(name string) error {
+	if err := gzipFile(name+".gz", name); err != nil {
+		wkfs.Remove(name + ".gz")
+		return err
+	}
+	return wkfs.Remove(name)
+}
+
+func gzipFile(dst, src string) error {
+	r, err := wkfs.Open(src)
+	if err != nil {
+		return err
+	}
+	defer r.Close()
+	fi, err := r.Stat()
+	if err != nil {
+		return err
+	}
+	w, err := wkfs.OpenFile(dst, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, fi.Mode().Perm())
+	if err != nil {
+		return err
+	}
+	zw := gzip.NewWriter(w)
+	_, err = io.Copy(zw, r)
+	if err1 := zw.Close(); err == nil {
+		err = err1
+	}
+	if err1 := w.Close(); err == nil {
+		err = err1
+	}
+	return err
+}
+
+// Reopen closes the file and opens Path again, for use after it was
+// moved away by another program such as logrotate.
+func (rf *RotatingFile) Reopen() error {
+	rf.mu.Lock()
+	defer rf.mu.Unlock()
+	if rf.closed {
+		return errRotatingFileClosed
+	}
+	if rf.f == nil {
+		return nil
+	}
+	err := rf.f.Close()
+	rf.f = nil
+	if err != nil {
+		return err
+	}
+	return rf.open(0)
+}
+
+// ReopenOnSignal calls Reopen whenever one of sigs, typically
+// syscall.SIGHUP, is received, until the returned stop function is
+// called. If Reopen fails, the next write tries to open Path again.
+func (rf *RotatingFile) ReopenOnSignal(sigs ...os.Signal) (stop func()) {
+	c := make(chan os.Signal, 1)
+	done := make(chan struct{})
+	signal.Notify(c, sigs...)
+	go func() {
+		for {
+			select {
+			case <-c:
+				rf.Reopen()
+			case <-done:
+				return
+			}
+		}
+	}()
+	var once sync.Once
+	return func() {
+		once.Do(func() {
+			signal.Stop(c)
+			close(done)
+		})
+	}
+}
+
+// Close closes the file and waits for any background compression to
+// finish, returning the first error from compression if there was one.
+func (rf *RotatingFile) Close() error {
+	rf.mu.Lock()
+	defer rf.mu.Unlock()
+	if rf.closed {
+		return nil
+	}
+	rf.closed = true
+	var err error
+	if rf.f != nil {
+		err = rf.f.Close()
+		rf.f = nil
+	}
+	rf.compressWG.Wait()
+	if err == nil {
+		rf.compressMu.Lock()
+		err = rf.compressErr
+		rf.compressMu.Unlock()
+	}
+	return err
+}
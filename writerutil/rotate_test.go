@@ -0,0 +1,298 @@
+/*
+Copyright 2026 The go4 Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+     http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package writerutil
+
+import (
+	"bytes"
+	"compress/gzip"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path"
+	"path/filepath"
+	"runtime"
+	"sync"
+	"syscall"
+	"testing"
+	"time"
+
+	"go4.org/wkfs"
+)
+
+func tempRotatingFile(t *testing.T) (rf *RotatingFile, cleanup func()) {
+	dir, err := ioutil.TempDir("", "rotate")
+	if err != nil {
+		t.Fatal(err)
+	}
+	return &RotatingFile{Path: filepath.Join(dir, "log")}, func() { os.RemoveAll(dir) }
+}
+
+func checkFile(t *testing.T, name, want string) {
+	t.Helper()
+	got, err := ioutil.ReadFile(name)
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	if string(got) != want {
+		t.Errorf("%s = %q; want %q", filepath.Base(name), got, want)
+	}
+}
+
+func checkNotExist(t *testing.T, name string) {
+	t.Helper()
+	if _, err := os.Stat(name); !os.IsNotExist(err) {
+		t.Errorf("%s exists", filepath.Base(name))
+	}
+}
+
+func TestRotatingFileSize(t *testing.T) {
+	rf, cleanup := tempRotatingFile(t)
+	defer cleanup()
+	rf.MaxSize = 4
+	rf.Keep = 2
+	for _, s := range []string{"ab", "cd", "ef", "ghijkl", "m"} {
+		if _, err := io.WriteString(rf, s); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := rf.Close(); err != nil {
+		t.Fatal(err)
+	}
+	checkFile(t, rf.Path, "m")
+	checkFile(t, rf.Path+".1", "ghijkl")
+	checkFile(t, rf.Path+".2", "ef")
+	checkNotExist(t, rf.Path+".3")
+	if _, err := io.WriteString(rf, "x"); err == nil {
+		t.Error("write after Close succeeded")
+	}
+}
+
+func TestRotatingFileAge(t *testing.T) {
+	rf, cleanup := tempRotatingFile(t)
+	defer cleanup()
+	now := time.Unix(1e9, 0)
+	rf.now = func() time.Time { return now }
+	rf.MaxAge = time.Hour
+	io.WriteString(rf, "a")
+	now = now.Add(59 * time.Minute)
+	io.WriteString(rf, "b")
+	now = now.Add(time.Minute)
+	io.WriteString(rf, "c")
+	rf.Close()
+	// Keep is zero, so the rotated file was discarded.
+	checkFile(t, rf.Path, "c")
+	checkNotExist(t, rf.Path+".1")
+}
+
+func TestRotatingFileCompress(t *testing.T) {
+	rf, cleanup := tempRotatingFile(t)
+	defer cleanup()
+	rf.Keep = 3
+	rf.Compress = true
+	for _, s := range []string{"one", "two", "three"} {
+		io.WriteString(rf, s)
+		if err := rf.Rotate(); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := rf.Close(); err != nil {
+		t.Fatal(err)
+	}
+	checkFile(t, rf.Path, "")
+	for i, want := range []string{"three", "two", "one"} {
+		name := rf.generation(i+1) + ".gz"
+		checkNotExist(t, rf.generation(i+1))
+		f, err := os.Open(name)
+		if err != nil {
+			t.Error(err)
+			continue
+		}
+		zr, err := gzip.NewReader(f)
+		if err != nil {
+			t.Fatal(err)
+		}
+		got, err := ioutil.ReadAll(zr)
+		f.Close()
+		if err != nil || string(got) != want {
+			t.Errorf("%s = %q, %v; want %q", filepath.Base(name), got, err, want)
+		}
+	}
+}
+
+func TestRotatingFileReopen(t *testing.T) {
+	if runtime.GOOS == "windows" || runtime.GOOS == "plan9" {
+		t.Skip("needs SIGHUP")
+	}
+	rf, cleanup := tempRotatingFile(t)
+	defer cleanup()
+	defer rf.Close()
+	stop := rf.ReopenOnSignal(syscall.SIGHUP)
+	defer stop()
+
+	io.WriteString(rf, "old")
+	if err := os.Rename(rf.Path, rf.Path+".moved"); err != nil {
+		t.Fatal(err)
+	}
+	p, err := os.FindProcess(os.Getpid())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := p.Signal(syscall.SIGHUP); err != nil {
+		t.Fatal(err)
+	}
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		if _, err := os.Stat(rf.Path); err == nil {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatal("file not reopened after SIGHUP")
+		}
+		time.Sleep(time.Millisecond)
+	}
+	io.WriteString(rf, "new")
+	checkFile(t, rf.Path+".moved", "old")
+	checkFile(t, rf.Path, "new")
+}
+
+// noAppendFS is an in-memory wkfs.FileSystem that, like Google Cloud
+// Storage, can only create or replace whole files.
+type noAppendFS struct {
+	mu    sync.Mutex
+	files map[string][]byte
+}
+
+func (fs *noAppendFS) get(name string) ([]byte, bool) {
+	fs.mu.Lock()
+	defer fs.mu.Unlock()
+	b, ok := fs.files[name]
+	return b, ok
+}
+
+func (fs *noAppendFS) Open(name string) (wkfs.File, error) {
+	b, ok := fs.get(name)
+	if !ok {
+		return nil, os.ErrNotExist
+	}
+	return &noAppendFile{Reader: bytes.NewReader(b), name: name}, nil
+}
+
+func (fs *noAppendFS) OpenFile(name string, flag int, perm os.FileMode) (wkfs.FileWriter, error) {
+	switch flag {
+	case os.O_WRONLY | os.O_CREATE | os.O_EXCL:
+		if _, ok := fs.get(name); ok {
+			return nil, os.ErrExist
+		}
+	case os.O_WRONLY | os.O_CREATE | os.O_TRUNC:
+	default:
+		return nil, fmt.Errorf("unsupported flag %d", flag)
+	}
+	return &noAppendWriter{fs: fs, name: name}, nil
+}
+
+func (fs *noAppendFS) Stat(name string) (os.FileInfo, error) {
+	b, ok := fs.get(name)
+	if !ok {
+		return nil, os.ErrNotExist
+	}
+	return noAppendInfo{name: path.Base(name), size: int64(len(b))}, nil
+}
+
+func (fs *noAppendFS) Lstat(name string) (os.FileInfo, error)       { return fs.Stat(name) }
+func (fs *noAppendFS) MkdirAll(path string, perm os.FileMode) error { return nil }
+
+func (fs *noAppendFS) Remove(name string) error {
+	fs.mu.Lock()
+	defer fs.mu.Unlock()
+	if _, ok := fs.files[name]; !ok {
+		return os.ErrNotExist
+	}
+	delete(fs.files, name)
+	return nil
+}
+
+type noAppendFile struct {
+	*bytes.Reader
+	name string
+}
+
+func (f *noAppendFile) Name() string { return f.name }
+func (f *noAppendFile) Close() error { return nil }
+func (f *noAppendFile) Stat() (os.FileInfo, error) {
+	return noAppendInfo{name: path.Base(f.name), size: f.Size()}, nil
+}
+
+// noAppendWriter stores its contents when closed.
+type noAppendWriter struct {
+	fs   *noAppendFS
+	name string
+	buf  bytes.Buffer
+}
+
+func (w *noAppendWriter) Write(p []byte) (int, error) { return w.buf.Write(p) }
+
+func (w *noAppendWriter) Close() error {
+	w.fs.mu.Lock()
+	defer w.fs.mu.Unlock()
+	w.fs.files[w.name] = w.buf.Bytes()
+	return nil
+}
+
+type noAppendInfo struct {
+	name string
+	size int64
+}
+
+func (fi noAppendInfo) Name() string       { return fi.name }
+func (fi noAppendInfo) Size() int64        { return fi.size }
+func (fi noAppendInfo) Mode() os.FileMode  { return 0644 }
+func (fi noAppendInfo) ModTime() time.Time { return time.Time{} }
+func (fi noAppendInfo) IsDir() bool        { return false }
+func (fi noAppendInfo) Sys() interface{}   { return nil }
+
+var testNoAppendFS = new(noAppendFS)
+
+func init() {
+	wkfs.RegisterFS("/rotatetest-noappend/", testNoAppendFS)
+}
+
+func TestRotatingFileNoAppend(t *testing.T) {
+	fs := testNoAppendFS
+	fs.mu.Lock()
+	fs.files = map[string][]byte{"/rotatetest-noappend/log": []byte("old")}
+	fs.mu.Unlock()
+	rf := &RotatingFile{Path: "/rotatetest-noappend/log", MaxSize: 10, Keep: 2}
+	for _, s := range []string{"hello", "0123456789"} {
+		if _, err := io.WriteString(rf, s); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := rf.Close(); err != nil {
+		t.Fatal(err)
+	}
+	for name, want := range map[string]string{
+		rf.Path:        "0123456789",
+		rf.Path + ".1": "hello",
+		rf.Path + ".2": "old",
+	} {
+		if got, _ := fs.get(name); string(got) != want {
+			t.Errorf("%s = %q; want %q", path.Base(name), got, want)
+		}
+	}
+}